@@ -0,0 +1,41 @@
+// Command fakebackend runs the fake Node.js student API for offline development.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"pdf-generator/internal/fakebackend"
+	"pdf-generator/internal/logging"
+)
+
+func main() {
+	addr := flag.String("addr", ":5007", "address to listen on")
+	email := flag.String("email", fakebackend.DefaultEmail, "login email accepted by the backend")
+	password := flag.String("password", fakebackend.DefaultPassword, "login password accepted by the backend")
+	tokenTTL := flag.Duration("token-ttl", fakebackend.DefaultAccessTokenTTL, "lifetime of issued access tokens")
+	flag.Parse()
+
+	slog.SetDefault(logging.NewFromEnv())
+
+	backend := fakebackend.New(fakebackend.Config{
+		Email:          *email,
+		Password:       *password,
+		AccessTokenTTL: *tokenTTL,
+	})
+
+	slog.Info("Fake Node.js backend starting", "addr", *addr, "base_path", fakebackend.BasePath, "token_ttl", tokenTTL.String())
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           backend,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("Fake backend stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -2,10 +2,13 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -13,11 +16,21 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"pdf-generator/internal/ctxtime"
+	"pdf-generator/internal/envconfig"
+	"pdf-generator/internal/metrics"
 )
 
 const (
 	DefaultNodeAPIURL = "http://localhost:5007/api/v1"
 	DefaultTimeout    = 10 * time.Second
+
+	// DefaultAuthTimeout bounds a single login or token refresh
+	DefaultAuthTimeout = 5 * time.Second
+
+	// tokenRefreshSkew is how long before the access token expires that it is proactively refreshed
+	tokenRefreshSkew = 30 * time.Second
 )
 
 type LoginRequest struct {
@@ -37,11 +50,18 @@ type LoginResponse struct {
 type APIClient struct {
 	httpClient    *http.Client
 	baseURL       string
+	authTimeout   time.Duration
+	retryPolicy   RetryPolicy
+	breaker       *CircuitBreaker
 	authenticated bool
 	authMutex     sync.RWMutex
 	authToken     string
+	authExpiry    time.Time
 	refreshToken  string
 	csrfToken     string
+
+	// renewMutex serializes logins and refreshes so concurrent callers share one renewal
+	renewMutex sync.Mutex
 }
 
 // NewAPIClient creates a new API client
@@ -51,29 +71,25 @@ func NewAPIClient() *APIClient {
 		baseURL = DefaultNodeAPIURL
 	}
 
-	timeout := DefaultTimeout
-	if timeoutStr := os.Getenv("API_REQUEST_TIMEOUT"); timeoutStr != "" {
-		if parsedTimeout, err := time.ParseDuration(timeoutStr); err == nil {
-			timeout = parsedTimeout
-		}
-	}
-
 	jar, err := cookiejar.New(nil)
 	if err != nil {
-		log.Printf("Failed to create cookie jar: %v", err)
+		slog.Warn("Failed to create cookie jar", "error", err)
 		jar = nil
 	}
 
 	return &APIClient{
 		httpClient: &http.Client{
-			Timeout: timeout,
+			Timeout: envconfig.Duration("API_REQUEST_TIMEOUT", DefaultTimeout, 0),
 			Jar:     jar,
 		},
-		baseURL: baseURL,
+		baseURL:     baseURL,
+		authTimeout: envconfig.Duration("API_AUTH_TIMEOUT", DefaultAuthTimeout, 0),
+		retryPolicy: NewRetryPolicyFromEnv(),
+		breaker:     NewCircuitBreakerFromEnv(),
 	}
 }
 
-func (c *APIClient) authenticate() error {
+func (c *APIClient) authenticate(ctx context.Context) error {
 	email := os.Getenv("AUTH_EMAIL")
 	password := os.Getenv("AUTH_PASSWORD")
 
@@ -92,7 +108,7 @@ func (c *APIClient) authenticate() error {
 	}
 
 	url := fmt.Sprintf("%s/auth/login", c.baseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return fmt.Errorf("failed to create login request: %w", err)
 	}
@@ -115,7 +131,7 @@ func (c *APIClient) authenticate() error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("login failed with status %d: %s", resp.StatusCode, string(body))
+		return newAuthStatusError(resp.StatusCode, body, errors.New("login failed"))
 	}
 
 	var loginResp LoginResponse
@@ -127,28 +143,104 @@ func (c *APIClient) authenticate() error {
 		return fmt.Errorf("login failed: invalid response")
 	}
 
+	c.storeTokens(cookies)
+
+	slog.InfoContext(ctx, "Authenticated with Node.js backend", "user_id", loginResp.ID, "role", loginResp.Role)
+	return nil
+}
+
+// refresh exchanges the stored refresh token for a new access token
+func (c *APIClient) refresh(ctx context.Context) error {
+	c.authMutex.RLock()
+	hasRefreshToken := c.refreshToken != ""
+	c.authMutex.RUnlock()
+
+	if !hasRefreshToken {
+		return fmt.Errorf("no refresh token available")
+	}
+
+	url := fmt.Sprintf("%s/auth/refresh", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	c.setAuthHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make refresh request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read refresh response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newAuthStatusError(resp.StatusCode, body, errors.New("refresh failed"))
+	}
+
+	var hasAccessToken bool
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "accessToken" && cookie.Value != "" {
+			hasAccessToken = true
+		}
+	}
+	if !hasAccessToken {
+		return fmt.Errorf("refresh failed: no access token in response")
+	}
+
+	c.storeTokens(resp.Cookies())
+
+	slog.InfoContext(ctx, "Refreshed access token", "expires_at", c.tokenExpiresAt())
+	return nil
+}
+
+// storeTokens extracts the auth tokens from the backend cookies - we'll send them manually
+func (c *APIClient) storeTokens(cookies []*http.Cookie) {
 	c.authMutex.Lock()
-	c.authenticated = true
+	defer c.authMutex.Unlock()
 
-	// Extract tokens from cookies - we'll send them manually
+	c.authenticated = true
 	for _, cookie := range cookies {
 		if cookie.Name == "accessToken" && cookie.Value != "" {
 			c.authToken = cookie.Value
-			log.Printf("Stored access token: %s", c.authToken)
+			c.authExpiry = tokenExpiry(cookie.Value)
 		}
 		if cookie.Name == "refreshToken" && cookie.Value != "" {
 			c.refreshToken = cookie.Value
-			log.Printf("Stored refresh token: %s", c.refreshToken)
 		}
 		if cookie.Name == "csrfToken" && cookie.Value != "" {
 			c.csrfToken = cookie.Value
-			log.Printf("Stored CSRF token: %s", c.csrfToken)
 		}
 	}
-	c.authMutex.Unlock()
+}
 
-	log.Printf("Successfully authenticated with Node.js backend as %s", loginResp.Name)
-	return nil
+// tokenExpiry returns the exp claim of a JWT, or the zero time if it cannot be read.
+// The signature is not verified; the backend remains the authority on token validity.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
 }
 
 // isAuthenticated checks if the client is authenticated
@@ -158,31 +250,84 @@ func (c *APIClient) isAuthenticated() bool {
 	return c.authenticated
 }
 
-// ensureAuthenticated ensures the client is authenticated
-func (c *APIClient) ensureAuthenticated() error {
-	if !c.isAuthenticated() {
-		return c.authenticate()
+// needsRefresh reports whether the access token is about to expire
+func (c *APIClient) needsRefresh() bool {
+	c.authMutex.RLock()
+	defer c.authMutex.RUnlock()
+	return !c.authExpiry.IsZero() && time.Now().Add(tokenRefreshSkew).After(c.authExpiry)
+}
+
+// tokenExpiresAt returns the expiry of the current access token
+func (c *APIClient) tokenExpiresAt() time.Time {
+	c.authMutex.RLock()
+	defer c.authMutex.RUnlock()
+	return c.authExpiry
+}
+
+// currentToken returns the access token currently in use
+func (c *APIClient) currentToken() string {
+	c.authMutex.RLock()
+	defer c.authMutex.RUnlock()
+	return c.authToken
+}
+
+// ensureAuthenticated ensures the client is authenticated with an access token that is not about to expire
+func (c *APIClient) ensureAuthenticated(ctx context.Context) error {
+	if !c.isAuthenticated() || c.needsRefresh() {
+		return c.renewAuth(ctx, c.currentToken())
 	}
 	return nil
 }
 
+// renewAuth replaces the stale access token, trying the refresh token first and
+// falling back to a full login. Callers that raced on the same stale token share
+// the renewal performed by whichever of them got here first.
+func (c *APIClient) renewAuth(ctx context.Context, staleToken string) error {
+	c.renewMutex.Lock()
+	defer c.renewMutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.authTimeout)
+	defer cancel()
+
+	if c.isAuthenticated() && c.currentToken() != staleToken && !c.needsRefresh() {
+		return nil
+	}
+
+	if c.isAuthenticated() {
+		err := c.refresh(ctx)
+		if err == nil {
+			return nil
+		}
+		slog.WarnContext(ctx, "Token refresh failed, falling back to login", "error", err)
+	}
+
+	c.authMutex.Lock()
+	c.authenticated = false
+	c.authMutex.Unlock()
+
+	return c.authenticate(ctx)
+}
+
 func (c *APIClient) getCsrfToken() string {
 	c.authMutex.RLock()
 	if c.csrfToken != "" {
-		log.Printf("Using stored CSRF token: %s", c.csrfToken)
 		c.authMutex.RUnlock()
 		return c.csrfToken
 	}
 	c.authMutex.RUnlock()
 
 	if c.httpClient.Jar == nil {
-		log.Printf("No cookie jar available")
+		slog.Debug("No cookie jar available")
 		return ""
 	}
 
 	baseURL, err := url.Parse(c.baseURL)
 	if err != nil {
-		log.Printf("Failed to parse base URL: %v", err)
+		slog.Warn("Failed to parse base URL", "error", err)
 		return ""
 	}
 
@@ -196,76 +341,267 @@ func (c *APIClient) getCsrfToken() string {
 		}
 
 		cookies := c.httpClient.Jar.Cookies(hostURL)
-		log.Printf("Found %d cookies for %s", len(cookies), hostURL.String())
+		slog.Debug("Inspecting cookie jar", "url", hostURL.String(), "count", len(cookies))
 
 		for _, cookie := range cookies {
-			log.Printf("Cookie: %s = %s (Domain: %s, Path: %s)", cookie.Name, cookie.Value, cookie.Domain, cookie.Path)
 			if cookie.Name == "csrfToken" {
 				c.authMutex.Lock()
 				c.csrfToken = cookie.Value
 				c.authMutex.Unlock()
-				log.Printf("Stored CSRF token from cookies: %s", c.csrfToken)
+				slog.Debug("Stored CSRF token from cookie jar", "domain", cookie.Domain, "path", cookie.Path)
 				return c.csrfToken
 			}
 		}
 	}
 
-	log.Printf("CSRF token not found in cookies")
+	slog.Debug("CSRF token not found in cookie jar")
 	return ""
 }
 
+// setAuthHeaders adds the auth cookies and CSRF header the backend expects
+func (c *APIClient) setAuthHeaders(req *http.Request) {
+	c.authMutex.RLock()
+
+	// Add required cookies
+	var cookieParts []string
+	if c.authToken != "" {
+		cookieParts = append(cookieParts, fmt.Sprintf("accessToken=%s", c.authToken))
+	}
+	if c.refreshToken != "" {
+		cookieParts = append(cookieParts, fmt.Sprintf("refreshToken=%s", c.refreshToken))
+	}
+	if c.csrfToken != "" {
+		cookieParts = append(cookieParts, fmt.Sprintf("csrfToken=%s", c.csrfToken))
+	}
+
+	if len(cookieParts) > 0 {
+		cookieHeader := strings.Join(cookieParts, "; ")
+		req.Header.Set("Cookie", cookieHeader)
+	}
+
+	// Add CSRF token as header (backend expects both cookie AND header)
+	if c.csrfToken != "" {
+		req.Header.Set("x-csrf-token", c.csrfToken)
+	} else {
+		slog.DebugContext(req.Context(), "No CSRF token available for request")
+	}
+
+	c.authMutex.RUnlock()
+}
+
 // GetStudentByID fetches student data from the Node.js API
-func (c *APIClient) GetStudentByID(id string) (*Student, error) {
-	if err := c.ensureAuthenticated(); err != nil {
-		return nil, fmt.Errorf("failed to authenticate: %w", err)
+func (c *APIClient) GetStudentByID(ctx context.Context, id string) (*Student, error) {
+	resp, body, err := c.get(ctx, fmt.Sprintf("/students/%s", id))
+	if err != nil {
+		return nil, err
 	}
 
-	createRequest := func() (*http.Request, error) {
-		url := fmt.Sprintf("%s/students/%s", c.baseURL, id)
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp.StatusCode, body)
+	}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Accept", "application/json")
+	var apiResponse APIResponse
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, &UpstreamError{Kind: ErrInvalidPayload, Err: fmt.Errorf("failed to parse API response: %w", err)}
+	}
+
+	if !apiResponse.Success {
+		return nil, &UpstreamError{Kind: ErrInvalidPayload, Err: fmt.Errorf("API request failed: %s", apiResponse.Message)}
+	}
+
+	studentData, err := json.Marshal(apiResponse.Data)
+	if err != nil {
+		return nil, &UpstreamError{Kind: ErrInvalidPayload, Err: fmt.Errorf("failed to marshal student data: %w", err)}
+	}
 
-		c.authMutex.RLock()
+	var student Student
+	if err := json.Unmarshal(studentData, &student); err != nil {
+		return nil, &UpstreamError{Kind: ErrInvalidPayload, Err: fmt.Errorf("failed to unmarshal student data: %w", err)}
+	}
 
-		// Add required cookies
-		var cookieParts []string
-		if c.authToken != "" {
-			cookieParts = append(cookieParts, fmt.Sprintf("accessToken=%s", c.authToken))
-			log.Printf("Adding accessToken cookie")
+	if student.ID == 0 {
+		return nil, &UpstreamError{Kind: ErrInvalidPayload, Err: fmt.Errorf("student data has no id")}
+	}
+
+	return &student, nil
+}
+
+// ListStudents fetches the students of a class and section from the Node.js API
+func (c *APIClient) ListStudents(ctx context.Context, filter StudentFilter) ([]*Student, error) {
+	query := url.Values{}
+	if filter.Class != "" {
+		query.Set("className", filter.Class)
+	}
+	if filter.Section != "" {
+		query.Set("section", filter.Section)
+	}
+
+	path := "/students"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	resp, body, err := c.get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp.StatusCode, body)
+	}
+
+	var apiResponse struct {
+		Success bool       `json:"success"`
+		Data    []*Student `json:"data"`
+		Message string     `json:"message"`
+	}
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, &UpstreamError{Kind: ErrInvalidPayload, Err: fmt.Errorf("failed to parse API response: %w", err)}
+	}
+
+	if !apiResponse.Success {
+		return nil, &UpstreamError{Kind: ErrInvalidPayload, Err: fmt.Errorf("API request failed: %s", apiResponse.Message)}
+	}
+
+	return apiResponse.Data, nil
+}
+
+// get performs an idempotent GET against the Node.js API, retrying transient
+// failures according to the client's retry policy. Rejected credentials and
+// other permanent failures are returned at once. The response body has
+// already been read and closed when it is returned.
+func (c *APIClient) get(ctx context.Context, path string) (*http.Response, []byte, error) {
+	for attempt := 1; ; attempt++ {
+		if err := c.breaker.Allow(); err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := c.doAuthenticated(ctx, "GET", path)
+		c.recordOutcome(ctx, resp, err)
+
+		var reason string
+		var upstreamErr *UpstreamError
+		var urlErr *url.Error
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return nil, nil, err
+		case err != nil && errors.As(err, &upstreamErr) && upstreamErr.StatusCode != 0:
+			// A login or refresh the backend answered with an error status
+			if !isRetryableStatus(upstreamErr.StatusCode) {
+				return nil, nil, err
+			}
+			reason = fmt.Sprintf("status_%d", upstreamErr.StatusCode)
+		case err != nil && (errors.As(err, &urlErr) || errors.Is(err, ErrUpstreamUnavailable)):
+			reason = "network"
+		case err != nil:
+			return nil, nil, err
+		case isRetryableStatus(resp.StatusCode):
+			reason = fmt.Sprintf("status_%d", resp.StatusCode)
 		}
-		if c.refreshToken != "" {
-			cookieParts = append(cookieParts, fmt.Sprintf("refreshToken=%s", c.refreshToken))
-			log.Printf("Adding refreshToken cookie")
+
+		if reason == "" || attempt >= c.retryPolicy.MaxAttempts {
+			if err != nil {
+				return nil, nil, err
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+			}
+			return resp, body, nil
 		}
-		if c.csrfToken != "" {
-			cookieParts = append(cookieParts, fmt.Sprintf("csrfToken=%s", c.csrfToken))
-			log.Printf("Adding csrfToken cookie")
+
+		delay := c.retryPolicy.delay(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
 		}
 
-		if len(cookieParts) > 0 {
-			cookieHeader := strings.Join(cookieParts, "; ")
-			req.Header.Set("Cookie", cookieHeader)
-			log.Printf("Set Cookie header with %d cookies", len(cookieParts))
+		metrics.RecordRetry(reason)
+		slog.WarnContext(ctx, "Retrying Node.js API request",
+			"path", path, "attempt", attempt, "max_attempts", c.retryPolicy.MaxAttempts,
+			"reason", reason, "delay", delay, "error", err)
+
+		if err := ctxtime.Sleep(ctx, delay); err != nil {
+			return nil, nil, err
 		}
+	}
+}
+
+// recordOutcome feeds the result of a backend call to the circuit breaker.
+// Transport errors, 5xx responses and failed logins or refreshes count against
+// the backend; cancellations, rejected credentials and 4xx responses do not.
+func (c *APIClient) recordOutcome(ctx context.Context, resp *http.Response, err error) {
+	switch {
+	case err != nil && ctx.Err() != nil:
+		c.breaker.Cancelled()
+	case err != nil && errors.Is(err, ErrUnauthorized):
+		c.breaker.Neutral()
+	case err != nil:
+		c.breaker.Failure()
+	case resp.StatusCode >= http.StatusInternalServerError:
+		c.breaker.Failure()
+	default:
+		c.breaker.Success()
+	}
+}
+
+// classifyTransportError wraps err as an UpstreamError. Network failures mean
+// the backend is unavailable; anything else gets the fallback kind. Errors
+// caused by the caller's context are returned unchanged.
+func classifyTransportError(ctx context.Context, err error, fallback error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return &UpstreamError{Kind: ErrUpstreamUnavailable, Err: err}
+	}
+	return &UpstreamError{Kind: fallback, Err: err}
+}
+
+// classifyAuthError classifies a failed login or refresh. A response from the
+// backend already carries an UpstreamError with the kind of its status;
+// failures that never reached the backend are classified like other transport
+// errors, and anything else means the credentials could not be used.
+func classifyAuthError(ctx context.Context, err error) error {
+	var upstreamErr *UpstreamError
+	if ctx.Err() != nil || errors.As(err, &upstreamErr) {
+		return err
+	}
+	return classifyTransportError(ctx, err, ErrUnauthorized)
+}
+
+// BreakerSnapshot reports the state of the circuit breaker guarding the Node.js API
+func (c *APIClient) BreakerSnapshot() BreakerSnapshot {
+	return c.breaker.Snapshot()
+}
 
-		// Add CSRF token as header (backend expects both cookie AND header)
-		if c.csrfToken != "" {
-			req.Header.Set("x-csrf-token", c.csrfToken)
-			log.Printf("Adding CSRF token to request header: %s", c.csrfToken)
-		} else {
-			log.Printf("No CSRF token available for request")
+// doAuthenticated sends an authenticated request, renewing the session and
+// retrying once if the backend answers 401
+func (c *APIClient) doAuthenticated(ctx context.Context, method, path string) (*http.Response, error) {
+	if err := c.ensureAuthenticated(ctx); err != nil {
+		return nil, classifyAuthError(ctx, fmt.Errorf("failed to authenticate: %w", err))
+	}
+
+	createRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
 		}
 
-		c.authMutex.RUnlock()
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+
+		c.setAuthHeaders(req)
 
 		return req, nil
 	}
 
+	staleToken := c.currentToken()
+
 	req, err := createRequest()
 	if err != nil {
 		return nil, err
@@ -273,22 +609,17 @@ func (c *APIClient) GetStudentByID(id string) (*Student, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request to Node.js API: %w", err)
+		return nil, classifyTransportError(ctx, fmt.Errorf("failed to make request to Node.js API: %w", err), nil)
 	}
 
 	if resp.StatusCode == http.StatusUnauthorized {
 		resp.Body.Close()
-		log.Printf("Received 401, re-authenticating and retrying...")
+		slog.InfoContext(ctx, "Received 401, renewing authentication and retrying", "path", path)
 
-		c.authMutex.Lock()
-		c.authenticated = false
-		c.authMutex.Unlock()
-
-		if err := c.authenticate(); err != nil {
-			return nil, fmt.Errorf("failed to re-authenticate after 401: %w", err)
+		if err := c.renewAuth(ctx, staleToken); err != nil {
+			return nil, classifyAuthError(ctx, fmt.Errorf("failed to re-authenticate after 401: %w", err))
 		}
 
-		log.Println("Retrying API request after re-authentication...")
 		retryReq, err := createRequest()
 		if err != nil {
 			return nil, err
@@ -296,38 +627,9 @@ func (c *APIClient) GetStudentByID(id string) (*Student, error) {
 
 		resp, err = c.httpClient.Do(retryReq)
 		if err != nil {
-			return nil, fmt.Errorf("failed to retry request after re-authentication: %w", err)
+			return nil, classifyTransportError(ctx, fmt.Errorf("failed to retry request after re-authentication: %w", err), nil)
 		}
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var apiResponse APIResponse
-	if err := json.Unmarshal(body, &apiResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse API response: %w", err)
-	}
 
-	if !apiResponse.Success {
-		return nil, fmt.Errorf("API request failed: %s", apiResponse.Message)
-	}
-
-	studentData, err := json.Marshal(apiResponse.Data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal student data: %w", err)
-	}
-
-	var student Student
-	if err := json.Unmarshal(studentData, &student); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal student data: %w", err)
-	}
-
-	return &student, nil
+	return resp, nil
 }
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeJWT(exp time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"id":1,"exp":%d}`, exp.Unix())))
+	return header + "." + payload + ".sig"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	assert.True(t, tokenExpiry(makeJWT(exp)).Equal(exp))
+	assert.True(t, tokenExpiry("not-a-jwt").IsZero())
+	assert.True(t, tokenExpiry("a.!!!.c").IsZero())
+}
@@ -0,0 +1,297 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/fakebackend"
+	"pdf-generator/internal/metrics"
+)
+
+// startBackend runs a fake Node.js backend and points the client environment at it
+func startBackend(t *testing.T, cfg fakebackend.Config) *fakebackend.Server {
+	t.Helper()
+
+	server := fakebackend.Start(cfg)
+	t.Cleanup(server.Close)
+
+	t.Setenv("NODE_API_URL", server.URL())
+	t.Setenv("AUTH_EMAIL", fakebackend.DefaultEmail)
+	t.Setenv("AUTH_PASSWORD", fakebackend.DefaultPassword)
+	t.Setenv("API_RETRY_BASE_DELAY", "1ms")
+	t.Setenv("API_RETRY_MAX_DELAY", "5ms")
+
+	return server
+}
+
+func TestGetStudentByID_LogsInOnce(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	client := api.NewAPIClient()
+
+	for i := 0; i < 3; i++ {
+		student, err := client.GetStudentByID(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, "John Doe", student.Name)
+	}
+
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteLogin))
+	assert.Equal(t, 0, backend.Calls(fakebackend.RouteRefresh))
+}
+
+func TestGetStudentByID_WrongCredentials(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	t.Setenv("AUTH_PASSWORD", "wrong")
+
+	before := metrics.RetryCount("network")
+
+	_, err := api.NewAPIClient().GetStudentByID(context.Background(), "1")
+	assert.ErrorIs(t, err, api.ErrUnauthorized)
+	assert.NotContains(t, err.Error(), "Invalid credentials")
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteLogin))
+	assert.Equal(t, before, metrics.RetryCount("network"))
+}
+
+func TestGetStudentByID_RefreshesOn401(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	client := api.NewAPIClient()
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+
+	backend.ExpireAccessTokens()
+
+	_, err = client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteLogin))
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteRefresh))
+}
+
+func TestGetStudentByID_FallsBackToLoginWhenRefreshFails(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	client := api.NewAPIClient()
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+
+	backend.ExpireAccessTokens()
+	backend.RevokeRefreshTokens()
+
+	_, err = client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, backend.Calls(fakebackend.RouteLogin))
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteRefresh))
+}
+
+func TestGetStudentByID_ProactiveRefreshBeforeExpiry(t *testing.T) {
+	// Tokens expire within the refresh skew, so every call after login refreshes first
+	backend := startBackend(t, fakebackend.Config{AccessTokenTTL: 5 * time.Second})
+	client := api.NewAPIClient()
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, backend.Calls(fakebackend.RouteRefresh))
+
+	_, err = client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteLogin))
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteRefresh))
+}
+
+func TestGetStudentByID_ConcurrentUnauthorizedSharesRefresh(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	client := api.NewAPIClient()
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+
+	backend.ExpireAccessTokens()
+	// Give concurrent callers a chance to pile up behind the refresh
+	backend.InjectFault(fakebackend.RouteRefresh, fakebackend.Fault{Delay: 20 * time.Millisecond, Times: 1})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetStudentByID(context.Background(), "1")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteLogin))
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteRefresh))
+}
+
+func TestGetStudentByID_CancelledContext(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	client := api.NewAPIClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.GetStudentByID(ctx, "1")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, backend.Calls(fakebackend.RouteLogin))
+}
+
+func TestGetStudentByID_RetriesTransientFailures(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	backend.InjectFault(fakebackend.RouteStudents, fakebackend.Fault{Status: http.StatusBadGateway, Times: 1})
+	backend.InjectFault(fakebackend.RouteStudents, fakebackend.Fault{Status: http.StatusServiceUnavailable, Times: 1})
+	client := api.NewAPIClient()
+
+	before := metrics.RetryCount("status_503")
+
+	student, err := client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", student.Name)
+	assert.Equal(t, 3, backend.Calls(fakebackend.RouteStudents))
+	assert.Equal(t, before+1, metrics.RetryCount("status_503"))
+}
+
+func TestGetStudentByID_RetriesConnectionReset(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	// net/http transparently retries one reset on a reused connection, so
+	// inject two to make sure the client's own retry kicks in
+	backend.InjectFault(fakebackend.RouteStudents, fakebackend.Fault{Reset: true, Times: 2})
+	client := api.NewAPIClient()
+
+	before := metrics.RetryCount("network")
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, backend.Calls(fakebackend.RouteStudents))
+	assert.Greater(t, metrics.RetryCount("network"), before)
+}
+
+func TestGetStudentByID_GivesUpAfterMaxAttempts(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	backend.InjectFault(fakebackend.RouteStudents, fakebackend.Fault{Status: http.StatusGatewayTimeout})
+	t.Setenv("API_RETRY_MAX_ATTEMPTS", "2")
+	client := api.NewAPIClient()
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, api.ErrUpstreamUnavailable)
+	assert.Contains(t, err.Error(), "504")
+	assert.Equal(t, 2, backend.Calls(fakebackend.RouteStudents))
+}
+
+func TestGetStudentByID_DoesNotRetryNotFound(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	client := api.NewAPIClient()
+
+	_, err := client.GetStudentByID(context.Background(), "999")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, api.ErrStudentNotFound)
+	assert.Equal(t, 1, backend.Calls(fakebackend.RouteStudents))
+
+	var upstreamErr *api.UpstreamError
+	require.ErrorAs(t, err, &upstreamErr)
+	assert.Equal(t, http.StatusNotFound, upstreamErr.StatusCode)
+}
+
+func TestGetStudentByID_HonorsRetryAfter(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	backend.InjectFault(fakebackend.RouteStudents, fakebackend.Fault{Status: http.StatusServiceUnavailable, RetryAfter: "1", Times: 1})
+	t.Setenv("API_RETRY_MAX_DELAY", "2s")
+	client := api.NewAPIClient()
+
+	start := time.Now()
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestGetStudentByID_Forbidden(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	backend.InjectFault(fakebackend.RouteStudents, fakebackend.Fault{Status: http.StatusForbidden, Times: 1})
+	client := api.NewAPIClient()
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	assert.ErrorIs(t, err, api.ErrUnauthorized)
+}
+
+func TestGetStudentByID_UnreachableBackend(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	backend.Close()
+	t.Setenv("API_RETRY_MAX_ATTEMPTS", "1")
+
+	_, err := api.NewAPIClient().GetStudentByID(context.Background(), "1")
+	assert.ErrorIs(t, err, api.ErrUpstreamUnavailable)
+}
+
+func TestGetStudentByID_FailsFastWhenBackendDown(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	backend.InjectFault(fakebackend.RouteStudents, fakebackend.Fault{Status: http.StatusServiceUnavailable})
+	t.Setenv("API_RETRY_MAX_ATTEMPTS", "1")
+	t.Setenv("API_BREAKER_FAILURE_THRESHOLD", "2")
+	client := api.NewAPIClient()
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetStudentByID(context.Background(), "1")
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, api.ErrCircuitOpen)
+	}
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, api.ErrCircuitOpen)
+	assert.ErrorIs(t, err, api.ErrUpstreamUnavailable)
+	assert.Equal(t, 2, backend.Calls(fakebackend.RouteStudents))
+	assert.Equal(t, "open", client.BreakerSnapshot().State)
+}
+
+func TestGetStudentByID_FailsFastWhenLoginDown(t *testing.T) {
+	backend := startBackend(t, fakebackend.Config{})
+	backend.InjectFault(fakebackend.RouteLogin, fakebackend.Fault{Status: http.StatusServiceUnavailable})
+	t.Setenv("API_RETRY_MAX_ATTEMPTS", "1")
+	t.Setenv("API_BREAKER_FAILURE_THRESHOLD", "2")
+	client := api.NewAPIClient()
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetStudentByID(context.Background(), "1")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, api.ErrUpstreamUnavailable)
+		assert.NotErrorIs(t, err, api.ErrUnauthorized)
+		assert.NotErrorIs(t, err, api.ErrCircuitOpen)
+	}
+
+	_, err := client.GetStudentByID(context.Background(), "1")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, api.ErrCircuitOpen)
+	assert.Equal(t, 2, backend.Calls(fakebackend.RouteLogin))
+	assert.Equal(t, 0, backend.Calls(fakebackend.RouteStudents))
+	assert.Equal(t, "open", client.BreakerSnapshot().State)
+}
+
+func TestGetStudentByID_WrongCredentialsKeepBreakerClosed(t *testing.T) {
+	startBackend(t, fakebackend.Config{})
+	t.Setenv("AUTH_PASSWORD", "wrong")
+	t.Setenv("API_RETRY_MAX_ATTEMPTS", "1")
+	t.Setenv("API_BREAKER_FAILURE_THRESHOLD", "2")
+	client := api.NewAPIClient()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.GetStudentByID(context.Background(), "1")
+		assert.ErrorIs(t, err, api.ErrUnauthorized)
+	}
+	assert.Equal(t, "closed", client.BreakerSnapshot().State)
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"pdf-generator/internal/envconfig"
+)
+
+const (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerOpenTimeout      = 30 * time.Second
+	DefaultBreakerHalfOpenRequests = 1
+)
+
+// ErrCircuitOpen is returned when the Node.js backend is considered down and
+// requests are rejected without being sent
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError carries how long callers should wait before trying again
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrCircuitOpen, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Unwrap() []error {
+	return []error{ErrCircuitOpen, ErrUpstreamUnavailable}
+}
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerSnapshot describes a circuit breaker for health reporting
+type BreakerSnapshot struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	OpenedAt            time.Time `json:"openedAt,omitempty"`
+	RetryAfterSeconds   int       `json:"retryAfterSeconds,omitempty"`
+}
+
+// BreakerReporter is implemented by student sources guarded by a circuit breaker
+type BreakerReporter interface {
+	BreakerSnapshot() BreakerSnapshot
+}
+
+// CircuitBreaker stops calls to a failing backend. It opens after
+// FailureThreshold consecutive failures, rejects calls for OpenTimeout, then
+// lets HalfOpenRequests probe calls through; a successful probe closes it and
+// a failed one opens it again.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+	now      func() time.Time
+}
+
+// NewCircuitBreakerFromEnv reads the breaker thresholds from
+// API_BREAKER_FAILURE_THRESHOLD, API_BREAKER_OPEN_TIMEOUT and API_BREAKER_HALF_OPEN_REQUESTS
+func NewCircuitBreakerFromEnv() *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: envconfig.Int("API_BREAKER_FAILURE_THRESHOLD", DefaultBreakerFailureThreshold, 1),
+		OpenTimeout:      envconfig.Duration("API_BREAKER_OPEN_TIMEOUT", DefaultBreakerOpenTimeout, time.Nanosecond),
+		HalfOpenRequests: envconfig.Int("API_BREAKER_HALF_OPEN_REQUESTS", DefaultBreakerHalfOpenRequests, 1),
+		now:              time.Now,
+	}
+}
+
+// Allow reports whether a call may proceed, returning a *CircuitOpenError if not.
+// Every allowed call must be followed by Success or Failure.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		remaining := b.OpenTimeout - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return &CircuitOpenError{RetryAfter: remaining}
+		}
+		b.setState(BreakerHalfOpen)
+		b.probes = 0
+	}
+
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.HalfOpenRequests {
+			return &CircuitOpenError{RetryAfter: time.Second}
+		}
+		b.probes++
+	}
+
+	return nil
+}
+
+// Success records a call that reached a healthy backend
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state != BreakerClosed {
+		b.setState(BreakerClosed)
+	}
+}
+
+// Failure records a call that failed because the backend is unhealthy
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.FailureThreshold) {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// Cancelled records a call abandoned by the caller, which says nothing about
+// the backend's health; it only frees the half-open probe slot it held
+func (b *CircuitBreaker) Cancelled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// Neutral records a call whose outcome says nothing about the backend's
+// health, such as one with rejected credentials; like Cancelled, it only frees
+// the half-open probe slot it held
+func (b *CircuitBreaker) Neutral() {
+	b.Cancelled()
+}
+
+// Snapshot returns the current breaker state
+func (b *CircuitBreaker) Snapshot() BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := BreakerSnapshot{
+		State:               b.state.String(),
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state == BreakerOpen {
+		snapshot.OpenedAt = b.openedAt
+		if remaining := b.OpenTimeout - b.now().Sub(b.openedAt); remaining > 0 {
+			snapshot.RetryAfterSeconds = int((remaining + time.Second - 1) / time.Second)
+		}
+	}
+	return snapshot
+}
+
+// setState must be called with b.mu held
+func (b *CircuitBreaker) setState(state BreakerState) {
+	slog.Warn("Circuit breaker state changed", "from", b.state.String(), "to", state.String(), "consecutive_failures", b.failures)
+	b.state = state
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBreaker(now *time.Time) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: 2,
+		OpenTimeout:      10 * time.Second,
+		HalfOpenRequests: 1,
+		now:              func() time.Time { return *now },
+	}
+}
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	now := time.Now()
+	breaker := newTestBreaker(&now)
+
+	require.NoError(t, breaker.Allow())
+	breaker.Failure()
+	require.NoError(t, breaker.Allow())
+	breaker.Failure()
+
+	err := breaker.Allow()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	var openErr *CircuitOpenError
+	require.True(t, errors.As(err, &openErr))
+	assert.Equal(t, 10*time.Second, openErr.RetryAfter)
+	assert.Equal(t, "open", breaker.Snapshot().State)
+	assert.Equal(t, 10, breaker.Snapshot().RetryAfterSeconds)
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	now := time.Now()
+	breaker := newTestBreaker(&now)
+
+	breaker.Failure()
+	breaker.Success()
+	breaker.Failure()
+
+	assert.NoError(t, breaker.Allow())
+	assert.Equal(t, "closed", breaker.Snapshot().State)
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	now := time.Now()
+	breaker := newTestBreaker(&now)
+
+	breaker.Failure()
+	breaker.Failure()
+	require.Error(t, breaker.Allow())
+
+	now = now.Add(11 * time.Second)
+
+	// Only one probe is let through while half-open
+	require.NoError(t, breaker.Allow())
+	assert.Equal(t, "half-open", breaker.Snapshot().State)
+	require.Error(t, breaker.Allow())
+
+	// A failed probe opens the breaker again
+	breaker.Failure()
+	require.Error(t, breaker.Allow())
+
+	now = now.Add(11 * time.Second)
+
+	// A successful probe closes it
+	require.NoError(t, breaker.Allow())
+	breaker.Success()
+	assert.Equal(t, "closed", breaker.Snapshot().State)
+	assert.NoError(t, breaker.Allow())
+}
+
+func TestCircuitBreaker_CancelledProbeFreesSlot(t *testing.T) {
+	now := time.Now()
+	breaker := newTestBreaker(&now)
+
+	breaker.Failure()
+	breaker.Failure()
+	now = now.Add(11 * time.Second)
+
+	require.NoError(t, breaker.Allow())
+	breaker.Cancelled()
+	assert.NoError(t, breaker.Allow())
+}
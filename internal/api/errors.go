@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by APIClient, classified so callers can map them to responses
+// without inspecting upstream bodies
+var (
+	ErrStudentNotFound     = errors.New("student not found")
+	ErrUnauthorized        = errors.New("not authorized by student service")
+	ErrUpstreamUnavailable = errors.New("student service unavailable")
+	ErrInvalidPayload      = errors.New("invalid payload from student service")
+)
+
+// maxErrorBodyLength bounds how much of an upstream body is kept for logs
+const maxErrorBodyLength = 512
+
+// UpstreamError describes a failed call to the Node.js API. Body is kept for
+// logging only and must never be sent to end users.
+type UpstreamError struct {
+	// Kind is one of the Err* sentinels, or nil for unexpected responses
+	Kind       error
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	msg := "student service request failed"
+	if e.Kind != nil {
+		msg = e.Kind.Error()
+	}
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s (status %d)", msg, e.StatusCode)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+func (e *UpstreamError) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// newStatusError classifies an unsuccessful upstream response
+func newStatusError(statusCode int, body []byte) *UpstreamError {
+	var kind error
+	switch {
+	case statusCode == http.StatusNotFound:
+		kind = ErrStudentNotFound
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		kind = ErrUnauthorized
+	case statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError:
+		kind = ErrUpstreamUnavailable
+	}
+
+	if len(body) > maxErrorBodyLength {
+		body = body[:maxErrorBodyLength]
+	}
+	return &UpstreamError{Kind: kind, StatusCode: statusCode, Body: string(body)}
+}
+
+// newAuthStatusError classifies an unsuccessful login or refresh response.
+// Unlike a student lookup's, its 404 does not mean a student is missing.
+func newAuthStatusError(statusCode int, body []byte, err error) *UpstreamError {
+	upstreamErr := newStatusError(statusCode, body)
+	if upstreamErr.Kind == ErrStudentNotFound {
+		upstreamErr.Kind = nil
+	}
+	upstreamErr.Err = err
+	return upstreamErr
+}
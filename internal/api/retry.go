@@ -0,0 +1,101 @@
+package api
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pdf-generator/internal/envconfig"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 200 * time.Millisecond
+	DefaultRetryMaxDelay    = 5 * time.Second
+	DefaultRetryJitter      = 0.5
+)
+
+// RetryPolicy controls how idempotent requests to the Node.js API are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; it doubles on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps both the computed backoff and any Retry-After from the backend
+	MaxDelay time.Duration
+	// Jitter is the fraction (0-1) of each delay that is randomized
+	Jitter float64
+}
+
+// NewRetryPolicyFromEnv reads the retry policy from API_RETRY_MAX_ATTEMPTS,
+// API_RETRY_BASE_DELAY, API_RETRY_MAX_DELAY and API_RETRY_JITTER
+func NewRetryPolicyFromEnv() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: envconfig.Int("API_RETRY_MAX_ATTEMPTS", DefaultRetryMaxAttempts, 1),
+		BaseDelay:   envconfig.Duration("API_RETRY_BASE_DELAY", DefaultRetryBaseDelay, 0),
+		MaxDelay:    envconfig.Duration("API_RETRY_MAX_DELAY", DefaultRetryMaxDelay, 0),
+		Jitter:      envconfig.Float("API_RETRY_JITTER", DefaultRetryJitter, 0, 1),
+	}
+}
+
+// backoff returns the delay before the given retry (1 for the first retry)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		spread := float64(delay) * p.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*spread)
+	}
+	return delay
+}
+
+// delay returns how long to wait before the given retry, preferring the
+// backend's Retry-After over the computed backoff
+func (p RetryPolicy) delay(retry int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if retryAfter > p.MaxDelay {
+				return p.MaxDelay
+			}
+			return retryAfter
+		}
+	}
+	return p.backoff(retry)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// isRetryableStatus reports whether a response status indicates a transient failure
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
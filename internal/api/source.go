@@ -0,0 +1,25 @@
+package api
+
+import "context"
+
+// StudentSource provides student records to the report handlers
+type StudentSource interface {
+	GetStudentByID(ctx context.Context, id string) (*Student, error)
+}
+
+// StudentFilter selects students by class and section; empty fields match everything
+type StudentFilter struct {
+	Class   string
+	Section string
+}
+
+// StudentLister is implemented by sources that can look students up by class and section
+type StudentLister interface {
+	ListStudents(ctx context.Context, filter StudentFilter) ([]*Student, error)
+}
+
+var (
+	_ StudentSource   = (*APIClient)(nil)
+	_ StudentLister   = (*APIClient)(nil)
+	_ BreakerReporter = (*APIClient)(nil)
+)
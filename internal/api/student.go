@@ -1,7 +1,12 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/mail"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -30,36 +35,119 @@ type Student struct {
 	ReporterName       *string `json:"reporterName"`
 }
 
+// LogValue implements slog.LogValuer so that logging a student never emits
+// names, contact details, addresses or dates of birth
+func (s *Student) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("id", s.ID),
+		slog.String("class", GetValueOrNA(s.Class)),
+		slog.String("section", GetValueOrNA(s.Section)),
+	)
+}
+
+// FieldError describes why a single student field is invalid
+type FieldError struct {
+	Field  string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError lists every invalid field of a student
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		parts[i] = fmt.Sprintf("%s: %s", field.Field, field.Reason)
+	}
+	return "invalid student: " + strings.Join(parts, "; ")
+}
+
+// ErrInvalidStudent is matched by every *ValidationError
+var ErrInvalidStudent = errors.New("invalid student")
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidStudent
+}
+
+// Validate checks that a student supplied by a caller can be rendered,
+// returning a *ValidationError listing every problem found
+func (s *Student) Validate() error {
+	var fields []FieldError
+	invalid := func(field, reason string) {
+		fields = append(fields, FieldError{Field: field, Reason: reason})
+	}
+
+	if s.ID <= 0 {
+		invalid("id", "must be a positive integer")
+	}
+	if strings.TrimSpace(s.Name) == "" {
+		invalid("name", "is required")
+	}
+	if strings.TrimSpace(s.Email) == "" {
+		invalid("email", "is required")
+	} else if _, err := mail.ParseAddress(s.Email); err != nil {
+		invalid("email", "must be a valid email address")
+	}
+	if s.Roll != nil && *s.Roll < 0 {
+		invalid("roll", "must not be negative")
+	}
+	for field, date := range map[string]*string{"dob": s.DOB, "admissionDate": s.AdmissionDate} {
+		if date != nil && *date != "" {
+			if _, err := time.Parse("2006-01-02", *date); err != nil {
+				invalid(field, "must be a date in YYYY-MM-DD format")
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
 type APIResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data"`
 	Message string      `json:"message"`
 }
 
-func (s *Student) FormatDate(dateStr *string) string {
+// NotAvailable is printed in place of missing values
+const NotAvailable = "N/A"
+
+// DateFormatter spells out dates in the language of a report
+type DateFormatter interface {
+	FormatDate(t time.Time) string
+}
+
+// FormatDate spells out a YYYY-MM-DD date with formatter. Missing dates are
+// NotAvailable and dates in any other format are returned as is.
+func (s *Student) FormatDate(dateStr *string, formatter DateFormatter) string {
 	if dateStr == nil || *dateStr == "" {
-		return "N/A"
+		return NotAvailable
 	}
 
 	if t, err := time.Parse("2006-01-02", *dateStr); err == nil {
-		return t.Format("January 2, 2006")
+		return formatter.FormatDate(t)
 	}
 
 	return *dateStr
 }
 
-// GetValueOrNA returns the string value or "N/A" if nil
+// GetValueOrNA returns the string value or NotAvailable if nil
 func GetValueOrNA(str *string) string {
 	if str == nil || *str == "" {
-		return "N/A"
+		return NotAvailable
 	}
 	return *str
 }
 
-// GetIntValueOrNA returns the int value as string or "N/A" if nil
+// GetIntValueOrNA returns the int value as string or NotAvailable if nil
 func GetIntValueOrNA(num *int) string {
 	if num == nil {
-		return "N/A"
+		return NotAvailable
 	}
 	return fmt.Sprintf("%d", *num)
 }
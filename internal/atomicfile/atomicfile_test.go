@@ -0,0 +1,40 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "record.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(content)); err != nil {
+			t.Fatalf("WriteFile(%q) error = %v", content, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if string(data) != content {
+			t.Errorf("content = %q, want %q", data, content)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the written file", len(entries))
+	}
+}
+
+func TestWriteFile_MissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "record.json")
+	if err := WriteFile(path, []byte("data")); err == nil {
+		t.Fatal("WriteFile() error = nil, want error")
+	}
+}
@@ -0,0 +1,292 @@
+// Package bidi prepares right-to-left and mixed-direction text for gofpdf,
+// which draws every string left to right exactly as given. It shapes Arabic
+// letters and reorders each line into display order following the Unicode
+// Bidirectional Algorithm (UAX #9). Explicit embeddings and bracket pairs are
+// not needed for report fields and are treated as ordinary neutrals. It also
+// moves the Devanagari vowel signs that are drawn before their consonant.
+package bidi
+
+import (
+	"slices"
+
+	ubidi "golang.org/x/text/unicode/bidi"
+)
+
+// IsRTL reports whether s contains right-to-left letters
+func IsRTL(s string) bool {
+	for _, r := range s {
+		switch class(r) {
+		case ubidi.R, ubidi.AL:
+			return true
+		}
+	}
+	return false
+}
+
+// Display returns one line of text in the order its characters are drawn
+// from left to right. Text without right-to-left letters keeps its order,
+// apart from Devanagari vowel signs, so that numbers and addresses read as
+// usual in either direction. Other text is shaped and laid out as a
+// paragraph that is right to left if rtl is set, and otherwise takes the
+// direction of its first letter.
+func Display(s string, rtl bool) string {
+	s = ReorderDevanagari(s)
+	if !IsRTL(s) {
+		return s
+	}
+	runes := []rune(Shape(s))
+
+	base := 0
+	if rtl || firstStrong(runes) != ubidi.L {
+		base = 1
+	}
+	levels := resolveLevels(runes, base)
+	return string(reorder(runes, levels))
+}
+
+func class(r rune) ubidi.Class {
+	props, _ := ubidi.LookupRune(r)
+	return props.Class()
+}
+
+func isMark(r rune) bool {
+	return class(r) == ubidi.NSM
+}
+
+// firstStrong returns L, R or AL for the first letter of runes, or L if it
+// has none
+func firstStrong(runes []rune) ubidi.Class {
+	for _, r := range runes {
+		switch c := class(r); c {
+		case ubidi.L, ubidi.R, ubidi.AL:
+			return c
+		}
+	}
+	return ubidi.L
+}
+
+// resolveLevels assigns an embedding level to every character of a
+// paragraph at the base level; see UAX #9 rules W1-W7, N1-N2, I1-I2 and L1
+func resolveLevels(runes []rune, base int) []int {
+	n := len(runes)
+	embedding := ubidi.L
+	if base == 1 {
+		embedding = ubidi.R
+	}
+
+	types := make([]ubidi.Class, n)
+	for i, r := range runes {
+		switch c := class(r); c {
+		case ubidi.L, ubidi.R, ubidi.AL, ubidi.EN, ubidi.ES, ubidi.ET, ubidi.AN, ubidi.CS, ubidi.NSM, ubidi.WS:
+			types[i] = c
+		case ubidi.B, ubidi.S:
+			types[i] = ubidi.WS
+		default:
+			types[i] = ubidi.ON
+		}
+	}
+
+	// W1: marks take the type of the character before them
+	for i, t := range types {
+		if t == ubidi.NSM {
+			types[i] = embedding
+			if i > 0 {
+				types[i] = types[i-1]
+			}
+		}
+	}
+
+	// W2, W3: European numbers after Arabic letters are Arabic numbers, and
+	// Arabic letters are right to left
+	strong := embedding
+	for i, t := range types {
+		switch t {
+		case ubidi.L, ubidi.R, ubidi.AL:
+			strong = t
+		case ubidi.EN:
+			if strong == ubidi.AL {
+				types[i] = ubidi.AN
+			}
+		}
+	}
+	for i, t := range types {
+		if t == ubidi.AL {
+			types[i] = ubidi.R
+		}
+	}
+
+	// W4: a single separator between two numbers of the same kind joins them
+	for i := 1; i < n-1; i++ {
+		before, after := types[i-1], types[i+1]
+		switch {
+		case types[i] == ubidi.ES && before == ubidi.EN && after == ubidi.EN:
+			types[i] = ubidi.EN
+		case types[i] == ubidi.CS && before == after && (before == ubidi.EN || before == ubidi.AN):
+			types[i] = before
+		}
+	}
+
+	// W5: terminators such as currency signs next to a number join it
+	for i := 0; i < n; i++ {
+		if types[i] != ubidi.ET {
+			continue
+		}
+		end := i
+		for end < n && types[end] == ubidi.ET {
+			end++
+		}
+		if (i > 0 && types[i-1] == ubidi.EN) || (end < n && types[end] == ubidi.EN) {
+			for j := i; j < end; j++ {
+				types[j] = ubidi.EN
+			}
+		}
+		i = end - 1
+	}
+
+	// W6: remaining separators and terminators are neutral
+	for i, t := range types {
+		switch t {
+		case ubidi.ES, ubidi.ET, ubidi.CS:
+			types[i] = ubidi.ON
+		}
+	}
+
+	// W7: European numbers in left-to-right text are left to right
+	strong = embedding
+	for i, t := range types {
+		switch t {
+		case ubidi.L, ubidi.R:
+			strong = t
+		case ubidi.EN:
+			if strong == ubidi.L {
+				types[i] = ubidi.L
+			}
+		}
+	}
+
+	// N1, N2: neutrals between characters of the same direction take that
+	// direction, and the paragraph's otherwise
+	direction := func(t ubidi.Class) ubidi.Class {
+		if t == ubidi.EN || t == ubidi.AN {
+			return ubidi.R
+		}
+		return t
+	}
+	for i := 0; i < n; i++ {
+		if types[i] != ubidi.ON && types[i] != ubidi.WS {
+			continue
+		}
+		end := i
+		for end < n && (types[end] == ubidi.ON || types[end] == ubidi.WS) {
+			end++
+		}
+		before, after := embedding, embedding
+		if i > 0 {
+			before = direction(types[i-1])
+		}
+		if end < n {
+			after = direction(types[end])
+		}
+		resolved := embedding
+		if before == after {
+			resolved = before
+		}
+		for j := i; j < end; j++ {
+			types[j] = resolved
+		}
+		i = end - 1
+	}
+
+	// I1, I2: implicit levels
+	levels := make([]int, n)
+	for i, t := range types {
+		levels[i] = base
+		switch {
+		case base == 0 && t == ubidi.R:
+			levels[i] = 1
+		case base == 0 && (t == ubidi.AN || t == ubidi.EN):
+			levels[i] = 2
+		case base == 1 && t != ubidi.R:
+			levels[i] = 2
+		}
+	}
+
+	// L1: trailing whitespace takes the paragraph level
+	for i := n - 1; i >= 0; i-- {
+		if c := class(runes[i]); c != ubidi.WS && c != ubidi.S && c != ubidi.B {
+			break
+		}
+		levels[i] = base
+	}
+	return levels
+}
+
+// reorder returns runes in display order; see UAX #9 rules L2 and L4
+func reorder(runes []rune, levels []int) []rune {
+	out := slices.Clone(runes)
+	for i, r := range out {
+		if levels[i]%2 == 1 {
+			out[i] = mirror(r)
+		}
+	}
+	lv := slices.Clone(levels)
+
+	// L2: from the highest level down to the lowest odd level, reverse every
+	// sequence at that level or higher
+	highest, lowestOdd := 0, 0
+	for _, l := range lv {
+		highest = max(highest, l)
+		if l%2 == 1 && (lowestOdd == 0 || l < lowestOdd) {
+			lowestOdd = l
+		}
+	}
+	for level := highest; lowestOdd > 0 && level >= lowestOdd; level-- {
+		for i := 0; i < len(out); i++ {
+			if lv[i] < level {
+				continue
+			}
+			end := i
+			for end < len(out) && lv[end] >= level {
+				end++
+			}
+			slices.Reverse(out[i:end])
+			slices.Reverse(lv[i:end])
+			i = end
+		}
+	}
+
+	// Reversal put combining marks in front of their letters; PDF viewers
+	// draw a mark over the glyph before it, so move them back behind it
+	for i := 0; i < len(out); i++ {
+		if !isMark(out[i]) {
+			continue
+		}
+		end := i
+		for end < len(out) && isMark(out[end]) {
+			end++
+		}
+		if end < len(out) && lv[end]%2 == 1 {
+			letter := out[end]
+			copy(out[i+1:end+1], out[i:end])
+			out[i] = letter
+		}
+		i = end
+	}
+	return out
+}
+
+// mirrored pairs characters that are drawn mirrored in right-to-left text
+var mirrored = map[rune]rune{
+	'(': ')', ')': '(',
+	'[': ']', ']': '[',
+	'{': '}', '}': '{',
+	'<': '>', '>': '<',
+	'«': '»', '»': '«',
+}
+
+func mirror(r rune) rune {
+	if m, ok := mirrored[r]; ok {
+		return m
+	}
+	return r
+}
@@ -0,0 +1,100 @@
+package bidi
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisplay(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		rtl  bool
+		want string
+	}{
+		{"latin unchanged", "John Doe", false, "John Doe"},
+		{"latin unchanged in rtl", "+1234567890", true, "+1234567890"},
+		{"email unchanged in rtl", "john.doe@school.com", true, "john.doe@school.com"},
+		{"hebrew", "שלום", false, "םולש"},
+		{"hebrew with number", "דני 123", true, "123 ינד"},
+		{"hebrew with email", "דני john@x.com", true, "john@x.com ינד"},
+		{"hebrew in ltr line", "Name: דני", false, "Name: ינד"},
+		{"ltr line takes its first letter's direction", "דני Cohen", false, "Cohen ינד"},
+		{"rtl forced", "Cohen דני", true, "ינד Cohen"},
+		{"brackets mirrored", "(דני)", true, "(ינד)"},
+		{"trailing space ends an rtl line on the left", "דני ", false, " ינד"},
+		{"marks follow their letter", "אָב", true, "באָ"},
+		{"arabic number after arabic letters", "ID علي 42", false, "ID 42 " + reversed(Shape("علي"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Display(tt.text, tt.rtl))
+		})
+	}
+}
+
+func reversed(s string) string {
+	runes := []rune(s)
+	slices.Reverse(runes)
+	return string(runes)
+}
+
+func TestShape(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []rune
+	}{
+		// meem (initial), hah (medial), meem (medial), dal (final)
+		{"joined word", "محمد", []rune{0xFEE3, 0xFEA4, 0xFEE4, 0xFEAA}},
+		// dal never joins forward, so the following letter is isolated
+		{"right-joining letter", "دب", []rune{0xFEA9, 0xFE8F}},
+		{"lam-alef ligature", "لا", []rune{0xFEFB}},
+		// seen (initial), lam-alef (final), meem (isolated after alef)
+		{"joined lam-alef", "سلام", []rune{0xFEB3, 0xFEFC, 0xFEE1}},
+		// marks do not break joining and stay in place
+		{"marks", "بَب", []rune{0xFE91, 0x064E, 0xFE90}},
+		{"persian letters", "پک", []rune{0xFB58, 0xFB8F}},
+		{"hamza never joins", "بء", []rune{0xFE8F, 0xFE80}},
+		{"other text", "Ali 42", []rune("Ali 42")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(tt.want), Shape(tt.text))
+		})
+	}
+}
+
+func TestReorderDevanagari(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		// ki-ra-n: the sign moves ahead of ka
+		{"vowel sign i", "किरण", "\u093f\u0915\u0930\u0923"},
+		// pri-ya: pa keeps its virama, so the sign only moves ahead of ra
+		{"after a cluster", "प्रिया", "\u092a\u094d\u093f\u0930\u092f\u093e"},
+		// zi: the nukta stays with its consonant
+		{"nukta", "ज़िया", "\u093f\u091c\u093c\u092f\u093e"},
+		{"other vowel signs", "अनुष्का शर्मा", "अनुष्का शर्मा"},
+		{"other text", "Priya 42", "Priya 42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ReorderDevanagari(tt.text))
+		})
+	}
+}
+
+func TestIsRTL(t *testing.T) {
+	assert.True(t, IsRTL("Name: דני"))
+	assert.True(t, IsRTL("محمد"))
+	assert.False(t, IsRTL("Łucja 42"))
+	assert.False(t, IsRTL("٤٢"))
+}
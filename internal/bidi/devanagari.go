@@ -0,0 +1,43 @@
+package bidi
+
+// gofpdf does not apply a font's OpenType rules either, so Devanagari is
+// drawn one character at a time. Conjuncts then show as consonants joined by
+// a visible virama, which still reads correctly, but the vowel sign I, which
+// is written after its consonant and drawn before it, must be moved.
+
+const (
+	vowelSignI = 0x093F
+	nukta      = 0x093C
+)
+
+// ReorderDevanagari moves every vowel sign I ahead of the consonant it
+// follows, and that consonant's nukta, so it is drawn on the left. Without
+// conjunct forms each consonant before a virama stands on its own, so the
+// sign goes only before the last consonant of a cluster.
+func ReorderDevanagari(s string) string {
+	runes := []rune(s)
+	moved := false
+	for i, r := range runes {
+		if r != vowelSignI {
+			continue
+		}
+		start := i - 1
+		if start > 0 && runes[start] == nukta {
+			start--
+		}
+		if start < 0 || !isDevanagariConsonant(runes[start]) {
+			continue
+		}
+		copy(runes[start+1:i+1], runes[start:i])
+		runes[start] = vowelSignI
+		moved = true
+	}
+	if !moved {
+		return s
+	}
+	return string(runes)
+}
+
+func isDevanagariConsonant(r rune) bool {
+	return r >= 0x0915 && r <= 0x0939 || r >= 0x0958 && r <= 0x095F || r >= 0x0978 && r <= 0x097F
+}
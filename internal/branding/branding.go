@@ -0,0 +1,255 @@
+// Package branding holds the school's identity printed on every report: its
+// name, logo, section header colours and the address and contact details in
+// the page footer.
+package branding
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is where NewFromEnv looks for the branding configuration
+const DefaultFile = "branding/branding.yaml"
+
+// DefaultLogoHeight is the height of the logo, in millimetres, if the
+// configuration does not set one
+const DefaultLogoHeight = 20.0
+
+// svgWidth is the width in pixels SVG logos are rasterized at, enough for a
+// sharp print at the sizes logos are shown
+const svgWidth = 1200
+
+// Image types as understood by gofpdf
+const (
+	PNG  = "PNG"
+	JPEG = "JPG"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// Color is an RGB colour
+type Color [3]int
+
+// Logo is an image printed in the top corner of each report
+type Logo struct {
+	// Data is PNG or JPEG data, as given by Type; SVG logos are rasterized
+	// to PNG when the branding is loaded
+	Data []byte
+	Type string
+	// Width and Height are the printed size in millimetres
+	Width  float64
+	Height float64
+}
+
+// Branding is how reports identify the school. The zero value, returned by
+// Default, leaves the look of the templates unchanged.
+type Branding struct {
+	// SchoolName replaces the translated "School Management System" bound to
+	// {{schoolName}} and printed in the page header
+	SchoolName string
+	Logo       *Logo
+	// Primary fills section headers and Secondary colours their text and
+	// border; nil keeps the template's style
+	Primary   *Color
+	Secondary *Color
+	// Address and Contact are printed at the foot of every page, above the
+	// page number
+	Address string
+	Contact string
+}
+
+// config is the YAML form of a Branding
+type config struct {
+	SchoolName string  `yaml:"schoolName"`
+	Logo       string  `yaml:"logo"`
+	LogoHeight float64 `yaml:"logoHeight"`
+	Colors     struct {
+		Primary   string `yaml:"primary"`
+		Secondary string `yaml:"secondary"`
+	} `yaml:"colors"`
+	Footer struct {
+		Address string `yaml:"address"`
+		Contact string `yaml:"contact"`
+	} `yaml:"footer"`
+}
+
+// Default returns the branding of the built-in templates
+func Default() *Branding {
+	return &Branding{}
+}
+
+// NewFromEnv loads the branding in BRANDING_FILE, or DefaultFile if it is
+// unset. A missing file gives the default branding.
+func NewFromEnv() (*Branding, error) {
+	path := os.Getenv("BRANDING_FILE")
+	if path == "" {
+		path = DefaultFile
+	}
+	b, err := Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Default(), nil
+	}
+	return b, err
+}
+
+// Load reads a branding configuration. The logo path is relative to the
+// configuration file.
+func Load(path string) (*Branding, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := Parse(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Parse reads a branding configuration from YAML or JSON, loading the logo
+// from dir
+func Parse(data []byte, dir string) (*Branding, error) {
+	var c config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// An empty document is the default branding
+	if err := decoder.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid branding: %w", err)
+	}
+
+	b := &Branding{
+		SchoolName: strings.TrimSpace(c.SchoolName),
+		Address:    strings.TrimSpace(c.Footer.Address),
+		Contact:    strings.TrimSpace(c.Footer.Contact),
+	}
+	var err error
+	if b.Primary, err = parseColor("colors.primary", c.Colors.Primary); err != nil {
+		return nil, err
+	}
+	if b.Secondary, err = parseColor("colors.secondary", c.Colors.Secondary); err != nil {
+		return nil, err
+	}
+
+	if c.LogoHeight < 0 {
+		return nil, errors.New("invalid branding: logoHeight must be positive")
+	}
+	if c.Logo != "" {
+		height := c.LogoHeight
+		if height == 0 {
+			height = DefaultLogoHeight
+		}
+		if b.Logo, err = loadLogo(filepath.Join(dir, c.Logo), height); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// parseColor reads a #RRGGBB colour, or nil for an empty value
+func parseColor(field, value string) (*Color, error) {
+	if value == "" {
+		return nil, nil
+	}
+	c, err := ParseColor(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid branding: %s must be a colour such as #1F4E79, got %q", field, value)
+	}
+	return &c, nil
+}
+
+// ParseColor reads a colour written as #RRGGBB
+func ParseColor(value string) (Color, error) {
+	if !colorPattern.MatchString(value) {
+		return Color{}, fmt.Errorf("invalid colour %q; expected #RRGGBB", value)
+	}
+	var c Color
+	for i := range c {
+		n, _ := strconv.ParseUint(value[1+2*i:3+2*i], 16, 8)
+		c[i] = int(n)
+	}
+	return c, nil
+}
+
+// loadLogo reads a PNG, JPEG or SVG image and sizes it to height
+func loadLogo(path string, height float64) (*Logo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		if data, err = rasterize(data); err != nil {
+			return nil, fmt.Errorf("invalid SVG logo %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("logo %s must be a PNG, JPEG or SVG image: %w", filepath.Base(path), err)
+	}
+	size := img.Bounds().Size()
+	logo := &Logo{Data: data, Type: JPEG, Height: height, Width: height * float64(size.X) / float64(size.Y)}
+	if format == "png" {
+		// gofpdf reads neither interlaced nor 16-bit PNGs, so store every
+		// PNG in a form it accepts
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, toNRGBA(img)); err != nil {
+			return nil, fmt.Errorf("failed to encode logo: %w", err)
+		}
+		logo.Data, logo.Type = buf.Bytes(), PNG
+	}
+	return logo, nil
+}
+
+// rasterize draws an SVG image into a PNG svgWidth pixels wide
+func rasterize(data []byte) ([]byte, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.StrictErrorMode)
+	if err != nil {
+		return nil, err
+	}
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+		return nil, errors.New("image has no size; set a viewBox")
+	}
+
+	w := svgWidth
+	h := max(1, int(float64(w)*icon.ViewBox.H/icon.ViewBox.W))
+	icon.SetTarget(0, 0, float64(w), float64(h))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	icon.Draw(rasterx.NewDasher(w, h, rasterx.NewScannerGV(w, h, img, img.Bounds())), 1)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		return nrgba
+	}
+	nrgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return nrgba
+}
+
+// HasFooter reports whether pages get a footer with the school's details
+func (b *Branding) HasFooter() bool {
+	return b.Address != "" || b.Contact != ""
+}
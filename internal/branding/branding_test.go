@@ -0,0 +1,138 @@
+package branding
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeImage writes a w x h 16-bit image with a red line as PNG or JPEG
+func writeImage(t *testing.T, path string, w, h int, format string) {
+	t.Helper()
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, h/2, color.RGBA64{R: 0xFFFF, A: 0xFFFF})
+	}
+	var buf bytes.Buffer
+	if format == "png" {
+		require.NoError(t, png.Encode(&buf, img))
+	} else {
+		require.NoError(t, jpeg.Encode(&buf, img, nil))
+	}
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+const squareSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100"><rect x="10" y="10" width="180" height="80" fill="#1F4E79"/></svg>`
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	writeImage(t, filepath.Join(dir, "logo.png"), 40, 20, "png")
+
+	b, err := Parse([]byte(`
+schoolName: Springfield High
+logo: logo.png
+logoHeight: 15
+colors:
+  primary: "#1F4E79"
+  secondary: "#ffffff"
+footer:
+  address: 742 Evergreen Terrace, Springfield
+  contact: "+1 555 0100 - office@springfield.edu"
+`), dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Springfield High", b.SchoolName)
+	assert.Equal(t, &Color{0x1F, 0x4E, 0x79}, b.Primary)
+	assert.Equal(t, &Color{255, 255, 255}, b.Secondary)
+	assert.Equal(t, "742 Evergreen Terrace, Springfield", b.Address)
+	assert.True(t, b.HasFooter())
+
+	require.NotNil(t, b.Logo)
+	assert.Equal(t, PNG, b.Logo.Type)
+	assert.Equal(t, 15.0, b.Logo.Height)
+	assert.Equal(t, 30.0, b.Logo.Width)
+	// 16-bit PNGs are stored as 8-bit, which gofpdf can read
+	img, err := png.Decode(bytes.NewReader(b.Logo.Data))
+	require.NoError(t, err)
+	assert.IsType(t, &image.NRGBA{}, img)
+}
+
+func TestParse_Logos(t *testing.T) {
+	dir := t.TempDir()
+	writeImage(t, filepath.Join(dir, "logo.jpg"), 30, 30, "jpeg")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logo.svg"), []byte(squareSVG), 0o644))
+
+	b, err := Parse([]byte("logo: logo.jpg"), dir)
+	require.NoError(t, err)
+	assert.Equal(t, JPEG, b.Logo.Type)
+	assert.Equal(t, DefaultLogoHeight, b.Logo.Width)
+
+	b, err = Parse([]byte("logo: logo.svg\nlogoHeight: 10"), dir)
+	require.NoError(t, err)
+	assert.Equal(t, PNG, b.Logo.Type)
+	assert.InDelta(t, 20.0, b.Logo.Width, 0.01)
+	img, err := png.Decode(bytes.NewReader(b.Logo.Data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(svgWidth, svgWidth/2), img.Bounds().Size())
+	// The rectangle is drawn in the primary colour
+	r, g, bl, _ := img.At(svgWidth/2, svgWidth/4).RGBA()
+	assert.Equal(t, []uint32{0x1F, 0x4E, 0x79}, []uint32{r >> 8, g >> 8, bl >> 8})
+}
+
+func TestParse_Default(t *testing.T) {
+	for _, source := range []string{"", "{}"} {
+		b, err := Parse([]byte(source), t.TempDir())
+		require.NoError(t, err)
+		assert.Equal(t, Default(), b)
+		assert.False(t, b.HasFooter())
+	}
+}
+
+func TestParse_Rejections(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logo.gif"), []byte("GIF89a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.svg"), []byte("<svg"), 0o644))
+
+	tests := []struct {
+		name    string
+		source  string
+		wantErr string
+	}{
+		{"unknown field", "schoolname: Springfield", "field schoolname not found"},
+		{"colour", "colors: {primary: blue}", `colors.primary must be a colour such as #1F4E79, got "blue"`},
+		{"short colour", "colors: {secondary: '#fff'}", "colors.secondary must be a colour"},
+		{"logo height", "logoHeight: -5", "logoHeight must be positive"},
+		{"missing logo", "logo: missing.png", "failed to read logo"},
+		{"unsupported logo", "logo: logo.gif", "logo logo.gif must be a PNG, JPEG or SVG image"},
+		{"invalid svg", "logo: broken.svg", "invalid SVG logo broken.svg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.source), dir)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("BRANDING_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	b, err := NewFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Default(), b)
+
+	path := filepath.Join(t.TempDir(), "branding.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("colors: {primary: nope}"), 0o644))
+	t.Setenv("BRANDING_FILE", path)
+	_, err = NewFromEnv()
+	assert.ErrorContains(t, err, path+": invalid branding")
+}
@@ -0,0 +1,20 @@
+// Package ctxtime waits in ways a context can cut short
+package ctxtime
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep waits for d or until ctx is done, returning ctx's error in that case
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,43 @@
+// Package envconfig reads optional settings from environment variables. Each
+// reader takes the smallest value the setting accepts; a value below it, or
+// one that does not parse, is ignored in favour of the fallback.
+package envconfig
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Duration returns the duration in the environment variable key, or fallback
+// if it is unset, invalid or shorter than min
+func Duration(key string, fallback, min time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed >= min {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// Int returns the integer in the environment variable key, or fallback if it
+// is unset, invalid or less than min
+func Int(key string, fallback, min int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= min {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// Float returns the number in the environment variable key, or fallback if it
+// is unset, invalid or outside min to max
+func Float(key string, fallback, min, max float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed >= min && parsed <= max {
+			return parsed
+		}
+	}
+	return fallback
+}
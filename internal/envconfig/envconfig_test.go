@@ -0,0 +1,72 @@
+package envconfig
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		want  time.Duration
+	}{
+		{"", time.Nanosecond, time.Minute},
+		{"15s", time.Nanosecond, 15 * time.Second},
+		{"0s", time.Nanosecond, time.Minute},
+		{"0s", 0, 0},
+		{"-1s", 0, time.Minute},
+		{"soon", 0, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_DURATION", tt.value)
+		if got := Duration("TEST_DURATION", time.Minute, tt.min); got != tt.want {
+			t.Errorf("Duration(%q, min %v) = %v, want %v", tt.value, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestInt(t *testing.T) {
+	tests := []struct {
+		value string
+		min   int
+		want  int
+	}{
+		{"", 1, 4},
+		{"12", 1, 12},
+		{"0", 1, 4},
+		{"0", 0, 0},
+		{"-3", 0, 4},
+		{"many", 1, 4},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_INT", tt.value)
+		if got := Int("TEST_INT", 4, tt.min); got != tt.want {
+			t.Errorf("Int(%q, min %d) = %d, want %d", tt.value, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"", 0.5},
+		{"0", 0},
+		{"0.25", 0.25},
+		{"1", 1},
+		{"1.5", 0.5},
+		{"-0.1", 0.5},
+		{"half", 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_FLOAT", tt.value)
+		if got := Float("TEST_FLOAT", 0.5, 0, 1); got != tt.want {
+			t.Errorf("Float(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
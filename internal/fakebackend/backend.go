@@ -0,0 +1,391 @@
+// Package fakebackend is an in-process stand-in for the Node.js student API,
+// used by integration tests and for offline development.
+package fakebackend
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pdf-generator/internal/api"
+)
+
+const (
+	// BasePath is the prefix the Node.js API serves its routes under
+	BasePath = "/api/v1"
+
+	DefaultEmail          = "admin@example.com"
+	DefaultPassword       = "password"
+	DefaultAccessTokenTTL = 15 * time.Minute
+)
+
+// Routes that faults can be injected into and calls counted for
+const (
+	RouteLogin    = "login"
+	RouteRefresh  = "refresh"
+	RouteStudents = "students"
+	RouteList     = "list"
+)
+
+// Config configures a Backend
+type Config struct {
+	Email          string
+	Password       string
+	AccessTokenTTL time.Duration
+	// Students served by the backend; defaults to api.GetMockStudent()
+	Students []*api.Student
+}
+
+// Fault makes a route misbehave
+type Fault struct {
+	// Status is the response status to return
+	Status int
+	// RetryAfter is sent as the Retry-After header when set
+	RetryAfter string
+	// Delay is waited before responding, or before Reset
+	Delay time.Duration
+	// Reset closes the connection without writing a response
+	Reset bool
+	// Times limits how many requests the fault applies to; 0 means until cleared
+	Times int
+}
+
+// Backend implements the subset of the Node.js API used by APIClient:
+// cookie-based login and refresh with CSRF checks, and student lookups
+type Backend struct {
+	email          string
+	password       string
+	accessTokenTTL time.Duration
+
+	mu            sync.Mutex
+	students      map[string]*api.Student
+	accessTokens  map[string]time.Time
+	refreshTokens map[string]string
+	faults        map[string][]*Fault
+	calls         map[string]int
+}
+
+// New creates a Backend
+func New(cfg Config) *Backend {
+	if cfg.Email == "" {
+		cfg.Email = DefaultEmail
+	}
+	if cfg.Password == "" {
+		cfg.Password = DefaultPassword
+	}
+	if cfg.AccessTokenTTL == 0 {
+		cfg.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if cfg.Students == nil {
+		cfg.Students = []*api.Student{api.GetMockStudent()}
+	}
+
+	b := &Backend{
+		email:          cfg.Email,
+		password:       cfg.Password,
+		accessTokenTTL: cfg.AccessTokenTTL,
+		students:       make(map[string]*api.Student),
+		accessTokens:   make(map[string]time.Time),
+		refreshTokens:  make(map[string]string),
+		faults:         make(map[string][]*Fault),
+		calls:          make(map[string]int),
+	}
+	for _, student := range cfg.Students {
+		b.AddStudent(student)
+	}
+	return b
+}
+
+// Server is a Backend listening on a local httptest server
+type Server struct {
+	*Backend
+	httpServer *httptest.Server
+}
+
+// Start runs a Backend on a local port until Close is called
+func Start(cfg Config) *Server {
+	backend := New(cfg)
+	return &Server{Backend: backend, httpServer: httptest.NewServer(backend)}
+}
+
+// URL returns the API base URL, suitable for NODE_API_URL
+func (s *Server) URL() string {
+	return s.httpServer.URL + BasePath
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+// AddStudent adds or replaces a student record
+func (b *Backend) AddStudent(student *api.Student) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.students[fmt.Sprintf("%d", student.ID)] = student
+}
+
+// InjectFault queues a fault for a route; queued faults apply in order
+func (b *Backend) InjectFault(route string, fault Fault) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.faults[route] = append(b.faults[route], &fault)
+}
+
+// ClearFaults removes all injected faults
+func (b *Backend) ClearFaults() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.faults = make(map[string][]*Fault)
+}
+
+// ExpireAccessTokens invalidates every issued access token, as if they all expired
+func (b *Backend) ExpireAccessTokens() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.accessTokens = make(map[string]time.Time)
+}
+
+// RevokeRefreshTokens invalidates every issued refresh token
+func (b *Backend) RevokeRefreshTokens() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshTokens = make(map[string]string)
+}
+
+// Calls returns how many requests reached a route, including faulted ones
+func (b *Backend) Calls(route string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls[route]
+}
+
+func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, BasePath)
+
+	switch {
+	case path == "/auth/login" && r.Method == http.MethodPost:
+		b.serve(w, r, RouteLogin, b.handleLogin)
+	case path == "/auth/refresh" && r.Method == http.MethodPost:
+		b.serve(w, r, RouteRefresh, b.handleRefresh)
+	case path == "/students" && r.Method == http.MethodGet:
+		b.serve(w, r, RouteList, b.handleList)
+	case strings.HasPrefix(path, "/students/") && r.Method == http.MethodGet:
+		b.serve(w, r, RouteStudents, b.handleStudent)
+	default:
+		writeJSON(w, http.StatusNotFound, api.APIResponse{Success: false, Message: "Route not found"})
+	}
+}
+
+// serve counts the call and applies any pending fault before handing over to the route handler
+func (b *Backend) serve(w http.ResponseWriter, r *http.Request, route string, handler http.HandlerFunc) {
+	fault := b.nextFault(route)
+	if fault == nil {
+		handler(w, r)
+		return
+	}
+
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if fault.Reset {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if fault.Status == 0 {
+		handler(w, r)
+		return
+	}
+	if fault.RetryAfter != "" {
+		w.Header().Set("Retry-After", fault.RetryAfter)
+	}
+	writeJSON(w, fault.Status, api.APIResponse{Success: false, Message: http.StatusText(fault.Status)})
+}
+
+func (b *Backend) nextFault(route string) *Fault {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls[route]++
+
+	queue := b.faults[route]
+	if len(queue) == 0 {
+		return nil
+	}
+
+	fault := queue[0]
+	if fault.Times > 0 {
+		fault.Times--
+		if fault.Times == 0 {
+			b.faults[route] = queue[1:]
+		}
+	}
+	return fault
+}
+
+func (b *Backend) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req api.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, api.APIResponse{Success: false, Message: "Invalid request body"})
+		return
+	}
+
+	if req.Username != b.email || req.Password != b.password {
+		writeJSON(w, http.StatusUnauthorized, api.APIResponse{Success: false, Message: "Invalid credentials"})
+		return
+	}
+
+	csrfToken := randomToken()
+	refreshToken := randomToken()
+
+	b.mu.Lock()
+	b.refreshTokens[refreshToken] = csrfToken
+	b.mu.Unlock()
+
+	b.issueAccessToken(w)
+	http.SetCookie(w, &http.Cookie{Name: "refreshToken", Value: refreshToken, Path: "/", HttpOnly: true})
+	http.SetCookie(w, &http.Cookie{Name: "csrfToken", Value: csrfToken, Path: "/"})
+
+	writeJSON(w, http.StatusOK, api.LoginResponse{ID: 1, Name: "Admin", Email: b.email, Role: "admin"})
+}
+
+func (b *Backend) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	refreshCookie, err := r.Cookie("refreshToken")
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, api.APIResponse{Success: false, Message: "Missing refresh token"})
+		return
+	}
+
+	b.mu.Lock()
+	csrfToken, ok := b.refreshTokens[refreshCookie.Value]
+	b.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.APIResponse{Success: false, Message: "Invalid refresh token"})
+		return
+	}
+	if r.Header.Get("x-csrf-token") != csrfToken {
+		writeJSON(w, http.StatusForbidden, api.APIResponse{Success: false, Message: "Invalid CSRF token"})
+		return
+	}
+
+	b.issueAccessToken(w)
+	writeJSON(w, http.StatusOK, api.APIResponse{Success: true, Message: "Token refreshed"})
+}
+
+func (b *Backend) handleStudent(w http.ResponseWriter, r *http.Request) {
+	if status, message := b.checkAuth(r); status != http.StatusOK {
+		writeJSON(w, status, api.APIResponse{Success: false, Message: message})
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, BasePath), "/students/")
+
+	b.mu.Lock()
+	student, ok := b.students[id]
+	b.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, api.APIResponse{Success: false, Message: "Student not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.APIResponse{Success: true, Data: student})
+}
+
+func (b *Backend) handleList(w http.ResponseWriter, r *http.Request) {
+	if status, message := b.checkAuth(r); status != http.StatusOK {
+		writeJSON(w, status, api.APIResponse{Success: false, Message: message})
+		return
+	}
+
+	className := r.URL.Query().Get("className")
+	section := r.URL.Query().Get("section")
+
+	b.mu.Lock()
+	students := make([]*api.Student, 0, len(b.students))
+	for _, student := range b.students {
+		if className != "" && api.GetValueOrNA(student.Class) != className {
+			continue
+		}
+		if section != "" && api.GetValueOrNA(student.Section) != section {
+			continue
+		}
+		students = append(students, student)
+	}
+	b.mu.Unlock()
+
+	sort.Slice(students, func(i, j int) bool { return students[i].ID < students[j].ID })
+	writeJSON(w, http.StatusOK, api.APIResponse{Success: true, Data: students})
+}
+
+// checkAuth validates the access token cookie and the double-submitted CSRF token
+func (b *Backend) checkAuth(r *http.Request) (int, string) {
+	accessCookie, err := r.Cookie("accessToken")
+	if err != nil {
+		return http.StatusUnauthorized, "Missing access token"
+	}
+
+	b.mu.Lock()
+	expiry, ok := b.accessTokens[accessCookie.Value]
+	b.mu.Unlock()
+
+	if !ok || time.Now().After(expiry) {
+		return http.StatusUnauthorized, "Invalid or expired access token"
+	}
+
+	csrfCookie, err := r.Cookie("csrfToken")
+	if err != nil || csrfCookie.Value == "" || r.Header.Get("x-csrf-token") != csrfCookie.Value {
+		return http.StatusForbidden, "Invalid CSRF token"
+	}
+
+	return http.StatusOK, ""
+}
+
+// issueAccessToken sets a new JWT-shaped access token cookie carrying an exp claim
+func (b *Backend) issueAccessToken(w http.ResponseWriter) {
+	expiry := time.Now().Add(b.accessTokenTTL)
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"id":1,"exp":%d,"jti":"%s"}`, expiry.Unix(), randomToken())))
+	token := header + "." + payload + "." + randomToken()
+
+	b.mu.Lock()
+	b.accessTokens[token] = expiry
+	b.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: "accessToken", Value: token, Path: "/", HttpOnly: true})
+}
+
+func randomToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
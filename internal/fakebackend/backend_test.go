@@ -0,0 +1,108 @@
+package fakebackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+)
+
+func login(t *testing.T, b *Backend) []*http.Cookie {
+	t.Helper()
+
+	body, err := json.Marshal(api.LoginRequest{Username: DefaultEmail, Password: DefaultPassword})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	b.ServeHTTP(rr, httptest.NewRequest("POST", BasePath+"/auth/login", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	return rr.Result().Cookies()
+}
+
+func getStudent(b *Backend, cookies []*http.Cookie, csrf string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", BasePath+"/students/1", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if csrf != "" {
+		req.Header.Set("x-csrf-token", csrf)
+	}
+
+	rr := httptest.NewRecorder()
+	b.ServeHTTP(rr, req)
+	return rr
+}
+
+func cookieValue(cookies []*http.Cookie, name string) string {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func TestBackend_LoginSetsCookies(t *testing.T) {
+	cookies := login(t, New(Config{}))
+
+	assert.NotEmpty(t, cookieValue(cookies, "accessToken"))
+	assert.NotEmpty(t, cookieValue(cookies, "refreshToken"))
+	assert.NotEmpty(t, cookieValue(cookies, "csrfToken"))
+}
+
+func TestBackend_RejectsBadCredentials(t *testing.T) {
+	body, err := json.Marshal(api.LoginRequest{Username: DefaultEmail, Password: "nope"})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	New(Config{}).ServeHTTP(rr, httptest.NewRequest("POST", BasePath+"/auth/login", bytes.NewReader(body)))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestBackend_StudentRequiresCSRFHeader(t *testing.T) {
+	b := New(Config{})
+	cookies := login(t, b)
+
+	assert.Equal(t, http.StatusForbidden, getStudent(b, cookies, "").Code)
+	assert.Equal(t, http.StatusForbidden, getStudent(b, cookies, "wrong").Code)
+
+	rr := getStudent(b, cookies, cookieValue(cookies, "csrfToken"))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp api.APIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.True(t, resp.Success)
+}
+
+func TestBackend_AccessTokensExpire(t *testing.T) {
+	b := New(Config{AccessTokenTTL: time.Millisecond})
+	cookies := login(t, b)
+
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Equal(t, http.StatusUnauthorized, getStudent(b, cookies, cookieValue(cookies, "csrfToken")).Code)
+}
+
+func TestBackend_InjectedFaults(t *testing.T) {
+	b := New(Config{})
+	cookies := login(t, b)
+	csrf := cookieValue(cookies, "csrfToken")
+
+	b.InjectFault(RouteStudents, Fault{Status: http.StatusBadGateway, RetryAfter: "2", Times: 1})
+
+	rr := getStudent(b, cookies, csrf)
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, getStudent(b, cookies, csrf).Code)
+	assert.Equal(t, 2, b.Calls(RouteStudents))
+}
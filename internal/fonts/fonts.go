@@ -0,0 +1,329 @@
+// Package fonts provides the TrueType fonts used to print text that the PDF
+// core fonts cannot encode, and picks a font for each script in a string.
+package fonts
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// BundledFamily is the name of the main font family built into the service
+const BundledFamily = "DejaVuSans"
+
+// DevanagariFamily is the name of the family built into the service for
+// Devanagari, which BundledFamily lacks
+const DevanagariFamily = "NotoSansDevanagari"
+
+// DefaultDir is where NewSetFromEnv looks for additional fonts
+const DefaultDir = "fonts"
+
+// Font styles as understood by gofpdf
+const (
+	Regular    = ""
+	Bold       = "B"
+	Italic     = "I"
+	BoldItalic = "BI"
+)
+
+//go:embed dejavu/*.ttf noto/*.ttf
+var bundled embed.FS
+
+// bundledFiles maps each style of BundledFamily to its file
+var bundledFiles = map[string]string{
+	Regular:    "dejavu/DejaVuSansCondensed.ttf",
+	Bold:       "dejavu/DejaVuSansCondensed-Bold.ttf",
+	Italic:     "dejavu/DejaVuSansCondensed-Oblique.ttf",
+	BoldItalic: "dejavu/DejaVuSansCondensed-BoldOblique.ttf",
+}
+
+// devanagariFiles maps the styles of DevanagariFamily to their files; the
+// other styles fall back to the regular face
+var devanagariFiles = map[string]string{
+	Regular: "noto/NotoSansDevanagari-Regular.ttf",
+}
+
+// styleSuffixes maps file name suffixes, as in NotoSans-BoldItalic.ttf, to
+// styles
+var styleSuffixes = map[string]string{
+	"regular":     Regular,
+	"bold":        Bold,
+	"italic":      Italic,
+	"oblique":     Italic,
+	"bolditalic":  BoldItalic,
+	"boldoblique": BoldItalic,
+}
+
+// Family is a TrueType font family. Styles that were not supplied fall back
+// to the regular face.
+type Family struct {
+	Name   string
+	styles map[string][]byte
+	// covers reports whether the family has a glyph for a rune
+	covers func(rune) bool
+}
+
+// newFamily parses the regular face of a family to learn which runes it
+// covers
+func newFamily(name string, styles map[string][]byte) (*Family, error) {
+	regular, ok := styles[Regular]
+	if !ok {
+		return nil, fmt.Errorf("font family %q has no regular face", name)
+	}
+	face, err := sfnt.Parse(regular)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font family %q: %w", name, err)
+	}
+
+	covers := func(r rune) bool {
+		var buf sfnt.Buffer
+		index, err := face.GlyphIndex(&buf, r)
+		return err == nil && index != 0
+	}
+	return &Family{Name: name, styles: styles, covers: covers}, nil
+}
+
+// Face returns the TrueType data of one style of the family
+func (f *Family) Face(style string) []byte {
+	if data, ok := f.styles[style]; ok {
+		return data
+	}
+	return f.styles[Regular]
+}
+
+// Covers reports whether the family can print r
+func (f *Family) Covers(r rune) bool {
+	return f.covers(r)
+}
+
+// Set is an ordered list of font families. Text is printed in the first
+// family that covers it, so the first family is the main Unicode font and
+// the others are fallbacks for scripts it lacks.
+type Set struct {
+	families []*Family
+}
+
+// Bundled returns a set of the families built into the service:
+// BundledFamily, followed by DevanagariFamily
+func Bundled() *Set {
+	return &Set{families: []*Family{
+		bundledFamily(BundledFamily, bundledFiles),
+		bundledFamily(DevanagariFamily, devanagariFiles),
+	}}
+}
+
+// bundledFamily loads a family built into the service from its files
+func bundledFamily(name string, files map[string]string) *Family {
+	styles := make(map[string][]byte, len(files))
+	for style, file := range files {
+		data, err := bundled.ReadFile(file)
+		if err != nil {
+			panic("fonts: bundled font is missing: " + err.Error())
+		}
+		styles[style] = data
+	}
+	family, err := newFamily(name, styles)
+	if err != nil {
+		panic("fonts: bundled font is invalid: " + err.Error())
+	}
+	return family
+}
+
+// NewSetFromEnv loads the fonts in FONT_DIR, or DefaultDir if it is unset,
+// with FONT_FAMILY as the main family; see LoadDir
+func NewSetFromEnv() (*Set, error) {
+	dir := os.Getenv("FONT_DIR")
+	if dir == "" {
+		dir = DefaultDir
+	}
+	return LoadDir(dir, os.Getenv("FONT_FAMILY"))
+}
+
+// LoadDir returns the bundled families plus every .ttf font in dir. Files
+// are grouped into families by name, so NotoSansArabic-Regular.ttf and
+// NotoSansArabic-Bold.ttf are two styles of NotoSansArabic. A family named
+// DevanagariFamily replaces the bundled one, for example to add its bold
+// face. primary names the main family and defaults to BundledFamily; the
+// other families follow, those from dir in name order. A missing dir is
+// not an error.
+func LoadDir(dir, primary string) (*Set, error) {
+	set := Bundled()
+
+	files, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == BundledFamily {
+			return nil, fmt.Errorf("font family %q is built in and cannot be replaced", name)
+		}
+		family, err := newFamily(name, files[name])
+		if err != nil {
+			return nil, err
+		}
+		if i := slices.Index(set.Names(), name); i >= 0 {
+			set.families[i] = family
+			continue
+		}
+		set.families = append(set.families, family)
+	}
+
+	if primary == "" || primary == BundledFamily {
+		return set, nil
+	}
+	for i, family := range set.families {
+		if family.Name == primary {
+			set.families = append([]*Family{family}, append(set.families[:i:i], set.families[i+1:]...)...)
+			return set, nil
+		}
+	}
+	return nil, fmt.Errorf("font family %q not found in %s", primary, dir)
+}
+
+// readDir reads the .ttf files in dir, grouped by family and style
+func readDir(dir string) (map[string]map[string][]byte, error) {
+	files := make(map[string]map[string][]byte)
+	if dir == "" {
+		return files, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".ttf") {
+			continue
+		}
+		name, style := familyStyle(entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font: %w", err)
+		}
+		if files[name] == nil {
+			files[name] = make(map[string][]byte)
+		}
+		if _, ok := files[name][style]; ok {
+			return nil, fmt.Errorf("%s: font family %q already has a face in this style", entry.Name(), name)
+		}
+		files[name][style] = data
+	}
+	return files, nil
+}
+
+// familyStyle splits a font file name into family and style
+func familyStyle(file string) (string, string) {
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		if style, ok := styleSuffixes[strings.ToLower(name[i+1:])]; ok {
+			return name[:i], style
+		}
+	}
+	return name, Regular
+}
+
+// Names returns the names of the families, main family first
+func (s *Set) Names() []string {
+	names := make([]string, len(s.families))
+	for i, family := range s.families {
+		names[i] = family.Name
+	}
+	return names
+}
+
+// Family returns the named family, or nil
+func (s *Set) Family(name string) *Family {
+	for _, family := range s.families {
+		if family.Name == name {
+			return family
+		}
+	}
+	return nil
+}
+
+// Run is a piece of text printed in one font. Family is empty for text that
+// the core fonts can print, in which case Text is encoded in Windows-1252 as
+// gofpdf expects; otherwise Text is UTF-8.
+type Run struct {
+	Family string
+	Text   string
+}
+
+// Split divides text into runs. Text that Windows-1252 can encode is a
+// single core font run so that it looks as it always has; other text is
+// printed in the first family covering each character. Spaces and
+// punctuation stay in the run they are in. missing lists the characters
+// that no family covers; they are printed in the main family.
+func (s *Set) Split(text string) (runs []Run, missing []rune) {
+	if encoded, err := charmap.Windows1252.NewEncoder().String(text); err == nil {
+		return []Run{{Text: encoded}}, nil
+	}
+	return s.SplitUnicode(text)
+}
+
+// SplitUnicode divides text into runs like Split, but prints all of it in
+// the families, which are embedded in documents, and none in the core fonts,
+// which are not
+func (s *Set) SplitUnicode(text string) (runs []Run, missing []rune) {
+	var current *Family
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			runs = append(runs, Run{Family: current.Name, Text: b.String()})
+			b.Reset()
+		}
+	}
+	for _, r := range text {
+		family := s.pick(r, current)
+		if family == nil {
+			missing = append(missing, r)
+			family = s.families[0]
+			if current != nil {
+				family = current
+			}
+		}
+		if family != current {
+			flush()
+			current = family
+		}
+		b.WriteRune(r)
+	}
+	flush()
+	return runs, missing
+}
+
+// pick returns the family to print r in, preferring current for characters
+// shared by all scripts
+func (s *Set) pick(r rune, current *Family) *Family {
+	if current != nil && isShared(r) && current.Covers(r) {
+		return current
+	}
+	for _, family := range s.families {
+		if family.Covers(r) {
+			return family
+		}
+	}
+	return nil
+}
+
+func isShared(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsDigit(r) || unicode.In(r, unicode.Common, unicode.Inherited)
+}
@@ -0,0 +1,176 @@
+package fonts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundled_Coverage(t *testing.T) {
+	family := Bundled().Family(BundledFamily)
+	require.NotNil(t, family)
+
+	for _, r := range "ŁżΓωДжعبשל" {
+		assert.True(t, family.Covers(r), "%c", r)
+	}
+	assert.False(t, family.Covers('अ'))
+
+	for _, style := range []string{Regular, Bold, Italic, BoldItalic} {
+		assert.NotEmpty(t, family.Face(style))
+	}
+
+	// Devanagari is printed in its own bundled family
+	devanagari := Bundled().Family(DevanagariFamily)
+	require.NotNil(t, devanagari)
+	for _, r := range "अनुष्काशर्मा" {
+		assert.True(t, devanagari.Covers(r), "%c", r)
+	}
+	assert.Equal(t, devanagari.Face(Regular), devanagari.Face(Bold))
+	assert.Equal(t, []string{BundledFamily, DevanagariFamily}, Bundled().Names())
+}
+
+func TestSplit(t *testing.T) {
+	set := Bundled()
+
+	tests := []struct {
+		name        string
+		text        string
+		wantRuns    []Run
+		wantMissing []rune
+	}{
+		{"ascii", "John Doe", []Run{{Text: "John Doe"}}, nil},
+		{"windows-1252", "José Müller", []Run{{Text: "Jos\xe9 M\xfcller"}}, nil},
+		{"polish", "Łucja Żółkiewska", []Run{{Family: BundledFamily, Text: "Łucja Żółkiewska"}}, nil},
+		{"greek", "Γιώργος", []Run{{Family: BundledFamily, Text: "Γιώργος"}}, nil},
+		{"cyrillic and arabic", "Дмитрий (محمد)", []Run{{Family: BundledFamily, Text: "Дмитрий (محمد)"}}, nil},
+		{"fallback", "Anna अनुष्का 7", []Run{
+			{Family: BundledFamily, Text: "Anna "},
+			{Family: DevanagariFamily, Text: "अनुष्का 7"},
+		}, nil},
+		{"fallback and back", "अनुष्का (Łucja)", []Run{
+			{Family: DevanagariFamily, Text: "अनुष्का ("},
+			{Family: BundledFamily, Text: "Łucja)"},
+		}, nil},
+		{"missing", "Li 李", []Run{{Family: BundledFamily, Text: "Li 李"}}, []rune{'李'}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, missing := set.Split(tt.text)
+			assert.Equal(t, tt.wantRuns, runs)
+			assert.Equal(t, tt.wantMissing, missing)
+		})
+	}
+}
+
+func TestSplitUnicode(t *testing.T) {
+	set := Bundled()
+
+	// Text the core fonts could print is printed in the main family, in UTF-8
+	runs, missing := set.SplitUnicode("José Müller")
+	assert.Equal(t, []Run{{Family: BundledFamily, Text: "José Müller"}}, runs)
+	assert.Empty(t, missing)
+
+	runs, missing = set.SplitUnicode("Li 李")
+	assert.Equal(t, []Run{{Family: BundledFamily, Text: "Li 李"}}, runs)
+	assert.Equal(t, []rune{'李'}, missing)
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	regular, err := bundled.ReadFile(bundledFiles[Regular])
+	require.NoError(t, err)
+	bold, err := bundled.ReadFile(bundledFiles[Bold])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Extra-Regular.ttf"), regular, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Extra-Bold.ttf"), bold, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Another.ttf"), regular, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a font"), 0o644))
+
+	set, err := LoadDir(dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{BundledFamily, DevanagariFamily, "Another", "Extra"}, set.Names())
+
+	extra := set.Family("Extra")
+	assert.Equal(t, bold, extra.Face(Bold))
+	// Missing styles fall back to the regular face
+	assert.Equal(t, regular, extra.Face(BoldItalic))
+
+	set, err = LoadDir(dir, "Extra")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Extra", BundledFamily, DevanagariFamily, "Another"}, set.Names())
+
+	_, err = LoadDir(dir, "Missing")
+	assert.ErrorContains(t, err, `font family "Missing" not found`)
+
+	set, err = LoadDir(filepath.Join(t.TempDir(), "absent"), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{BundledFamily, DevanagariFamily}, set.Names())
+}
+
+func TestLoadDir_ReplacesDevanagari(t *testing.T) {
+	dir := t.TempDir()
+	regular, err := bundled.ReadFile(devanagariFiles[Regular])
+	require.NoError(t, err)
+	bold, err := bundled.ReadFile(bundledFiles[Bold])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, DevanagariFamily+"-Regular.ttf"), regular, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, DevanagariFamily+"-Bold.ttf"), bold, 0o644))
+
+	set, err := LoadDir(dir, "")
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{BundledFamily, DevanagariFamily}, set.Names())
+	assert.Equal(t, bold, set.Family(DevanagariFamily).Face(Bold))
+}
+
+func TestLoadDir_Rejections(t *testing.T) {
+	regular, err := bundled.ReadFile(bundledFiles[Regular])
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		wantErr string
+	}{
+		{"no regular face", map[string][]byte{"Extra-Bold.ttf": regular}, `font family "Extra" has no regular face`},
+		{"not a font", map[string][]byte{"Extra.ttf": []byte("not a font")}, `failed to parse font family "Extra"`},
+		{"duplicate style", map[string][]byte{"Extra.ttf": regular, "Extra-Regular.ttf": regular}, `already has a face in this style`},
+		{"bundled name", map[string][]byte{BundledFamily + ".ttf": regular}, "is built in"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+			}
+			_, err := LoadDir(dir, "")
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestFamilyStyle(t *testing.T) {
+	tests := []struct {
+		file       string
+		wantFamily string
+		wantStyle  string
+	}{
+		{"NotoSans.ttf", "NotoSans", Regular},
+		{"NotoSans-Regular.ttf", "NotoSans", Regular},
+		{"NotoSans-Bold.TTF", "NotoSans", Bold},
+		{"NotoSans-Oblique.ttf", "NotoSans", Italic},
+		{"NotoSans-BoldItalic.ttf", "NotoSans", BoldItalic},
+		{"Noto-Sans-Arabic.ttf", "Noto-Sans-Arabic", Regular},
+	}
+
+	for _, tt := range tests {
+		family, style := familyStyle(tt.file)
+		assert.Equal(t, tt.wantFamily, family, tt.file)
+		assert.Equal(t, tt.wantStyle, style, tt.file)
+	}
+}
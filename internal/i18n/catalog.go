@@ -0,0 +1,312 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultDir is where NewCatalogsFromEnv looks for additional catalogs
+const DefaultDir = "messages"
+
+// englishDateFormat is how dates are spelled out in English
+const englishDateFormat = "January 2, 2006"
+
+//go:embed messages/*.json
+var bundled embed.FS
+
+// placeholderPattern matches the parts of a message that are filled in when
+// it is printed: template {{field}} placeholders and fmt verbs
+var placeholderPattern = regexp.MustCompile(`\{\{\s*[A-Za-z]+\s*\}\}|%[dsv]`)
+
+// catalogFile is the JSON form of a catalog, named after its language tag,
+// as in pt.json or pt-BR.json
+type catalogFile struct {
+	// DateFormat is a Go time layout such as "2 January 2006"; January is
+	// replaced with the month from Months
+	DateFormat string            `json:"dateFormat"`
+	Months     []string          `json:"months"`
+	Messages   map[string]string `json:"messages"`
+}
+
+// Catalog holds the translations of report text into one language. Messages
+// are keyed by their English text, placeholders included, so templates are
+// written in English and translated as they are printed.
+type Catalog struct {
+	locale     Locale
+	messages   map[string]string
+	dateFormat string
+	months     []string
+}
+
+// newCatalog returns an empty catalog that prints dates in English
+func newCatalog(locale Locale) *Catalog {
+	return &Catalog{locale: locale, messages: make(map[string]string), dateFormat: englishDateFormat}
+}
+
+// Locale returns the language of the catalog
+func (c *Catalog) Locale() Locale {
+	return c.locale
+}
+
+// Message returns the translation of msg. English messages translate to
+// themselves unless a catalog rewords them.
+func (c *Catalog) Message(msg string) (string, bool) {
+	if translated, ok := c.messages[msg]; ok {
+		return translated, true
+	}
+	return msg, c.isEnglish()
+}
+
+// FormatDate spells out a date in the catalog's language
+func (c *Catalog) FormatDate(t time.Time) string {
+	if len(c.months) == 0 {
+		return t.Format(c.dateFormat)
+	}
+	// Go only knows English month names, so format around a marker and put
+	// the translated name in its place
+	layout := strings.ReplaceAll(c.dateFormat, "January", "\x00")
+	return strings.ReplaceAll(t.Format(layout), "\x00", c.months[t.Month()-1])
+}
+
+func (c *Catalog) isEnglish() bool {
+	base, _ := c.locale.tag.Base()
+	return base.String() == "en"
+}
+
+// merge adds a catalog file's messages and date format to c
+func (c *Catalog) merge(name string, data []byte) error {
+	var file catalogFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if len(file.Months) != 0 && len(file.Months) != 12 {
+		return fmt.Errorf("%s: months must list all 12 months, got %d", name, len(file.Months))
+	}
+	if len(file.Months) != 0 && file.DateFormat == "" {
+		return fmt.Errorf("%s: months require a dateFormat", name)
+	}
+	for msg, translated := range file.Messages {
+		if want, got := placeholders(msg), placeholders(translated); !slices.Equal(want, got) {
+			return fmt.Errorf("%s: translation of %q must keep the placeholders %v, got %v", name, msg, want, got)
+		}
+		c.messages[msg] = translated
+	}
+	if file.DateFormat != "" {
+		c.dateFormat, c.months = file.DateFormat, file.Months
+	}
+	return nil
+}
+
+// placeholders returns the sorted placeholders of a message
+func placeholders(msg string) []string {
+	found := placeholderPattern.FindAllString(msg, -1)
+	for i, p := range found {
+		found[i] = strings.Join(strings.Fields(p), "")
+	}
+	sort.Strings(found)
+	return found
+}
+
+// Catalogs are the languages reports can be translated into. English is
+// always available.
+type Catalogs struct {
+	catalogs []*Catalog
+	matcher  language.Matcher
+}
+
+// Bundled returns the catalogs built into the service
+func Bundled() *Catalogs {
+	catalogs, err := load(nil, "")
+	if err != nil {
+		panic("i18n: bundled catalog is invalid: " + err.Error())
+	}
+	return catalogs
+}
+
+// NewCatalogsFromEnv loads the catalogs in MESSAGE_DIR, or DefaultDir if it
+// is unset; see LoadDir
+func NewCatalogsFromEnv() (*Catalogs, error) {
+	dir := os.Getenv("MESSAGE_DIR")
+	if dir == "" {
+		dir = DefaultDir
+	}
+	return LoadDir(dir)
+}
+
+// LoadDir returns the bundled catalogs plus every .json catalog in dir. A
+// file for a bundled language adds to and overrides its messages. A missing
+// dir is not an error.
+func LoadDir(dir string) (*Catalogs, error) {
+	if dir == "" {
+		return load(nil, "")
+	}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return load(nil, "")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read message directory: %w", err)
+	}
+	return load(os.DirFS(dir), dir)
+}
+
+// load reads the bundled catalogs followed by the ones in fsys
+func load(fsys fs.FS, dir string) (*Catalogs, error) {
+	catalogs := map[string]*Catalog{"en": newCatalog(English)}
+	read := func(fsys fs.FS, pattern, dir string) error {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			lang := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+			locale, err := Parse(lang)
+			if err != nil {
+				return fmt.Errorf("%s: file name must be a language tag such as pt or pt-BR", filepath.Join(dir, name))
+			}
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return fmt.Errorf("failed to read message catalog: %w", err)
+			}
+			key := locale.String()
+			if catalogs[key] == nil {
+				catalogs[key] = newCatalog(locale)
+			}
+			if err := catalogs[key].merge(filepath.Join(dir, name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := read(bundled, "messages/*.json", ""); err != nil {
+		return nil, err
+	}
+	if fsys != nil {
+		if err := read(fsys, "*.json", dir); err != nil {
+			return nil, err
+		}
+	}
+
+	// English comes first so that the matcher falls back to it
+	keys := make([]string, 0, len(catalogs))
+	for key := range catalogs {
+		if key != "en" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	set := &Catalogs{catalogs: []*Catalog{catalogs["en"]}}
+	for _, key := range keys {
+		set.catalogs = append(set.catalogs, catalogs[key])
+	}
+	tags := make([]language.Tag, len(set.catalogs))
+	for i, catalog := range set.catalogs {
+		tags[i] = catalog.locale.tag
+	}
+	set.matcher = language.NewMatcher(tags)
+	return set, nil
+}
+
+// Languages returns the language tags of the catalogs, English first
+func (c *Catalogs) Languages() []string {
+	languages := make([]string, len(c.catalogs))
+	for i, catalog := range c.catalogs {
+		languages[i] = catalog.locale.String()
+	}
+	return languages
+}
+
+// Catalog returns the catalog that best matches locale, such as pt for
+// pt-BR. A language with no catalog gets an empty one, so that all of its
+// text is printed in English and reported as untranslated.
+func (c *Catalogs) Catalog(locale Locale) *Catalog {
+	if catalog, ok := c.match(locale.tag); ok {
+		return catalog
+	}
+	return newCatalog(locale)
+}
+
+// Negotiate returns the locale of the catalog that best matches an
+// Accept-Language header, or English if none does
+func (c *Catalogs) Negotiate(acceptLanguage string) Locale {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return English
+	}
+	if catalog, ok := c.match(tags...); ok {
+		return catalog.locale
+	}
+	return English
+}
+
+func (c *Catalogs) match(tags ...language.Tag) (*Catalog, bool) {
+	_, index, confidence := c.matcher.Match(tags...)
+	if confidence == language.No {
+		return nil, false
+	}
+	return c.catalogs[index], true
+}
+
+// Translator translates the text of one report and remembers the messages
+// its catalog lacks
+type Translator struct {
+	catalog *Catalog
+	missing map[string]bool
+}
+
+// NewTranslator returns a translator that uses catalog
+func NewTranslator(catalog *Catalog) *Translator {
+	return &Translator{catalog: catalog, missing: make(map[string]bool)}
+}
+
+// Locale returns the language text is translated into
+func (t *Translator) Locale() Locale {
+	return t.catalog.locale
+}
+
+// Text returns the translation of msg, or msg itself if it has none. Text
+// without letters, such as a lone placeholder, needs no translation.
+func (t *Translator) Text(msg string) string {
+	if !hasWords(msg) {
+		return msg
+	}
+	translated, ok := t.catalog.Message(msg)
+	if !ok {
+		t.missing[msg] = true
+	}
+	return translated
+}
+
+// FormatDate spells out a date in the translator's language
+func (t *Translator) FormatDate(date time.Time) string {
+	return t.catalog.FormatDate(date)
+}
+
+// Missing returns the untranslated messages seen since it was last called,
+// in order
+func (t *Translator) Missing() []string {
+	missing := make([]string, 0, len(t.missing))
+	for msg := range t.missing {
+		missing = append(missing, msg)
+	}
+	clear(t.missing)
+	sort.Strings(missing)
+	return missing
+}
+
+// hasWords reports whether msg has letters outside its placeholders
+func hasWords(msg string) bool {
+	return strings.IndexFunc(placeholderPattern.ReplaceAllString(msg, ""), unicode.IsLetter) >= 0
+}
@@ -0,0 +1,168 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, tag string) Locale {
+	t.Helper()
+	locale, err := Parse(tag)
+	require.NoError(t, err)
+	return locale
+}
+
+func TestBundled_Catalogs(t *testing.T) {
+	catalogs := Bundled()
+	assert.Equal(t, []string{"en", "ar", "es", "fr", "he", "pt"}, catalogs.Languages())
+
+	// Every bundled language translates every message the others do
+	reference := catalogs.catalogs[1].messages
+	for _, catalog := range catalogs.catalogs[1:] {
+		assert.Len(t, catalog.messages, len(reference), catalog.locale.String())
+		for msg := range reference {
+			_, ok := catalog.Message(msg)
+			assert.True(t, ok, "%s lacks %q", catalog.locale, msg)
+		}
+	}
+}
+
+func TestCatalogs_Catalog(t *testing.T) {
+	catalogs := Bundled()
+	date := time.Date(2008, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		tag    string
+		want   string
+		report string
+		date   string
+	}{
+		{"en", "en", "STUDENT REPORT", "March 15, 2008"},
+		{"en-GB", "en", "STUDENT REPORT", "March 15, 2008"},
+		{"pt-BR", "pt", "RELATÓRIO DO ALUNO", "15 de março de 2008"},
+		{"es", "es", "INFORME DEL ESTUDIANTE", "15 de marzo de 2008"},
+		{"fr", "fr", "BULLETIN DE L'ÉLÈVE", "15 mars 2008"},
+		{"ar-EG", "ar", "تقرير الطالب", "15 مارس 2008"},
+		{"he", "he", "דוח תלמיד", "15 במרץ 2008"},
+		// No catalog: English text, reported as missing
+		{"de", "de", "STUDENT REPORT", "March 15, 2008"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			catalog := catalogs.Catalog(mustParse(t, tt.tag))
+			assert.Equal(t, tt.want, catalog.Locale().String())
+			report, _ := catalog.Message("STUDENT REPORT")
+			assert.Equal(t, tt.report, report)
+			assert.Equal(t, tt.date, catalog.FormatDate(date))
+		})
+	}
+}
+
+func TestCatalogs_Negotiate(t *testing.T) {
+	catalogs := Bundled()
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"pt-BR,pt;q=0.9,en;q=0.8", "pt"},
+		{"de-DE,fr;q=0.7", "fr"},
+		{"de-DE", "en"},
+		{"he-IL", "he"},
+		{"not a header!", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, catalogs.Negotiate(tt.header).String())
+		})
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	tr := NewTranslator(Bundled().Catalog(mustParse(t, "es")))
+
+	assert.Equal(t, "Generado el: {{generatedOn}}", tr.Text("Generated on: {{generatedOn}}"))
+	assert.Equal(t, "Custom label:", tr.Text("Custom label:"))
+	assert.Equal(t, "{{name}}", tr.Text("{{name}}"))
+	assert.Equal(t, "42 - 7", tr.Text("42 - 7"))
+	assert.Equal(t, "Custom label:", tr.Text("Custom label:"))
+	assert.Equal(t, "Other", tr.Text("Other"))
+
+	assert.Equal(t, []string{"Custom label:", "Other"}, tr.Missing())
+	assert.Empty(t, tr.Missing())
+
+	// English never reports missing messages
+	english := NewTranslator(Bundled().Catalog(English))
+	assert.Equal(t, "Custom label:", english.Text("Custom label:"))
+	assert.Empty(t, english.Missing())
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("de.json", `{"dateFormat": "2. January 2006", "months": ["Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"], "messages": {"STUDENT REPORT": "SCHÜLERBERICHT"}}`)
+	write("pt.json", `{"messages": {"STUDENT REPORT": "BOLETIM"}}`)
+	write("en.json", `{"messages": {"School Management System": "Springfield High"}}`)
+	write("notes.txt", "ignored")
+
+	catalogs, err := LoadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"en", "ar", "de", "es", "fr", "he", "pt"}, catalogs.Languages())
+
+	german := catalogs.Catalog(mustParse(t, "de-AT"))
+	report, ok := german.Message("STUDENT REPORT")
+	assert.True(t, ok)
+	assert.Equal(t, "SCHÜLERBERICHT", report)
+	assert.Equal(t, "15. März 2008", german.FormatDate(time.Date(2008, 3, 15, 0, 0, 0, 0, time.UTC)))
+
+	// Files for bundled languages override single messages
+	portuguese := catalogs.Catalog(mustParse(t, "pt"))
+	report, _ = portuguese.Message("STUDENT REPORT")
+	assert.Equal(t, "BOLETIM", report)
+	name, _ := portuguese.Message("Full Name:")
+	assert.Equal(t, "Nome completo:", name)
+	assert.Equal(t, "15 de março de 2008", portuguese.FormatDate(time.Date(2008, 3, 15, 0, 0, 0, 0, time.UTC)))
+
+	school, _ := catalogs.Catalog(English).Message("School Management System")
+	assert.Equal(t, "Springfield High", school)
+
+	_, err = LoadDir(filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+}
+
+func TestLoadDir_Rejections(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"invalid json", "de.json", `{"messages": `, "de.json: unexpected end of JSON input"},
+		{"invalid name", "german.json", `{}`, "german.json: file name must be a language tag"},
+		{"months", "de.json", `{"dateFormat": "2 January 2006", "months": ["Januar"]}`, "months must list all 12 months, got 1"},
+		{"months without format", "de.json", `{"months": ["1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"]}`, "months require a dateFormat"},
+		{"placeholders", "de.json", `{"messages": {"Generated on: {{generatedOn}}": "Erstellt am: {{date}}"}}`, `translation of "Generated on: {{generatedOn}}" must keep the placeholders [{{generatedOn}}], got [{{date}}]`},
+		{"verbs", "de.json", `{"messages": {"Student %d: %s (%s)": "Schüler %d: %s"}}`, "must keep the placeholders [%d %s %s], got [%d %s]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0o644))
+
+			_, err := LoadDir(dir)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
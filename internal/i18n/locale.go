@@ -0,0 +1,48 @@
+// Package i18n holds the locales reports can be written in and the message
+// catalogs that translate their text.
+package i18n
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+// Locale is the language and region a report is written for
+type Locale struct {
+	tag language.Tag
+}
+
+// English is the default locale
+var English = Locale{tag: language.English}
+
+// rtlScripts are the scripts written from right to left
+var rtlScripts = map[string]bool{
+	"Adlm": true, // Adlam
+	"Arab": true, // Arabic, Persian, Urdu
+	"Hebr": true, // Hebrew, Yiddish
+	"Nkoo": true, // N'Ko
+	"Rohg": true, // Hanifi Rohingya
+	"Syrc": true, // Syriac
+	"Thaa": true, // Thaana (Dhivehi)
+}
+
+// Parse returns the locale for a BCP 47 language tag such as "ar" or "he-IL"
+func Parse(s string) (Locale, error) {
+	tag, err := language.Parse(s)
+	if err != nil {
+		return Locale{}, fmt.Errorf("invalid language tag %q", s)
+	}
+	return Locale{tag: tag}, nil
+}
+
+// String returns the BCP 47 tag of the locale
+func (l Locale) String() string {
+	return l.tag.String()
+}
+
+// RTL reports whether the locale's language is written right to left
+func (l Locale) RTL() bool {
+	script, _ := l.tag.Script()
+	return rtlScripts[script.String()]
+}
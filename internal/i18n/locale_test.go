@@ -0,0 +1,39 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    string
+		wantRTL bool
+	}{
+		{"en", "en", false},
+		{"pt-BR", "pt-BR", false},
+		{"ar", "ar", true},
+		{"ar-EG", "ar-EG", true},
+		{"he", "he", true},
+		{"fa", "fa", true},
+		{"ur", "ur", true},
+		{"az-Arab", "az-Arab", true},
+		{"ru", "ru", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			locale, err := Parse(tt.tag)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, locale.String())
+			assert.Equal(t, tt.wantRTL, locale.RTL())
+		})
+	}
+
+	_, err := Parse("not a tag!")
+	assert.Error(t, err)
+	assert.False(t, English.RTL())
+}
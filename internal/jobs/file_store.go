@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"pdf-generator/internal/atomicfile"
+)
+
+const (
+	jobFileExt    = ".json"
+	resultFileExt = ".result"
+)
+
+// FileStore keeps each job as a JSON file next to its result, so jobs survive
+// restarts. Files are written to a temporary name and renamed into place so a
+// crash never leaves a partially written job behind.
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewFileStore creates a store in dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) jobPath(id string) string {
+	return filepath.Join(s.dir, id+jobFileExt)
+}
+
+func (s *FileStore) resultPath(id string) string {
+	return filepath.Join(s.dir, id+resultFileExt)
+}
+
+func (s *FileStore) Save(_ context.Context, job *Job) error {
+	if !validID(job.ID) {
+		return fmt.Errorf("invalid job ID %q", job.ID)
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeFile(s.jobPath(job.ID), data)
+}
+
+func (s *FileStore) Get(_ context.Context, id string) (*Job, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readJob(s.jobPath(id))
+}
+
+func (s *FileStore) List(_ context.Context) ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	var jobs []*Job
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), jobFileExt)
+		if !ok || !validID(id) {
+			continue
+		}
+		job, err := s.readJob(filepath.Join(s.dir, entry.Name()))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *FileStore) Delete(_ context.Context, id string) error {
+	if !validID(id) {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range []string{s.resultPath(id), s.jobPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete job: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) SaveResult(_ context.Context, id string, data []byte) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.jobPath(id)); err != nil {
+		return ErrNotFound
+	}
+	return s.writeFile(s.resultPath(id), data)
+}
+
+func (s *FileStore) OpenResult(_ context.Context, id string) (io.ReadCloser, int64, error) {
+	if !validID(id) {
+		return nil, 0, ErrNoResult
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	file, err := os.Open(s.resultPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrNoResult
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open job result: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to open job result: %w", err)
+	}
+	return file, info.Size(), nil
+}
+
+// readJob decodes one job file
+func (s *FileStore) readJob(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", filepath.Base(path), err)
+	}
+	return &job, nil
+}
+
+// writeFile atomically replaces path with data
+func (s *FileStore) writeFile(path string, data []byte) error {
+	if err := atomicfile.WriteFile(path, data); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	return nil
+}
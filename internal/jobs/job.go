@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"pdf-generator/internal/watermark"
+	"pdf-generator/internal/webhook"
+)
+
+// Status is the lifecycle state of a report job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+var (
+	// ErrNotFound is returned for unknown or expired jobs
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueFull is returned when a job cannot be queued
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrNoResult is returned when a job has no stored result yet
+	ErrNoResult = errors.New("job has no result")
+)
+
+// Callback delivery states
+const (
+	CallbackPending   = "pending"
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed"
+)
+
+// Callback is a URL notified when a job finishes, with a record of every
+// delivery attempt
+type Callback struct {
+	URL      string            `json:"url"`
+	Status   string            `json:"status"`
+	Attempts []webhook.Attempt `json:"attempts,omitempty"`
+}
+
+// Request describes a job to submit
+type Request struct {
+	StudentIDs []int
+	Format     string
+	// Template and TemplateVersion select the report layout
+	Template        string
+	TemplateVersion int
+	// Locale is the language tag of the reports
+	Locale string
+	// Protection is how the reports are encrypted, or empty for not at all
+	Protection string
+	// Watermark is printed over every page of the reports, or nil for none
+	Watermark *watermark.Watermark
+	// PDFA writes the reports as PDF/A-2b
+	PDFA bool
+	// CallbackURL is optional; see Callback
+	CallbackURL string
+}
+
+// Progress counts the students a job has processed
+type Progress struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+}
+
+// Job is a report generation request that runs in the background. Jobs are
+// stored as JSON so that they can be resumed after a restart.
+type Job struct {
+	ID         string `json:"id"`
+	Status     Status `json:"status"`
+	StudentIDs []int  `json:"studentIds"`
+	Format     string `json:"format"`
+	Template   string `json:"template,omitempty"`
+	// TemplateVersion pins the layout version active when the job was
+	// created, so that activating another version does not affect it
+	TemplateVersion int                  `json:"templateVersion,omitempty"`
+	Locale          string               `json:"locale,omitempty"`
+	Protection      string               `json:"protection,omitempty"`
+	Watermark       *watermark.Watermark `json:"watermark,omitempty"`
+	PDFA            bool                 `json:"pdfa,omitempty"`
+	Progress        Progress             `json:"progress"`
+	// Error is set for failed jobs and is safe to show to end users
+	Error string `json:"error,omitempty"`
+	// ContentType and Filename describe the result of a succeeded job
+	ContentType string `json:"contentType,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	// Callback is set if the creator asked to be notified
+	Callback *Callback `json:"callback,omitempty"`
+	// RequestID is the ID of the request that created the job, used to
+	// correlate the job's logs
+	RequestID string    `json:"requestId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Finished reports whether the job has succeeded or failed
+func (j *Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Expired reports whether the job's TTL has passed
+func (j *Job) Expired(now time.Time) bool {
+	return !j.ExpiresAt.IsZero() && !now.Before(j.ExpiresAt)
+}
+
+// clone returns a copy that shares no memory with the job
+func (j *Job) clone() *Job {
+	c := *j
+	c.StudentIDs = append([]int(nil), j.StudentIDs...)
+	if j.Callback != nil {
+		callback := *j.Callback
+		callback.Attempts = append([]webhook.Attempt(nil), j.Callback.Attempts...)
+		c.Callback = &callback
+	}
+	return &c
+}
+
+// newID generates a random job ID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validID reports whether id could have been produced by newID, so that
+// IDs taken from URLs are never used to build file paths
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,422 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"pdf-generator/internal/envconfig"
+	"pdf-generator/internal/logging"
+	"pdf-generator/internal/webhook"
+)
+
+const (
+	// DefaultConcurrency is how many jobs run at once
+	DefaultConcurrency = 2
+	// DefaultQueueSize is how many jobs may wait for a worker
+	DefaultQueueSize = 100
+	// DefaultTTL is how long a job and its result are kept
+	DefaultTTL = 24 * time.Hour
+)
+
+// Config controls the worker pool and job expiry
+type Config struct {
+	Concurrency int
+	QueueSize   int
+	// TTL is counted from when a job is created and restarted when it finishes
+	TTL time.Duration
+}
+
+// NewConfigFromEnv reads the job configuration from JOB_CONCURRENCY,
+// JOB_QUEUE_SIZE and JOB_TTL
+func NewConfigFromEnv() Config {
+	return Config{
+		Concurrency: envconfig.Int("JOB_CONCURRENCY", DefaultConcurrency, 1),
+		QueueSize:   envconfig.Int("JOB_QUEUE_SIZE", DefaultQueueSize, 1),
+		TTL:         envconfig.Duration("JOB_TTL", DefaultTTL, time.Nanosecond),
+	}
+}
+
+// Result is the output of a succeeded job
+type Result struct {
+	Data        []byte
+	ContentType string
+	Filename    string
+}
+
+// RunFunc generates the output of a job. progress may be called from any
+// goroutine with the number of students processed so far. The message of a
+// returned error is stored on the job and must be safe to show to end users.
+type RunFunc func(ctx context.Context, job *Job, progress func(completed int)) (*Result, error)
+
+// Notifier delivers the callback of a finished job, calling record after
+// every delivery attempt
+type Notifier func(ctx context.Context, job *Job, record func(webhook.Attempt)) error
+
+// Manager queues jobs in a store and runs them on a pool of workers
+type Manager struct {
+	store  Store
+	run    RunFunc
+	notify Notifier
+	config Config
+	queue  chan string
+	now    func() time.Time
+
+	// mu serializes read-modify-write cycles on stored jobs
+	mu sync.Mutex
+	wg sync.WaitGroup
+}
+
+// NewManager creates a manager that runs jobs with run. Call Start before
+// submitting jobs.
+func NewManager(store Store, run RunFunc, config Config) *Manager {
+	if config.Concurrency < 1 {
+		config.Concurrency = DefaultConcurrency
+	}
+	if config.QueueSize < 1 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultTTL
+	}
+
+	return &Manager{
+		store:  store,
+		run:    run,
+		config: config,
+		queue:  make(chan string, config.QueueSize),
+		now:    time.Now,
+	}
+}
+
+// SetNotifier sets how callbacks are delivered; call it before Start.
+// Without a notifier, callbacks stay pending.
+func (m *Manager) SetNotifier(notify Notifier) {
+	m.notify = notify
+}
+
+// Start requeues jobs left unfinished by a previous process and starts the
+// workers and the expiry sweeper. They stop when ctx is done; jobs and
+// callbacks interrupted that way are resumed by the next Start.
+func (m *Manager) Start(ctx context.Context) error {
+	pending, err := m.resume(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range pending {
+		m.deliverCallback(ctx, job)
+	}
+
+	for i := 0; i < m.config.Concurrency; i++ {
+		m.wg.Add(1)
+		go m.worker(ctx)
+	}
+	m.wg.Add(1)
+	go m.sweeper(ctx)
+
+	slog.InfoContext(ctx, "Report job workers started", "concurrency", m.config.Concurrency, "queue_size", m.config.QueueSize, "ttl", m.config.TTL)
+	return nil
+}
+
+// Wait blocks until the workers started by Start have stopped
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Submit stores a new job and queues it
+func (m *Manager) Submit(ctx context.Context, req Request) (*Job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate job ID: %w", err)
+	}
+
+	now := m.now()
+	job := &Job{
+		ID:              id,
+		Status:          StatusQueued,
+		StudentIDs:      req.StudentIDs,
+		Format:          req.Format,
+		Template:        req.Template,
+		TemplateVersion: req.TemplateVersion,
+		Locale:          req.Locale,
+		Protection:      req.Protection,
+		Watermark:       req.Watermark,
+		PDFA:            req.PDFA,
+		Progress:        Progress{Total: len(req.StudentIDs)},
+		RequestID:       logging.RequestID(ctx),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		ExpiresAt:       now.Add(m.config.TTL),
+	}
+	if req.CallbackURL != "" {
+		job.Callback = &Callback{URL: req.CallbackURL, Status: CallbackPending}
+	}
+	if err := m.store.Save(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+
+	select {
+	case m.queue <- id:
+	default:
+		if err := m.store.Delete(ctx, id); err != nil {
+			slog.WarnContext(ctx, "Failed to delete rejected job", "job_id", id, "error", err)
+		}
+		return nil, ErrQueueFull
+	}
+
+	slog.InfoContext(ctx, "Report job queued", "job_id", id, "students", len(req.StudentIDs), "format", req.Format, "callback", job.Callback != nil)
+	return job, nil
+}
+
+// Get returns a job, treating expired jobs as not found
+func (m *Manager) Get(ctx context.Context, id string) (*Job, error) {
+	job, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Expired(m.now()) && job.Status != StatusRunning {
+		return nil, ErrNotFound
+	}
+	return job, nil
+}
+
+// OpenResult returns a reader for a succeeded job's output and its size
+func (m *Manager) OpenResult(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	return m.store.OpenResult(ctx, id)
+}
+
+// Sweep deletes expired jobs and their results, returning how many were
+// removed. Running jobs are never removed.
+func (m *Manager) Sweep(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs, err := m.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := m.now()
+	removed := 0
+	for _, job := range jobs {
+		if job.Status == StatusRunning || !job.Expired(now) {
+			continue
+		}
+		if err := m.store.Delete(ctx, job.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// resume requeues queued and interrupted jobs, oldest first, and returns the
+// finished jobs whose callbacks have not been delivered
+func (m *Manager) resume(ctx context.Context) ([]*Job, error) {
+	if _, err := m.Sweep(ctx); err != nil {
+		return nil, fmt.Errorf("failed to remove expired jobs: %w", err)
+	}
+
+	jobs, err := m.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	var pending []*Job
+	resumed := 0
+	for _, job := range jobs {
+		if job.Finished() {
+			if job.Callback != nil && job.Callback.Status == CallbackPending {
+				pending = append(pending, job)
+			}
+			continue
+		}
+
+		select {
+		case m.queue <- job.ID:
+			_, err = m.update(ctx, job.ID, func(job *Job) {
+				job.Status = StatusQueued
+				job.Progress.Completed = 0
+			})
+			resumed++
+		default:
+			_, err = m.update(ctx, job.ID, func(job *Job) {
+				job.Status = StatusFailed
+				job.Error = "job could not be resumed after a restart"
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resume job %s: %w", job.ID, err)
+		}
+	}
+
+	if resumed > 0 {
+		slog.InfoContext(ctx, "Resumed report jobs", "count", resumed)
+	}
+	return pending, nil
+}
+
+func (m *Manager) worker(ctx context.Context) {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-m.queue:
+			// select picks at random when both are ready; a job dequeued
+			// during shutdown stays queued in the store for the next Start
+			if ctx.Err() != nil {
+				return
+			}
+			m.process(ctx, id)
+		}
+	}
+}
+
+// process runs one job and records its outcome
+func (m *Manager) process(ctx context.Context, id string) {
+	job, err := m.update(ctx, id, func(job *Job) { job.Status = StatusRunning })
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to start report job", "job_id", id, "error", err)
+		return
+	}
+
+	if job.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, job.RequestID)
+	}
+	start := m.now()
+	slog.InfoContext(ctx, "Running report job", "job_id", id, "students", len(job.StudentIDs), "format", job.Format)
+
+	result, runErr := m.run(ctx, job, func(completed int) {
+		_, err := m.update(ctx, id, func(job *Job) {
+			if completed > job.Progress.Completed {
+				job.Progress.Completed = completed
+			}
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to record report job progress", "job_id", id, "error", err)
+		}
+	})
+
+	if ctx.Err() != nil {
+		slog.InfoContext(ctx, "Report job interrupted; it will be resumed on restart", "job_id", id)
+		return
+	}
+
+	errorMessage := ""
+	if runErr != nil {
+		errorMessage = runErr.Error()
+	} else if err := m.store.SaveResult(ctx, id, result.Data); err != nil {
+		slog.ErrorContext(ctx, "Failed to store report job result", "job_id", id, "error", err)
+		errorMessage = "report could not be stored"
+	}
+
+	job, err = m.update(ctx, id, func(job *Job) {
+		job.ExpiresAt = m.now().Add(m.config.TTL)
+		if errorMessage != "" {
+			job.Status = StatusFailed
+			job.Error = errorMessage
+			return
+		}
+		job.Status = StatusSucceeded
+		job.Progress.Completed = job.Progress.Total
+		job.ContentType = result.ContentType
+		job.Filename = result.Filename
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record report job outcome", "job_id", id, "error", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Report job finished", "job_id", id, "status", job.Status, "duration", m.now().Sub(start))
+
+	if job.Callback != nil {
+		m.deliverCallback(ctx, job)
+	}
+}
+
+// deliverCallback notifies a finished job's callback URL in the background,
+// recording each attempt and the final outcome on the job
+func (m *Manager) deliverCallback(ctx context.Context, job *Job) {
+	if m.notify == nil {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		err := m.notify(ctx, job, func(attempt webhook.Attempt) {
+			_, err := m.update(ctx, job.ID, func(job *Job) {
+				if job.Callback != nil {
+					job.Callback.Attempts = append(job.Callback.Attempts, attempt)
+				}
+			})
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to record callback attempt", "job_id", job.ID, "error", err)
+			}
+		})
+		if ctx.Err() != nil {
+			// Still pending, so the next Start delivers it
+			return
+		}
+
+		status := CallbackDelivered
+		if err != nil {
+			status = CallbackFailed
+			slog.ErrorContext(ctx, "Report job callback failed", "job_id", job.ID, "error", err)
+		}
+		if _, err := m.update(ctx, job.ID, func(job *Job) {
+			if job.Callback != nil {
+				job.Callback.Status = status
+			}
+		}); err != nil {
+			slog.WarnContext(ctx, "Failed to record callback outcome", "job_id", job.ID, "error", err)
+		}
+	}()
+}
+
+// update applies fn to the stored job and saves it
+func (m *Manager) update(ctx context.Context, id string, fn func(job *Job)) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	fn(job)
+	job.UpdatedAt = m.now()
+	if err := m.store.Save(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// sweeper periodically removes expired jobs
+func (m *Manager) sweeper(ctx context.Context) {
+	defer m.wg.Done()
+
+	interval := min(max(m.config.TTL/10, time.Second), time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := m.Sweep(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to remove expired report jobs", "error", err)
+			} else if removed > 0 {
+				slog.InfoContext(ctx, "Removed expired report jobs", "count", removed)
+			}
+		}
+	}
+}
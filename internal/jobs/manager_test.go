@@ -0,0 +1,329 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/webhook"
+)
+
+// startManager starts a manager whose workers stop when the test ends
+func startManager(t *testing.T, store Store, run RunFunc, config Config) *Manager {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewManager(store, run, config)
+	require.NoError(t, m.Start(ctx))
+	t.Cleanup(func() {
+		cancel()
+		m.Wait()
+	})
+	return m
+}
+
+// waitForJob polls until the job is finished
+func waitForJob(t *testing.T, m *Manager, id string) *Job {
+	t.Helper()
+	var job *Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = m.Get(context.Background(), id)
+		return err == nil && job.Finished()
+	}, 5*time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestManager_RunsJobToCompletion(t *testing.T) {
+	m := startManager(t, NewMemoryStore(), func(ctx context.Context, job *Job, progress func(int)) (*Result, error) {
+		for i := range job.StudentIDs {
+			progress(i + 1)
+		}
+		return &Result{Data: []byte("%PDF"), ContentType: "application/pdf", Filename: "report.pdf"}, nil
+	}, Config{Concurrency: 2})
+
+	job, err := m.Submit(context.Background(), Request{StudentIDs: []int{1, 2, 3}, Format: "pdf"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, job.Status)
+	assert.Equal(t, Progress{Total: 3}, job.Progress)
+
+	done := waitForJob(t, m, job.ID)
+	assert.Equal(t, StatusSucceeded, done.Status)
+	assert.Equal(t, Progress{Completed: 3, Total: 3}, done.Progress)
+	assert.Equal(t, "application/pdf", done.ContentType)
+	assert.Equal(t, "report.pdf", done.Filename)
+	assert.Empty(t, done.Error)
+
+	reader, size, err := m.OpenResult(context.Background(), job.ID)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF", string(data))
+	assert.Equal(t, int64(4), size)
+}
+
+func TestManager_ReportsProgressWhileRunning(t *testing.T) {
+	release := make(chan struct{})
+	m := startManager(t, NewMemoryStore(), func(ctx context.Context, job *Job, progress func(int)) (*Result, error) {
+		progress(1)
+		<-release
+		return &Result{Data: []byte("%PDF")}, nil
+	}, Config{Concurrency: 1})
+
+	job, err := m.Submit(context.Background(), Request{StudentIDs: []int{1, 2}, Format: "zip"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		current, err := m.Get(context.Background(), job.ID)
+		return err == nil && current.Status == StatusRunning && current.Progress.Completed == 1
+	}, 5*time.Second, 5*time.Millisecond)
+
+	close(release)
+	assert.Equal(t, StatusSucceeded, waitForJob(t, m, job.ID).Status)
+}
+
+func TestManager_RecordsFailure(t *testing.T) {
+	m := startManager(t, NewMemoryStore(), func(ctx context.Context, job *Job, progress func(int)) (*Result, error) {
+		return nil, errors.New("student not found")
+	}, Config{})
+
+	job, err := m.Submit(context.Background(), Request{StudentIDs: []int{7}, Format: "pdf"})
+	require.NoError(t, err)
+
+	done := waitForJob(t, m, job.ID)
+	assert.Equal(t, StatusFailed, done.Status)
+	assert.Equal(t, "student not found", done.Error)
+
+	_, _, err = m.OpenResult(context.Background(), job.ID)
+	assert.ErrorIs(t, err, ErrNoResult)
+}
+
+func TestManager_BoundsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	m := startManager(t, NewMemoryStore(), func(ctx context.Context, job *Job, progress func(int)) (*Result, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &Result{}, nil
+	}, Config{Concurrency: 2})
+
+	var ids []string
+	for i := 0; i < 6; i++ {
+		job, err := m.Submit(context.Background(), Request{StudentIDs: []int{i + 1}, Format: "pdf"})
+		require.NoError(t, err)
+		ids = append(ids, job.ID)
+	}
+	for _, id := range ids {
+		waitForJob(t, m, id)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, peak)
+}
+
+func TestManager_QueueFull(t *testing.T) {
+	store := NewMemoryStore()
+	// Not started, so nothing drains the queue
+	m := NewManager(store, nil, Config{QueueSize: 1})
+
+	_, err := m.Submit(context.Background(), Request{StudentIDs: []int{1}, Format: "pdf"})
+	require.NoError(t, err)
+	_, err = m.Submit(context.Background(), Request{StudentIDs: []int{2}, Format: "pdf"})
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	jobs, err := store.List(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1, "rejected job must not be stored")
+}
+
+func TestManager_ExpiresJobsAfterTTL(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewManager(store, nil, Config{TTL: time.Hour})
+	m.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	job, err := m.Submit(ctx, Request{StudentIDs: []int{1}, Format: "pdf"})
+	require.NoError(t, err)
+	_, err = m.update(ctx, job.ID, func(job *Job) { job.Status = StatusSucceeded })
+	require.NoError(t, err)
+	require.NoError(t, store.SaveResult(ctx, job.ID, []byte("%PDF")))
+
+	now = now.Add(59 * time.Minute)
+	_, err = m.Get(ctx, job.ID)
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = m.Get(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	removed, err := m.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, _, err = store.OpenResult(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrNoResult)
+}
+
+func TestManager_SweepKeepsRunningJobs(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewManager(store, nil, Config{TTL: time.Minute})
+	m.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	job, err := m.Submit(ctx, Request{StudentIDs: []int{1}, Format: "pdf"})
+	require.NoError(t, err)
+	_, err = m.update(ctx, job.ID, func(job *Job) { job.Status = StatusRunning })
+	require.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	removed, err := m.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+}
+
+func TestManager_ResumesUnfinishedJobsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	// The first process stops while one job runs and another is queued
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	first := NewManager(store, func(ctx context.Context, job *Job, progress func(int)) (*Result, error) {
+		progress(1)
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, Config{Concurrency: 1})
+	require.NoError(t, first.Start(ctx))
+
+	running, err := first.Submit(ctx, Request{StudentIDs: []int{1, 2}, Format: "zip"})
+	require.NoError(t, err)
+	<-started
+	queued, err := first.Submit(ctx, Request{StudentIDs: []int{3}, Format: "pdf"})
+	require.NoError(t, err)
+	cancel()
+	first.Wait()
+
+	interrupted, err := store.Get(context.Background(), running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, interrupted.Status)
+
+	// A new process with a fresh store on the same directory finishes both
+	reopened, err := NewFileStore(dir)
+	require.NoError(t, err)
+	second := startManager(t, reopened, func(ctx context.Context, job *Job, progress func(int)) (*Result, error) {
+		return &Result{Data: []byte("%PDF"), ContentType: "application/pdf"}, nil
+	}, Config{Concurrency: 1})
+
+	for _, id := range []string{running.ID, queued.ID} {
+		done := waitForJob(t, second, id)
+		assert.Equal(t, StatusSucceeded, done.Status)
+		assert.Equal(t, done.Progress.Total, done.Progress.Completed)
+	}
+}
+
+func TestManager_DeliversCallback(t *testing.T) {
+	var notified atomic.Int32
+	m := startManagerWithNotifier(t, func(ctx context.Context, job *Job, record func(webhook.Attempt)) error {
+		notified.Add(1)
+		assert.Equal(t, StatusSucceeded, job.Status)
+		record(webhook.Attempt{Number: 1, StatusCode: 500})
+		record(webhook.Attempt{Number: 2, StatusCode: 200})
+		return nil
+	})
+
+	job, err := m.Submit(context.Background(), Request{StudentIDs: []int{1}, Format: "pdf", CallbackURL: "http://example.com/hook"})
+	require.NoError(t, err)
+	require.NotNil(t, job.Callback)
+	assert.Equal(t, CallbackPending, job.Callback.Status)
+
+	require.Eventually(t, func() bool {
+		current, err := m.Get(context.Background(), job.ID)
+		return err == nil && current.Callback.Status == CallbackDelivered
+	}, 5*time.Second, 5*time.Millisecond)
+
+	current, err := m.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	require.Len(t, current.Callback.Attempts, 2)
+	assert.Equal(t, 500, current.Callback.Attempts[0].StatusCode)
+	assert.Equal(t, int32(1), notified.Load())
+}
+
+func TestManager_RecordsFailedCallback(t *testing.T) {
+	m := startManagerWithNotifier(t, func(ctx context.Context, job *Job, record func(webhook.Attempt)) error {
+		record(webhook.Attempt{Number: 1, Error: "connection refused"})
+		return errors.New("webhook attempt 1 failed: connection refused")
+	})
+
+	job, err := m.Submit(context.Background(), Request{StudentIDs: []int{1}, Format: "pdf", CallbackURL: "http://example.com/hook"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		current, err := m.Get(context.Background(), job.ID)
+		return err == nil && current.Callback.Status == CallbackFailed && len(current.Callback.Attempts) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestManager_ResumesPendingCallbacks(t *testing.T) {
+	store := NewMemoryStore()
+	job := &Job{
+		ID:         "0123456789abcdef0123456789abcdef",
+		Status:     StatusSucceeded,
+		StudentIDs: []int{1},
+		Callback:   &Callback{URL: "http://example.com/hook", Status: CallbackPending},
+		CreatedAt:  time.Now(),
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}
+	require.NoError(t, store.Save(context.Background(), job))
+
+	delivered := make(chan string, 1)
+	m := NewManager(store, nil, Config{})
+	m.SetNotifier(func(ctx context.Context, job *Job, record func(webhook.Attempt)) error {
+		delivered <- job.ID
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, m.Start(ctx))
+	t.Cleanup(func() {
+		cancel()
+		m.Wait()
+	})
+
+	select {
+	case id := <-delivered:
+		assert.Equal(t, job.ID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending callback was not delivered after restart")
+	}
+}
+
+func startManagerWithNotifier(t *testing.T, notify Notifier) *Manager {
+	t.Helper()
+	m := NewManager(NewMemoryStore(), func(ctx context.Context, job *Job, progress func(int)) (*Result, error) {
+		return &Result{Data: []byte("%PDF")}, nil
+	}, Config{})
+	m.SetNotifier(notify)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, m.Start(ctx))
+	t.Cleanup(func() {
+		cancel()
+		m.Wait()
+	})
+	return m
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+
+	// DefaultStoreDir is where the file store keeps jobs when JOB_STORE_DIR is not set
+	DefaultStoreDir = "data/jobs"
+)
+
+// Store persists jobs and their results. Implementations must be safe for
+// concurrent use and must return copies, so callers may modify returned jobs.
+type Store interface {
+	// Save creates or replaces a job
+	Save(ctx context.Context, job *Job) error
+	// Get returns the job with the given ID or ErrNotFound
+	Get(ctx context.Context, id string) (*Job, error)
+	// List returns every stored job in no particular order
+	List(ctx context.Context) ([]*Job, error)
+	// Delete removes a job and its result; deleting a missing job is not an error
+	Delete(ctx context.Context, id string) error
+	// SaveResult stores the output of a job
+	SaveResult(ctx context.Context, id string, data []byte) error
+	// OpenResult returns a reader for a job's output and its size, or ErrNoResult
+	OpenResult(ctx context.Context, id string) (io.ReadCloser, int64, error)
+}
+
+// NewStoreFromEnv creates the store selected by JOB_STORE ("memory" or "file").
+// The file store keeps its data in JOB_STORE_DIR.
+func NewStoreFromEnv() (Store, error) {
+	switch kind := os.Getenv("JOB_STORE"); kind {
+	case "", StoreMemory:
+		return NewMemoryStore(), nil
+	case StoreFile:
+		dir := os.Getenv("JOB_STORE_DIR")
+		if dir == "" {
+			dir = DefaultStoreDir
+		}
+		return NewFileStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown JOB_STORE %q", kind)
+	}
+}
+
+// MemoryStore keeps jobs in memory; they are lost when the process exits
+type MemoryStore struct {
+	mu      sync.RWMutex
+	jobs    map[string]*Job
+	results map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:    make(map[string]*Job),
+		results: make(map[string][]byte),
+	}
+}
+
+func (s *MemoryStore) Save(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job.clone()
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return job.clone(), nil
+}
+
+func (s *MemoryStore) List(_ context.Context) ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.clone())
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	delete(s.results, id)
+	return nil
+}
+
+func (s *MemoryStore) SaveResult(_ context.Context, id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return ErrNotFound
+	}
+	s.results[id] = bytes.Clone(data)
+	return nil
+}
+
+func (s *MemoryStore) OpenResult(_ context.Context, id string) (io.ReadCloser, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.results[id]
+	if !ok {
+		return nil, 0, ErrNoResult
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
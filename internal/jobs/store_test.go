@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	return map[string]Store{
+		StoreMemory: NewMemoryStore(),
+		StoreFile:   fileStore,
+	}
+}
+
+func newTestJob(t *testing.T) *Job {
+	id, err := newID()
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Job{
+		ID:         id,
+		Status:     StatusQueued,
+		StudentIDs: []int{1, 2},
+		Format:     "zip",
+		Progress:   Progress{Total: 2},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  now.Add(time.Hour),
+	}
+}
+
+func TestStore_SaveGetListDelete(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			job := newTestJob(t)
+			require.NoError(t, store.Save(ctx, job))
+
+			got, err := store.Get(ctx, job.ID)
+			require.NoError(t, err)
+			assert.Equal(t, job, got)
+
+			// Returned jobs are copies
+			got.StudentIDs[0] = 99
+			got.Status = StatusFailed
+			again, err := store.Get(ctx, job.ID)
+			require.NoError(t, err)
+			assert.Equal(t, job, again)
+
+			jobs, err := store.List(ctx)
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			assert.Equal(t, job.ID, jobs[0].ID)
+
+			require.NoError(t, store.Delete(ctx, job.ID))
+			_, err = store.Get(ctx, job.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.NoError(t, store.Delete(ctx, job.ID))
+		})
+	}
+}
+
+func TestStore_Results(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			job := newTestJob(t)
+
+			assert.ErrorIs(t, store.SaveResult(ctx, job.ID, []byte("x")), ErrNotFound)
+
+			require.NoError(t, store.Save(ctx, job))
+			_, _, err := store.OpenResult(ctx, job.ID)
+			assert.ErrorIs(t, err, ErrNoResult)
+
+			require.NoError(t, store.SaveResult(ctx, job.ID, []byte("%PDF-1.3")))
+			reader, size, err := store.OpenResult(ctx, job.ID)
+			require.NoError(t, err)
+			data, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			assert.Equal(t, "%PDF-1.3", string(data))
+			assert.Equal(t, int64(8), size)
+
+			require.NoError(t, store.Delete(ctx, job.ID))
+			_, _, err = store.OpenResult(ctx, job.ID)
+			assert.ErrorIs(t, err, ErrNoResult)
+		})
+	}
+}
+
+func TestFileStore_PersistsAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first, err := NewFileStore(dir)
+	require.NoError(t, err)
+	job := newTestJob(t)
+	require.NoError(t, first.Save(ctx, job))
+	require.NoError(t, first.SaveResult(ctx, job.ID, []byte("report")))
+
+	second, err := NewFileStore(dir)
+	require.NoError(t, err)
+	got, err := second.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job, got)
+
+	_, size, err := second.OpenResult(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), size)
+}
+
+func TestFileStore_RejectsPathsAsIDs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(filepath.Join(dir, "jobs"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.json"), []byte(`{"id":"secret"}`), 0o600))
+
+	_, err = store.Get(ctx, "../secret")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = store.OpenResult(ctx, "../secret")
+	assert.ErrorIs(t, err, ErrNoResult)
+	assert.Error(t, store.Save(ctx, &Job{ID: "../secret"}))
+}
+
+func TestFileStore_ListSkipsUnrelatedFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.json"), []byte("{}"), 0o600))
+	require.NoError(t, store.Save(ctx, newTestJob(t)))
+
+	jobs, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+func TestNewStoreFromEnv(t *testing.T) {
+	t.Setenv("JOB_STORE", "")
+	store, err := NewStoreFromEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+
+	t.Setenv("JOB_STORE", "file")
+	t.Setenv("JOB_STORE_DIR", t.TempDir())
+	store, err = NewStoreFromEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &FileStore{}, store)
+
+	t.Setenv("JOB_STORE", "redis")
+	_, err = NewStoreFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package layout
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/i18n"
+)
+
+// GeneratedOnField is bound to the date the report is rendered
+const GeneratedOnField = "generatedOn"
+
+// SchoolNameField is bound to the name of the school, which is
+// DefaultSchoolName unless the report's branding names the school
+const SchoolNameField = "schoolName"
+
+// ReporterField is bound to the name of the student's class teacher, next to
+// which signed reports print their signature block
+const ReporterField = "reporterName"
+
+// DefaultSchoolName is printed for SchoolNameField without branding
+const DefaultSchoolName = "School Management System"
+
+// Fields lists the names templates can bind to: every api.Student field by
+// its JSON name, plus GeneratedOnField and SchoolNameField
+var Fields = []string{
+	"id", "name", "email", "systemAccess", "phone", "gender", "dob",
+	"class", "section", "roll",
+	"fatherName", "fatherPhone", "motherName", "motherPhone",
+	"guardianName", "guardianPhone", "relationOfGuardian",
+	"currentAddress", "permanentAddress", "admissionDate", ReporterField,
+	GeneratedOnField, SchoolNameField,
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z]+)\s*\}\}`)
+
+// StudentValues returns the text bound to each of Fields for a student,
+// formatted as on the standard report: missing values are api.NotAvailable
+// and dates are spelled out, both in the translator's language
+func StudentValues(student *api.Student, now time.Time, tr *i18n.Translator) map[string]string {
+	values := map[string]string{
+		"id":                 fmt.Sprintf("%d", student.ID),
+		"name":               student.Name,
+		"email":              student.Email,
+		"systemAccess":       fmt.Sprintf("%t", student.SystemAccess),
+		"phone":              api.GetValueOrNA(student.Phone),
+		"gender":             api.GetValueOrNA(student.Gender),
+		"dob":                student.FormatDate(student.DOB, tr),
+		"class":              api.GetValueOrNA(student.Class),
+		"section":            api.GetValueOrNA(student.Section),
+		"roll":               api.GetIntValueOrNA(student.Roll),
+		"fatherName":         api.GetValueOrNA(student.FatherName),
+		"fatherPhone":        api.GetValueOrNA(student.FatherPhone),
+		"motherName":         api.GetValueOrNA(student.MotherName),
+		"motherPhone":        api.GetValueOrNA(student.MotherPhone),
+		"guardianName":       api.GetValueOrNA(student.GuardianName),
+		"guardianPhone":      api.GetValueOrNA(student.GuardianPhone),
+		"relationOfGuardian": api.GetValueOrNA(student.RelationOfGuardian),
+		"currentAddress":     api.GetValueOrNA(student.CurrentAddress),
+		"permanentAddress":   api.GetValueOrNA(student.PermanentAddress),
+		"admissionDate":      student.FormatDate(student.AdmissionDate, tr),
+		ReporterField:        api.GetValueOrNA(student.ReporterName),
+		GeneratedOnField:     tr.FormatDate(now),
+		SchoolNameField:      tr.Text(DefaultSchoolName),
+	}
+	for field, value := range values {
+		if value == api.NotAvailable {
+			values[field] = tr.Text(value)
+		}
+	}
+	return values
+}
+
+// Expand replaces every {{field}} placeholder in text with its value
+func Expand(text string, values map[string]string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		return values[placeholderPattern.FindStringSubmatch(match)[1]]
+	})
+}
+
+// Binds reports whether any text of the block has a placeholder for field
+func (b *Block) Binds(field string) bool {
+	texts := []string{b.Text, b.Title}
+	for _, row := range b.Rows {
+		texts = append(texts, row.Label, row.Value)
+	}
+	for _, column := range b.Columns {
+		texts = append(texts, column.Header)
+	}
+	for _, row := range b.Cells {
+		texts = append(texts, row...)
+	}
+	for _, text := range texts {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if match[1] == field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkPlaceholders returns why text's placeholders cannot be bound, or ""
+func checkPlaceholders(text string) string {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(Fields, match[1]) {
+			return fmt.Sprintf("unknown field %q in placeholder %s", match[1], match[0])
+		}
+	}
+	if strings.Contains(placeholderPattern.ReplaceAllString(text, ""), "{{") {
+		return "malformed placeholder; use {{field}}"
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pdf-generator/internal/atomicfile"
+)
+
+const (
+	recordFileExt = ".json"
+	sourceFileExt = ".template"
+)
+
+// FileStore keeps each template's record as a JSON file and every version's
+// document in its own file, so uploads survive restarts. Files are written
+// to a temporary name and renamed into place.
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewFileStore creates a store in dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create template store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Template names are validated by Parse, so they are safe to use in paths
+func (s *FileStore) recordPath(name string) string {
+	return filepath.Join(s.dir, name+recordFileExt)
+}
+
+func (s *FileStore) sourcePath(name string, version int) string {
+	return filepath.Join(s.dir, name+"."+strconv.Itoa(version)+sourceFileExt)
+}
+
+func (s *FileStore) Save(_ context.Context, record *Record) error {
+	if !namePattern.MatchString(record.Name) {
+		return fmt.Errorf("invalid template name %q", record.Name)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeFile(s.recordPath(record.Name), data)
+}
+
+func (s *FileStore) Get(_ context.Context, name string) (*Record, error) {
+	if !namePattern.MatchString(name) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readRecord(s.recordPath(name))
+}
+
+func (s *FileStore) List(_ context.Context) ([]*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	var records []*Record
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), recordFileExt)
+		if !ok || !namePattern.MatchString(name) {
+			continue
+		}
+		record, err := s.readRecord(filepath.Join(s.dir, entry.Name()))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *FileStore) SaveSource(_ context.Context, name string, version int, source []byte) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid template name %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeFile(s.sourcePath(name, version), source)
+}
+
+func (s *FileStore) Source(_ context.Context, name string, version int) ([]byte, error) {
+	if !namePattern.MatchString(name) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	source, err := os.ReadFile(s.sourcePath(name, version))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template source: %w", err)
+	}
+	return source, nil
+}
+
+// readRecord decodes one record file
+func (s *FileStore) readRecord(path string) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template record: %w", err)
+	}
+
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode template record %s: %w", filepath.Base(path), err)
+	}
+	return &record, nil
+}
+
+// writeFile atomically replaces path with data
+func (s *FileStore) writeFile(path string, data []byte) error {
+	if err := atomicfile.WriteFile(path, data); err != nil {
+		return fmt.Errorf("failed to write template file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package layout
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is one reason a template is invalid. Line is 1-based and zero when
+// the problem cannot be tied to a line.
+type Problem struct {
+	Line    int    `json:"line,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", p.Line)
+	}
+	if p.Path != "" {
+		b.WriteString(p.Path + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ValidationError lists every problem found in a template
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		parts[i] = problem.String()
+	}
+	return "invalid template: " + strings.Join(parts, "; ")
+}
+
+// ErrInvalidTemplate is matched by every *ValidationError
+var ErrInvalidTemplate = errors.New("invalid template")
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidTemplate
+}
+
+var (
+	namePattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+	orientations = []string{"P", "L"}
+	pageSizes    = []string{"A3", "A4", "A5", "Letter", "Legal"}
+	fontFamilies = []string{"Arial", "Helvetica", "Times", "Courier"}
+	aligns       = []string{"L", "C", "R"}
+)
+
+// Parse reads a template from YAML or JSON, applies defaults and validates
+// it. Every problem found is returned in a *ValidationError, with the line
+// it occurs on.
+func Parse(data []byte) (*Template, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, &ValidationError{Problems: []Problem{yamlProblem(err.Error())}}
+	}
+	if len(root.Content) == 0 {
+		return nil, &ValidationError{Problems: []Problem{{Line: 1, Message: "template is empty"}}}
+	}
+
+	var t Template
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&t); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, &ValidationError{Problems: []Problem{yamlProblem(err.Error())}}
+		}
+		problems := make([]Problem, len(typeErr.Errors))
+		for i, message := range typeErr.Errors {
+			problems[i] = yamlProblem(message)
+		}
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	v := validator{root: root.Content[0]}
+	v.validate(&t)
+	if len(v.problems) > 0 {
+		return nil, &ValidationError{Problems: v.problems}
+	}
+
+	t.applyDefaults()
+	return &t, nil
+}
+
+// yamlProblem converts a yaml.v3 error message such as
+// "yaml: line 3: mapping values are not allowed in this context"
+func yamlProblem(message string) Problem {
+	match := yamlLinePattern.FindStringSubmatch(message)
+	if match == nil {
+		return Problem{Message: strings.TrimPrefix(message, "yaml: ")}
+	}
+	line, _ := strconv.Atoi(match[1])
+	// yaml.v3 numbers the lines of parser errors, unlike scanner errors,
+	// from zero
+	if strings.HasPrefix(match[2], "did not find expected") {
+		line++
+	}
+	// Go type names mean nothing to template authors
+	text := strings.NewReplacer("layout.", "", "!!", "").Replace(match[2])
+	return Problem{Line: line, Message: text}
+}
+
+// validator collects the problems of a decoded template, locating each one
+// in the YAML node tree it was decoded from
+type validator struct {
+	root     *yaml.Node
+	problems []Problem
+}
+
+// fail records a problem at path, a sequence of mapping keys and sequence
+// indexes
+func (v *validator) fail(message string, path ...any) {
+	v.problems = append(v.problems, Problem{
+		Line:    v.line(path),
+		Path:    formatPath(path),
+		Message: message,
+	})
+}
+
+// line returns the line of the node at path, or of its closest ancestor that
+// exists, since problems are often about missing keys
+func (v *validator) line(path []any) int {
+	node := v.root
+	for _, step := range path {
+		next := childNode(node, step)
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return node.Line
+}
+
+func childNode(node *yaml.Node, step any) *yaml.Node {
+	switch step := step.(type) {
+	case string:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == step {
+				return node.Content[i+1]
+			}
+		}
+	case int:
+		if node.Kind == yaml.SequenceNode && step < len(node.Content) {
+			return node.Content[step]
+		}
+	}
+	return nil
+}
+
+func formatPath(path []any) string {
+	var b strings.Builder
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(step)
+		case int:
+			fmt.Fprintf(&b, "[%d]", step)
+		}
+	}
+	return b.String()
+}
+
+func (v *validator) validate(t *Template) {
+	if !namePattern.MatchString(t.Name) {
+		v.fail("name is required and must be lowercase letters, digits, '-' or '_'", "name")
+	}
+
+	v.oneOf(t.Page.Orientation, orientations, "page", "orientation")
+	v.oneOf(t.Page.Size, pageSizes, "page", "size")
+	margins := t.Page.Margins
+	if margins.Left < 0 || margins.Top < 0 || margins.Right < 0 {
+		v.fail("margins must not be negative", "page", "margins")
+	}
+
+	styles := t.Styles
+	v.font(&styles.SectionHeader.Font, "styles", "sectionHeader", "font")
+	if fill := styles.SectionHeader.Fill; len(fill) > 0 {
+		if len(fill) != 3 || slices.ContainsFunc(fill, func(c int) bool { return c < 0 || c > 255 }) {
+			v.fail("fill must be three RGB values from 0 to 255", "styles", "sectionHeader", "fill")
+		}
+	}
+	if border := styles.SectionHeader.Border; border != "" && border != "0" && border != "1" && strings.Trim(border, "LTRB") != "" {
+		v.fail(`border must be "0", "1" or a combination of L, T, R and B`, "styles", "sectionHeader", "border")
+	}
+	v.font(&styles.Label.Font, "styles", "label", "font")
+	v.font(&styles.Value.Font, "styles", "value", "font")
+	v.nonNegative(styles.SectionHeader.Height, "styles", "sectionHeader", "height")
+	v.nonNegative(styles.SectionHeader.SpaceAfter, "styles", "sectionHeader", "spaceAfter")
+	v.nonNegative(styles.Label.Width, "styles", "label", "width")
+	v.nonNegative(styles.Value.Width, "styles", "value", "width")
+	v.nonNegative(styles.RowHeight, "styles", "rowHeight")
+
+	if len(t.Blocks) == 0 {
+		v.fail("at least one block is required", "blocks")
+	}
+	for i := range t.Blocks {
+		v.block(&t.Blocks[i], "blocks", i)
+	}
+}
+
+func (v *validator) block(block *Block, path ...any) {
+	at := func(steps ...any) []any {
+		return append(slices.Clone(path), steps...)
+	}
+
+	v.nonNegative(block.Height, at("height")...)
+	v.nonNegative(block.SpaceAfter, at("spaceAfter")...)
+
+	switch block.Type {
+	case BlockText:
+		if block.Text == "" {
+			v.fail("text blocks need text", at("text")...)
+		}
+		v.binding(block.Text, at("text")...)
+		if block.Font != nil {
+			v.font(block.Font, at("font")...)
+		}
+		v.oneOf(block.Align, aligns, at("align")...)
+	case BlockSpacer:
+		if block.Height <= 0 {
+			v.fail("spacers need a positive height", at("height")...)
+		}
+	case BlockSection:
+		if block.Title == "" {
+			v.fail("sections need a title", at("title")...)
+		}
+		v.binding(block.Title, at("title")...)
+		if len(block.Rows) == 0 {
+			v.fail("sections need at least one row", at("rows")...)
+		}
+		for i, row := range block.Rows {
+			v.binding(row.Label, at("rows", i, "label")...)
+			v.binding(row.Value, at("rows", i, "value")...)
+		}
+	case BlockTable:
+		v.binding(block.Title, at("title")...)
+		if len(block.Columns) == 0 {
+			v.fail("tables need at least one column", at("columns")...)
+		}
+		for i, column := range block.Columns {
+			v.binding(column.Header, at("columns", i, "header")...)
+			v.nonNegative(column.Width, at("columns", i, "width")...)
+			v.oneOf(column.Align, aligns, at("columns", i, "align")...)
+		}
+		for i, row := range block.Cells {
+			if len(row) != len(block.Columns) {
+				v.fail(fmt.Sprintf("row has %d cells but the table has %d columns", len(row), len(block.Columns)), at("cells", i)...)
+			}
+			for j, cell := range row {
+				v.binding(cell, at("cells", i, j)...)
+			}
+		}
+	case "":
+		v.fail("type is required", at("type")...)
+	default:
+		v.fail(fmt.Sprintf("unknown block type %q; use text, spacer, section or table", block.Type), at("type")...)
+	}
+}
+
+func (v *validator) font(font *Font, path ...any) {
+	if font.Family != "" && !slices.Contains(fontFamilies, font.Family) {
+		v.fail(fmt.Sprintf("unsupported font family %q; use one of %s", font.Family, strings.Join(fontFamilies, ", ")), append(path, "family")...)
+	}
+	if strings.Trim(strings.ToUpper(font.Style), "BIU") != "" {
+		v.fail("style must be a combination of B, I and U", append(path, "style")...)
+	}
+	if font.Size < 0 {
+		v.fail("size must not be negative", append(path, "size")...)
+	}
+}
+
+func (v *validator) binding(text string, path ...any) {
+	if reason := checkPlaceholders(text); reason != "" {
+		v.fail(reason, path...)
+	}
+}
+
+func (v *validator) oneOf(value string, allowed []string, path ...any) {
+	if value != "" && !slices.Contains(allowed, value) {
+		v.fail(fmt.Sprintf("must be one of %s", strings.Join(allowed, ", ")), path...)
+	}
+}
+
+func (v *validator) nonNegative(value float64, path ...any) {
+	if value < 0 {
+		v.fail("must not be negative", path...)
+	}
+}
@@ -0,0 +1,429 @@
+package layout
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultName is the name of the template used when a request names none
+const DefaultName = "default"
+
+// DefaultDir is where NewRegistryFromEnv looks for templates
+const DefaultDir = "templates"
+
+var (
+	// ErrNotFound is returned for unknown template names and versions
+	ErrNotFound = errors.New("template not found")
+	// ErrNoRollback is returned when a template has never been re-activated
+	ErrNoRollback = errors.New("template has no previous version to roll back to")
+)
+
+// defaultSource reproduces the standard student report
+//
+//go:embed templates/default.yaml
+var defaultSource []byte
+
+// Default returns the built-in template
+func Default() *Template {
+	t, err := Parse(defaultSource)
+	if err != nil {
+		panic("layout: built-in default template is invalid: " + err.Error())
+	}
+	return t
+}
+
+// DefaultSource returns the YAML of the built-in template
+func DefaultSource() []byte {
+	return slices.Clone(defaultSource)
+}
+
+// Registry is the catalogue of report templates. Every version of every
+// template is kept in a Store and one version of each is active; the
+// registry caches the parsed active versions for rendering. It always holds
+// a template named DefaultName.
+type Registry struct {
+	store Store
+	now   func() time.Time
+
+	// mu serializes changes and guards active
+	mu     sync.RWMutex
+	active map[string]*Template
+}
+
+// NewRegistry returns a registry holding only the built-in template, kept in
+// memory
+func NewRegistry() *Registry {
+	registry, err := Open(context.Background(), NewMemoryStore(), "")
+	if err != nil {
+		panic("layout: failed to open built-in registry: " + err.Error())
+	}
+	return registry
+}
+
+// NewRegistryFromEnv opens the store selected by TEMPLATE_STORE and imports
+// the templates in TEMPLATE_DIR, or DefaultDir if it is unset; see Open
+func NewRegistryFromEnv(ctx context.Context) (*Registry, error) {
+	store, err := NewStoreFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	dir := os.Getenv("TEMPLATE_DIR")
+	if dir == "" {
+		dir = DefaultDir
+	}
+	return Open(ctx, store, dir)
+}
+
+// LoadDir returns a registry kept in memory holding the built-in template
+// and the templates in dir; see Open
+func LoadDir(dir string) (*Registry, error) {
+	return Open(context.Background(), NewMemoryStore(), dir)
+}
+
+// Open returns a registry backed by store after importing every .yaml, .yml
+// and .json template in dir, and the built-in template unless dir has one
+// named DefaultName. A missing or empty dir is not an error, but an invalid
+// template or two templates with the same name are.
+//
+// A template is imported as a new version whenever its document differs from
+// the last one imported for that name. The new version becomes active unless
+// an uploaded version is active, so deployments keep control of templates
+// until an administrator takes over.
+func Open(ctx context.Context, store Store, dir string) (*Registry, error) {
+	r := &Registry{store: store, now: time.Now, active: make(map[string]*Template)}
+
+	imports, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(imports, func(i templateImport) bool { return i.template.Name == DefaultName }) {
+		imports = append(imports, templateImport{template: Default(), source: defaultSource, origin: OriginBuiltin})
+	}
+	for _, i := range imports {
+		if err := r.importVersion(ctx, i); err != nil {
+			return nil, fmt.Errorf("failed to import template %q: %w", i.template.Name, err)
+		}
+	}
+
+	records, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		t, err := r.load(ctx, record.Name, record.Active)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load template %q: %w", record.Name, err)
+		}
+		r.active[record.Name] = t
+	}
+	return r, nil
+}
+
+// templateImport is a template read from disk or built in
+type templateImport struct {
+	template *Template
+	source   []byte
+	origin   string
+}
+
+func readDir(dir string) ([]templateImport, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template directory: %w", err)
+	}
+
+	var imports []templateImport
+	paths := make(map[string]string)
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		if entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		t, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if other, ok := paths[t.Name]; ok {
+			return nil, fmt.Errorf("%s: template %q is already defined in %s", path, t.Name, other)
+		}
+		paths[t.Name] = path
+		imports = append(imports, templateImport{template: t, source: data, origin: OriginFile})
+	}
+	return imports, nil
+}
+
+// importVersion stores a template from disk unless the last imported version
+// of that name has the same document
+func (r *Registry) importVersion(ctx context.Context, i templateImport) error {
+	record, err := r.record(ctx, i.template.Name)
+	if err != nil {
+		return err
+	}
+
+	checksum := checksumOf(i.source)
+	for _, version := range slices.Backward(record.Versions) {
+		if version.Origin != OriginUpload {
+			if version.Checksum == checksum {
+				return nil
+			}
+			break
+		}
+	}
+
+	version, err := r.addVersion(ctx, record, i.template, i.source, i.origin)
+	if err != nil {
+		return err
+	}
+	if active, ok := record.Version(record.Active); !ok || active.Origin != OriginUpload {
+		activate(record, version.Version, r.now())
+	}
+	return r.store.Save(ctx, record)
+}
+
+// record returns the stored record of a template, or a new empty one
+func (r *Registry) record(ctx context.Context, name string) (*Record, error) {
+	record, err := r.store.Get(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return &Record{Name: name}, nil
+	}
+	return record, err
+}
+
+// addVersion stores source as the next version of record, without saving the
+// record itself
+func (r *Registry) addVersion(ctx context.Context, record *Record, t *Template, source []byte, origin string) (Version, error) {
+	now := r.now().UTC()
+	version := Version{
+		Version:     len(record.Versions) + 1,
+		Description: t.Description,
+		Origin:      origin,
+		Checksum:    checksumOf(source),
+		CreatedAt:   now,
+	}
+	if err := r.store.SaveSource(ctx, record.Name, version.Version, source); err != nil {
+		return Version{}, err
+	}
+	record.Versions = append(record.Versions, version)
+	record.UpdatedAt = now
+	return version, nil
+}
+
+// activate makes number the active version of record, remembering the
+// previous one for Rollback
+func activate(record *Record, number int, now time.Time) {
+	if record.Active == number {
+		return
+	}
+	if record.Active != 0 {
+		record.History = append(record.History, record.Active)
+	}
+	record.Active = number
+	record.UpdatedAt = now.UTC()
+}
+
+// load reads and parses one stored version
+func (r *Registry) load(ctx context.Context, name string, number int) (*Template, error) {
+	source, err := r.store.Source(ctx, name, number)
+	if err != nil {
+		return nil, err
+	}
+	t, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	t.Version = number
+	return t, nil
+}
+
+func checksumOf(source []byte) string {
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the active version of the named template, or of the default
+// template if name is empty
+func (r *Registry) Get(name string) (*Template, error) {
+	if name == "" {
+		name = DefaultName
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.active[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return t, nil
+}
+
+// Version returns one version of the named template, active or not. Version
+// zero is the active version.
+func (r *Registry) Version(ctx context.Context, name string, number int) (*Template, error) {
+	if t, err := r.Get(name); err != nil || number == 0 || t.Version == number {
+		return t, err
+	}
+	t, err := r.load(ctx, name, number)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %q version %d", ErrNotFound, name, number)
+	}
+	return t, err
+}
+
+// Names returns the names of all templates, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.active))
+	for name := range r.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Record returns every version of the named template
+func (r *Registry) Record(ctx context.Context, name string) (*Record, error) {
+	record, err := r.store.Get(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return record, err
+}
+
+// Records returns the records of all templates, sorted by name
+func (r *Registry) Records(ctx context.Context) ([]*Record, error) {
+	records, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records, nil
+}
+
+// Source returns the document of one version of a template
+func (r *Registry) Source(ctx context.Context, name string, number int) ([]byte, error) {
+	source, err := r.store.Source(ctx, name, number)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %q version %d", ErrNotFound, name, number)
+	}
+	return source, err
+}
+
+// Upload validates a template document and stores it as the next version of
+// the template it names. The first version of a new template is activated
+// straight away; later versions must be activated explicitly.
+func (r *Registry) Upload(ctx context.Context, source []byte) (*Record, Version, error) {
+	t, err := Parse(source)
+	if err != nil {
+		return nil, Version{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, err := r.record(ctx, t.Name)
+	if err != nil {
+		return nil, Version{}, err
+	}
+	version, err := r.addVersion(ctx, record, t, source, OriginUpload)
+	if err != nil {
+		return nil, Version{}, err
+	}
+	if record.Active == 0 {
+		activate(record, version.Version, r.now())
+	}
+	if err := r.store.Save(ctx, record); err != nil {
+		return nil, Version{}, err
+	}
+
+	if record.Active == version.Version {
+		t.Version = version.Version
+		r.active[t.Name] = t
+	}
+	return record, version, nil
+}
+
+// Activate makes the given version of a template the one used for reports
+func (r *Registry) Activate(ctx context.Context, name string, number int) (*Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.switchVersion(ctx, name, func(record *Record) (int, error) {
+		if _, ok := record.Version(number); !ok {
+			return 0, fmt.Errorf("%w: %q version %d", ErrNotFound, name, number)
+		}
+		return number, nil
+	})
+}
+
+// Rollback re-activates the version that was active before the last
+// activation
+func (r *Registry) Rollback(ctx context.Context, name string) (*Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.switchVersion(ctx, name, func(record *Record) (int, error) {
+		if len(record.History) == 0 {
+			return 0, ErrNoRollback
+		}
+		previous := record.History[len(record.History)-1]
+		// Activating pushes the current version; a rollback forgets it
+		// instead, so that repeated rollbacks keep going back
+		record.History = record.History[:len(record.History)-1]
+		record.Active, record.UpdatedAt = 0, r.now().UTC()
+		return previous, nil
+	})
+}
+
+// switchVersion activates the version chosen by pick, which may also edit
+// the record's history. The caller must hold r.mu.
+func (r *Registry) switchVersion(ctx context.Context, name string, pick func(*Record) (int, error)) (*Record, error) {
+	record, err := r.store.Get(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	number, err := pick(record)
+	if err != nil {
+		return nil, err
+	}
+	t, err := r.load(ctx, name, number)
+	if err != nil {
+		return nil, err
+	}
+
+	activate(record, number, r.now())
+	if err := r.store.Save(ctx, record); err != nil {
+		return nil, err
+	}
+	r.active[name] = t
+	return record, nil
+}
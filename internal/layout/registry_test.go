@@ -0,0 +1,213 @@
+package layout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplate(t *testing.T, dir, file, source string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(source), 0o644))
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "landscape.yaml", "name: landscape\npage: {orientation: L}\nblocks: [{type: spacer, height: 5}]\n")
+	writeTemplate(t, dir, "letter.json", `{"name": "letter", "page": {"size": "Letter"}, "blocks": [{"type": "spacer", "height": 5}]}`)
+	writeTemplate(t, dir, "README.md", "not a template")
+
+	registry, err := LoadDir(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"default", "landscape", "letter"}, registry.Names())
+
+	tmpl, err := registry.Get("letter")
+	require.NoError(t, err)
+	assert.Equal(t, "Letter", tmpl.Page.Size)
+
+	tmpl, err = registry.Get("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultName, tmpl.Name)
+
+	_, err = registry.Get("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLoadDir_OverridesDefault(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "default.yml", "name: default\ndescription: Local\nblocks: [{type: spacer, height: 5}]\n")
+
+	registry, err := LoadDir(dir)
+	require.NoError(t, err)
+
+	tmpl, err := registry.Get(DefaultName)
+	require.NoError(t, err)
+	assert.Equal(t, "Local", tmpl.Description)
+}
+
+func TestLoadDir_MissingDirectory(t *testing.T) {
+	registry, err := LoadDir(filepath.Join(t.TempDir(), "absent"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{DefaultName}, registry.Names())
+}
+
+func TestLoadDir_Rejections(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "broken.yaml", "name: broken\nblocks:\n  - type: chart\n")
+
+	_, err := LoadDir(dir)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+	assert.Contains(t, err.Error(), "broken.yaml: invalid template: line 3: blocks[0].type")
+
+	dir = t.TempDir()
+	writeTemplate(t, dir, "a.yaml", "name: same\nblocks: [{type: spacer, height: 5}]\n")
+	writeTemplate(t, dir, "b.yaml", "name: same\nblocks: [{type: spacer, height: 5}]\n")
+
+	_, err = LoadDir(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `template "same" is already defined`)
+}
+
+// The example templates shipped with the service must stay valid
+func TestLoadDir_ShippedTemplates(t *testing.T) {
+	registry, err := LoadDir(filepath.Join("..", "..", DefaultDir))
+	require.NoError(t, err)
+	assert.Contains(t, registry.Names(), "compact")
+}
+
+const (
+	compactV1 = "name: compact\ndescription: First\nblocks: [{type: spacer, height: 5}]\n"
+	compactV2 = "name: compact\ndescription: Second\nblocks: [{type: spacer, height: 10}]\n"
+)
+
+func TestRegistry_UploadActivateRollback(t *testing.T) {
+	ctx := context.Background()
+	registry := NewRegistry()
+
+	// The first version of a new template is active straight away
+	record, version, err := registry.Upload(ctx, []byte(compactV1))
+	require.NoError(t, err)
+	assert.Equal(t, 1, version.Version)
+	assert.Equal(t, OriginUpload, version.Origin)
+	assert.Equal(t, "First", version.Description)
+	assert.Len(t, version.Checksum, 64)
+	assert.Equal(t, 1, record.Active)
+	assert.Equal(t, []string{"compact", "default"}, registry.Names())
+
+	// Later versions are kept but not used until activated
+	record, version, err = registry.Upload(ctx, []byte(compactV2))
+	require.NoError(t, err)
+	assert.Equal(t, 2, version.Version)
+	assert.Equal(t, 1, record.Active)
+	tmpl, err := registry.Get("compact")
+	require.NoError(t, err)
+	assert.Equal(t, "First", tmpl.Description)
+	assert.Equal(t, 1, tmpl.Version)
+
+	record, err = registry.Activate(ctx, "compact", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, record.Active)
+	assert.Equal(t, []int{1}, record.History)
+	tmpl, err = registry.Get("compact")
+	require.NoError(t, err)
+	assert.Equal(t, "Second", tmpl.Description)
+	assert.Equal(t, 2, tmpl.Version)
+
+	// Inactive versions can still be loaded, e.g. by queued jobs
+	old, err := registry.Version(ctx, "compact", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "First", old.Description)
+
+	record, err = registry.Rollback(ctx, "compact")
+	require.NoError(t, err)
+	assert.Equal(t, 1, record.Active)
+	assert.Empty(t, record.History)
+	tmpl, err = registry.Get("compact")
+	require.NoError(t, err)
+	assert.Equal(t, "First", tmpl.Description)
+
+	_, err = registry.Rollback(ctx, "compact")
+	assert.ErrorIs(t, err, ErrNoRollback)
+
+	source, err := registry.Source(ctx, "compact", 2)
+	require.NoError(t, err)
+	assert.Equal(t, compactV2, string(source))
+}
+
+func TestRegistry_Rejections(t *testing.T) {
+	ctx := context.Background()
+	registry := NewRegistry()
+
+	_, _, err := registry.Upload(ctx, []byte("name: compact\nblocks:\n  - type: chart\n"))
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+	assert.Equal(t, []string{DefaultName}, registry.Names())
+
+	_, err = registry.Activate(ctx, DefaultName, 5)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = registry.Activate(ctx, "missing", 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = registry.Version(ctx, DefaultName, 5)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = registry.Record(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestOpen_PersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	storeDir, templateDir := t.TempDir(), t.TempDir()
+	writeTemplate(t, templateDir, "compact.yaml", compactV1)
+
+	open := func() *Registry {
+		store, err := NewFileStore(storeDir)
+		require.NoError(t, err)
+		registry, err := Open(ctx, store, templateDir)
+		require.NoError(t, err)
+		return registry
+	}
+
+	registry := open()
+	record, err := registry.Record(ctx, "compact")
+	require.NoError(t, err)
+	require.Len(t, record.Versions, 1)
+	assert.Equal(t, OriginFile, record.Versions[0].Origin)
+	record, err = registry.Record(ctx, DefaultName)
+	require.NoError(t, err)
+	assert.Equal(t, OriginBuiltin, record.Versions[0].Origin)
+
+	// Reopening with unchanged files adds no versions
+	registry = open()
+	record, err = registry.Record(ctx, "compact")
+	require.NoError(t, err)
+	assert.Len(t, record.Versions, 1)
+
+	// A changed file is imported and activated while no upload is active
+	writeTemplate(t, templateDir, "compact.yaml", compactV2)
+	registry = open()
+	tmpl, err := registry.Get("compact")
+	require.NoError(t, err)
+	assert.Equal(t, "Second", tmpl.Description)
+	assert.Equal(t, 2, tmpl.Version)
+
+	// Once an uploaded version is active, changed files no longer replace it
+	_, _, err = registry.Upload(ctx, []byte(strings.Replace(compactV1, "First", "Uploaded", 1)))
+	require.NoError(t, err)
+	_, err = registry.Activate(ctx, "compact", 3)
+	require.NoError(t, err)
+
+	writeTemplate(t, templateDir, "compact.yaml", strings.Replace(compactV1, "First", "Third", 1))
+	registry = open()
+	tmpl, err = registry.Get("compact")
+	require.NoError(t, err)
+	assert.Equal(t, "Uploaded", tmpl.Description)
+	record, err = registry.Record(ctx, "compact")
+	require.NoError(t, err)
+	assert.Len(t, record.Versions, 4)
+	assert.Equal(t, []int{1, 2}, record.History)
+}
@@ -0,0 +1,166 @@
+package layout
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+
+	// DefaultStoreDir is where the file store keeps templates when
+	// TEMPLATE_STORE_DIR is not set
+	DefaultStoreDir = "data/templates"
+)
+
+// Where a template version came from
+const (
+	OriginBuiltin = "builtin"
+	OriginFile    = "file"
+	OriginUpload  = "upload"
+)
+
+// Version describes one stored revision of a template. Versions are numbered
+// from 1 and never change once stored.
+type Version struct {
+	Version     int    `json:"version"`
+	Description string `json:"description,omitempty"`
+	Origin      string `json:"origin"`
+	// Checksum is the hex SHA-256 of the template document
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Record is every version of one template and which of them is in use
+type Record struct {
+	Name string `json:"name"`
+	// Active is the version used to render reports
+	Active int `json:"activeVersion"`
+	// History lists the previously active versions, most recent last, so
+	// that activations can be rolled back
+	History   []int     `json:"history,omitempty"`
+	Versions  []Version `json:"versions"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Latest returns the most recently stored version
+func (r *Record) Latest() Version {
+	return r.Versions[len(r.Versions)-1]
+}
+
+// Version returns the given version, if it exists
+func (r *Record) Version(number int) (Version, bool) {
+	if number < 1 || number > len(r.Versions) {
+		return Version{}, false
+	}
+	return r.Versions[number-1], true
+}
+
+// clone returns a copy that shares no memory with the record
+func (r *Record) clone() *Record {
+	c := *r
+	c.History = slices.Clone(r.History)
+	c.Versions = slices.Clone(r.Versions)
+	return &c
+}
+
+// Store persists template records and the documents of their versions.
+// Implementations must be safe for concurrent use and must return copies.
+type Store interface {
+	// Save creates or replaces a template's record
+	Save(ctx context.Context, record *Record) error
+	// Get returns the named record or ErrNotFound
+	Get(ctx context.Context, name string) (*Record, error)
+	// List returns every record in no particular order
+	List(ctx context.Context) ([]*Record, error)
+	// SaveSource stores the document of one version of a template
+	SaveSource(ctx context.Context, name string, version int, source []byte) error
+	// Source returns the document of one version or ErrNotFound
+	Source(ctx context.Context, name string, version int) ([]byte, error)
+}
+
+// NewStoreFromEnv creates the store selected by TEMPLATE_STORE ("memory" or
+// "file"). The file store keeps its data in TEMPLATE_STORE_DIR.
+func NewStoreFromEnv() (Store, error) {
+	switch kind := os.Getenv("TEMPLATE_STORE"); kind {
+	case "", StoreMemory:
+		return NewMemoryStore(), nil
+	case StoreFile:
+		dir := os.Getenv("TEMPLATE_STORE_DIR")
+		if dir == "" {
+			dir = DefaultStoreDir
+		}
+		return NewFileStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown TEMPLATE_STORE %q", kind)
+	}
+}
+
+// MemoryStore keeps templates in memory; uploads are lost when the process
+// exits
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+	sources map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]*Record),
+		sources: make(map[string][]byte),
+	}
+}
+
+func sourceKey(name string, version int) string {
+	return fmt.Sprintf("%s@%d", name, version)
+}
+
+func (s *MemoryStore) Save(_ context.Context, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.Name] = record.clone()
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, name string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.records[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return record.clone(), nil
+}
+
+func (s *MemoryStore) List(_ context.Context) ([]*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]*Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record.clone())
+	}
+	return records, nil
+}
+
+func (s *MemoryStore) SaveSource(_ context.Context, name string, version int, source []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources[sourceKey(name, version)] = slices.Clone(source)
+	return nil
+}
+
+func (s *MemoryStore) Source(_ context.Context, name string, version int) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	source, ok := s.sources[sourceKey(name, version)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return slices.Clone(source), nil
+}
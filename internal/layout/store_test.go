@@ -0,0 +1,118 @@
+package layout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	return map[string]Store{
+		StoreMemory: NewMemoryStore(),
+		StoreFile:   fileStore,
+	}
+}
+
+func newTestRecord() *Record {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Record{
+		Name:    "compact",
+		Active:  2,
+		History: []int{1},
+		Versions: []Version{
+			{Version: 1, Origin: OriginFile, Checksum: "aa", CreatedAt: now},
+			{Version: 2, Origin: OriginUpload, Checksum: "bb", CreatedAt: now},
+		},
+		UpdatedAt: now,
+	}
+}
+
+func TestStore_Records(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			record := newTestRecord()
+			require.NoError(t, store.Save(ctx, record))
+
+			got, err := store.Get(ctx, "compact")
+			require.NoError(t, err)
+			assert.Equal(t, record, got)
+
+			// Returned records are copies
+			got.History[0] = 9
+			got.Versions[0].Origin = OriginUpload
+			again, err := store.Get(ctx, "compact")
+			require.NoError(t, err)
+			assert.Equal(t, record, again)
+
+			records, err := store.List(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []*Record{record}, records)
+
+			_, err = store.Get(ctx, "missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = store.Get(ctx, "../etc/passwd")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestStore_Sources(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			require.NoError(t, store.SaveSource(ctx, "compact", 1, []byte("name: compact\n")))
+			require.NoError(t, store.SaveSource(ctx, "compact", 2, []byte(`{"name": "compact"}`)))
+
+			source, err := store.Source(ctx, "compact", 1)
+			require.NoError(t, err)
+			assert.Equal(t, "name: compact\n", string(source))
+
+			source, err = store.Source(ctx, "compact", 2)
+			require.NoError(t, err)
+			assert.Equal(t, `{"name": "compact"}`, string(source))
+
+			_, err = store.Source(ctx, "compact", 3)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestFileStore_IgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, newTestRecord()))
+	require.NoError(t, store.SaveSource(ctx, "compact", 1, []byte("name: compact\n")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644))
+
+	records, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "compact", records[0].Name)
+}
+
+func TestNewStoreFromEnv(t *testing.T) {
+	t.Setenv("TEMPLATE_STORE", "")
+	store, err := NewStoreFromEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+
+	t.Setenv("TEMPLATE_STORE", "file")
+	t.Setenv("TEMPLATE_STORE_DIR", t.TempDir())
+	store, err = NewStoreFromEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &FileStore{}, store)
+
+	t.Setenv("TEMPLATE_STORE", "postgres")
+	_, err = NewStoreFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+// Package layout describes student reports declaratively. A template lists
+// the blocks of a report page - text, sections of label/value rows and
+// tables - with fonts and spacing, and binds them to student fields with
+// {{field}} placeholders. Templates are written in YAML or JSON.
+package layout
+
+// Block types
+const (
+	BlockText    = "text"
+	BlockSpacer  = "spacer"
+	BlockSection = "section"
+	BlockTable   = "table"
+)
+
+// Template is a parsed report layout
+type Template struct {
+	// Name identifies the template in ?template= and must be unique
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description"`
+	Page        Page    `yaml:"page"`
+	Styles      Styles  `yaml:"styles"`
+	Blocks      []Block `yaml:"blocks"`
+
+	// Version is the stored version the template was loaded from, or zero
+	Version int `yaml:"-"`
+}
+
+// Page sets the paper and margins, in millimetres
+type Page struct {
+	// Orientation is P (portrait) or L (landscape)
+	Orientation string `yaml:"orientation"`
+	// Size is A3, A4, A5, Letter or Legal
+	Size    string  `yaml:"size"`
+	Margins Margins `yaml:"margins"`
+}
+
+type Margins struct {
+	Left  float64 `yaml:"left"`
+	Top   float64 `yaml:"top"`
+	Right float64 `yaml:"right"`
+}
+
+// Font selects one of the PDF core fonts. Style is any combination of B, I
+// and U; an empty style is regular.
+type Font struct {
+	Family string  `yaml:"family"`
+	Style  string  `yaml:"style"`
+	Size   float64 `yaml:"size"`
+}
+
+// Styles are the defaults shared by every block of a template
+type Styles struct {
+	SectionHeader SectionHeaderStyle `yaml:"sectionHeader"`
+	// Label and Value style the two columns of section rows, and the header
+	// and body cells of tables
+	Label     ColumnStyle `yaml:"label"`
+	Value     ColumnStyle `yaml:"value"`
+	RowHeight float64     `yaml:"rowHeight"`
+}
+
+type SectionHeaderStyle struct {
+	Font Font `yaml:"font"`
+	// Fill is the RGB background colour; [] for no fill
+	Fill []int `yaml:"fill"`
+	// Border is a gofpdf border string: "0", "1" or any of "LTRB"
+	Border     string  `yaml:"border"`
+	Height     float64 `yaml:"height"`
+	SpaceAfter float64 `yaml:"spaceAfter"`
+}
+
+type ColumnStyle struct {
+	Font  Font    `yaml:"font"`
+	Width float64 `yaml:"width"`
+}
+
+// Block is one element of the report, rendered top to bottom. Which fields
+// apply depends on Type.
+type Block struct {
+	Type string `yaml:"type"`
+
+	// Text, Font, Align and Height configure text blocks; Height is also the
+	// height of spacers
+	Text   string  `yaml:"text"`
+	Font   *Font   `yaml:"font"`
+	Align  string  `yaml:"align"`
+	Height float64 `yaml:"height"`
+
+	// Title is the header of sections and, optionally, tables
+	Title string `yaml:"title"`
+	// Rows are the label/value pairs of a section
+	Rows []Row `yaml:"rows"`
+	// Columns and Cells define a table; every row of Cells has one entry per
+	// column
+	Columns []Column   `yaml:"columns"`
+	Cells   [][]string `yaml:"cells"`
+
+	// SpaceAfter is the vertical gap below the block
+	SpaceAfter float64 `yaml:"spaceAfter"`
+}
+
+type Row struct {
+	Label string `yaml:"label"`
+	Value string `yaml:"value"`
+}
+
+type Column struct {
+	Header string `yaml:"header"`
+	// Width is in millimetres; columns without a width share the space left
+	Width float64 `yaml:"width"`
+	Align string  `yaml:"align"`
+}
+
+// ColumnWidths returns the width of each table column given the width
+// available to the table
+func (b *Block) ColumnWidths(available float64) []float64 {
+	widths := make([]float64, len(b.Columns))
+	var fixed float64
+	var flexible int
+	for i, column := range b.Columns {
+		widths[i] = column.Width
+		fixed += column.Width
+		if column.Width == 0 {
+			flexible++
+		}
+	}
+	if flexible > 0 && available > fixed {
+		share := (available - fixed) / float64(flexible)
+		for i := range widths {
+			if widths[i] == 0 {
+				widths[i] = share
+			}
+		}
+	}
+	return widths
+}
+
+// applyDefaults fills in everything a template may leave out, so that the
+// defaults reproduce the standard report
+func (t *Template) applyDefaults() {
+	if t.Page.Orientation == "" {
+		t.Page.Orientation = "P"
+	}
+	if t.Page.Size == "" {
+		t.Page.Size = "A4"
+	}
+	if t.Page.Margins == (Margins{}) {
+		t.Page.Margins = Margins{Left: 10, Top: 10, Right: 10}
+	}
+
+	header := &t.Styles.SectionHeader
+	defaultFont(&header.Font, Font{Family: "Arial", Style: "B", Size: 14})
+	if header.Fill == nil {
+		header.Fill = []int{240, 240, 240}
+	}
+	if header.Border == "" {
+		header.Border = "1"
+	}
+	if header.Height == 0 {
+		header.Height = 8
+	}
+	if header.SpaceAfter == 0 {
+		header.SpaceAfter = 2
+	}
+	defaultFont(&t.Styles.Label.Font, Font{Family: "Arial", Style: "B", Size: 11})
+	defaultFont(&t.Styles.Value.Font, Font{Family: "Arial", Size: 11})
+	if t.Styles.Label.Width == 0 {
+		t.Styles.Label.Width = 60
+	}
+	if t.Styles.Value.Width == 0 {
+		t.Styles.Value.Width = 130
+	}
+	if t.Styles.RowHeight == 0 {
+		t.Styles.RowHeight = 6
+	}
+
+	for i := range t.Blocks {
+		block := &t.Blocks[i]
+		if block.Type == BlockText {
+			if block.Font == nil {
+				font := t.Styles.Value.Font
+				block.Font = &font
+			}
+			defaultFont(block.Font, t.Styles.Value.Font)
+			if block.Height == 0 {
+				block.Height = t.Styles.RowHeight
+			}
+		}
+		if block.Align == "" {
+			block.Align = "L"
+		}
+		for j := range block.Columns {
+			if block.Columns[j].Align == "" {
+				block.Columns[j].Align = "L"
+			}
+		}
+	}
+}
+
+// defaultFont replaces an unset font, and fills in the family and size of a
+// partially set one
+func defaultFont(font *Font, fallback Font) {
+	if *font == (Font{}) {
+		*font = fallback
+		return
+	}
+	if font.Family == "" {
+		font.Family = fallback.Family
+	}
+	if font.Size == 0 {
+		font.Size = fallback.Size
+	}
+}
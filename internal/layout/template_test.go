@@ -0,0 +1,218 @@
+package layout
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/i18n"
+)
+
+// parseProblems parses an invalid template and returns its problems
+func parseProblems(t *testing.T, source string) []Problem {
+	t.Helper()
+	_, err := Parse([]byte(source))
+	require.Error(t, err)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "want a *ValidationError, got %v", err)
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+	return validationErr.Problems
+}
+
+func TestDefault(t *testing.T) {
+	tmpl := Default()
+
+	assert.Equal(t, DefaultName, tmpl.Name)
+	assert.Equal(t, "P", tmpl.Page.Orientation)
+	assert.Equal(t, "A4", tmpl.Page.Size)
+	assert.Equal(t, []int{240, 240, 240}, tmpl.Styles.SectionHeader.Fill)
+
+	var sections []string
+	for _, block := range tmpl.Blocks {
+		if block.Type == BlockSection {
+			sections = append(sections, block.Title)
+		}
+	}
+	assert.Equal(t, []string{
+		"PERSONAL INFORMATION", "ACADEMIC INFORMATION", "FAMILY INFORMATION",
+		"ADDRESS INFORMATION", "ADDITIONAL INFORMATION",
+	}, sections)
+}
+
+func TestParse_AppliesDefaults(t *testing.T) {
+	tmpl, err := Parse([]byte(`
+name: minimal
+blocks:
+  - type: text
+    text: "{{name}}"
+  - type: table
+    columns: [{header: A, width: 50}, {header: B}, {header: C}]
+    cells: [[a, b, c]]
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, Margins{Left: 10, Top: 10, Right: 10}, tmpl.Page.Margins)
+	assert.Equal(t, Font{Family: "Arial", Style: "B", Size: 14}, tmpl.Styles.SectionHeader.Font)
+	assert.Equal(t, 6.0, tmpl.Styles.RowHeight)
+
+	text := tmpl.Blocks[0]
+	assert.Equal(t, &Font{Family: "Arial", Size: 11}, text.Font)
+	assert.Equal(t, "L", text.Align)
+	assert.Equal(t, 6.0, text.Height)
+
+	assert.Equal(t, []float64{50, 70, 70}, tmpl.Blocks[1].ColumnWidths(190))
+}
+
+func TestParse_JSON(t *testing.T) {
+	tmpl, err := Parse([]byte(`{
+  "name": "json",
+  "page": {"orientation": "L", "size": "Letter"},
+  "blocks": [{"type": "section", "title": "INFO", "rows": [{"label": "Name:", "value": "{{name}}"}]}]
+}`))
+	require.NoError(t, err)
+	assert.Equal(t, "L", tmpl.Page.Orientation)
+	assert.Equal(t, "Letter", tmpl.Page.Size)
+	assert.Equal(t, "{{name}}", tmpl.Blocks[0].Rows[0].Value)
+}
+
+func TestParse_ReportsLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []Problem
+	}{
+		{
+			name:   "syntax error",
+			source: "name: broken\nblocks:\n  - type: text\n   text: oops\n",
+			want:   []Problem{{Line: 3, Message: "did not find expected '-' indicator"}},
+		},
+		{
+			name:   "JSON syntax error",
+			source: "{\"name\": \"broken\",\n \"blocks\": [}\n",
+			want:   []Problem{{Line: 2, Message: "did not find expected node content"}},
+		},
+		{
+			name:   "duplicate key",
+			source: "name: x\nname: y\nblocks: [{type: spacer, height: 5}]\n",
+			want:   []Problem{{Line: 2, Message: `mapping key "name" already defined at line 1`}},
+		},
+		{
+			name:   "unknown field",
+			source: "name: x\nblocks:\n  - type: text\n    text: hi\n    colour: red\n",
+			want:   []Problem{{Line: 5, Message: "field colour not found in type Block"}},
+		},
+		{
+			name:   "wrong type",
+			source: "name: x\npage:\n  margins: {left: wide}\nblocks:\n  - {type: spacer, height: 5}\n",
+			want:   []Problem{{Line: 3, Message: "cannot unmarshal str `wide` into float64"}},
+		},
+		{
+			name:   "empty",
+			source: "",
+			want:   []Problem{{Line: 1, Message: "template is empty"}},
+		},
+		{
+			name: "semantic problems",
+			source: `name: Not Valid
+page:
+  size: A9
+blocks:
+  - type: section
+    title: INFO
+    rows:
+      - label: "Nickname:"
+        value: "{{nickname}}"
+  - type: table
+    columns: [{header: A}, {header: B}]
+    cells:
+      - [one, two]
+      - [three]
+  - type: chart
+  - type: text
+    text: "{{name"
+    font: {family: Comic Sans}
+`,
+			want: []Problem{
+				{Line: 1, Path: "name", Message: "name is required and must be lowercase letters, digits, '-' or '_'"},
+				{Line: 3, Path: "page.size", Message: "must be one of A3, A4, A5, Letter, Legal"},
+				{Line: 9, Path: "blocks[0].rows[0].value", Message: `unknown field "nickname" in placeholder {{nickname}}`},
+				{Line: 14, Path: "blocks[1].cells[1]", Message: "row has 1 cells but the table has 2 columns"},
+				{Line: 15, Path: "blocks[2].type", Message: `unknown block type "chart"; use text, spacer, section or table`},
+				{Line: 17, Path: "blocks[3].text", Message: "malformed placeholder; use {{field}}"},
+				{Line: 18, Path: "blocks[3].font.family", Message: `unsupported font family "Comic Sans"; use one of Arial, Helvetica, Times, Courier`},
+			},
+		},
+		{
+			name:   "missing keys point at the parent",
+			source: "name: x\nblocks:\n  - type: section\n    title: INFO\n",
+			want:   []Problem{{Line: 3, Path: "blocks[0].rows", Message: "sections need at least one row"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseProblems(t, tt.source))
+		})
+	}
+}
+
+func TestValidationError_Error(t *testing.T) {
+	err := &ValidationError{Problems: []Problem{
+		{Line: 3, Path: "page.size", Message: "must be one of A4"},
+		{Message: "template is empty"},
+	}}
+	assert.Equal(t, "invalid template: line 3: page.size: must be one of A4; template is empty", err.Error())
+}
+
+func TestStudentValues(t *testing.T) {
+	roll := 7
+	dob := "2008-03-15"
+	student := &api.Student{ID: 12, Name: "Ana", SystemAccess: true, Roll: &roll, DOB: &dob}
+
+	values := StudentValues(student, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), i18n.NewTranslator(i18n.Bundled().Catalog(i18n.English)))
+
+	assert.Len(t, values, len(Fields))
+	assert.Equal(t, "12", values["id"])
+	assert.Equal(t, "true", values["systemAccess"])
+	assert.Equal(t, "7", values["roll"])
+	assert.Equal(t, "March 15, 2008", values["dob"])
+	assert.Equal(t, "N/A", values["phone"])
+	assert.Equal(t, "N/A", values["admissionDate"])
+	assert.Equal(t, "June 1, 2024", values[GeneratedOnField])
+}
+
+func TestStudentValues_Translated(t *testing.T) {
+	dob := "2008-03-15"
+	student := &api.Student{ID: 12, Name: "Ana", DOB: &dob}
+	locale, err := i18n.Parse("pt-BR")
+	require.NoError(t, err)
+
+	values := StudentValues(student, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), i18n.NewTranslator(i18n.Bundled().Catalog(locale)))
+
+	assert.Equal(t, "15 de março de 2008", values["dob"])
+	assert.Equal(t, "N/D", values["phone"])
+	assert.Equal(t, "1 de junho de 2024", values[GeneratedOnField])
+}
+
+func TestExpand(t *testing.T) {
+	values := map[string]string{"name": "Ana", "class": "10"}
+
+	assert.Equal(t, "Ana (class 10)", Expand("{{name}} (class {{ class }})", values))
+	assert.Equal(t, "no placeholders", Expand("no placeholders", values))
+}
+
+func TestBlock_Binds(t *testing.T) {
+	section := Block{Type: BlockSection, Rows: []Row{{Label: "Teacher:", Value: "{{ reporterName }}"}}}
+	table := Block{Type: BlockTable, Columns: []Column{{Header: "Name"}}, Cells: [][]string{{"{{reporterName}}"}}}
+	text := Block{Type: BlockText, Text: "Reporter: {{reporterNameX}}"}
+
+	assert.True(t, section.Binds(ReporterField))
+	assert.True(t, table.Binds(ReporterField))
+	assert.False(t, text.Binds(ReporterField))
+	assert.False(t, section.Binds("name"))
+}
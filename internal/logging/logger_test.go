@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+)
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	return line
+}
+
+func TestNew_RedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "info", "json")
+
+	logger.Info("auth",
+		"accessToken", "eyJhbGciOi",
+		"refresh_token", "r-123",
+		"csrfToken", "c-456",
+		"password", "hunter2",
+		"cookie", "accessToken=abc",
+		"status", 200,
+	)
+
+	line := decodeLine(t, &buf)
+	assert.Equal(t, Redacted, line["accessToken"])
+	assert.Equal(t, Redacted, line["refresh_token"])
+	assert.Equal(t, Redacted, line["csrfToken"])
+	assert.Equal(t, Redacted, line["password"])
+	assert.Equal(t, Redacted, line["cookie"])
+	assert.Equal(t, float64(200), line["status"])
+	assert.NotContains(t, buf.String(), "hunter2")
+}
+
+func TestNew_RedactsStudentPII(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "info", "json")
+
+	student := api.GetMockStudent()
+	logger.Info("fetched", "student", student, "fatherPhone", *student.FatherPhone, "currentAddress", *student.CurrentAddress)
+
+	out := buf.String()
+	assert.NotContains(t, out, student.Name)
+	assert.NotContains(t, out, *student.Phone)
+	assert.NotContains(t, out, *student.FatherPhone)
+	assert.NotContains(t, out, *student.CurrentAddress)
+	assert.NotContains(t, out, *student.DOB)
+
+	line := decodeLine(t, &buf)
+	group, ok := line["student"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, float64(student.ID), group["id"])
+}
+
+func TestNew_AddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "info", "json")
+
+	ctx := WithRequestID(context.Background(), "req-42")
+	logger.InfoContext(ctx, "hello")
+
+	line := decodeLine(t, &buf)
+	assert.Equal(t, "req-42", line["request_id"])
+}
+
+func TestNew_HonorsLevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "warn", "text")
+
+	logger.Info("dropped")
+	assert.Empty(t, buf.String())
+
+	logger.Warn("kept", "csrfToken", "secret")
+	assert.Contains(t, buf.String(), "level=WARN")
+	assert.Contains(t, buf.String(), "csrfToken="+Redacted)
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, parseLevel("DEBUG"))
+	assert.Equal(t, slog.LevelWarn, parseLevel("warning"))
+	assert.Equal(t, slog.LevelError, parseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, parseLevel(""))
+	assert.Equal(t, slog.LevelInfo, parseLevel("verbose"))
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the value of any attribute considered sensitive
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched exactly after normalization
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"cookies":       true,
+	"setcookie":     true,
+	"dob":           true,
+	"dateofbirth":   true,
+	"email":         true,
+	"username":      true,
+}
+
+// sensitiveSuffixes catch families of keys such as fatherPhone or csrf_token
+var sensitiveSuffixes = []string{
+	"token",
+	"password",
+	"secret",
+	"phone",
+	"address",
+}
+
+// IsSensitiveKey reports whether an attribute with this key must not be logged
+func IsSensitiveKey(key string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "", ".", "").Replace(key))
+	if sensitiveKeys[normalized] {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(normalized, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if IsSensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
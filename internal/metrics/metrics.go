@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// Report outcomes
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	OutcomeCancelled = "cancelled"
+)
+
+var (
+	reports = expvar.NewMap("reports")
+	retries = expvar.NewMap("upstream_retries")
+)
+
+// RecordReport counts a report request by outcome
+func RecordReport(outcome string) {
+	reports.Add(outcome, 1)
+}
+
+// ReportCount returns how many report requests ended with the given outcome
+func ReportCount(outcome string) int64 {
+	if v, ok := reports.Get(outcome).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// RecordRetry counts a retried upstream request by the reason it was retried
+func RecordRetry(reason string) {
+	retries.Add(reason, 1)
+}
+
+// RetryCount returns how many upstream requests were retried for the given reason
+func RetryCount(reason string) int64 {
+	if v, ok := retries.Get(reason).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// Handler serves all counters as JSON
+func Handler() http.Handler {
+	return expvar.Handler()
+}
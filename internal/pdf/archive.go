@@ -0,0 +1,155 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pdf-generator/internal/pdfa"
+	"pdf-generator/internal/protection"
+)
+
+const (
+	// pdfaProducer names the service in the metadata of PDF/A reports
+	pdfaProducer = "PDF Generator Service"
+	// pdfaHeader replaces the header gofpdf writes. The comment's bytes
+	// above 127 mark the file as binary to transfer programs, as PDF/A
+	// requires.
+	pdfaHeader = "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"
+)
+
+// errArchiveEncrypted is returned when a PDF/A report is to be encrypted,
+// which PDF/A forbids
+var errArchiveEncrypted = errors.New("PDF/A reports cannot be encrypted")
+
+// uncoveredError is returned when a PDF/A report has characters no font
+// covers. PDF/A forbids printing them as missing glyphs, and a report that
+// left them out would misspell names.
+type uncoveredError struct {
+	characters string
+}
+
+func (e *uncoveredError) Error() string {
+	listed := make([]string, 0, len(e.characters))
+	for _, r := range e.characters {
+		listed = append(listed, fmt.Sprintf("%c (%U)", r, r))
+	}
+	return "no font covers the characters " + strings.Join(listed, ", ") + ", which a PDF/A report cannot leave out"
+}
+
+// checkCovered returns an uncoveredError if a PDF/A report printed
+// characters no font covers since the last check; other reports print them
+// as missing glyphs, and only log them
+func (pg *PDFGenerator) checkCovered(ctx context.Context, args ...any) error {
+	missing := pg.missingCharacters()
+	if missing == "" {
+		return nil
+	}
+	if pg.pdfa {
+		return &uncoveredError{characters: missing}
+	}
+	slog.WarnContext(ctx, "No font covers some characters of a report", append(args, "characters", missing)...)
+	return nil
+}
+
+// archive turns a document gofpdf wrote into PDF/A-2b. gofpdf writes the
+// document information dictionary and the catalog last, so they are written
+// again in their place: the information with metadata matching the XMP
+// metadata, and the catalog linking that and an sRGB output intent, which
+// follow them. A new cross-reference table gives the trailer a document ID.
+func (pg *PDFGenerator) archive(data []byte) ([]byte, error) {
+	if pg.encryption != nil {
+		return nil, errArchiveEncrypted
+	}
+	doc, err := readDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	catalog, err := doc.object(doc.root)
+	if err != nil || !bytes.HasPrefix(header, []byte("%PDF-1.")) || doc.info != doc.root-1 || doc.root != doc.size-1 {
+		return nil, errors.New("failed to read document: unexpected layout")
+	}
+
+	out := bytes.NewBufferString(pdfaHeader)
+	shift := out.Len() - len(header) - 1
+	out.Write(data[len(header)+1 : doc.offsets[doc.info]])
+	metadataObject, intentObject, profileObject := doc.size, doc.size+1, doc.size+2
+	offsets := make([]int, doc.size+3)
+	for n := 1; n < doc.info; n++ {
+		offsets[n] = doc.offsets[n] + shift
+	}
+	newObject := func(n int) {
+		offsets[n] = out.Len()
+		fmt.Fprintf(out, "%d 0 obj\n", n)
+	}
+
+	metadata := pdfa.Metadata{Author: pg.schoolName(), Producer: pdfaProducer, Created: pg.generated}
+	if len(pg.pageGroups) > 0 {
+		metadata.Title = pg.pageGroups[0].title
+	}
+	newObject(doc.info)
+	out.WriteString("<<\n")
+	if metadata.Title != "" {
+		fmt.Fprintf(out, "/Title %s\n", textString(nil, metadata.Title))
+	}
+	if metadata.Author != "" {
+		fmt.Fprintf(out, "/Author %s\n", textString(nil, metadata.Author))
+	}
+	date := textString(nil, pdfa.PDFDate(metadata.Created))
+	fmt.Fprintf(out, "/Producer %s\n/CreationDate %s\n/ModDate %s\n>>\nendobj\n", textString(nil, metadata.Producer), date, date)
+
+	newObject(doc.root)
+	fmt.Fprintf(out, "%s/Metadata %d 0 R\n/OutputIntents [%d 0 R]\n>>\nendobj\n", strings.TrimSuffix(catalog, ">>"), metadataObject, intentObject)
+
+	// The metadata must stay uncompressed, so that tools that do not read PDF
+	// can find it
+	xmp := pdfa.XMP(metadata)
+	newObject(metadataObject)
+	fmt.Fprintf(out, "<</Type /Metadata /Subtype /XML /Length %d>>\nstream\n%s\nendstream\nendobj\n", len(xmp), xmp)
+
+	condition := textString(nil, pdfa.OutputCondition)
+	newObject(intentObject)
+	fmt.Fprintf(out, "<</Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier %s /Info %s /RegistryName (http://www.color.org) /DestOutputProfile %d 0 R>>\nendobj\n", condition, condition, profileObject)
+
+	var profile bytes.Buffer
+	w := zlib.NewWriter(&profile)
+	w.Write(pdfa.SRGBProfile())
+	w.Close()
+	newObject(profileObject)
+	fmt.Fprintf(out, "<</N 3 /Filter /FlateDecode /Length %d>>\nstream\n%s\nendstream\nendobj\n", profile.Len(), profile.Bytes())
+
+	writeXref(out, offsets, doc.root, doc.info, "")
+	return out.Bytes(), nil
+}
+
+// pdfaFor reads whether a request wants PDF/A reports from its pdfa query
+// parameter. PDF/A reports cannot be encrypted, so it refuses them unless
+// mode, the protection chosen for the request, is none. It writes an error
+// response and returns false if the choice is invalid.
+func (s *Server) pdfaFor(w http.ResponseWriter, r *http.Request, reportType string, mode protection.Mode) (bool, bool) {
+	value := r.URL.Query().Get("pdfa")
+	if value == "" {
+		return false, true
+	}
+	archive, err := strconv.ParseBool(value)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid pdfa %q; expected true or false", value))
+		return false, false
+	}
+	if !archive || mode == "" || mode == protection.None {
+		return archive, true
+	}
+	if r.URL.Query().Get("protect") == "" && r.Header.Get(passwordHeader) == "" {
+		writeProblem(w, r, http.StatusForbidden, fmt.Sprintf("Reports of type %s must be protected, and PDF/A reports cannot be encrypted", reportType))
+		return false, false
+	}
+	writeProblem(w, r, http.StatusBadRequest, "PDF/A reports cannot be encrypted; leave out protect and "+passwordHeader)
+	return false, false
+}
@@ -0,0 +1,208 @@
+package pdf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/pdfa"
+	"pdf-generator/internal/protection"
+	"pdf-generator/internal/watermark"
+)
+
+var documentIDPattern = regexp.MustCompile(`/ID \[<[0-9a-f]{32}> <[0-9a-f]{32}>\]`)
+
+func TestGenerateStudentReport_PDFA(t *testing.T) {
+	output := renderUncompressed(t, Options{PDFA: true}, api.GetMockStudent())
+
+	require.NoError(t, pdfa.Check([]byte(output)))
+	assert.True(t, strings.HasPrefix(output, "%PDF-1.7\n%"))
+	assert.Contains(t, output, "<pdfaid:part>2</pdfaid:part>")
+	assert.Contains(t, output, "/S /GTS_PDFA1")
+	assert.Regexp(t, documentIDPattern, output)
+	// Every run is printed in an embedded font, even plain English
+	assert.NotContains(t, output, "/BaseFont /Helvetica")
+	assert.Contains(t, output, "/FontFile2")
+
+	// gofpdf's own output breaks the rules PDF/A mode keeps
+	err := pdfa.Check([]byte(renderUncompressed(t, Options{}, api.GetMockStudent())))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "must be embedded")
+	assert.ErrorContains(t, err, "no XMP metadata")
+	assert.ErrorContains(t, err, "document ID")
+}
+
+func TestGenerateStudentReport_PDFAOptions(t *testing.T) {
+	hebrew, err := i18n.Parse("he")
+	require.NoError(t, err)
+	arabic, err := i18n.Parse("ar")
+	require.NoError(t, err)
+	mark := watermark.Default()
+	mark.Style = watermark.Tiled
+
+	tests := []struct {
+		name    string
+		opts    Options
+		student *api.Student
+	}{
+		{"compressed", Options{PDFA: true}, api.GetMockStudent()},
+		{"many scripts", Options{PDFA: true}, multiScriptStudent()},
+		{"hebrew", Options{PDFA: true, Locale: hebrew}, api.GetMockStudent()},
+		{"arabic", Options{PDFA: true, Locale: arabic}, multiScriptStudent()},
+		{"watermark", Options{PDFA: true, Watermark: &mark}, api.GetMockStudent()},
+		{"verification", Options{PDFA: true, Verification: testVerification}, api.GetMockStudent()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := NewPDFGenerator(layout.Default(), tt.opts)
+			pdfBytes, err := generator.GenerateStudentReport(context.Background(), tt.student)
+			require.NoError(t, err)
+			assert.NoError(t, pdfa.Check(pdfBytes))
+		})
+	}
+}
+
+func TestGenerateMergedReport_PDFA(t *testing.T) {
+	generator := NewPDFGenerator(layout.Default(), Options{PDFA: true})
+	students := []*api.Student{api.GetMockStudent(), multiScriptStudent()}
+
+	pdfBytes, err := generator.GenerateMergedReport(context.Background(), students, func([]PageRange, *i18n.Translator) []string {
+		return []string{"Requested: 2, succeeded: 2, failed: 0"}
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, pdfa.Check(pdfBytes))
+}
+
+func TestGenerateStudentReport_PDFASigned(t *testing.T) {
+	signer, pool := newTestSigner(t)
+
+	output := renderUncompressed(t, Options{PDFA: true, Signer: signer}, api.GetMockStudent())
+
+	verifySignature(t, output, pool)
+	checkUpdateOffsets(t, output)
+	require.NoError(t, pdfa.Check([]byte(output)))
+	// The update keeps the document's ID
+	ids := documentIDPattern.FindAllString(output, -1)
+	require.Len(t, ids, 2)
+	assert.Equal(t, ids[0], ids[1])
+}
+
+func TestGenerateStudentReport_PDFAEncrypted(t *testing.T) {
+	generator := NewPDFGenerator(layout.Default(), Options{PDFA: true, Encryption: &Encryption{}})
+
+	_, err := generator.GenerateStudentReport(context.Background(), api.GetMockStudent())
+
+	assert.ErrorIs(t, err, errArchiveEncrypted)
+}
+
+func TestGenerateStudentReport_PDFAUncovered(t *testing.T) {
+	student := api.GetMockStudent()
+	student.Name = "Li 李 Wei"
+
+	_, err := NewPDFGenerator(layout.Default(), Options{PDFA: true}).GenerateStudentReport(context.Background(), student)
+
+	var uncovered *uncoveredError
+	require.ErrorAs(t, err, &uncovered)
+	assert.Equal(t, "李", uncovered.characters)
+	assert.ErrorContains(t, err, "李 (U+674E)")
+
+	// Other reports print them as missing glyphs
+	_, err = NewPDFGenerator(layout.Default(), Options{}).GenerateStudentReport(context.Background(), student)
+	assert.NoError(t, err)
+}
+
+func TestRenderStudentReport_PDFAUncovered(t *testing.T) {
+	student := api.GetMockStudent()
+	student.Name = "Li 李 Wei"
+	body, err := json.Marshal(student)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/api/v1/reports/student?pdfa=true", strings.NewReader(string(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(newTestServer().RenderStudentReport).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "李 (U+674E)")
+}
+
+func TestGenerateStudentReport_PDFARequested(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		password   string
+		wantStatus int
+		wantPDFA   bool
+	}{
+		{"not asked for", "", "", http.StatusOK, false},
+		{"false", "?pdfa=false", "", http.StatusOK, false},
+		{"true", "?pdfa=true", "", http.StatusOK, true},
+		{"unprotected", "?pdfa=1&protect=none", "", http.StatusOK, true},
+		{"invalid", "?pdfa=maybe", "", http.StatusBadRequest, false},
+		{"protected", "?pdfa=true&protect=restrict", "", http.StatusBadRequest, false},
+		{"password", "?pdfa=true", "S3cret!", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/students/1/report"+tt.query, nil)
+			require.NoError(t, err)
+			if tt.password != "" {
+				req.Header.Set(passwordHeader, tt.password)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(newTestServer().GenerateStudentReport).ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantPDFA, pdfa.Check(rr.Body.Bytes()) == nil)
+			}
+		})
+	}
+}
+
+func TestGenerateTestReport_PDFAProtectionRequired(t *testing.T) {
+	t.Setenv("PROTECTED_REPORTS", "test")
+	t.Setenv("PROTECTION_DEFAULT", "dob")
+	t.Setenv("PDF_OWNER_PASSWORD", "")
+	policy, err := protection.NewPolicyFromEnv()
+	require.NoError(t, err)
+	server := newTestServer()
+	server.SetProtection(policy)
+
+	// The policy's protection is not the caller's to leave out
+	rr := getProtectedReport(t, server, "?pdfa=true", "")
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestReportJob_PDFA(t *testing.T) {
+	server := newJobTestServer(t)
+
+	req, err := http.NewRequest("POST", "/api/v1/jobs?pdfa=true", strings.NewReader(`{"studentIds":[1]}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.CreateReportJob).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+
+	location := rr.Header().Get("Location")
+	assert.Equal(t, "succeeded", waitForJobStatus(t, server, location)["status"])
+	rr = getJob(t, server, location+"/result")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, pdfa.Check(rr.Body.Bytes()))
+}
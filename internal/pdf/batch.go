@@ -0,0 +1,460 @@
+package pdf
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/metrics"
+	"pdf-generator/internal/protection"
+)
+
+const (
+	// DefaultBatchConcurrency is how many students are fetched at once for a batch
+	DefaultBatchConcurrency = 4
+	// DefaultBatchMaxStudents caps the number of students in one batch
+	DefaultBatchMaxStudents = 200
+
+	BatchFormatZip = "zip"
+	BatchFormatPDF = "pdf"
+
+	batchStatusSucceeded = "succeeded"
+	batchStatusFailed    = "failed"
+)
+
+// BatchRequest is the body of POST /api/v1/reports/batch. Either StudentIDs or
+// Class (optionally with Section) selects the students.
+type BatchRequest struct {
+	StudentIDs []int  `json:"studentIds"`
+	Class      string `json:"class"`
+	Section    string `json:"section"`
+	// Format is "zip" for one PDF per student or "pdf" for a single merged PDF
+	Format string `json:"format"`
+}
+
+// BatchManifest reports the outcome for every student in a batch
+type BatchManifest struct {
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Format      string       `json:"format"`
+	Requested   int          `json:"requested"`
+	Succeeded   int          `json:"succeeded"`
+	Failed      int          `json:"failed"`
+	Entries     []BatchEntry `json:"entries"`
+}
+
+// BatchEntry is the outcome for one student. Error is safe to show to end users.
+type BatchEntry struct {
+	StudentID int    `json:"studentId"`
+	Status    string `json:"status"`
+	File      string `json:"file,omitempty"`
+	Pages     string `json:"pages,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// batchItem holds the intermediate state of one student while a batch runs
+type batchItem struct {
+	id      int
+	student *api.Student
+	pdf     []byte
+	err     error
+}
+
+// GenerateBatchReport handles the POST /api/v1/reports/batch endpoint, returning
+// a ZIP of individual reports or one merged PDF. Students are fetched with a
+// bounded worker pool and per-student failures are listed in the manifest.
+// Like the other report endpoints, ?template= selects the layout and ?lang=
+// the language.
+func (s *Server) GenerateBatchReport(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if !decodeBatchRequest(w, r, &req) {
+		return
+	}
+	opts, ok := s.reportOptionsFor(w, r, protection.ReportBatch)
+	if !ok {
+		return
+	}
+	if req.Format == "" {
+		req.Format = BatchFormatZip
+	}
+	if req.Format == BatchFormatPDF && opts.protection == protection.DateOfBirth {
+		writeProblem(w, r, http.StatusBadRequest, `A merged PDF cannot be protected with each student's date of birth; use format "zip" or the `+passwordHeader+" header")
+		return
+	}
+
+	ctx := r.Context()
+
+	ids, ok := s.resolveBatchIDs(w, r, req)
+	if !ok {
+		return
+	}
+
+	slog.InfoContext(ctx, "Generating batch report", "students", len(ids), "format", req.Format)
+
+	result, err := s.runBatch(ctx, opts, ids, req.Format, nil)
+	if err != nil {
+		handleStageError(w, r, "Failed to generate batch", err)
+		return
+	}
+
+	metrics.RecordReport(metrics.OutcomeSucceeded)
+	slog.InfoContext(ctx, "Generated batch report", "format", req.Format, "succeeded", result.manifest.Succeeded, "failed", result.manifest.Failed, "bytes", len(result.body))
+
+	w.Header().Set("Content-Type", result.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", result.filename))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(result.body)))
+	w.Header().Set("X-Batch-Succeeded", strconv.Itoa(result.manifest.Succeeded))
+	w.Header().Set("X-Batch-Failed", strconv.Itoa(result.manifest.Failed))
+
+	if _, err := w.Write(result.body); err != nil {
+		slog.ErrorContext(ctx, "Error writing batch to response", "error", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Batch report sent", "format", req.Format)
+}
+
+// batchResult is a finished batch, ready to be sent or stored
+type batchResult struct {
+	body        []byte
+	contentType string
+	filename    string
+	manifest    BatchManifest
+}
+
+// runBatch fetches and, for ZIP output, renders every student before packing
+// the reports. progress, if not nil, is called as each student finishes. The
+// batch only fails as a whole if no report could be generated, in which case
+// the first student's error is returned.
+func (s *Server) runBatch(ctx context.Context, opts reportOptions, ids []int, format string, progress func()) (*batchResult, error) {
+	items := make([]*batchItem, len(ids))
+	for i, id := range ids {
+		items[i] = &batchItem{id: id}
+	}
+
+	forEachConcurrently(ctx, len(items), s.batchConcurrency, func(ctx context.Context, i int) {
+		item := items[i]
+		item.student, item.err = s.fetchStudent(ctx, strconv.Itoa(item.id))
+		if item.err == nil && format == BatchFormatZip {
+			item.pdf, item.err = s.renderReport(ctx, opts, item.student)
+		}
+		if progress != nil {
+			progress()
+		}
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &batchResult{
+		manifest: BatchManifest{
+			GeneratedAt: time.Now().UTC(),
+			Format:      format,
+			Requested:   len(items),
+			Entries:     make([]BatchEntry, len(items)),
+		},
+	}
+	manifest := &result.manifest
+
+	var firstErr error
+	for i, item := range items {
+		if item.err == nil && item.student == nil {
+			item.err = errors.New("student was not processed")
+		}
+
+		entry := BatchEntry{StudentID: item.id, Status: batchStatusSucceeded}
+		if item.err != nil {
+			failEntry(ctx, &entry, item.err)
+			manifest.Failed++
+			if firstErr == nil {
+				firstErr = item.err
+			}
+		} else {
+			manifest.Succeeded++
+			if format == BatchFormatZip {
+				entry.File = fmt.Sprintf("student_%d_report.pdf", item.id)
+			}
+		}
+		manifest.Entries[i] = entry
+	}
+
+	if manifest.Succeeded == 0 {
+		return nil, fmt.Errorf("no reports could be generated: %w", firstErr)
+	}
+
+	var err error
+	if format == BatchFormatZip {
+		result.body, err = buildBatchZip(items, manifest)
+		result.contentType, result.filename = "application/zip", "student_reports.zip"
+	} else {
+		result.body, err = s.renderMergedReport(ctx, opts, items, manifest)
+		result.contentType, result.filename = "application/pdf", "student_reports.pdf"
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// batchBody is a request body that embeds a BatchRequest
+type batchBody interface {
+	batchRequest() *BatchRequest
+}
+
+func (req *BatchRequest) batchRequest() *BatchRequest {
+	return req
+}
+
+// decodeBatchRequest reads a JSON body holding a batch request into body,
+// writing an error response and returning false if the request is malformed.
+// An empty Format is left for the caller to default.
+func decodeBatchRequest(w http.ResponseWriter, r *http.Request, body batchBody) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Use POST with a batch JSON body")
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxStudentBodyBytes)).Decode(body); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid batch JSON")
+		return false
+	}
+
+	if format := body.batchRequest().Format; format != "" && format != BatchFormatZip && format != BatchFormatPDF {
+		writeProblem(w, r, http.StatusBadRequest, `Format must be "zip" or "pdf"`)
+		return false
+	}
+	return true
+}
+
+// resolveBatchIDs returns the student IDs selected by a batch request, writing
+// an error response and returning false if the request is invalid
+func (s *Server) resolveBatchIDs(w http.ResponseWriter, r *http.Request, req BatchRequest) ([]int, bool) {
+	hasIDs := len(req.StudentIDs) > 0
+	hasFilter := req.Class != "" || req.Section != ""
+
+	switch {
+	case hasIDs && hasFilter:
+		writeProblem(w, r, http.StatusBadRequest, "Use either studentIds or a class and section filter, not both")
+		return nil, false
+	case !hasIDs && req.Class == "":
+		writeProblem(w, r, http.StatusBadRequest, "Either studentIds or class is required")
+		return nil, false
+	}
+
+	var ids []int
+	if hasIDs {
+		seen := make(map[int]bool, len(req.StudentIDs))
+		for _, id := range req.StudentIDs {
+			if id <= 0 {
+				writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid student ID: %d", id))
+				return nil, false
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		lister, ok := s.students.(api.StudentLister)
+		if !ok {
+			writeProblem(w, r, http.StatusNotImplemented, "Filtering by class is not supported by the student source")
+			return nil, false
+		}
+
+		students, err := lister.ListStudents(r.Context(), api.StudentFilter{Class: req.Class, Section: req.Section})
+		if err != nil {
+			handleStageError(w, r, "Failed to list students", err)
+			return nil, false
+		}
+		for _, student := range students {
+			ids = append(ids, student.ID)
+		}
+		if len(ids) == 0 {
+			writeProblem(w, r, http.StatusNotFound, "No students match the class and section")
+			return nil, false
+		}
+	}
+
+	if len(ids) > s.batchMaxStudents {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("A batch may contain at most %d students", s.batchMaxStudents))
+		return nil, false
+	}
+
+	return ids, true
+}
+
+// failEntry marks a manifest entry as failed with a reason that is safe to
+// show to end users
+func failEntry(ctx context.Context, entry *BatchEntry, err error) {
+	slog.WarnContext(ctx, "Batch entry failed", "student_id", entry.StudentID, "error", err)
+	_, reason := errorStatus(err)
+	if reason == "" {
+		reason = "report could not be generated"
+	}
+	entry.Status = batchStatusFailed
+	entry.Error = reason
+}
+
+// renderMergedReport renders all fetched students into one PDF, ending with a
+// summary page that lists every manifest entry and its page range, and
+// records it for verification if it is issued. A student whose report cannot
+// be rendered is marked failed in the manifest and the PDF is rendered again
+// without them.
+func (s *Server) renderMergedReport(ctx context.Context, opts reportOptions, items []*batchItem, manifest *BatchManifest) ([]byte, error) {
+	var students []*api.Student
+	var entries []*BatchEntry
+	for i, item := range items {
+		if item.err == nil {
+			students = append(students, item.student)
+			entries = append(entries, &manifest.Entries[i])
+		}
+	}
+
+	encryption, err := s.encryptionFor(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.newVerification(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.renderTimeout*time.Duration(len(students)))
+	defer cancel()
+
+	summary := func(ranges []PageRange, tr *i18n.Translator) []string {
+		for i, pages := range ranges {
+			entries[i].Pages = pages.String()
+		}
+
+		lines := make([]string, 0, len(manifest.Entries)+1)
+		lines = append(lines, fmt.Sprintf(tr.Text("Requested: %d, succeeded: %d, failed: %d"), manifest.Requested, manifest.Succeeded, manifest.Failed))
+		for _, entry := range manifest.Entries {
+			if entry.Status == batchStatusFailed {
+				lines = append(lines, fmt.Sprintf(tr.Text("Student %d: %s (%s)"), entry.StudentID, tr.Text(entry.Status), entry.Error))
+			} else {
+				lines = append(lines, fmt.Sprintf(tr.Text("Student %d: %s, pages %s"), entry.StudentID, tr.Text(entry.Status), entry.Pages))
+			}
+		}
+		return lines
+	}
+
+	var pdfBytes []byte
+	for {
+		pdfBytes, err = s.newGenerator(opts, encryption, v).GenerateMergedReport(ctx, students, summary)
+		var studentErr *studentRenderError
+		if !errors.As(err, &studentErr) {
+			break
+		}
+
+		failEntry(ctx, entries[studentErr.index], studentErr.err)
+		manifest.Succeeded--
+		manifest.Failed++
+		if manifest.Succeeded == 0 {
+			return nil, fmt.Errorf("no reports could be generated: %w", studentErr.err)
+		}
+		students = slices.Delete(students, studentErr.index, studentErr.index+1)
+		entries = slices.Delete(entries, studentErr.index, studentErr.index+1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	studentIDs := make([]int, len(students))
+	for i, student := range students {
+		studentIDs[i] = student.ID
+	}
+	if err := s.recordIssued(ctx, v, pdfBytes, studentIDs...); err != nil {
+		return nil, err
+	}
+	return pdfBytes, nil
+}
+
+// buildBatchZip packs the rendered reports and the manifest into a ZIP archive
+func buildBatchZip(items []*batchItem, manifest *BatchManifest) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for _, item := range items {
+		if item.err != nil {
+			continue
+		}
+		file, err := archive.Create(fmt.Sprintf("student_%d_report.pdf", item.id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to add report to archive: %w", err)
+		}
+		if _, err := file.Write(item.pdf); err != nil {
+			return nil, fmt.Errorf("failed to add report to archive: %w", err)
+		}
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	file, err := archive.Create("manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to add manifest to archive: %w", err)
+	}
+	if _, err := file.Write(manifestJSON); err != nil {
+		return nil, fmt.Errorf("failed to add manifest to archive: %w", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// forEachConcurrently calls fn for every index in [0, n) using at most limit
+// goroutines. Indexes not yet started when ctx is done are skipped.
+func forEachConcurrently(ctx context.Context, n, limit int, fn func(ctx context.Context, i int)) {
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > n {
+		limit = n
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < limit; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(ctx, i)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
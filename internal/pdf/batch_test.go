@@ -0,0 +1,224 @@
+package pdf
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+)
+
+func mockStudentWithID(id int, name string) *api.Student {
+	student := api.GetMockStudent()
+	student.ID = id
+	student.Name = name
+	return student
+}
+
+func newBatchTestServer() *Server {
+	other := mockStudentWithID(2, "Mary Major")
+	section := "B"
+	other.Section = &section
+
+	return NewServer(newMemorySource(api.GetMockStudent(), other, mockStudentWithID(3, "Richard Roe")))
+}
+
+func postBatch(t *testing.T, server *Server, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", "/api/v1/reports/batch", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateBatchReport).ServeHTTP(rr, req)
+	return rr
+}
+
+func readZip(t *testing.T, body []byte) map[string][]byte {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		rc, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[file.Name] = content
+	}
+	return files
+}
+
+func TestGenerateBatchReport_Zip(t *testing.T) {
+	rr := postBatch(t, newBatchTestServer(), `{"studentIds":[1,99,3,1],"format":"zip"}`)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "2", rr.Header().Get("X-Batch-Succeeded"))
+	assert.Equal(t, "1", rr.Header().Get("X-Batch-Failed"))
+
+	files := readZip(t, rr.Body.Bytes())
+	require.Contains(t, files, "student_1_report.pdf")
+	require.Contains(t, files, "student_3_report.pdf")
+	assert.NotContains(t, files, "student_99_report.pdf")
+	assert.True(t, bytes.HasPrefix(files["student_1_report.pdf"], []byte("%PDF")))
+
+	var manifest BatchManifest
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	assert.Equal(t, 3, manifest.Requested)
+	assert.Equal(t, 2, manifest.Succeeded)
+	assert.Equal(t, 1, manifest.Failed)
+	require.Len(t, manifest.Entries, 3)
+	assert.Equal(t, BatchEntry{StudentID: 1, Status: "succeeded", File: "student_1_report.pdf"}, manifest.Entries[0])
+	assert.Equal(t, BatchEntry{StudentID: 99, Status: "failed", Error: "student not found"}, manifest.Entries[1])
+}
+
+func TestGenerateBatchReport_MergedPDF(t *testing.T) {
+	rr := postBatch(t, newBatchTestServer(), `{"class":"Grade 10","format":"pdf"}`)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "3", rr.Header().Get("X-Batch-Succeeded"))
+
+	body := rr.Body.String()
+	assert.True(t, strings.HasPrefix(body, "%PDF"))
+	assert.Contains(t, body, "/Outlines")
+	assert.Contains(t, body, "(John Doe \\(ID 1\\))")
+	assert.Contains(t, body, "(Batch Summary)")
+	// Each outline entry must point at a page object, not an earlier object
+	assert.Contains(t, body, "/Dest [3 0 R ")
+	assert.Contains(t, body, "3 0 obj\n<</Type /Page\n")
+}
+
+func TestGenerateBatchReport_MergedPDFRenderFailure(t *testing.T) {
+	// PDF/A reports fail for characters no font covers
+	server := NewServer(newMemorySource(api.GetMockStudent(), mockStudentWithID(2, "Li 李 Wei"), mockStudentWithID(3, "Richard Roe")))
+
+	req, err := http.NewRequest("POST", "/api/v1/reports/batch?pdfa=true", strings.NewReader(`{"studentIds":[1,2,3],"format":"pdf"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateBatchReport).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("X-Batch-Succeeded"))
+	assert.Equal(t, "1", rr.Header().Get("X-Batch-Failed"))
+
+	// The outline lists the two reports and the summary, in UTF-16 as PDF/A
+	// reports print all text in Unicode fonts
+	body := rr.Body.String()
+	assert.Equal(t, 3, strings.Count(body, "<</Title ("))
+	assert.Contains(t, body, utf16Text("John Doe"))
+	assert.Contains(t, body, utf16Text("Richard Roe"))
+	assert.NotContains(t, body, utf16Text("Li"))
+}
+
+func TestGenerateBatchReport_ClassAndSectionFilter(t *testing.T) {
+	rr := postBatch(t, newBatchTestServer(), `{"class":"Grade 10","section":"B"}`)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	files := readZip(t, rr.Body.Bytes())
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, "student_2_report.pdf")
+}
+
+func TestGenerateBatchReport_AllFailed(t *testing.T) {
+	rr := postBatch(t, newBatchTestServer(), `{"studentIds":[98,99]}`)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+}
+
+func TestGenerateBatchReport_Rejections(t *testing.T) {
+	t.Setenv("BATCH_MAX_STUDENTS", "2")
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "Malformed JSON", body: `{`, expectedStatus: http.StatusBadRequest},
+		{name: "Nothing selected", body: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "IDs and filter", body: `{"studentIds":[1],"class":"Grade 10"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Section without class", body: `{"section":"A"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Bad format", body: `{"studentIds":[1],"format":"tar"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Bad ID", body: `{"studentIds":[0]}`, expectedStatus: http.StatusBadRequest},
+		{name: "Too many", body: `{"studentIds":[1,2,3]}`, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "No class match", body: `{"class":"Grade 1"}`, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postBatch(t, newBatchTestServer(), tt.body)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+// countingSource records the peak number of concurrent lookups
+type countingSource struct {
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (c *countingSource) GetStudentByID(_ context.Context, id string) (*api.Student, error) {
+	current := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if current <= peak || c.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	student := api.GetMockStudent()
+	student.ID, _ = strconv.Atoi(id)
+	return student, nil
+}
+
+func TestGenerateBatchReport_BoundedConcurrency(t *testing.T) {
+	t.Setenv("BATCH_CONCURRENCY", "3")
+	source := &countingSource{}
+
+	rr := postBatch(t, NewServer(source), `{"studentIds":[1,2,3,4,5,6,7,8,9,10],"format":"pdf"}`)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.LessOrEqual(t, source.peak.Load(), int32(3))
+	assert.Greater(t, source.peak.Load(), int32(1))
+}
+
+func TestForEachConcurrently_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mu sync.Mutex
+	var seen []int
+	forEachConcurrently(ctx, 100, 1, func(_ context.Context, i int) {
+		mu.Lock()
+		seen = append(seen, i)
+		mu.Unlock()
+		if i == 2 {
+			cancel()
+		}
+	})
+
+	assert.Less(t, len(seen), 100)
+}
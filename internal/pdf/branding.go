@@ -0,0 +1,42 @@
+package pdf
+
+import (
+	"bytes"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"pdf-generator/internal/layout"
+)
+
+// logoImage is the name the logo is registered under in the document
+const logoImage = "logo"
+
+// schoolName is the branded school name, or the translated default
+func (pg *PDFGenerator) schoolName() string {
+	if pg.branding.SchoolName != "" {
+		return pg.branding.SchoolName
+	}
+	return pg.tr.Text(layout.DefaultSchoolName)
+}
+
+// drawLogo places the school's logo in the top corner of the page opposite
+// the start of the text: the right corner, or the left one in right-to-left
+// reports. It does not move the cursor, so the blocks keep their places.
+func (pg *PDFGenerator) drawLogo() {
+	logo := pg.branding.Logo
+	if logo == nil {
+		return
+	}
+
+	options := gofpdf.ImageOptions{ImageType: logo.Type}
+	if pg.pdf.GetImageInfo(logoImage) == nil {
+		pg.pdf.RegisterImageOptionsReader(logoImage, options, bytes.NewReader(logo.Data))
+	}
+	left, top, right, _ := pg.pdf.GetMargins()
+	width, _ := pg.pdf.GetPageSize()
+	x := width - right - logo.Width
+	if pg.rtl {
+		x = left
+	}
+	pg.pdf.ImageOptions(logoImage, x, top, logo.Width, logo.Height, false, options, 0, "")
+}
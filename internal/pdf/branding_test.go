@@ -0,0 +1,72 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/bidi"
+	"pdf-generator/internal/branding"
+	"pdf-generator/internal/i18n"
+)
+
+// testBranding is a branding with every option set and a 20 x 10 mm logo
+func testBranding(t *testing.T) *branding.Branding {
+	t.Helper()
+	var logo bytes.Buffer
+	require.NoError(t, png.Encode(&logo, image.NewNRGBA(image.Rect(0, 0, 40, 20))))
+	return &branding.Branding{
+		SchoolName: "Springfield High",
+		Logo:       &branding.Logo{Data: logo.Bytes(), Type: branding.PNG, Width: 20, Height: 10},
+		Primary:    &branding.Color{31, 78, 121},
+		Secondary:  &branding.Color{255, 255, 255},
+		Address:    "742 Evergreen Terrace, Springfield",
+		Contact:    "office@springfield.edu",
+	}
+}
+
+func TestGenerateStudentReport_Branding(t *testing.T) {
+	output := renderUncompressed(t, Options{Branding: testBranding(t)}, api.GetMockStudent())
+
+	// The school name replaces the default one under the title
+	assert.NotContains(t, output, "(School Management System)Tj")
+	assert.Contains(t, output, "BT 255.29 756.09 Td (Springfield High)Tj")
+
+	// The logo is drawn once, 20 x 10 mm in the top right corner
+	assert.Equal(t, 1, strings.Count(output, " cm /I"))
+	assert.Contains(t, output, "q 56.69291 0 0 28.34646 510.24063 785.19709 cm /I")
+
+	// Section headers use the branding colours instead of the template's
+	assert.Contains(t, output, "0.122 0.306 0.475 rg")
+	assert.Contains(t, output, "1.000 G")
+	assert.NotContains(t, output, "0.941 g")
+	assert.Contains(t, output, "q 1.000 g BT 31.18 681.78 Td (PERSONAL INFORMATION)Tj ET Q")
+
+	// Every page carries the school's name in its header and its details in
+	// its footer
+	pages := strings.Count(output, "/Type /Page\n")
+	require.Greater(t, pages, 1)
+	for _, line := range []string{"(Springfield High)Tj", "(742 Evergreen Terrace, Springfield)Tj", "(office@springfield.edu)Tj"} {
+		assert.GreaterOrEqual(t, strings.Count(output, line), pages, line)
+	}
+}
+
+func TestGenerateStudentReport_BrandingRightToLeft(t *testing.T) {
+	locale, err := i18n.Parse("ar")
+	require.NoError(t, err)
+	b := testBranding(t)
+	b.SchoolName = ""
+
+	output := renderUncompressed(t, Options{Locale: locale, Branding: b}, api.GetMockStudent())
+
+	// The logo moves to the top left corner and the default school name is
+	// translated
+	assert.Contains(t, output, "q 56.69291 0 0 28.34646 28.34646 785.19709 cm /I")
+	assert.Contains(t, output, shownText(bidi.Display("نظام إدارة المدرسة", true)))
+}
@@ -0,0 +1,351 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// encryptedHeader replaces the header gofpdf writes. AES-256 encryption
+// (revision 6 of the standard security handler) came with PDF 2.0.
+const encryptedHeader = "%PDF-2.0\n%\xe2\xe3\xcf\xd3\n"
+
+// restrictedPermissions is the /P entry of encrypted reports: none of print,
+// modify, copy, annotate, fill in, extract, assemble or print well, with the
+// bits the standard reserves set
+const restrictedPermissions = -3904
+
+var streamLengthPattern = regexp.MustCompile(`/Length (\d+)`)
+
+// encrypt encrypts a document gofpdf wrote with AES-256, the standard
+// security handler's revision 6: every string and stream is encrypted with
+// a random file key, which the user and owner passwords unlock. gofpdf's own
+// encryption is 40-bit RC4, which can be broken whatever the password. The
+// objects are written again in their place, followed by the encryption
+// dictionary, and a new cross-reference table gives the trailer the document
+// ID encrypted documents need. The file key is kept for signing.
+func (pg *PDFGenerator) encrypt(data []byte) ([]byte, error) {
+	doc, err := readDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	if doc.encrypt != 0 {
+		return nil, errors.New("document is already encrypted")
+	}
+	owner := pg.encryption.OwnerPassword
+	if owner == "" {
+		owner = randomHex(16)
+	}
+	security := newStandardSecurity(pg.encryption.UserPassword, owner, restrictedPermissions)
+
+	// Objects are written in the order gofpdf wrote them, which is not the
+	// order of their numbers
+	order := make([]int, 0, doc.size)
+	for n := 1; n < doc.size; n++ {
+		order = append(order, n)
+	}
+	slices.SortFunc(order, func(a, b int) int { return doc.offsets[a] - doc.offsets[b] })
+
+	out := bytes.NewBufferString(encryptedHeader)
+	out.Write(data[bytes.IndexByte(data, '\n')+1 : doc.offsets[order[0]]])
+	encryptObject := doc.size
+	offsets := make([]int, doc.size+1)
+	for _, n := range order {
+		offsets[n] = out.Len()
+		if err := doc.encryptObject(out, n, security.fileKey); err != nil {
+			return nil, err
+		}
+	}
+	offsets[encryptObject] = out.Len()
+	fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", encryptObject, security.dictionary())
+
+	writeXref(out, offsets, doc.root, doc.info, fmt.Sprintf("/Encrypt %d 0 R\n", encryptObject))
+	pg.fileKey = security.fileKey
+	return out.Bytes(), nil
+}
+
+// encryptObject writes object n again with its strings and stream encrypted
+func (doc *pdfDocument) encryptObject(out *bytes.Buffer, n int, key []byte) error {
+	header := fmt.Sprintf("%d 0 obj\n", n)
+	body := doc.data[doc.offsets[n]:]
+	if !bytes.HasPrefix(body, []byte(header)) {
+		return fmt.Errorf("object %d is not where the cross-reference table puts it", n)
+	}
+	body = body[len(header):]
+
+	var dict bytes.Buffer
+	end, err := encryptStrings(&dict, body, key)
+	if err != nil {
+		return fmt.Errorf("object %d: %w", n, err)
+	}
+	out.WriteString(header)
+	if bytes.HasPrefix(body[end:], []byte("endobj")) {
+		out.Write(dict.Bytes())
+		out.WriteString("endobj\n")
+		return nil
+	}
+
+	// gofpdf gives every stream a direct /Length
+	match := streamLengthPattern.FindSubmatchIndex(dict.Bytes())
+	if match == nil {
+		return fmt.Errorf("stream of object %d has no /Length", n)
+	}
+	length, _ := strconv.Atoi(string(dict.Bytes()[match[2]:match[3]]))
+	start := end + len("stream\n")
+	if start+length > len(body) {
+		return fmt.Errorf("stream of object %d is shorter than its /Length", n)
+	}
+	stream := encryptAES(key, body[start:start+length])
+	out.Write(dict.Bytes()[:match[2]])
+	out.WriteString(strconv.Itoa(len(stream)))
+	out.Write(dict.Bytes()[match[3]:])
+	out.WriteString("stream\n")
+	out.Write(stream)
+	out.WriteString("\nendstream\nendobj\n")
+	return nil
+}
+
+// encryptStrings copies text, an object's body, to out with every literal
+// and hexadecimal string encrypted, up to the stream or endobj keyword that
+// ends it, and returns where that keyword starts
+func encryptStrings(out *bytes.Buffer, text, key []byte) (int, error) {
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '(':
+			value, n, ok := readLiteral(text[i:])
+			if !ok {
+				return 0, errors.New("unterminated string")
+			}
+			out.WriteString("<" + hex.EncodeToString(encryptAES(key, value)) + ">")
+			i += n
+		case c == '<' && bytes.HasPrefix(text[i:], []byte("<<")):
+			out.WriteString("<<")
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(text[i:], '>')
+			if end < 0 {
+				return 0, errors.New("unterminated hexadecimal string")
+			}
+			digits := bytes.Join(bytes.Fields(text[i+1:i+end]), nil)
+			if len(digits)%2 != 0 {
+				digits = append(digits, '0')
+			}
+			value := make([]byte, hex.DecodedLen(len(digits)))
+			if _, err := hex.Decode(value, digits); err != nil {
+				return 0, err
+			}
+			out.WriteString("<" + hex.EncodeToString(encryptAES(key, value)) + ">")
+			i += end + 1
+		case bytes.HasPrefix(text[i:], []byte("stream\n")), bytes.HasPrefix(text[i:], []byte("endobj")):
+			return i, nil
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return 0, errors.New("no endobj")
+}
+
+// readLiteral reads the literal string at the start of text, undoing its
+// escapes, and returns its value and length
+func readLiteral(text []byte) ([]byte, int, bool) {
+	var value []byte
+	depth := 0
+	for i := 1; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\\':
+			i++
+			if i >= len(text) {
+				return nil, 0, false
+			}
+			switch e := text[i]; e {
+			case 'n':
+				value = append(value, '\n')
+			case 'r':
+				value = append(value, '\r')
+			case 't':
+				value = append(value, '\t')
+			case 'b':
+				value = append(value, '\b')
+			case 'f':
+				value = append(value, '\f')
+			case '\n':
+				// A line continuation
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				j := i
+				for j < len(text) && j < i+3 && text[j] >= '0' && text[j] <= '7' {
+					j++
+				}
+				octal, _ := strconv.ParseUint(string(text[i:j]), 8, 8)
+				value = append(value, byte(octal))
+				i = j - 1
+			default:
+				value = append(value, e)
+			}
+		case '(':
+			depth++
+			value = append(value, c)
+		case ')':
+			if depth == 0 {
+				return value, i + 1, true
+			}
+			depth--
+			value = append(value, c)
+		default:
+			value = append(value, c)
+		}
+	}
+	return nil, 0, false
+}
+
+// encryptAES encrypts data with AES-256 in CBC mode under a random
+// initialization vector, which precedes the result, as PDF strings and
+// streams are encrypted
+func encryptAES(key, data []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	encrypted := make([]byte, aes.BlockSize+len(data)+padding)
+	rand.Read(encrypted[:aes.BlockSize])
+	copy(encrypted[aes.BlockSize:], data)
+	for i := len(encrypted) - padding; i < len(encrypted); i++ {
+		encrypted[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, encrypted[:aes.BlockSize]).CryptBlocks(encrypted[aes.BlockSize:], encrypted[aes.BlockSize:])
+	return encrypted
+}
+
+// standardSecurity is the key material of the standard security handler's
+// revision 6: the file key, and the entries that let each password unlock
+// it
+type standardSecurity struct {
+	fileKey []byte
+	// user and owner are the /U and /O entries, which check the passwords,
+	// and userKey and ownerKey the /UE and /OE entries, the file key
+	// encrypted with each
+	user, owner       []byte
+	userKey, ownerKey []byte
+	// permissions is the /P entry, and perms the /Perms entry that holds it
+	// encrypted
+	permissions int32
+	perms       []byte
+}
+
+// newStandardSecurity creates a random file key and locks it with the user
+// and owner passwords, as ISO 32000-2 algorithms 8 to 10 describe
+func newStandardSecurity(userPassword, ownerPassword string, permissions int32) *standardSecurity {
+	s := &standardSecurity{fileKey: randomBytes(32), permissions: permissions}
+	user, owner := passwordBytes(userPassword), passwordBytes(ownerPassword)
+
+	validationSalt, keySalt := randomBytes(8), randomBytes(8)
+	s.user = slices.Concat(hashR6(user, validationSalt, nil), validationSalt, keySalt)
+	s.userKey = encryptKey(hashR6(user, keySalt, nil), s.fileKey)
+
+	validationSalt, keySalt = randomBytes(8), randomBytes(8)
+	s.owner = slices.Concat(hashR6(owner, validationSalt, s.user), validationSalt, keySalt)
+	s.ownerKey = encryptKey(hashR6(owner, keySalt, s.user), s.fileKey)
+
+	// The permissions are also stored encrypted with the file key, so that
+	// readers can tell they were not changed; T means the metadata is
+	// encrypted too
+	perms := binary.LittleEndian.AppendUint32(nil, uint32(permissions))
+	perms = append(perms, 0xFF, 0xFF, 0xFF, 0xFF, 'T', 'a', 'd', 'b')
+	perms = append(perms, randomBytes(4)...)
+	block, _ := aes.NewCipher(s.fileKey)
+	s.perms = make([]byte, aes.BlockSize)
+	block.Encrypt(s.perms, perms)
+	return s
+}
+
+// dictionary is the encryption dictionary
+func (s *standardSecurity) dictionary() string {
+	return fmt.Sprintf("<</Filter /Standard /V 5 /R 6 /Length 256\n"+
+		"/CF <</StdCF <</AuthEvent /DocOpen /CFM /AESV3 /Length 32>>>> /StmF /StdCF /StrF /StdCF\n"+
+		"/O <%x>\n/U <%x>\n/OE <%x>\n/UE <%x>\n/Perms <%x>\n/P %d /EncryptMetadata true>>",
+		s.owner, s.user, s.ownerKey, s.userKey, s.perms, s.permissions)
+}
+
+// hashR6 hashes a password with a salt and, for the owner password, the
+// user entry, as ISO 32000-2 algorithm 2.B describes: at least 64 rounds of
+// AES and SHA-2, which makes guessing passwords slow
+func hashR6(password, salt, user []byte) []byte {
+	sum := sha256.Sum256(slices.Concat(password, salt, user))
+	k := sum[:]
+	var e []byte
+	for round := 0; round < 64 || int(e[len(e)-1]) > round-32; round++ {
+		k1 := bytes.Repeat(slices.Concat(password, k, user), 64)
+		block, _ := aes.NewCipher(k[:16])
+		e = make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+		// The first 16 bytes of E, as a number, modulo 3 choose the hash;
+		// 256 is 1 modulo 3, so that is the sum of the bytes modulo 3
+		var remainder int
+		for _, b := range e[:16] {
+			remainder += int(b)
+		}
+		switch remainder % 3 {
+		case 0:
+			sum := sha256.Sum256(e)
+			k = sum[:]
+		case 1:
+			sum := sha512.Sum384(e)
+			k = sum[:]
+		default:
+			sum := sha512.Sum512(e)
+			k = sum[:]
+		}
+	}
+	return k[:32]
+}
+
+// encryptKey encrypts the file key with a key derived from a password, with
+// AES-256 in CBC mode, no initialization vector and no padding
+func encryptKey(key, fileKey []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	encrypted := make([]byte, len(fileKey))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(encrypted, fileKey)
+	return encrypted
+}
+
+// passwordBytes is a password as revision 6 uses it: UTF-8, at most 127
+// bytes
+func passwordBytes(password string) []byte {
+	b := []byte(password)
+	return b[:min(len(b), 127)]
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func randomHex(n int) string {
+	return hex.EncodeToString(randomBytes(n))
+}
+
+// writeXref writes a cross-reference table of offsets, one for each object
+// from zero, and a trailer whose document ID is a hash of the document so
+// far; extra holds any further trailer entries
+func writeXref(out *bytes.Buffer, offsets []int, root, info int, extra string) {
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	// The ID identifies the document by its content; both parts are the same
+	// until the document is updated
+	sum := md5.Sum(out.Bytes())
+	id := hex.EncodeToString(sum[:])
+	fmt.Fprintf(out, "trailer\n<<\n/Size %d\n/Root %d 0 R\n/Info %d 0 R\n%s/ID [<%s> <%s>]\n>>\nstartxref\n%d\n%%%%EOF\n", len(offsets), root, info, extra, id, id, xref)
+}
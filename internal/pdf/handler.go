@@ -1,23 +1,362 @@
 package pdf
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"mime"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"pdf-generator/internal/api"
+	"pdf-generator/internal/branding"
+	"pdf-generator/internal/envconfig"
+	"pdf-generator/internal/fonts"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/jobs"
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/metrics"
+	"pdf-generator/internal/protection"
+	"pdf-generator/internal/signing"
+	"pdf-generator/internal/verification"
+	"pdf-generator/internal/watermark"
+	"pdf-generator/internal/webhook"
 )
 
+const (
+	// DefaultFetchTimeout bounds fetching a student, including any authentication and retries
+	DefaultFetchTimeout = 15 * time.Second
+	// DefaultRenderTimeout bounds rendering a single PDF report
+	DefaultRenderTimeout = 10 * time.Second
+)
+
+// Server holds the dependencies shared by the report handlers
+type Server struct {
+	students         api.StudentSource
+	fetchTimeout     time.Duration
+	renderTimeout    time.Duration
+	batchConcurrency int
+	batchMaxStudents int
+	// jobs runs asynchronous report jobs; nil until StartJobs is called
+	jobs *jobs.Manager
+	// webhooks delivers job callbacks; nil if callbacks are disabled
+	webhooks *webhook.Sender
+	// publicBaseURL is the base of the links sent in callbacks and printed
+	// on issued reports
+	publicBaseURL string
+	// templates are the report layouts requests can choose from
+	templates *layout.Registry
+	// templateAdminToken, if set, is required to change templates
+	templateAdminToken string
+	// fonts print the text that the core fonts cannot encode
+	fonts *fonts.Set
+	// messages translate reports into the languages requests ask for
+	messages *i18n.Catalogs
+	// branding is the school's name, logo, colours and footer
+	branding *branding.Branding
+	// protection decides which reports are encrypted
+	protection *protection.Policy
+	// signer signs reports; nil if they are not signed
+	signer *signing.Signer
+	// verification records the reports the server issues, so that readers
+	// can check them
+	verification verification.Store
+	// watermarks decides which reports are watermarked and how
+	watermarks *watermark.Policy
+}
+
+// NewServer creates a Server that fetches student data from the given source.
+// Stage deadlines are read from STUDENT_FETCH_TIMEOUT and PDF_RENDER_TIMEOUT,
+// batch limits from BATCH_CONCURRENCY and BATCH_MAX_STUDENTS, the base of
+// links sent in job callbacks and printed on reports from PUBLIC_BASE_URL,
+// and the bearer token required to change templates from
+// TEMPLATE_ADMIN_TOKEN.
+func NewServer(students api.StudentSource) *Server {
+	return &Server{
+		students:           students,
+		fetchTimeout:       envconfig.Duration("STUDENT_FETCH_TIMEOUT", DefaultFetchTimeout, time.Nanosecond),
+		renderTimeout:      envconfig.Duration("PDF_RENDER_TIMEOUT", DefaultRenderTimeout, time.Nanosecond),
+		batchConcurrency:   envconfig.Int("BATCH_CONCURRENCY", DefaultBatchConcurrency, 1),
+		batchMaxStudents:   envconfig.Int("BATCH_MAX_STUDENTS", DefaultBatchMaxStudents, 1),
+		publicBaseURL:      strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/"),
+		templates:          layout.NewRegistry(),
+		templateAdminToken: os.Getenv("TEMPLATE_ADMIN_TOKEN"),
+		fonts:              fonts.Bundled(),
+		messages:           i18n.Bundled(),
+		branding:           branding.Default(),
+		protection:         protection.DefaultPolicy(),
+		verification:       verification.NewMemoryStore(),
+		watermarks:         watermark.DefaultPolicy(),
+	}
+}
+
+// SetTemplates replaces the report layouts, which default to the built-in
+// template only
+func (s *Server) SetTemplates(templates *layout.Registry) {
+	s.templates = templates
+}
+
+// SetFonts replaces the Unicode fonts, which default to the bundled family
+// only
+func (s *Server) SetFonts(fontSet *fonts.Set) {
+	s.fonts = fontSet
+}
+
+// SetMessages replaces the message catalogs, which default to the bundled
+// languages
+func (s *Server) SetMessages(messages *i18n.Catalogs) {
+	s.messages = messages
+}
+
+// SetBranding replaces the school branding, which defaults to the look of
+// the templates alone
+func (s *Server) SetBranding(b *branding.Branding) {
+	s.branding = b
+}
+
+// SetSigner makes the server sign the reports it issues with signer; nil
+// leaves them unsigned, as by default
+func (s *Server) SetSigner(signer *signing.Signer) {
+	s.signer = signer
+}
+
+// signerFor returns the signer of reports with the given options, or nil
+// for reports that are not issued, such as those of mock data or of student
+// JSON the caller sends, which must not carry the school's signature
+func (s *Server) signerFor(opts reportOptions) *signing.Signer {
+	if !opts.issued {
+		return nil
+	}
+	return s.signer
+}
+
+// fetchStudent loads a student within the fetch stage deadline
+func (s *Server) fetchStudent(ctx context.Context, id string) (*api.Student, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.fetchTimeout)
+	defer cancel()
+	return s.students.GetStudentByID(ctx, id)
+}
+
+// reportOptions are the choices a request makes about how its reports look
+// and how they are protected
+type reportOptions struct {
+	template *layout.Template
+	locale   i18n.Locale
+	// protection is how reports are encrypted, and password the password
+	// the caller chose for protection.Password
+	protection protection.Mode
+	password   string
+	// issued reports are signed with the server's signer, if it has one,
+	// and recorded for verification; only reports of the backend's student
+	// data are issued
+	issued bool
+	// watermark is printed over every page of the reports; nil for none
+	watermark *watermark.Watermark
+	// pdfa writes the reports as PDF/A-2b
+	pdfa bool
+}
+
+// newGenerator creates a PDF generator for reports with the given options
+func (s *Server) newGenerator(opts reportOptions, encryption *Encryption, v *Verification) *PDFGenerator {
+	return NewPDFGenerator(opts.template, Options{
+		Fonts:        s.fonts,
+		Locale:       opts.locale,
+		Messages:     s.messages.Catalog(opts.locale),
+		Branding:     s.branding,
+		Encryption:   encryption,
+		Signer:       s.signerFor(opts),
+		Verification: v,
+		Watermark:    opts.watermark,
+		PDFA:         opts.pdfa,
+	})
+}
+
+// renderReport renders a student report within the render stage deadline,
+// and records it for verification if it is issued
+func (s *Server) renderReport(ctx context.Context, opts reportOptions, student *api.Student) ([]byte, error) {
+	encryption, err := s.encryptionFor(opts, student)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.newVerification(opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.renderTimeout)
+	defer cancel()
+	pdfBytes, err := s.newGenerator(opts, encryption, v).GenerateStudentReport(ctx, student)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recordIssued(ctx, v, pdfBytes, student.ID); err != nil {
+		return nil, err
+	}
+	return pdfBytes, nil
+}
+
+// reportOptionsFor reads the template, language, protection, watermark and
+// PDF/A choice of a request for reports of reportType. It writes an error
+// response and returns false if any is invalid.
+func (s *Server) reportOptionsFor(w http.ResponseWriter, r *http.Request, reportType string) (reportOptions, bool) {
+	tmpl, ok := s.templateFor(w, r)
+	if !ok {
+		return reportOptions{}, false
+	}
+	locale, ok := s.localeFor(w, r)
+	if !ok {
+		return reportOptions{}, false
+	}
+	mode, password, ok := s.protectionFor(w, r, reportType)
+	if !ok {
+		return reportOptions{}, false
+	}
+	mark, ok := s.watermarkFor(w, r, reportType)
+	if !ok {
+		return reportOptions{}, false
+	}
+	archive, ok := s.pdfaFor(w, r, reportType, mode)
+	if !ok {
+		return reportOptions{}, false
+	}
+	return reportOptions{
+		template:   tmpl,
+		locale:     locale,
+		protection: mode,
+		password:   password,
+		issued:     issuedReport(reportType),
+		watermark:  mark,
+		pdfa:       archive,
+	}, true
+}
+
+// issuedReport reports whether reports of reportType are issued: built from
+// the student data the backend holds. Reports of mock data and of student
+// JSON the caller sends are neither signed nor recorded for verification,
+// so that they cannot pass for official ones.
+func issuedReport(reportType string) bool {
+	switch reportType {
+	case protection.ReportStudent, protection.ReportBatch, protection.ReportJob:
+		return true
+	default:
+		return false
+	}
+}
+
+// localeFor returns the locale named by the request's lang query parameter,
+// or else the best match for its Accept-Language header among the message
+// catalogs, or English. It writes a 400 response and returns false if lang
+// is not a valid tag.
+func (s *Server) localeFor(w http.ResponseWriter, r *http.Request) (i18n.Locale, bool) {
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		return s.messages.Negotiate(r.Header.Get("Accept-Language")), true
+	}
+	locale, err := i18n.Parse(lang)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid lang %q; expected a language tag such as en, ar or he", lang))
+		return i18n.Locale{}, false
+	}
+	return locale, true
+}
+
+// templateFor returns the layout named by the request's template query
+// parameter, or the default layout. It writes a 400 response and returns
+// false if the template does not exist.
+func (s *Server) templateFor(w http.ResponseWriter, r *http.Request) (*layout.Template, bool) {
+	name := r.URL.Query().Get("template")
+	tmpl, err := s.templates.Get(name)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown template %q; available templates: %s", name, strings.Join(s.templates.Names(), ", ")))
+		return nil, false
+	}
+	return tmpl, true
+}
+
+// handleStageError reports a failed fetch or render stage. Requests abandoned by
+// the client are logged and counted as cancelled rather than failed; other
+// errors are mapped to a status and a problem+json body that never echoes
+// upstream responses.
+func handleStageError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	ctx := r.Context()
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		slog.InfoContext(ctx, "Report request cancelled by client", "stage_error", err)
+		metrics.RecordReport(metrics.OutcomeCancelled)
+		return
+	}
+
+	metrics.RecordReport(metrics.OutcomeFailed)
+
+	// Upstream bodies may echo student data or tokens, which the redacting
+	// logger cannot recognize, so they are only logged when debugging
+	var upstreamErr *api.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		slog.ErrorContext(ctx, message, "error", err, "upstream_status", upstreamErr.StatusCode)
+		slog.DebugContext(ctx, "Upstream error response", "upstream_status", upstreamErr.StatusCode, "upstream_body", upstreamErr.Body)
+	} else {
+		slog.ErrorContext(ctx, message, "error", err)
+	}
+
+	var openErr *api.CircuitOpenError
+	if errors.As(err, &openErr) {
+		retryAfter := int((openErr.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	status, reason := errorStatus(err)
+	if reason != "" {
+		message += ": " + reason
+	}
+	writeProblem(w, r, status, message)
+}
+
+// errorStatus maps an error to a response status and a reason that is safe to
+// show to end users; the reason is empty for unexpected internal errors
+func errorStatus(err error) (int, string) {
+	var openErr *api.CircuitOpenError
+	var upstreamErr *api.UpstreamError
+	var netErr net.Error
+	var uncovered *uncoveredError
+	switch {
+	case errors.As(err, &openErr):
+		return http.StatusServiceUnavailable, "student service temporarily unavailable"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout, "timed out"
+	case errors.Is(err, api.ErrStudentNotFound):
+		return http.StatusNotFound, "student not found"
+	case errors.Is(err, api.ErrUpstreamUnavailable):
+		return http.StatusServiceUnavailable, "student service unavailable"
+	case errors.Is(err, api.ErrUnauthorized):
+		return http.StatusBadGateway, "student service rejected our credentials"
+	case errors.Is(err, api.ErrInvalidPayload):
+		return http.StatusBadGateway, "student service returned an invalid response"
+	case errors.Is(err, layout.ErrNotFound):
+		return http.StatusBadRequest, "template not found"
+	case errors.Is(err, protection.ErrNoDateOfBirth):
+		return http.StatusUnprocessableEntity, "student has no date of birth to protect the report with"
+	case errors.Is(err, errMergedDateOfBirth):
+		return http.StatusBadRequest, "a merged report cannot be protected with a date of birth"
+	case errors.As(err, &uncovered):
+		return http.StatusUnprocessableEntity, uncovered.Error()
+	case errors.As(err, &upstreamErr):
+		return http.StatusBadGateway, "unexpected response from student service"
+	default:
+		return http.StatusInternalServerError, ""
+	}
+}
+
 // GenerateStudentReport handles the GET /api/v1/students/:id/report endpoint
-func GenerateStudentReport(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GenerateStudentReport(w http.ResponseWriter, r *http.Request) {
 	// Extract student ID from URL path: /api/v1/students/{id}/report
 	path := strings.TrimPrefix(r.URL.Path, "/api/v1/students/")
 	parts := strings.Split(path, "/")
 	if len(parts) < 2 || parts[1] != "report" {
-		http.Error(w, "Invalid URL format. Expected: /api/v1/students/{id}/report", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, "Invalid URL format. Expected: /api/v1/students/{id}/report")
 		return
 	}
 
@@ -26,81 +365,166 @@ func GenerateStudentReport(w http.ResponseWriter, r *http.Request) {
 	// Validate student ID
 	studentID, err := strconv.Atoi(studentIDStr)
 	if err != nil {
-		http.Error(w, "Invalid student ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, "Invalid student ID")
 		return
 	}
 
-	log.Printf("Generating PDF report for student ID: %d", studentID)
+	opts, ok := s.reportOptionsFor(w, r, protection.ReportStudent)
+	if !ok {
+		return
+	}
 
-	apiClient := api.NewAPIClient()
+	ctx := r.Context()
+	slog.InfoContext(ctx, "Generating PDF report", "student_id", studentID)
 
-	student, err := apiClient.GetStudentByID(studentIDStr)
+	student, err := s.fetchStudent(ctx, studentIDStr)
 	if err != nil {
-		log.Printf("Error fetching student data: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to fetch student data: %v", err), http.StatusInternalServerError)
+		handleStageError(w, r, "Failed to fetch student data", err)
 		return
 	}
 
-	log.Printf("Successfully fetched student data for: %s", student.Name)
+	slog.InfoContext(ctx, "Fetched student data", "student", student)
 
 	// Generate PDF
-	pdfGenerator := NewPDFGenerator()
-	pdfBytes, err := pdfGenerator.GenerateStudentReport(student)
+	pdfBytes, err := s.renderReport(ctx, opts, student)
 	if err != nil {
-		log.Printf("Error generating PDF: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to generate PDF: %v", err), http.StatusInternalServerError)
+		handleStageError(w, r, "Failed to generate PDF", err)
 		return
 	}
 
-	log.Printf("Successfully generated PDF report (%d bytes)", len(pdfBytes))
+	metrics.RecordReport(metrics.OutcomeSucceeded)
+	slog.InfoContext(ctx, "Generated PDF report", "student_id", studentID, "bytes", len(pdfBytes))
 
 	w.Header().Set("Content-Type", "application/pdf")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"student_%d_report.pdf\"", studentID))
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(pdfBytes)))
 
 	if _, err := w.Write(pdfBytes); err != nil {
-		log.Printf("Error writing PDF to response: %v", err)
+		slog.ErrorContext(ctx, "Error writing PDF to response", "student_id", studentID, "error", err)
 		return
 	}
 
-	log.Printf("PDF report successfully sent for student ID: %d", studentID)
+	slog.InfoContext(ctx, "PDF report sent", "student_id", studentID)
 }
 
 // GenerateTestReport handles the test endpoint with mock data
-func GenerateTestReport(w http.ResponseWriter, _ *http.Request) {
-	log.Println("Generating test PDF report with mock data")
+func (s *Server) GenerateTestReport(w http.ResponseWriter, r *http.Request) {
+	opts, ok := s.reportOptionsFor(w, r, protection.ReportTest)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	slog.InfoContext(ctx, "Generating test PDF report with mock data", "template", opts.template.Name, "lang", opts.locale)
 
 	student := api.GetMockStudent()
 
-	pdfGenerator := NewPDFGenerator()
-	pdfBytes, err := pdfGenerator.GenerateStudentReport(student)
+	pdfBytes, err := s.renderReport(ctx, opts, student)
 	if err != nil {
-		log.Printf("Error generating test PDF: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to generate test PDF: %v", err), http.StatusInternalServerError)
+		handleStageError(w, r, "Failed to generate test PDF", err)
 		return
 	}
 
-	log.Printf("Successfully generated test PDF report (%d bytes)", len(pdfBytes))
+	slog.InfoContext(ctx, "Generated test PDF report", "bytes", len(pdfBytes))
 
 	w.Header().Set("Content-Type", "application/pdf")
 	w.Header().Set("Content-Disposition", "attachment; filename=\"test_student_report.pdf\"")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(pdfBytes)))
 
 	if _, err := w.Write(pdfBytes); err != nil {
-		log.Printf("Error writing test PDF to response: %v", err)
+		slog.ErrorContext(ctx, "Error writing test PDF to response", "error", err)
 		return
 	}
 
-	log.Println("Test PDF report successfully sent")
+	slog.InfoContext(ctx, "Test PDF report sent")
 }
 
-func HealthCheck(w http.ResponseWriter, _ *http.Request) {
+// maxStudentBodyBytes bounds the JSON body accepted by RenderStudentReport
+const maxStudentBodyBytes = 1 << 20
+
+// RenderStudentReport handles the POST /api/v1/reports/student endpoint, rendering
+// a report for student data supplied in the request body instead of fetched from
+// the Node.js backend
+func (s *Server) RenderStudentReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Use POST with a student JSON body")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+
+	opts, ok := s.reportOptionsFor(w, r, protection.ReportRender)
+	if !ok {
+		return
+	}
+
+	var student api.Student
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxStudentBodyBytes)).Decode(&student); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, "Student data is too large")
+			return
+		}
+		writeProblem(w, r, http.StatusBadRequest, "Invalid student JSON")
+		return
+	}
+
+	ctx := r.Context()
+
+	var validationErr *api.ValidationError
+	if err := student.Validate(); errors.As(err, &validationErr) {
+		slog.InfoContext(ctx, "Rejected invalid student data", "error", err)
+		writeValidationProblem(w, r, validationErr)
+		return
+	}
+
+	slog.InfoContext(ctx, "Rendering PDF report from request body", "student", &student)
+
+	pdfBytes, err := s.renderReport(ctx, opts, &student)
+	if err != nil {
+		handleStageError(w, r, "Failed to generate PDF", err)
+		return
+	}
+
+	metrics.RecordReport(metrics.OutcomeSucceeded)
+	slog.InfoContext(ctx, "Generated PDF report", "student_id", student.ID, "bytes", len(pdfBytes))
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"student_%d_report.pdf\"", student.ID))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(pdfBytes)))
+
+	if _, err := w.Write(pdfBytes); err != nil {
+		slog.ErrorContext(ctx, "Error writing PDF to response", "student_id", student.ID, "error", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "PDF report sent", "student_id", student.ID)
+}
+
+// HealthCheck handles the GET /health endpoint. The service reports itself
+// degraded while the circuit breaker to the student backend is not closed.
+func (s *Server) HealthCheck(w http.ResponseWriter, _ *http.Request) {
 	response := map[string]interface{}{
 		"status":  "healthy",
 		"service": "pdf",
 		"version": "1.0.0",
 	}
 
+	if reporter, ok := s.students.(api.BreakerReporter); ok {
+		breaker := reporter.BreakerSnapshot()
+		response["upstream"] = map[string]interface{}{
+			"circuitBreaker": breaker,
+		}
+		if breaker.State != api.BreakerClosed.String() {
+			response["status"] = "degraded"
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
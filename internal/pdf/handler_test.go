@@ -1,23 +1,85 @@
 package pdf
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/fakebackend"
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/metrics"
 )
 
+// memorySource is an in-memory api.StudentSource used by the handler tests
+type memorySource struct {
+	students map[string]*api.Student
+}
+
+func newMemorySource(students ...*api.Student) *memorySource {
+	src := &memorySource{students: make(map[string]*api.Student)}
+	for _, student := range students {
+		src.students[fmt.Sprintf("%d", student.ID)] = student
+	}
+	return src
+}
+
+func (m *memorySource) GetStudentByID(_ context.Context, id string) (*api.Student, error) {
+	student, ok := m.students[id]
+	if !ok {
+		return nil, fmt.Errorf("student %s: %w", id, api.ErrStudentNotFound)
+	}
+	return student, nil
+}
+
+func (m *memorySource) ListStudents(_ context.Context, filter api.StudentFilter) ([]*api.Student, error) {
+	var students []*api.Student
+	for _, student := range m.students {
+		if filter.Class != "" && api.GetValueOrNA(student.Class) != filter.Class {
+			continue
+		}
+		if filter.Section != "" && api.GetValueOrNA(student.Section) != filter.Section {
+			continue
+		}
+		students = append(students, student)
+	}
+	sort.Slice(students, func(i, j int) bool { return students[i].ID < students[j].ID })
+	return students, nil
+}
+
+// testPublicBaseURL is the PUBLIC_BASE_URL of test servers, which issued
+// reports need for their verification links
+const testPublicBaseURL = "https://reports.example.edu"
+
+func TestMain(m *testing.M) {
+	os.Setenv("PUBLIC_BASE_URL", testPublicBaseURL)
+	os.Exit(m.Run())
+}
+
+func newTestServer() *Server {
+	return NewServer(newMemorySource(api.GetMockStudent()))
+}
+
 func TestHealthCheck(t *testing.T) {
 	req, err := http.NewRequest("GET", "/health", nil)
 	require.NoError(t, err)
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(HealthCheck)
+	handler := http.HandlerFunc(newTestServer().HealthCheck)
 
 	handler.ServeHTTP(rr, req)
 
@@ -37,7 +99,7 @@ func TestGenerateTestReport(t *testing.T) {
 	require.NoError(t, err)
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GenerateTestReport)
+	handler := http.HandlerFunc(newTestServer().GenerateTestReport)
 
 	handler.ServeHTTP(rr, req)
 
@@ -59,58 +121,181 @@ func TestGenerateStudentReport_ValidID(t *testing.T) {
 	require.NoError(t, err)
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GenerateStudentReport)
+	handler := http.HandlerFunc(newTestServer().GenerateStudentReport)
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "student_1_report.pdf")
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "%PDF"), "Response should be a valid PDF")
+}
+
+func TestGenerateStudentReport_NotFound(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/students/2/report", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(newTestServer().GenerateStudentReport)
 
 	handler.ServeHTTP(rr, req)
 
-	// Note: This test will fail if the Node.js API is not running or authentication fails
-	// For unit testing, we would need to mock the API client
-	// For now, we just check that the URL parsing works correctly
-	if rr.Code == http.StatusInternalServerError {
-		assert.Contains(t, rr.Body.String(), "Failed to fetch student data")
-	} else if rr.Code == http.StatusOK {
-		assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
-		assert.Contains(t, rr.Header().Get("Content-Disposition"), "student_1_report.pdf")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, "Not Found", problem.Title)
+	assert.Contains(t, problem.Detail, "Failed to fetch student data")
+	assert.Equal(t, "/api/v1/students/2/report", problem.Instance)
+}
+
+// errorSource fails every lookup with the configured error
+type errorSource struct {
+	err error
+}
+
+func (e errorSource) GetStudentByID(context.Context, string) (*api.Student, error) {
+	return nil, e.err
+}
+
+func TestGenerateStudentReport_UpstreamErrorMapping(t *testing.T) {
+	const leakedBody = `{"stack":"at db.query (/srv/app/secret.js:42)"}`
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{
+			name:           "Not found",
+			err:            &api.UpstreamError{Kind: api.ErrStudentNotFound, StatusCode: 404, Body: leakedBody},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Unauthorized",
+			err:            &api.UpstreamError{Kind: api.ErrUnauthorized, StatusCode: 401, Body: leakedBody},
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:           "Unavailable",
+			err:            &api.UpstreamError{Kind: api.ErrUpstreamUnavailable, StatusCode: 503, Body: leakedBody},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Invalid payload",
+			err:            &api.UpstreamError{Kind: api.ErrInvalidPayload, Err: fmt.Errorf("bad json")},
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:           "Unexpected status",
+			err:            &api.UpstreamError{StatusCode: 418, Body: leakedBody},
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:           "Deadline exceeded",
+			err:            fmt.Errorf("fetch: %w", context.DeadlineExceeded),
+			expectedStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:           "Unknown",
+			err:            fmt.Errorf("boom"),
+			expectedStatus: http.StatusInternalServerError,
+		},
 	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/students/1/report", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(NewServer(errorSource{err: tt.err}).GenerateStudentReport)
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			assert.NotContains(t, rr.Body.String(), "secret.js")
+			assert.NotContains(t, rr.Body.String(), "boom")
+		})
+	}
+}
+
+func TestGenerateStudentReport_UpstreamBodyNotLogged(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	err := &api.UpstreamError{Kind: api.ErrUpstreamUnavailable, StatusCode: 503, Body: `{"name":"John Doe","dob":"2010-05-15"}`}
+	req := httptest.NewRequest("GET", "/api/v1/students/1/report", nil)
+	rr := httptest.NewRecorder()
+	NewServer(errorSource{err: err}).GenerateStudentReport(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, logs.String(), `"upstream_status":503`)
+	assert.NotContains(t, logs.String(), "John Doe")
 }
 
 func TestGenerateStudentReport_Integration(t *testing.T) {
+	backend := fakebackend.Start(fakebackend.Config{})
+	t.Cleanup(backend.Close)
+
+	t.Setenv("NODE_API_URL", backend.URL())
+	t.Setenv("AUTH_EMAIL", fakebackend.DefaultEmail)
+	t.Setenv("AUTH_PASSWORD", fakebackend.DefaultPassword)
+	t.Setenv("API_RETRY_BASE_DELAY", "1ms")
+
+	server := NewServer(api.NewAPIClient())
+
 	tests := []struct {
 		name           string
 		path           string
+		fault          *fakebackend.Fault
 		expectedStatus int
-		shouldCallFunc bool
 	}{
 		{
 			name:           "Valid report endpoint",
 			path:           "/api/v1/students/1/report",
-			expectedStatus: http.StatusInternalServerError, // Expected if Node.js API unavailable
-			shouldCallFunc: true,
+			expectedStatus: http.StatusOK,
 		},
 		{
 			name:           "Invalid ID",
 			path:           "/api/v1/students/abc/report",
 			expectedStatus: http.StatusBadRequest,
-			shouldCallFunc: true,
+		},
+		{
+			name:           "Unknown student",
+			path:           "/api/v1/students/999/report",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Backend unavailable",
+			path:           "/api/v1/students/1/report",
+			fault:          &fakebackend.Fault{Status: http.StatusServiceUnavailable, Times: 3},
+			expectedStatus: http.StatusServiceUnavailable,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			backend.ClearFaults()
+			if tt.fault != nil {
+				backend.InjectFault(fakebackend.RouteStudents, *tt.fault)
+			}
+
 			req, err := http.NewRequest("GET", tt.path, nil)
 			require.NoError(t, err)
 
 			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.GenerateStudentReport).ServeHTTP(rr, req)
 
-			if tt.shouldCallFunc {
-				handler := http.HandlerFunc(GenerateStudentReport)
-				handler.ServeHTTP(rr, req)
-
-				if tt.expectedStatus == http.StatusBadRequest {
-					assert.Equal(t, tt.expectedStatus, rr.Code)
-				} else {
-					assert.True(t, rr.Code == http.StatusOK || rr.Code == http.StatusInternalServerError)
-				}
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+				assert.True(t, strings.HasPrefix(rr.Body.String(), "%PDF"))
 			}
 		})
 	}
@@ -145,7 +330,7 @@ func TestGenerateStudentReport_InvalidID(t *testing.T) {
 			require.NoError(t, err)
 
 			rr := httptest.NewRecorder()
-			handler := http.HandlerFunc(GenerateStudentReport)
+			handler := http.HandlerFunc(newTestServer().GenerateStudentReport)
 
 			handler.ServeHTTP(rr, req)
 
@@ -205,3 +390,277 @@ func TestGenerateStudentReport_URLParsing(t *testing.T) {
 		})
 	}
 }
+
+// blockingSource never returns a student until its context is done
+type blockingSource struct{}
+
+func (blockingSource) GetStudentByID(ctx context.Context, _ string) (*api.Student, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGenerateStudentReport_ClientCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "/api/v1/students/1/report", nil)
+	require.NoError(t, err)
+
+	before := metrics.ReportCount(metrics.OutcomeCancelled)
+	failedBefore := metrics.ReportCount(metrics.OutcomeFailed)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(NewServer(blockingSource{}).GenerateStudentReport)
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, before+1, metrics.ReportCount(metrics.OutcomeCancelled))
+	assert.Equal(t, failedBefore, metrics.ReportCount(metrics.OutcomeFailed))
+	assert.Empty(t, rr.Body.String())
+}
+
+func TestGenerateStudentReport_FetchTimeout(t *testing.T) {
+	t.Setenv("STUDENT_FETCH_TIMEOUT", "10ms")
+
+	req, err := http.NewRequest("GET", "/api/v1/students/1/report", nil)
+	require.NoError(t, err)
+
+	before := metrics.ReportCount(metrics.OutcomeFailed)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(NewServer(blockingSource{}).GenerateStudentReport)
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to fetch student data")
+	assert.Equal(t, before+1, metrics.ReportCount(metrics.OutcomeFailed))
+}
+
+// openBreakerSource behaves like an APIClient whose circuit breaker is open
+type openBreakerSource struct{}
+
+func (openBreakerSource) GetStudentByID(context.Context, string) (*api.Student, error) {
+	return nil, fmt.Errorf("failed: %w", &api.CircuitOpenError{RetryAfter: 2500 * time.Millisecond})
+}
+
+func (openBreakerSource) BreakerSnapshot() api.BreakerSnapshot {
+	return api.BreakerSnapshot{State: api.BreakerOpen.String(), ConsecutiveFailures: 5, RetryAfterSeconds: 3}
+}
+
+func TestGenerateStudentReport_CircuitOpen(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/students/1/report", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(NewServer(openBreakerSource{}).GenerateStudentReport)
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "3", rr.Header().Get("Retry-After"))
+}
+
+func TestHealthCheck_ReportsBreakerState(t *testing.T) {
+	req, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(NewServer(openBreakerSource{}).HealthCheck)
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Status   string `json:"status"`
+		Upstream struct {
+			CircuitBreaker api.BreakerSnapshot `json:"circuitBreaker"`
+		} `json:"upstream"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+
+	assert.Equal(t, "degraded", response.Status)
+	assert.Equal(t, "open", response.Upstream.CircuitBreaker.State)
+	assert.Equal(t, 3, response.Upstream.CircuitBreaker.RetryAfterSeconds)
+}
+
+func TestRenderStudentReport(t *testing.T) {
+	body, err := json.Marshal(api.GetMockStudent())
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/api/v1/reports/student", strings.NewReader(string(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(newTestServer().RenderStudentReport)
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "student_1_report.pdf")
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "%PDF"), "Response should be a valid PDF")
+}
+
+func TestRenderStudentReport_Rejections(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		contentType    string
+		body           string
+		expectedStatus int
+		invalidFields  []string
+	}{
+		{
+			name:           "Wrong method",
+			method:         "GET",
+			contentType:    "application/json",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "Wrong content type",
+			method:         "POST",
+			contentType:    "text/plain",
+			body:           `{}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "Malformed JSON",
+			method:         "POST",
+			contentType:    "application/json",
+			body:           `{"id":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Too large",
+			method:         "POST",
+			contentType:    "application/json",
+			body:           `{"name":"` + strings.Repeat("a", maxStudentBodyBytes) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "Invalid fields",
+			method:         "POST",
+			contentType:    "application/json",
+			body:           `{"id":0,"name":" ","email":"not-an-email","dob":"15/05/1995","roll":-1}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			invalidFields:  []string{"dob", "email", "id", "name", "roll"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/api/v1/reports/student", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(newTestServer().RenderStudentReport)
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+
+			var fields []string
+			for _, param := range problem.InvalidParams {
+				fields = append(fields, param.Field)
+			}
+			assert.Equal(t, tt.invalidFields, fields)
+		})
+	}
+}
+
+// newTemplateTestServer returns a test server that also offers a US Letter
+// landscape layout named "letter"
+func newTemplateTestServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	source := `
+name: letter
+page: {orientation: L, size: Letter}
+blocks:
+  - type: text
+    text: "{{name}}"
+  - type: table
+    columns: [{header: Relation}, {header: Name}]
+    cells: [[Father, "{{fatherName}}"]]
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "letter.yaml"), []byte(source), 0o644))
+	templates, err := layout.LoadDir(dir)
+	require.NoError(t, err)
+
+	server := newTestServer()
+	server.SetTemplates(templates)
+	return server
+}
+
+func TestGenerateTestReport_Template(t *testing.T) {
+	server := newTemplateTestServer(t)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		mediaBox       string
+	}{
+		{"Default", "", http.StatusOK, "/MediaBox [0 0 595.28 841.89]"},
+		{"Named default", "?template=default", http.StatusOK, "/MediaBox [0 0 595.28 841.89]"},
+		{"Custom", "?template=letter", http.StatusOK, "/MediaBox [0 0 792.00 612.00]"},
+		{"Unknown", "?template=missing", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/test/report"+tt.query, nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.GenerateTestReport).ServeHTTP(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.mediaBox != "" {
+				assert.Contains(t, rr.Body.String(), tt.mediaBox)
+			} else {
+				assert.Contains(t, rr.Body.String(), `Unknown template \"missing\"; available templates: default, letter`)
+			}
+		})
+	}
+}
+
+func TestGenerateTestReport_Lang(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"Default", "", http.StatusOK},
+		{"Left to right", "?lang=fr", http.StatusOK},
+		{"Right to left", "?lang=ar-EG", http.StatusOK},
+		{"Invalid", "?lang=!!", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/test/report"+tt.query, nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.GenerateTestReport).ServeHTTP(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.Contains(t, rr.Body.String(), `Invalid lang \"!!\"`)
+			} else {
+				assert.True(t, strings.HasPrefix(rr.Body.String(), "%PDF"))
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package pdf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/jobs"
+	"pdf-generator/internal/metrics"
+	"pdf-generator/internal/protection"
+	"pdf-generator/internal/webhook"
+)
+
+// jobsPath is the route prefix of the asynchronous report job endpoints
+const jobsPath = "/api/v1/jobs"
+
+// JobRequest is the body of POST /api/v1/jobs: a batch request plus an
+// optional URL to notify when the job finishes
+type JobRequest struct {
+	BatchRequest
+	CallbackURL string `json:"callbackUrl"`
+}
+
+// jobEvent is the signed JSON body POSTed to a job's callback URL
+type jobEvent struct {
+	JobID string `json:"jobId"`
+	// StudentID is set for single-student jobs
+	StudentID   int         `json:"studentId,omitempty"`
+	StudentIDs  []int       `json:"studentIds"`
+	Status      jobs.Status `json:"status"`
+	DownloadURL string      `json:"downloadUrl,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	FinishedAt  time.Time   `json:"finishedAt"`
+}
+
+// jobResponse is the JSON representation of a job with links to poll it and,
+// once it has succeeded, to download its result
+type jobResponse struct {
+	*jobs.Job
+	StatusURL string `json:"statusUrl"`
+	ResultURL string `json:"resultUrl,omitempty"`
+}
+
+func newJobResponse(job *jobs.Job) jobResponse {
+	response := jobResponse{Job: job, StatusURL: jobsPath + "/" + job.ID}
+	if job.Status == jobs.StatusSucceeded {
+		response.ResultURL = response.StatusURL + "/result"
+	}
+	return response
+}
+
+// StartJobs starts the asynchronous report job workers, configured from the
+// environment, on the given store. Jobs left unfinished in the store by a
+// previous process are resumed. The workers stop when ctx is done. Callbacks
+// are only accepted when WEBHOOK_SECRET is set.
+func (s *Server) StartJobs(ctx context.Context, store jobs.Store) (*jobs.Manager, error) {
+	manager := jobs.NewManager(store, s.runJob, jobs.NewConfigFromEnv())
+
+	sender, err := webhook.NewSenderFromEnv()
+	switch {
+	case errors.Is(err, webhook.ErrNotConfigured):
+		slog.InfoContext(ctx, "Report job callbacks disabled; set WEBHOOK_SECRET to enable them")
+	case err != nil:
+		return nil, fmt.Errorf("failed to configure webhooks: %w", err)
+	default:
+		s.webhooks = sender
+		manager.SetNotifier(s.notifyJob)
+	}
+
+	if err := manager.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start report jobs: %w", err)
+	}
+	s.jobs = manager
+	return manager, nil
+}
+
+// CreateReportJob handles the POST /api/v1/jobs endpoint. It accepts the same
+// body as GenerateBatchReport and returns 202 with the queued job. A job for a
+// single student produces that student's PDF unless a ZIP is requested. The
+// layout version chosen with ?template= and the language chosen with ?lang=
+// are stored on the job.
+func (s *Server) CreateReportJob(w http.ResponseWriter, r *http.Request) {
+	if s.jobs == nil {
+		writeProblem(w, r, http.StatusNotImplemented, "Asynchronous report jobs are not enabled")
+		return
+	}
+
+	var req JobRequest
+	if !decodeBatchRequest(w, r, &req) {
+		return
+	}
+	opts, ok := s.reportOptionsFor(w, r, protection.ReportJob)
+	if !ok {
+		return
+	}
+	if opts.protection == protection.Password {
+		writeProblem(w, r, http.StatusBadRequest, passwordHeader+" cannot be used with jobs, which are stored until they run; use protect=restrict or protect=dob")
+		return
+	}
+
+	if req.CallbackURL != "" {
+		if s.webhooks == nil {
+			writeProblem(w, r, http.StatusNotImplemented, "Callbacks are not enabled on this server")
+			return
+		}
+		if err := s.webhooks.ValidateURL(req.CallbackURL); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "Invalid callbackUrl: "+err.Error())
+			return
+		}
+	}
+
+	ids, ok := s.resolveBatchIDs(w, r, req.BatchRequest)
+	if !ok {
+		return
+	}
+
+	if req.Format == "" {
+		req.Format = BatchFormatZip
+		if len(ids) == 1 {
+			req.Format = BatchFormatPDF
+		}
+	}
+	if req.Format == BatchFormatPDF && len(ids) > 1 && opts.protection == protection.DateOfBirth {
+		writeProblem(w, r, http.StatusBadRequest, `A merged PDF cannot be protected with each student's date of birth; use format "zip"`)
+		return
+	}
+
+	ctx := r.Context()
+	job, err := s.jobs.Submit(ctx, jobs.Request{
+		StudentIDs:      ids,
+		Format:          req.Format,
+		Template:        opts.template.Name,
+		TemplateVersion: opts.template.Version,
+		Locale:          opts.locale.String(),
+		Protection:      string(opts.protection),
+		Watermark:       opts.watermark,
+		PDFA:            opts.pdfa,
+		CallbackURL:     req.CallbackURL,
+	})
+	if errors.Is(err, jobs.ErrQueueFull) {
+		slog.WarnContext(ctx, "Rejected report job", "error", err)
+		writeProblem(w, r, http.StatusServiceUnavailable, "Too many report jobs are queued; try again later")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create report job", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "Failed to create report job")
+		return
+	}
+
+	response := newJobResponse(job)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", response.StatusURL)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetReportJob handles GET /api/v1/jobs/{id}, reporting a job's status and
+// progress, and GET /api/v1/jobs/{id}/result, streaming its output
+func (s *Server) GetReportJob(w http.ResponseWriter, r *http.Request) {
+	if s.jobs == nil {
+		writeProblem(w, r, http.StatusNotImplemented, "Asynchronous report jobs are not enabled")
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Use GET to read a report job")
+		return
+	}
+
+	// Extract the job ID from /api/v1/jobs/{id} or /api/v1/jobs/{id}/result
+	path := strings.TrimPrefix(r.URL.Path, jobsPath+"/")
+	parts := strings.Split(path, "/")
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "result") {
+		writeProblem(w, r, http.StatusNotFound, "Expected: /api/v1/jobs/{id} or /api/v1/jobs/{id}/result")
+		return
+	}
+
+	ctx := r.Context()
+	job, err := s.jobs.Get(ctx, parts[0])
+	if errors.Is(err, jobs.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, "Report job not found or expired")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load report job", "job_id", parts[0], "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "Failed to load report job")
+		return
+	}
+
+	if len(parts) == 1 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newJobResponse(job))
+		return
+	}
+
+	s.writeJobResult(w, r, job)
+}
+
+// writeJobResult streams the output of a succeeded job
+func (s *Server) writeJobResult(w http.ResponseWriter, r *http.Request, job *jobs.Job) {
+	ctx := r.Context()
+	switch job.Status {
+	case jobs.StatusSucceeded:
+	case jobs.StatusFailed:
+		writeProblem(w, r, http.StatusConflict, "Report job failed: "+job.Error)
+		return
+	default:
+		w.Header().Set("Retry-After", "1")
+		writeProblem(w, r, http.StatusConflict, fmt.Sprintf("Report job is %s", job.Status))
+		return
+	}
+
+	result, size, err := s.jobs.OpenResult(ctx, job.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to open report job result", "job_id", job.ID, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "Failed to load report job result")
+		return
+	}
+	defer result.Close()
+
+	w.Header().Set("Content-Type", job.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", job.Filename))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+
+	if _, err := io.Copy(w, result); err != nil {
+		slog.ErrorContext(ctx, "Error writing report job result to response", "job_id", job.ID, "error", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Report job result sent", "job_id", job.ID, "bytes", size)
+}
+
+// notifyJob POSTs a finished job's outcome to its callback URL
+func (s *Server) notifyJob(ctx context.Context, job *jobs.Job, record func(webhook.Attempt)) error {
+	event := jobEvent{
+		JobID:      job.ID,
+		StudentIDs: job.StudentIDs,
+		Status:     job.Status,
+		Error:      job.Error,
+		FinishedAt: job.UpdatedAt.UTC(),
+	}
+	if len(job.StudentIDs) == 1 {
+		event.StudentID = job.StudentIDs[0]
+	}
+	if job.Status == jobs.StatusSucceeded {
+		event.DownloadURL = s.publicBaseURL + newJobResponse(job).ResultURL
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job event: %w", err)
+	}
+	return s.webhooks.Deliver(ctx, job.Callback.URL, "report.job."+string(job.Status), body, record)
+}
+
+// runJob generates the output of a report job: a single report for a one
+// student PDF job, otherwise a batch
+func (s *Server) runJob(ctx context.Context, job *jobs.Job, progress func(int)) (*jobs.Result, error) {
+	opts, err := s.jobReportOptions(ctx, job)
+	if err != nil {
+		return nil, jobFailure(ctx, job, err)
+	}
+
+	if len(job.StudentIDs) == 1 && job.Format == BatchFormatPDF {
+		id := job.StudentIDs[0]
+		student, err := s.fetchStudent(ctx, strconv.Itoa(id))
+		if err != nil {
+			return nil, jobFailure(ctx, job, err)
+		}
+		pdfBytes, err := s.renderReport(ctx, opts, student)
+		if err != nil {
+			return nil, jobFailure(ctx, job, err)
+		}
+		progress(1)
+
+		metrics.RecordReport(metrics.OutcomeSucceeded)
+		return &jobs.Result{
+			Data:        pdfBytes,
+			ContentType: "application/pdf",
+			Filename:    fmt.Sprintf("student_%d_report.pdf", id),
+		}, nil
+	}
+
+	var completed atomic.Int64
+	result, err := s.runBatch(ctx, opts, job.StudentIDs, job.Format, func() {
+		progress(int(completed.Add(1)))
+	})
+	if err != nil {
+		return nil, jobFailure(ctx, job, err)
+	}
+
+	metrics.RecordReport(metrics.OutcomeSucceeded)
+	return &jobs.Result{
+		Data:        result.body,
+		ContentType: result.contentType,
+		Filename:    result.filename,
+	}, nil
+}
+
+// jobReportOptions restores the report options a job was created with
+func (s *Server) jobReportOptions(ctx context.Context, job *jobs.Job) (reportOptions, error) {
+	tmpl, err := s.templates.Version(ctx, job.Template, job.TemplateVersion)
+	if err != nil {
+		return reportOptions{}, err
+	}
+	locale, err := i18n.Parse(job.Locale)
+	if err != nil {
+		return reportOptions{}, err
+	}
+	mode, err := protection.ParseMode(job.Protection)
+	if err != nil {
+		return reportOptions{}, err
+	}
+	return reportOptions{
+		template:   tmpl,
+		locale:     locale,
+		protection: mode,
+		issued:     true,
+		watermark:  job.Watermark,
+		pdfa:       job.PDFA,
+	}, nil
+}
+
+// jobFailure logs why a job failed and returns an error whose message is safe
+// to store on the job and show to end users
+func jobFailure(ctx context.Context, job *jobs.Job, err error) error {
+	if ctx.Err() != nil {
+		// The job was interrupted by shutdown and will be resumed
+		return err
+	}
+
+	metrics.RecordReport(metrics.OutcomeFailed)
+	slog.ErrorContext(ctx, "Report job failed", "job_id", job.ID, "error", err)
+
+	_, reason := errorStatus(err)
+	if reason == "" {
+		reason = "report could not be generated"
+	}
+	return errors.New(reason)
+}
@@ -0,0 +1,325 @@
+package pdf
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/jobs"
+	"pdf-generator/internal/webhook"
+)
+
+// newJobTestServer returns a batch test server whose job workers stop when
+// the test ends
+func newJobTestServer(t *testing.T) *Server {
+	t.Helper()
+	return startTestJobs(t, newBatchTestServer())
+}
+
+// startTestJobs starts the server's job workers until the test ends
+func startTestJobs(t *testing.T, server *Server) *Server {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	manager, err := server.StartJobs(ctx, jobs.NewMemoryStore())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cancel()
+		manager.Wait()
+	})
+	return server
+}
+
+func postJob(t *testing.T, server *Server, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", "/api/v1/jobs", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.CreateReportJob).ServeHTTP(rr, req)
+	return rr
+}
+
+func getJob(t *testing.T, server *Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", path, nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GetReportJob).ServeHTTP(rr, req)
+	return rr
+}
+
+// waitForJobStatus polls the status endpoint until the job has finished
+func waitForJobStatus(t *testing.T, server *Server, statusURL string) map[string]interface{} {
+	t.Helper()
+
+	var status map[string]interface{}
+	require.Eventually(t, func() bool {
+		rr := getJob(t, server, statusURL)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		return status["status"] == "succeeded" || status["status"] == "failed"
+	}, 5*time.Second, 5*time.Millisecond)
+	return status
+}
+
+func TestReportJob_SingleStudent(t *testing.T) {
+	server := newJobTestServer(t)
+
+	rr := postJob(t, server, `{"studentIds":[1]}`)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+
+	var created map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	id, _ := created["id"].(string)
+	require.NotEmpty(t, id)
+	assert.Equal(t, "/api/v1/jobs/"+id, rr.Header().Get("Location"))
+	assert.Equal(t, "/api/v1/jobs/"+id, created["statusUrl"])
+	assert.Equal(t, "pdf", created["format"])
+
+	status := waitForJobStatus(t, server, "/api/v1/jobs/"+id)
+	assert.Equal(t, "succeeded", status["status"])
+	assert.Equal(t, map[string]interface{}{"completed": float64(1), "total": float64(1)}, status["progress"])
+	assert.Equal(t, "/api/v1/jobs/"+id+"/result", status["resultUrl"])
+
+	rr = getJob(t, server, "/api/v1/jobs/"+id+"/result")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="student_1_report.pdf"`, rr.Header().Get("Content-Disposition"))
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "%PDF"))
+}
+
+func TestReportJob_Batch(t *testing.T) {
+	server := newJobTestServer(t)
+
+	rr := postJob(t, server, `{"class":"Grade 10"}`)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	location := rr.Header().Get("Location")
+
+	status := waitForJobStatus(t, server, location)
+	assert.Equal(t, "succeeded", status["status"])
+	assert.Equal(t, "zip", status["format"])
+	assert.Equal(t, map[string]interface{}{"completed": float64(3), "total": float64(3)}, status["progress"])
+
+	rr = getJob(t, server, location+"/result")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	files := readZip(t, rr.Body.Bytes())
+	assert.Contains(t, files, "manifest.json")
+	assert.Contains(t, files, "student_3_report.pdf")
+}
+
+func TestReportJob_Failed(t *testing.T) {
+	server := newJobTestServer(t)
+
+	rr := postJob(t, server, `{"studentIds":[99]}`)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	location := rr.Header().Get("Location")
+
+	status := waitForJobStatus(t, server, location)
+	assert.Equal(t, "failed", status["status"])
+	assert.Equal(t, "student not found", status["error"])
+	assert.NotContains(t, status, "resultUrl")
+
+	rr = getJob(t, server, location+"/result")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "student not found")
+}
+
+func TestReportJob_ResultBeforeFinished(t *testing.T) {
+	server := newBatchTestServer()
+	store := jobs.NewMemoryStore()
+	// The workers are never started, so the job stays queued
+	server.jobs = jobs.NewManager(store, server.runJob, jobs.Config{})
+
+	rr := postJob(t, server, `{"studentIds":[1]}`)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	location := rr.Header().Get("Location")
+
+	rr = getJob(t, server, location)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"queued"`)
+
+	rr = getJob(t, server, location+"/result")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+}
+
+func TestReportJob_Rejections(t *testing.T) {
+	server := newJobTestServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"unknown job", "GET", "/api/v1/jobs/0123456789abcdef0123456789abcdef", http.StatusNotFound},
+		{"path traversal", "GET", "/api/v1/jobs/..%2F..%2Fetc%2Fpasswd", http.StatusNotFound},
+		{"unknown sub-resource", "GET", "/api/v1/jobs/abc/logs", http.StatusNotFound},
+		{"missing ID", "GET", "/api/v1/jobs/", http.StatusNotFound},
+		{"wrong method", "DELETE", "/api/v1/jobs/abc", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.GetReportJob).ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+		})
+	}
+
+	rr := postJob(t, server, `{"format":"pdf"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestReportJob_NotEnabled(t *testing.T) {
+	rr := postJob(t, newTestServer(), `{"studentIds":[1]}`)
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+
+	rr = getJob(t, newTestServer(), "/api/v1/jobs/abc")
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+}
+
+func TestReportJob_Callback(t *testing.T) {
+	const secret = "callback-secret"
+	t.Setenv("WEBHOOK_SECRET", secret)
+	t.Setenv("WEBHOOK_BASE_DELAY", "1ms")
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "127.0.0.1")
+	t.Setenv("PUBLIC_BASE_URL", "https://reports.example.com/")
+
+	// The receiver fails the first delivery so that it is retried
+	var calls atomic.Int32
+	events := make(chan map[string]interface{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if !webhook.Verify([]byte(secret), r.Header.Get(webhook.SignatureHeader), r.Header.Get(webhook.TimestampHeader), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &event))
+		events <- event
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	server := newJobTestServer(t)
+	rr := postJob(t, server, `{"studentIds":[2],"callbackUrl":"`+receiver.URL+`/hooks"}`)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	location := rr.Header().Get("Location")
+	id := strings.TrimPrefix(location, "/api/v1/jobs/")
+
+	var event map[string]interface{}
+	select {
+	case event = <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+	assert.Equal(t, id, event["jobId"])
+	assert.Equal(t, float64(2), event["studentId"])
+	assert.Equal(t, "succeeded", event["status"])
+	assert.Equal(t, "https://reports.example.com/api/v1/jobs/"+id+"/result", event["downloadUrl"])
+
+	require.Eventually(t, func() bool {
+		rr := getJob(t, server, location)
+		return strings.Contains(rr.Body.String(), `"status":"delivered"`)
+	}, 5*time.Second, 5*time.Millisecond)
+
+	var status struct {
+		Callback jobs.Callback `json:"callback"`
+	}
+	require.NoError(t, json.Unmarshal(getJob(t, server, location).Body.Bytes(), &status))
+	require.Len(t, status.Callback.Attempts, 2)
+	assert.Equal(t, http.StatusServiceUnavailable, status.Callback.Attempts[0].StatusCode)
+	assert.Equal(t, http.StatusNoContent, status.Callback.Attempts[1].StatusCode)
+}
+
+func TestReportJob_CallbackRejections(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRET", "")
+	rr := postJob(t, newJobTestServer(t), `{"studentIds":[1],"callbackUrl":"http://example.com/hook"}`)
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+
+	t.Setenv("WEBHOOK_SECRET", "secret")
+	rr = postJob(t, newJobTestServer(t), `{"studentIds":[1],"callbackUrl":"/relative"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "callbackUrl")
+
+	// Callbacks cannot reach the service's own network
+	for _, url := range []string{"http://127.0.0.1:8080/admin", "http://169.254.169.254/latest/meta-data/"} {
+		rr = postJob(t, newJobTestServer(t), `{"studentIds":[1],"callbackUrl":"`+url+`"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+		assert.Contains(t, rr.Body.String(), "not a public address")
+	}
+}
+
+func TestReportJob_Template(t *testing.T) {
+	server := startTestJobs(t, newTemplateTestServer(t))
+
+	req, err := http.NewRequest("POST", "/api/v1/jobs?template=letter", strings.NewReader(`{"studentIds":[1]}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.CreateReportJob).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	location := rr.Header().Get("Location")
+
+	status := waitForJobStatus(t, server, location)
+	assert.Equal(t, "succeeded", status["status"])
+	assert.Equal(t, "letter", status["template"])
+
+	rr = getJob(t, server, location+"/result")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "/MediaBox [0 0 792.00 612.00]")
+}
+
+func TestReportJob_Locale(t *testing.T) {
+	server := newJobTestServer(t)
+
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		want           string
+	}{
+		{"Accept-Language", "", "pt-BR,pt;q=0.9", "pt"},
+		{"lang wins", "?lang=he", "pt-BR", "he"},
+		{"no catalog", "", "de-DE", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/api/v1/jobs"+tt.query, strings.NewReader(`{"studentIds":[1]}`))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.CreateReportJob).ServeHTTP(rr, req)
+			require.Equal(t, http.StatusAccepted, rr.Code)
+
+			status := waitForJobStatus(t, server, rr.Header().Get("Location"))
+			assert.Equal(t, "succeeded", status["status"])
+			assert.Equal(t, tt.want, status["locale"])
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package pdf
+
+import (
+	"fmt"
+	"strconv"
+
+	"pdf-generator/internal/layout"
+)
+
+const (
+	// marginFontSize and marginLineHeight size the header and footer text
+	marginFontSize   = 8
+	marginLineHeight = 4
+	// footerBottom is the space below the footer, in millimetres
+	footerBottom = 5
+	// pageBottom is the least space kept free for the footer at the foot of
+	// each page, as gofpdf does by default
+	pageBottom = 20
+)
+
+// pageGroup is the run of pages holding one report of the document. Its
+// pages are numbered from one in their footers, so each student's report in
+// a merged document reads "Page 1 of 2" and so on.
+type pageGroup struct {
+	// title is printed in the header of each page
+	title string
+	// first is the page number of the group's first page in the document
+	first int
+	// alias stands for the number of pages in the group until the document
+	// is written. It is letters and digits only, so that ordering
+	// right-to-left text keeps it in one piece, and no alias is part of
+	// another.
+	alias string
+}
+
+// startPages begins a group for the pages added next; title is printed in
+// their headers
+func (pg *PDFGenerator) startPages(title string) {
+	pg.group = &pageGroup{title: title, alias: fmt.Sprintf("Nb%dPages", len(pg.pageGroups))}
+}
+
+// registerPageCounts replaces each group's alias with its number of pages
+// when the document is written
+func (pg *PDFGenerator) registerPageCounts() {
+	counts := make(map[*pageGroup]int)
+	for _, group := range pg.pageGroups {
+		counts[group]++
+	}
+	for group, count := range counts {
+		pg.pdf.RegisterAlias(group.alias, strconv.Itoa(count))
+	}
+}
+
+// drawHeader prints the school's name and the report title in the top
+// margin of a new page. gofpdf calls it for every page, including those
+// started by an automatic page break, and moves the cursor back to the top
+// margin afterwards.
+func (pg *PDFGenerator) drawHeader() {
+	if pg.group == nil {
+		pg.startPages("")
+	}
+	group := pg.group
+	if group.first == 0 {
+		group.first = pg.pdf.PageNo()
+	}
+	pg.pageGroups = append(pg.pageGroups, group)
+
+	defer pg.keepFont()()
+	_, top, _, _ := pg.pdf.GetMargins()
+	pg.pdf.SetY(max(0, (top-marginLineHeight)/2))
+	pg.setFont(pg.marginFont())
+	pg.marginRow(pg.schoolName(), group.title, 0)
+}
+
+// drawFooter prints the school's address and contact line at the foot of
+// the page, over a line with the generation time and the page number, and
+// the watermark over the whole page. gofpdf calls it while finishing each
+// page.
+func (pg *PDFGenerator) drawFooter() {
+	group := pg.pageGroups[pg.pdf.PageNo()-1]
+
+	defer pg.keepFont()()
+	if pg.watermark != nil {
+		pg.drawWatermark()
+	}
+	pg.pdf.SetY(-pg.footerHeight())
+	pg.setFont(pg.marginFont())
+	for _, line := range pg.footerLines() {
+		pg.cell(pg.contentWidth(), marginLineHeight, line, "0", 1, "C", false)
+	}
+
+	generated := fmt.Sprintf(pg.tr.Text("Generated on %s"), pg.tr.FormatDate(pg.generated)+" "+pg.generated.Format("15:04 MST"))
+	number := pg.pdf.PageNo() - group.first + 1
+	page := fmt.Sprintf(pg.tr.Text("Page %d of %s"), number, group.alias)
+	// The page count replaces the alias after the line is placed, so a line
+	// that ends with the alias is let past the margin by the width the count
+	// will not take up, guessed from the page number
+	var overhang float64
+	if !pg.rtl {
+		overhang = max(0, pg.pdf.GetStringWidth(group.alias)-pg.pdf.GetStringWidth(strconv.Itoa(number)))
+	}
+	pg.marginRow(generated, page, overhang)
+}
+
+// footerLines are the branding lines printed above the page number
+func (pg *PDFGenerator) footerLines() []string {
+	var lines []string
+	for _, line := range []string{pg.branding.Address, pg.branding.Contact} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// footerHeight is the space the footer takes at the foot of the page
+func (pg *PDFGenerator) footerHeight() float64 {
+	return footerBottom + marginLineHeight*float64(len(pg.footerLines())+1)
+}
+
+// marginFont is the font of the header and footer
+func (pg *PDFGenerator) marginFont() layout.Font {
+	return layout.Font{Family: pg.template.Styles.Value.Font.Family, Size: marginFontSize}
+}
+
+// marginRow prints start at the start of the line and end at its end, which
+// is moved overhang past the right margin
+func (pg *PDFGenerator) marginRow(start, end string, overhang float64) {
+	left, _, _, _ := pg.pdf.GetMargins()
+	pg.cell(pg.contentWidth(), marginLineHeight, start, "0", 0, "L", false)
+	pg.pdf.SetX(left)
+	pg.cell(pg.contentWidth()+overhang, marginLineHeight, end, "0", 0, "R", false)
+}
+
+// keepFont records the template font and returns a function that restores
+// it. gofpdf restores its own font after printing a header or footer, so the
+// generator's record of the font must be restored with it.
+func (pg *PDFGenerator) keepFont() func() {
+	font, selected := pg.font, pg.selected
+	return func() {
+		pg.font, pg.selected = font, selected
+	}
+}
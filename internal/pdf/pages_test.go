@@ -0,0 +1,68 @@
+package pdf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/bidi"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/layout"
+)
+
+func TestGenerateStudentReport_HeaderAndFooter(t *testing.T) {
+	output := renderUncompressed(t, Options{}, api.GetMockStudent())
+
+	pages := strings.Count(output, "/Type /Page\n")
+	require.Greater(t, pages, 1)
+
+	// Every page, including the one started by the page break, has the
+	// header in the top margin and is numbered in the footer
+	assert.Equal(t, pages, strings.Count(output, "825.32 Td (School Management System)Tj"))
+	assert.Equal(t, pages, strings.Count(output, "825.32 Td (Student Report)Tj"))
+	assert.Equal(t, pages, strings.Count(output, "(Generated on "))
+	for page := 1; page <= pages; page++ {
+		assert.Contains(t, output, fmt.Sprintf("17.44 Td (Page %d of %d)Tj", page, pages))
+	}
+	assert.NotContains(t, output, "Pages)Tj")
+
+	// The body still starts at the top margin
+	assert.Contains(t, output, "BT 205.97 793.37 Td (STUDENT REPORT)Tj")
+}
+
+func TestGenerateStudentReport_HeaderAndFooterRightToLeft(t *testing.T) {
+	locale, err := i18n.Parse("ar")
+	require.NoError(t, err)
+
+	output := renderUncompressed(t, Options{Locale: locale}, api.GetMockStudent())
+
+	pages := strings.Count(output, "/Type /Page\n")
+	assert.Contains(t, output, shownText(bidi.Display("تقرير الطالب", true)))
+	for page := 1; page <= pages; page++ {
+		assert.Contains(t, output, shownText(bidi.Display(fmt.Sprintf("صفحة %d من %d", page, pages), true)))
+	}
+}
+
+func TestGenerateMergedReport_PageNumbers(t *testing.T) {
+	generator := NewPDFGenerator(layout.Default(), Options{})
+	generator.pdf.SetCompression(false)
+	students := []*api.Student{api.GetMockStudent(), api.GetMockStudent()}
+
+	pdfBytes, err := generator.GenerateMergedReport(context.Background(), students, func([]PageRange, *i18n.Translator) []string {
+		return []string{"Requested: 2, succeeded: 2, failed: 0"}
+	})
+	require.NoError(t, err)
+	output := string(pdfBytes)
+
+	// Each student's pages are numbered on their own, as is the summary
+	assert.Equal(t, 2, strings.Count(output, "(Page 1 of 2)Tj"))
+	assert.Equal(t, 2, strings.Count(output, "(Page 2 of 2)Tj"))
+	assert.Equal(t, 1, strings.Count(output, "(Page 1 of 1)Tj"))
+	assert.Equal(t, 4, strings.Count(output, "(Student Report)Tj"))
+	assert.Equal(t, 1, strings.Count(output, "825.32 Td (Batch Summary)Tj"))
+}
@@ -0,0 +1,75 @@
+package pdf
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/logging"
+)
+
+// Problem is an RFC 7807 problem details response body
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	// InvalidParams lists the fields that failed validation
+	InvalidParams []api.FieldError `json:"invalid-params,omitempty"`
+	// Errors lists the problems of an invalid template, by line
+	Errors []layout.Problem `json:"errors,omitempty"`
+}
+
+// writeProblem writes an application/problem+json error response. detail is
+// shown to end users and must not contain upstream response bodies.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeProblemBody(w, r, Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: logging.RequestID(r.Context()),
+	})
+}
+
+// writeValidationProblem writes a 422 response listing the invalid fields
+func writeValidationProblem(w http.ResponseWriter, r *http.Request, err *api.ValidationError) {
+	writeProblemBody(w, r, Problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(http.StatusUnprocessableEntity),
+		Status:        http.StatusUnprocessableEntity,
+		Detail:        "Student data failed validation",
+		Instance:      r.URL.Path,
+		RequestID:     logging.RequestID(r.Context()),
+		InvalidParams: err.Fields,
+	})
+}
+
+// writeTemplateProblem writes a 422 response listing where a template is invalid
+func writeTemplateProblem(w http.ResponseWriter, r *http.Request, err *layout.ValidationError) {
+	writeProblemBody(w, r, Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(http.StatusUnprocessableEntity),
+		Status:    http.StatusUnprocessableEntity,
+		Detail:    "Template failed validation",
+		Instance:  r.URL.Path,
+		RequestID: logging.RequestID(r.Context()),
+		Errors:    err.Problems,
+	})
+}
+
+func writeProblemBody(w http.ResponseWriter, r *http.Request, problem Problem) {
+	status := problem.Status
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing problem response", "error", err)
+	}
+}
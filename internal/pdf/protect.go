@@ -0,0 +1,94 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/protection"
+)
+
+// passwordHeader carries the password a caller chooses for its reports. It
+// is a header rather than a query parameter so that it stays out of access
+// logs.
+const passwordHeader = "X-Report-Password"
+
+// errMergedDateOfBirth is returned when a merged report, which has no single
+// student, is to be opened with a date of birth
+var errMergedDateOfBirth = errors.New("a merged report cannot be protected with a date of birth")
+
+// SetProtection replaces the protection policy, which defaults to
+// protecting only the reports whose requests ask for it
+func (s *Server) SetProtection(policy *protection.Policy) {
+	s.protection = policy
+}
+
+// protectionFor reads how a request wants its reports protected, from the
+// protect query parameter and the X-Report-Password header, and applies the
+// policy for reportType. A password implies protect=password. It writes an
+// error response and returns false if the choice is invalid or the policy
+// forbids it.
+func (s *Server) protectionFor(w http.ResponseWriter, r *http.Request, reportType string) (protection.Mode, string, bool) {
+	value := r.URL.Query().Get("protect")
+	mode, err := protection.ParseMode(value)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid protect %q; expected one of %s", value, modeList(protection.Modes...)))
+		return "", "", false
+	}
+
+	password := r.Header.Get(passwordHeader)
+	switch {
+	case password != "" && mode != "" && mode != protection.Password:
+		writeProblem(w, r, http.StatusBadRequest, passwordHeader+" can only be used with protect=password")
+		return "", "", false
+	case password != "":
+		if err := protection.ValidatePassword(password); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid %s: %s", passwordHeader, err))
+			return "", "", false
+		}
+		mode = protection.Password
+	case mode == protection.Password:
+		writeProblem(w, r, http.StatusBadRequest, "protect=password requires the "+passwordHeader+" header")
+		return "", "", false
+	}
+
+	mode, err = s.protection.Resolve(reportType, mode)
+	if errors.Is(err, protection.ErrRequired) {
+		writeProblem(w, r, http.StatusForbidden, fmt.Sprintf("Reports of type %s must be protected; use protect=%s", reportType, modeList(protection.Restrict, protection.DateOfBirth, protection.Password)))
+		return "", "", false
+	}
+	return mode, password, true
+}
+
+// modeList joins modes for an error message
+func modeList(modes ...protection.Mode) string {
+	names := make([]string, len(modes))
+	for i, mode := range modes {
+		names[i] = string(mode)
+	}
+	return strings.Join(names, ", ")
+}
+
+// encryptionFor returns how a student's report is encrypted, or nil if it
+// is not. student is nil for a merged report.
+func (s *Server) encryptionFor(opts reportOptions, student *api.Student) (*Encryption, error) {
+	encryption := &Encryption{OwnerPassword: s.protection.OwnerPassword()}
+	switch opts.protection {
+	case protection.None, "":
+		return nil, nil
+	case protection.DateOfBirth:
+		if student == nil {
+			return nil, errMergedDateOfBirth
+		}
+		password, err := protection.DateOfBirthPassword(student.DOB)
+		if err != nil {
+			return nil, err
+		}
+		encryption.UserPassword = password
+	case protection.Password:
+		encryption.UserPassword = opts.password
+	}
+	return encryption, nil
+}
@@ -0,0 +1,322 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/protection"
+)
+
+// encryptEntry reads the hexadecimal string after key in a PDF's encryption
+// dictionary
+func encryptEntry(t *testing.T, output, key string) []byte {
+	t.Helper()
+	match := regexp.MustCompile(`/` + key + ` <([0-9a-f]+)>`).FindStringSubmatch(output)
+	require.NotNil(t, match, "missing /%s", key)
+	value, err := hex.DecodeString(match[1])
+	require.NoError(t, err)
+	return value
+}
+
+// opensWith reports whether password opens an encrypted PDF as its user, by
+// hashing it with the /U entry's validation salt as a reader does
+func opensWith(t *testing.T, output, password string) bool {
+	t.Helper()
+	user := encryptEntry(t, output, "U")
+	require.Len(t, user, 48)
+	return bytes.Equal(hashR6([]byte(password), user[32:40], nil), user[:32])
+}
+
+// opensAsOwner reports whether password opens an encrypted PDF as its
+// owner, which lifts its restrictions
+func opensAsOwner(t *testing.T, output, password string) bool {
+	t.Helper()
+	user, owner := encryptEntry(t, output, "U"), encryptEntry(t, output, "O")
+	require.Len(t, owner, 48)
+	return bytes.Equal(hashR6([]byte(password), owner[32:40], user), owner[:32])
+}
+
+// fileKey unlocks the file key of an encrypted PDF with its user password,
+// and checks the permissions stored with it
+func fileKey(t *testing.T, output, password string) []byte {
+	t.Helper()
+	user := encryptEntry(t, output, "U")
+	block, err := aes.NewCipher(hashR6([]byte(password), user[40:48], nil))
+	require.NoError(t, err)
+	key := encryptEntry(t, output, "UE")
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, key)
+
+	block, err = aes.NewCipher(key)
+	require.NoError(t, err)
+	perms := encryptEntry(t, output, "Perms")
+	block.Decrypt(perms, perms)
+	require.Equal(t, "Tadb", string(perms[8:12]), "the file key must decrypt /Perms")
+	assert.Equal(t, int32(restrictedPermissions), int32(binary.LittleEndian.Uint32(perms)))
+	return key
+}
+
+// decryptAES decrypts a string or stream encrypted with key
+func decryptAES(t *testing.T, key, data []byte) []byte {
+	t.Helper()
+	require.Zero(t, len(data)%aes.BlockSize)
+	require.GreaterOrEqual(t, len(data), 2*aes.BlockSize)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	plain := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plain, data[aes.BlockSize:])
+	padding := int(plain[len(plain)-1])
+	require.True(t, padding >= 1 && padding <= aes.BlockSize, "invalid padding")
+	return plain[:len(plain)-padding]
+}
+
+// decryptedStreams decrypts every stream of an encrypted PDF
+func decryptedStreams(t *testing.T, output string, key []byte) string {
+	t.Helper()
+	var streams strings.Builder
+	for _, match := range regexp.MustCompile(`/Length (\d+)[^>]*>>\nstream\n`).FindAllStringSubmatchIndex(output, -1) {
+		length, _ := strconv.Atoi(output[match[2]:match[3]])
+		if length == 0 {
+			continue
+		}
+		streams.Write(decryptAES(t, key, []byte(output[match[1]:match[1]+length])))
+		streams.WriteString("\n")
+	}
+	return streams.String()
+}
+
+func TestGenerateStudentReport_Encrypted(t *testing.T) {
+	tests := []struct {
+		name        string
+		encryption  *Encryption
+		opens       []string
+		doesNotOpen []string
+	}{
+		{"restrict", &Encryption{}, []string{""}, []string{"15051995"}},
+		{"user password", &Encryption{UserPassword: "15051995"}, []string{"15051995"}, []string{"", "15051996"}},
+		{"owner password", &Encryption{UserPassword: "secret", OwnerPassword: "owner"}, []string{"secret"}, []string{"owner"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := renderUncompressed(t, Options{Encryption: tt.encryption}, api.GetMockStudent())
+
+			assert.True(t, strings.HasPrefix(output, "%PDF-2.0\n%"))
+			assert.Contains(t, output, "/Filter /Standard /V 5 /R 6 /Length 256")
+			assert.Contains(t, output, "/CFM /AESV3")
+			assert.Contains(t, output, "/P -3904 ")
+			assert.Regexp(t, `/ID \[<[0-9a-f]{32}> <[0-9a-f]{32}>\]`, output)
+			assert.NotContains(t, output, "(John Doe)Tj")
+			assert.NotContains(t, output, "FPDF")
+			for _, password := range tt.opens {
+				assert.True(t, opensWith(t, output, password), "should open with %q", password)
+			}
+			for _, password := range tt.doesNotOpen {
+				assert.False(t, opensWith(t, output, password), "should not open with %q", password)
+			}
+
+			// The content decrypts with the file key the password unlocks
+			key := fileKey(t, output, tt.opens[0])
+			assert.Contains(t, decryptedStreams(t, output, key), "(John Doe)Tj")
+		})
+	}
+
+	output := renderUncompressed(t, Options{Encryption: &Encryption{UserPassword: "secret", OwnerPassword: "owner"}}, api.GetMockStudent())
+	assert.True(t, opensAsOwner(t, output, "owner"))
+	assert.False(t, opensAsOwner(t, output, "secret"))
+}
+
+func TestEncryptStrings(t *testing.T) {
+	key := randomBytes(32)
+	object := []byte("<</Title (Report \\(1\\) \\101\\r) /Nested ((a)b) /Hex <4a6F 6>>>\nendobj\n")
+	var out bytes.Buffer
+
+	end, err := encryptStrings(&out, object, key)
+
+	require.NoError(t, err)
+	assert.Equal(t, "endobj\n", string(object[end:]))
+	assert.True(t, strings.HasSuffix(out.String(), ">>\n"))
+	values := regexp.MustCompile(`<([0-9a-f]+)>`).FindAllStringSubmatch(out.String(), -1)
+	require.Len(t, values, 3)
+	var decrypted []string
+	for _, value := range values {
+		data, err := hex.DecodeString(value[1])
+		require.NoError(t, err)
+		decrypted = append(decrypted, string(decryptAES(t, key, data)))
+	}
+	assert.Equal(t, []string{"Report (1) A\r", "(a)b", "Jo`"}, decrypted)
+}
+
+func TestGenerateStudentReport_NotEncrypted(t *testing.T) {
+	output := renderUncompressed(t, Options{}, api.GetMockStudent())
+
+	assert.NotContains(t, output, "/Encrypt")
+	assert.Contains(t, output, "(John Doe)Tj")
+}
+
+// getProtectedReport requests the test report with a protect query and an
+// optional password header
+func getProtectedReport(t *testing.T, server *Server, query, password string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", "/test/report"+query, nil)
+	require.NoError(t, err)
+	if password != "" {
+		req.Header.Set(passwordHeader, password)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateTestReport).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGenerateTestReport_Protection(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		password  string
+		opensWith string
+	}{
+		{"restrict", "?protect=restrict", "", ""},
+		{"date of birth", "?protect=dob", "", "15051995"},
+		{"password header", "", "S3cret!", "S3cret!"},
+		{"password mode", "?protect=password", "S3cret!", "S3cret!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := getProtectedReport(t, newTestServer(), tt.query, tt.password)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			body := rr.Body.String()
+			assert.Contains(t, body, "/Filter /Standard")
+			assert.True(t, opensWith(t, body, tt.opensWith))
+		})
+	}
+
+	rr := getProtectedReport(t, newTestServer(), "?protect=none", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "/Encrypt")
+}
+
+func TestGenerateTestReport_ProtectionInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		password   string
+		wantDetail string
+	}{
+		{"unknown mode", "?protect=secret", "", `Invalid protect "secret"`},
+		{"password with another mode", "?protect=dob", "S3cret!", "X-Report-Password can only be used with protect=password"},
+		{"password mode without password", "?protect=password", "", "protect=password requires the X-Report-Password header"},
+		{"invalid password", "", "contraseña", "Invalid X-Report-Password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := getProtectedReport(t, newTestServer(), tt.query, tt.password)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var problem Problem
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+			assert.Contains(t, problem.Detail, tt.wantDetail)
+		})
+	}
+}
+
+func TestGenerateTestReport_ProtectionRequired(t *testing.T) {
+	t.Setenv("PROTECTED_REPORTS", "test")
+	t.Setenv("PROTECTION_DEFAULT", "dob")
+	t.Setenv("PDF_OWNER_PASSWORD", "")
+	policy, err := protection.NewPolicyFromEnv()
+	require.NoError(t, err)
+
+	server := newTestServer()
+	server.SetProtection(policy)
+
+	rr := getProtectedReport(t, server, "?protect=none", "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// A request that does not choose gets the policy's default
+	rr = getProtectedReport(t, server, "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, opensWith(t, rr.Body.String(), "15051995"))
+}
+
+func TestGenerateStudentReport_NoDateOfBirth(t *testing.T) {
+	student := api.GetMockStudent()
+	student.DOB = nil
+	server := NewServer(newMemorySource(student))
+
+	req, err := http.NewRequest("GET", "/api/v1/students/1/report?protect=dob", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateStudentReport).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestGenerateBatchReport_Protection(t *testing.T) {
+	rr := postBatchProtected(t, "?protect=dob", `{"studentIds":[1,2],"format":"pdf"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Each report in a ZIP opens with its own student's date of birth
+	rr = postBatchProtected(t, "?protect=dob", `{"studentIds":[1,2],"format":"zip"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	files := readZip(t, rr.Body.Bytes())
+	require.Contains(t, files, "student_1_report.pdf")
+	assert.True(t, opensWith(t, string(files["student_1_report.pdf"]), "15051995"))
+}
+
+func postBatchProtected(t *testing.T, query, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", "/api/v1/reports/batch"+query, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(newBatchTestServer().GenerateBatchReport).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateReportJob_Protection(t *testing.T) {
+	server := newJobTestServer(t)
+
+	req, err := http.NewRequest("POST", "/api/v1/jobs", strings.NewReader(`{"studentIds":[1]}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(passwordHeader, "S3cret!")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.CreateReportJob).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, err = http.NewRequest("POST", "/api/v1/jobs?protect=dob", strings.NewReader(`{"studentIds":[1]}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.CreateReportJob).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+
+	location := rr.Header().Get("Location")
+	status := waitForJobStatus(t, server, location)
+	assert.Equal(t, "succeeded", status["status"])
+	assert.Equal(t, "dob", status["protection"])
+
+	rr = getJob(t, server, location+"/result")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, opensWith(t, rr.Body.String(), "15051995"))
+}
@@ -2,99 +2,441 @@ package pdf
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/jung-kurt/gofpdf"
 
 	"pdf-generator/internal/api"
+	"pdf-generator/internal/branding"
+	"pdf-generator/internal/fonts"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/signing"
+	"pdf-generator/internal/watermark"
 )
 
 type PDFGenerator struct {
-	pdf *gofpdf.Fpdf
+	pdf      *gofpdf.Fpdf
+	template *layout.Template
+	fonts    *fonts.Set
+	// rtl mirrors the layout and orders text for right-to-left languages
+	rtl bool
+	// tr translates template text and formats dates
+	tr *i18n.Translator
+	// branding names the school and styles headers and footers
+	branding *branding.Branding
+
+	// font is the template font of the text being printed
+	font layout.Font
+	// selected is the family font is printed in, or empty for the core font
+	selected string
+	// registered holds the family/style keys of the fonts added to the document
+	registered map[string]bool
+	// missing collects characters that no font could print
+	missing map[rune]bool
+
+	// generated is when the document was generated
+	generated time.Time
+	// group is the page group pages added now belong to, and pageGroups
+	// holds the group of every page so far
+	group      *pageGroup
+	pageGroups []*pageGroup
+
+	// encryption protects the document; nil if it is not encrypted. fileKey
+	// is the key its strings and streams are encrypted with, once they are.
+	encryption *Encryption
+	fileKey    []byte
+	// signer signs the document; nil if it is not signed. signature is the
+	// first visible signature block, where readers show its status.
+	signer    *signing.Signer
+	signature *signatureBlock
+	// verification identifies the document in the verification registry;
+	// nil if it is not registered
+	verification *Verification
+	// watermark is printed over every page; nil if the document has none
+	watermark *watermark.Watermark
+	// pdfa writes the document as PDF/A-2b
+	pdfa bool
 }
 
-func NewPDFGenerator() *PDFGenerator {
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	return &PDFGenerator{pdf: pdf}
+// Options are the settings of a PDFGenerator besides its template
+type Options struct {
+	// Fonts print the text that the core fonts cannot encode; the bundled
+	// family is used if nil
+	Fonts *fonts.Set
+	// Locale is the language of the report. Right-to-left locales mirror the
+	// layout: labels go on the right and alignments are swapped.
+	Locale i18n.Locale
+	// Messages translate the report's text; the bundled catalog for Locale
+	// is used if nil
+	Messages *i18n.Catalog
+	// Branding adds the school's name, logo, colours and footer details;
+	// the template's own look is kept if nil
+	Branding *branding.Branding
+	// Encryption password-protects the report; it is not encrypted if nil
+	Encryption *Encryption
+	// Signer signs the report, and prints a signature block on it if the
+	// signer is visible; it is not signed if nil
+	Signer *signing.Signer
+	// Verification prints a QR code and a short code at the end of each
+	// student's report, with which readers can check that it is genuine;
+	// neither is printed if nil
+	Verification *Verification
+	// Watermark is printed over every page, such as DRAFT on reports that
+	// are not official; there is none if nil
+	Watermark *watermark.Watermark
+	// PDFA writes the report as PDF/A-2b, for archiving: all text is printed
+	// in embedded fonts, and the document carries XMP metadata, an sRGB
+	// output intent and a document ID. PDF/A reports cannot be encrypted.
+	PDFA bool
+}
+
+// Encryption protects a report with passwords, encrypting it with AES-256.
+// An encrypted report cannot be printed, copied from or modified without its
+// owner password.
+type Encryption struct {
+	// UserPassword is needed to open the report; it opens without one if
+	// empty, but keeps its restrictions
+	UserPassword string
+	// OwnerPassword lifts the restrictions; a random one is used if empty
+	OwnerPassword string
+}
+
+// NewPDFGenerator creates a generator that lays reports out with tmpl
+func NewPDFGenerator(tmpl *layout.Template, opts Options) *PDFGenerator {
+	pdf := gofpdf.New(tmpl.Page.Orientation, "mm", tmpl.Page.Size, "")
+	margins := tmpl.Page.Margins
+	pdf.SetMargins(margins.Left, margins.Top, margins.Right)
+	if opts.Fonts == nil {
+		opts.Fonts = fonts.Bundled()
+	}
+	if opts.Messages == nil {
+		opts.Messages = i18n.Bundled().Catalog(opts.Locale)
+	}
+	if opts.Branding == nil {
+		opts.Branding = branding.Default()
+	}
+	pg := &PDFGenerator{
+		pdf:          pdf,
+		template:     tmpl,
+		fonts:        opts.Fonts,
+		rtl:          opts.Locale.RTL(),
+		tr:           i18n.NewTranslator(opts.Messages),
+		branding:     opts.Branding,
+		registered:   make(map[string]bool),
+		missing:      make(map[rune]bool),
+		generated:    time.Now(),
+		encryption:   opts.Encryption,
+		signer:       opts.Signer,
+		verification: opts.Verification,
+		watermark:    opts.Watermark,
+		pdfa:         opts.PDFA,
+	}
+	// Every page gets a header and footer, and content breaks onto a new
+	// page above the footer
+	pdf.SetHeaderFuncMode(pg.drawHeader, true)
+	pdf.SetFooterFunc(pg.drawFooter)
+	pdf.SetAutoPageBreak(true, max(pageBottom, pg.footerHeight()+footerBottom))
+	return pg
 }
 
 // GenerateStudentReport creates a PDF report for a student
-func (pg *PDFGenerator) GenerateStudentReport(student *api.Student) ([]byte, error) {
+func (pg *PDFGenerator) GenerateStudentReport(ctx context.Context, student *api.Student) ([]byte, error) {
+	start := time.Now()
+	slog.DebugContext(ctx, "Rendering student report", "student", student)
+
+	if err := pg.renderStudent(ctx, student); err != nil {
+		return nil, err
+	}
+
+	pdfBytes, err := pg.output(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "Rendered student report", "student", student, "bytes", len(pdfBytes), "duration", time.Since(start))
+
+	return pdfBytes, nil
+}
+
+// PageRange is the first and last page of one student's report in a merged document
+type PageRange struct {
+	First int
+	Last  int
+}
+
+func (r PageRange) String() string {
+	if r.First == r.Last {
+		return fmt.Sprintf("%d", r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// GenerateMergedReport creates a single PDF holding one report per student,
+// each starting on a new page with its own outline entry. summary is called
+// with the page range of every student, in order, and the lines it returns
+// are printed on a final summary page; it translates them with tr. The
+// summary is not embedded as a file attachment because gofpdf writes
+// attachments ahead of the pages, which breaks the outline's page
+// references. If one student's report cannot be rendered, a
+// *studentRenderError says which; gofpdf cannot take pages out again, so the
+// document is abandoned.
+func (pg *PDFGenerator) GenerateMergedReport(ctx context.Context, students []*api.Student, summary func(ranges []PageRange, tr *i18n.Translator) []string) ([]byte, error) {
+	start := time.Now()
+	slog.DebugContext(ctx, "Rendering merged report", "students", len(students))
+
+	ranges := make([]PageRange, len(students))
+	for i, student := range students {
+		// renderStudent always starts a new page
+		first := pg.pdf.PageNo() + 1
+		if err := pg.renderStudent(ctx, student); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			return nil, &studentRenderError{index: i, err: err}
+		}
+		ranges[i] = PageRange{First: first, Last: pg.pdf.PageNo()}
+	}
+
+	if lines := summary(ranges, pg.tr); len(lines) > 0 {
+		pg.startPages(pg.tr.Text("Batch Summary"))
+		pg.pdf.AddPage()
+		pg.bookmark(pg.tr.Text("Batch Summary"))
+		rows := make([][]rowText, len(lines))
+		for i, line := range lines {
+			rows[i] = []rowText{{pg.contentWidth(), line, pg.template.Styles.Value.Font, "L"}}
+		}
+		pg.addSectionHeader(pg.tr.Text("BATCH SUMMARY"), pg.rowHeight(rows[0], pg.template.Styles.RowHeight))
+		for _, row := range rows {
+			pg.addRow(row, pg.template.Styles.RowHeight, "0")
+		}
+		// The summary may quote characters no font covers when it says why a
+		// student failed, which is no reason to fail the whole document
+		pg.missingCharacters()
+	}
+
+	pdfBytes, err := pg.output(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "Rendered merged report", "students", len(students), "bytes", len(pdfBytes), "duration", time.Since(start))
+
+	return pdfBytes, nil
+}
+
+// studentRenderError is returned by GenerateMergedReport when the report of
+// the student at index could not be rendered
+type studentRenderError struct {
+	index int
+	err   error
+}
+
+func (e *studentRenderError) Error() string {
+	return e.err.Error()
+}
+
+func (e *studentRenderError) Unwrap() error {
+	return e.err
+}
+
+// renderStudent adds the pages of one student's report to the document
+func (pg *PDFGenerator) renderStudent(ctx context.Context, student *api.Student) error {
+	if err := renderAborted(ctx); err != nil {
+		return err
+	}
+
+	pg.startPages(pg.tr.Text("Student Report"))
 	pg.pdf.AddPage()
+	pg.bookmark(fmt.Sprintf("%s (ID %d)", student.Name, student.ID))
+	pg.drawLogo()
 
-	pg.pdf.SetFont("Arial", "B", 20)
-
-	pg.pdf.CellFormat(190, 10, "STUDENT REPORT", "0", 1, "C", false, 0, "")
-	pg.pdf.Ln(5)
-
-	pg.pdf.SetFont("Arial", "", 12)
-	pg.pdf.CellFormat(190, 8, "School Management System", "0", 1, "C", false, 0, "")
-	pg.pdf.CellFormat(190, 8, fmt.Sprintf("Generated on: %s", time.Now().Format("January 2, 2006")), "0", 1, "C", false, 0, "")
-	pg.pdf.Ln(10)
-
-	pg.addSectionHeader("PERSONAL INFORMATION")
-	pg.addInfoRow("Student ID:", fmt.Sprintf("%d", student.ID))
-	pg.addInfoRow("Full Name:", student.Name)
-	pg.addInfoRow("Email:", student.Email)
-	pg.addInfoRow("Phone:", api.GetValueOrNA(student.Phone))
-	pg.addInfoRow("Gender:", api.GetValueOrNA(student.Gender))
-	pg.addInfoRow("Date of Birth:", student.FormatDate(student.DOB))
-	pg.pdf.Ln(5)
-
-	pg.addSectionHeader("ACADEMIC INFORMATION")
-	pg.addInfoRow("Class:", api.GetValueOrNA(student.Class))
-	pg.addInfoRow("Section:", api.GetValueOrNA(student.Section))
-	pg.addInfoRow("Roll Number:", api.GetIntValueOrNA(student.Roll))
-	pg.addInfoRow("Admission Date:", student.FormatDate(student.AdmissionDate))
-	pg.addInfoRow("System Access:", fmt.Sprintf("%t", student.SystemAccess))
-	pg.pdf.Ln(5)
-
-	pg.addSectionHeader("FAMILY INFORMATION")
-	pg.addInfoRow("Father's Name:", api.GetValueOrNA(student.FatherName))
-	pg.addInfoRow("Father's Phone:", api.GetValueOrNA(student.FatherPhone))
-	pg.addInfoRow("Mother's Name:", api.GetValueOrNA(student.MotherName))
-	pg.addInfoRow("Mother's Phone:", api.GetValueOrNA(student.MotherPhone))
-	pg.addInfoRow("Guardian's Name:", api.GetValueOrNA(student.GuardianName))
-	pg.addInfoRow("Guardian's Phone:", api.GetValueOrNA(student.GuardianPhone))
-	pg.addInfoRow("Relation to Guardian:", api.GetValueOrNA(student.RelationOfGuardian))
-	pg.pdf.Ln(5)
-
-	pg.addSectionHeader("ADDRESS INFORMATION")
-	pg.addInfoRow("Current Address:", api.GetValueOrNA(student.CurrentAddress))
-	pg.addInfoRow("Permanent Address:", api.GetValueOrNA(student.PermanentAddress))
-	pg.pdf.Ln(5)
-
-	pg.addSectionHeader("ADDITIONAL INFORMATION")
-	pg.addInfoRow("Reporter/Class Teacher:", api.GetValueOrNA(student.ReporterName))
-
-	pg.pdf.Ln(20)
-	pg.pdf.SetFont("Arial", "I", 10)
-	pg.pdf.CellFormat(190, 8, "This report was generated automatically by the School Management System", "0", 1, "C", false, 0, "")
-	pg.pdf.CellFormat(190, 8, "For any queries, please contact the school administration", "0", 1, "C", false, 0, "")
+	values := layout.StudentValues(student, pg.generated, pg.tr)
+	values[layout.SchoolNameField] = pg.schoolName()
+	signAfter := pg.signatureBlockAfter()
+	for i := range pg.template.Blocks {
+		block := &pg.template.Blocks[i]
+		pg.renderBlock(block, values)
+		if i == signAfter {
+			pg.drawSignatureBlock()
+		}
+		if block.SpaceAfter > 0 {
+			pg.pdf.Ln(block.SpaceAfter)
+		}
+		if err := renderAborted(ctx); err != nil {
+			return err
+		}
+	}
+	if pg.verification != nil {
+		pg.drawVerificationBlock()
+	}
 
+	if err := pg.checkCovered(ctx, "student_id", student.ID); err != nil {
+		return err
+	}
+
+	return pg.pdf.Error()
+}
+
+// renderBlock draws one template block bound to a student's values, without
+// the space after it
+func (pg *PDFGenerator) renderBlock(block *layout.Block, values map[string]string) {
+	switch block.Type {
+	case layout.BlockText:
+		pg.addRow([]rowText{{pg.contentWidth(), pg.expand(block.Text, values), *block.Font, block.Align}}, block.Height, "0")
+	case layout.BlockSpacer:
+		pg.pdf.Ln(block.Height)
+	case layout.BlockSection:
+		rows := make([][]rowText, len(block.Rows))
+		for i, row := range block.Rows {
+			rows[i] = pg.infoRow(pg.expand(row.Label, values), pg.expand(row.Value, values))
+		}
+		var first float64
+		if len(rows) > 0 {
+			first = pg.rowHeight(rows[0], pg.template.Styles.RowHeight)
+		}
+		pg.addSectionHeader(pg.expand(block.Title, values), first)
+		for _, row := range rows {
+			pg.addRow(row, pg.template.Styles.RowHeight, "0")
+		}
+	case layout.BlockTable:
+		pg.addTable(block, values)
+	}
+}
+
+// expand translates template text and fills in its placeholders
+func (pg *PDFGenerator) expand(text string, values map[string]string) string {
+	return layout.Expand(pg.tr.Text(text), values)
+}
+
+// output serializes the document
+func (pg *PDFGenerator) output(ctx context.Context) ([]byte, error) {
+	if err := renderAborted(ctx); err != nil {
+		return nil, err
+	}
+
+	if missing := pg.tr.Missing(); len(missing) > 0 {
+		slog.WarnContext(ctx, "Missing translations; printed in English", "lang", pg.tr.Locale(), "messages", missing)
+	}
+
+	pg.registerPageCounts()
 	var buf bytes.Buffer
 	err := pg.pdf.Output(&buf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate PDF: %w", err)
 	}
+	// Page footers and summaries are printed after the students
+	if err := pg.checkCovered(ctx); err != nil {
+		return nil, err
+	}
 
-	return buf.Bytes(), nil
+	pdfBytes := buf.Bytes()
+	if pg.pdfa {
+		if pdfBytes, err = pg.archive(pdfBytes); err != nil {
+			return nil, fmt.Errorf("failed to write PDF/A: %w", err)
+		}
+	}
+	if pg.encryption != nil {
+		if pdfBytes, err = pg.encrypt(pdfBytes); err != nil {
+			return nil, fmt.Errorf("failed to encrypt PDF: %w", err)
+		}
+	}
+	if pg.signer != nil {
+		signed, err := pg.sign(pdfBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign PDF: %w", err)
+		}
+		return signed, nil
+	}
+	return pdfBytes, nil
+}
+
+// renderAborted returns an error if the caller gave up on the report; gofpdf
+// cannot be interrupted, so rendering checks for this between sections
+func renderAborted(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("report rendering aborted: %w", err)
+	}
+	return nil
+}
+
+// addSectionHeader adds a formatted section header. keep is the height of
+// the content that must follow the header on its page, so that a header is
+// never left alone at the foot of a page.
+func (pg *PDFGenerator) addSectionHeader(title string, keep float64) {
+	style := pg.template.Styles.SectionHeader
+	pg.keepTogether(style.Height + style.SpaceAfter + keep)
+	pg.setFont(style.Font)
+	fill := len(style.Fill) == 3
+	if primary := pg.branding.Primary; primary != nil {
+		fill = true
+		pg.pdf.SetFillColor(primary[0], primary[1], primary[2])
+	} else if fill {
+		pg.pdf.SetFillColor(style.Fill[0], style.Fill[1], style.Fill[2])
+	}
+	secondary := pg.branding.Secondary
+	if secondary != nil {
+		pg.pdf.SetTextColor(secondary[0], secondary[1], secondary[2])
+		pg.pdf.SetDrawColor(secondary[0], secondary[1], secondary[2])
+	}
+	pg.cell(pg.contentWidth(), style.Height, title, style.Border, 1, "L", fill)
+	if secondary != nil {
+		pg.pdf.SetTextColor(0, 0, 0)
+		pg.pdf.SetDrawColor(0, 0, 0)
+	}
+	pg.pdf.Ln(style.SpaceAfter)
+}
+
+// infoRow is a label and its value, printed side by side by addRow
+func (pg *PDFGenerator) infoRow(label, value string) []rowText {
+	styles := pg.template.Styles
+	return []rowText{
+		{styles.Label.Width, label, styles.Label.Font, "L"},
+		{styles.Value.Width, value, styles.Value.Font, "L"},
+	}
 }
 
-// addSectionHeader adds a formatted section header
-func (pg *PDFGenerator) addSectionHeader(title string) {
-	pg.pdf.SetFont("Arial", "B", 14)
-	pg.pdf.SetFillColor(240, 240, 240)
-	pg.pdf.CellFormat(190, 8, title, "1", 1, "L", true, 0, "")
-	pg.pdf.Ln(2)
-	pg.pdf.SetFont("Arial", "", 11)
+// addTable adds a bordered table, under the block's title if it has one,
+// whose header row uses the label style and whose cells use the value style.
+// The title and header row stay on the page of the first row.
+func (pg *PDFGenerator) addTable(block *layout.Block, values map[string]string) {
+	styles := pg.template.Styles
+	widths := block.ColumnWidths(pg.contentWidth())
+
+	header := make([]rowText, len(block.Columns))
+	for i, column := range block.Columns {
+		header[i] = rowText{widths[i], pg.expand(column.Header, values), styles.Label.Font, column.Align}
+	}
+	rows := make([][]rowText, len(block.Cells))
+	for i, row := range block.Cells {
+		rows[i] = make([]rowText, len(row))
+		for j, cell := range row {
+			rows[i][j] = rowText{widths[j], pg.expand(cell, values), styles.Value.Font, block.Columns[j].Align}
+		}
+	}
+
+	keep := pg.rowHeight(header, styles.RowHeight)
+	if len(rows) > 0 {
+		keep += pg.rowHeight(rows[0], styles.RowHeight)
+	}
+	if block.Title != "" {
+		pg.addSectionHeader(pg.expand(block.Title, values), keep)
+	} else {
+		pg.keepTogether(keep)
+	}
+
+	pg.addRow(header, styles.RowHeight, "1")
+	for _, row := range rows {
+		pg.addRow(row, styles.RowHeight, "1")
+	}
 }
 
-// addInfoRow adds a formatted information row
-func (pg *PDFGenerator) addInfoRow(label, value string) {
-	pg.pdf.SetFont("Arial", "B", 11)
-	pg.pdf.CellFormat(60, 6, label, "0", 0, "L", false, 0, "")
-	pg.pdf.SetFont("Arial", "", 11)
-	pg.pdf.CellFormat(130, 6, value, "0", 1, "L", false, 0, "")
+// contentWidth is the width of the page between the margins
+func (pg *PDFGenerator) contentWidth() float64 {
+	width, _ := pg.pdf.GetPageSize()
+	left, _, right, _ := pg.pdf.GetMargins()
+	return width - left - right
 }
@@ -0,0 +1,320 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pdf-generator/internal/layout"
+)
+
+const (
+	// signatureWidth and signaturePadding size the visible signature block,
+	// in millimetres
+	signatureWidth   = 80
+	signaturePadding = 2
+	// signatureFieldName names the signature field readers list
+	signatureFieldName = "Signature1"
+	// byteRangeWidth is the space reserved for the signature's /ByteRange
+	// array, which is filled in once the signed document's size is known
+	byteRangeWidth = 40
+)
+
+// signatureBlock is where a signature block was printed, in millimetres from
+// the top left corner of its page
+type signatureBlock struct {
+	page       int
+	x, y, w, h float64
+}
+
+// signatureBlockAfter is the index of the block followed by the visible
+// signature block: the first that binds the class teacher's name, so that
+// the signature sits by the Reporter/Class Teacher line, or else the last.
+// It is -1 if the report is not signed visibly.
+func (pg *PDFGenerator) signatureBlockAfter() int {
+	if pg.signer == nil || !pg.signer.Visible {
+		return -1
+	}
+	for i := range pg.template.Blocks {
+		if pg.template.Blocks[i].Binds(layout.ReporterField) {
+			return i
+		}
+	}
+	return len(pg.template.Blocks) - 1
+}
+
+// drawSignatureBlock prints who signs the report, and when, in a box at the
+// end of the line below the cursor. The first box of the document is where
+// readers show the signature's status.
+func (pg *PDFGenerator) drawSignatureBlock() {
+	date := pg.tr.FormatDate(pg.generated) + " " + pg.generated.Format("15:04 MST")
+	lines := []string{
+		fmt.Sprintf(pg.tr.Text("Digitally signed by %s"), pg.signer.Name()),
+		fmt.Sprintf(pg.tr.Text("Date: %s"), date),
+	}
+	if pg.signer.Reason != "" {
+		lines = append(lines, fmt.Sprintf(pg.tr.Text("Reason: %s"), pg.signer.Reason))
+	}
+	if pg.signer.Location != "" {
+		lines = append(lines, fmt.Sprintf(pg.tr.Text("Location: %s"), pg.signer.Location))
+	}
+
+	height := 2*signaturePadding + marginLineHeight*float64(len(lines))
+	pg.keepTogether(signaturePadding + height)
+	left, _, right, _ := pg.pdf.GetMargins()
+	pageWidth, _ := pg.pdf.GetPageSize()
+	x := pageWidth - right - signatureWidth
+	if pg.rtl {
+		x = left
+	}
+	y := pg.pdf.GetY() + signaturePadding
+
+	pg.pdf.Rect(x, y, signatureWidth, height, "D")
+	pg.setFont(pg.marginFont())
+	for i, line := range lines {
+		pg.pdf.SetXY(x+signaturePadding, y+signaturePadding+marginLineHeight*float64(i))
+		pg.cell(signatureWidth-2*signaturePadding, marginLineHeight, line, "0", 0, "L", false)
+	}
+	pg.pdf.SetXY(left, y+height)
+
+	if pg.signature == nil {
+		pg.signature = &signatureBlock{page: pg.pdf.PageNo(), x: x, y: y, w: signatureWidth, h: height}
+	}
+}
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	trailerPattern   = regexp.MustCompile(`/(Size|Root|Info|Encrypt) (\d+)`)
+	idPattern        = regexp.MustCompile(`/ID (\[[^\]]*\])`)
+)
+
+// pdfDocument is a document written by gofpdf, read far enough to append an
+// incremental update to it
+type pdfDocument struct {
+	data []byte
+	// xref is the offset of the cross-reference table and offsets holds the
+	// offset of each object in it
+	xref    int
+	offsets []int
+	// size, root, info and encrypt are the trailer's entries; encrypt is
+	// zero if the document is not encrypted
+	size, root, info, encrypt int
+	// id is the trailer's document ID array, or empty if it has none
+	id string
+}
+
+// readDocument reads the cross-reference table and trailer of a document
+// written by gofpdf, which has a single table
+func readDocument(data []byte) (*pdfDocument, error) {
+	match := startxrefPattern.FindSubmatch(data)
+	if match == nil {
+		return nil, errors.New("no startxref")
+	}
+	doc := &pdfDocument{data: data}
+	doc.xref, _ = strconv.Atoi(string(match[1]))
+	if doc.xref >= len(data) {
+		return nil, errors.New("startxref is past the end of the document")
+	}
+
+	table := data[doc.xref:]
+	trailerAt := bytes.Index(table, []byte("trailer"))
+	if trailerAt < 0 {
+		return nil, errors.New("no trailer")
+	}
+	for _, entry := range trailerPattern.FindAllSubmatch(table[trailerAt:], -1) {
+		value, _ := strconv.Atoi(string(entry[2]))
+		switch string(entry[1]) {
+		case "Size":
+			doc.size = value
+		case "Root":
+			doc.root = value
+		case "Info":
+			doc.info = value
+		case "Encrypt":
+			doc.encrypt = value
+		}
+	}
+	if match := idPattern.FindSubmatch(table[trailerAt:]); match != nil {
+		doc.id = string(match[1])
+	}
+
+	lines := strings.Split(string(table[:trailerAt]), "\n")
+	if len(lines) < 2 || lines[0] != "xref" {
+		return nil, errors.New("no cross-reference table")
+	}
+	var first, count int
+	if _, err := fmt.Sscanf(lines[1], "%d %d", &first, &count); err != nil || first != 0 || count != doc.size || len(lines) < count+2 {
+		return nil, errors.New("unexpected cross-reference table")
+	}
+	doc.offsets = make([]int, count)
+	for i := range count {
+		if len(lines[i+2]) < 10 {
+			return nil, errors.New("unexpected cross-reference table")
+		}
+		doc.offsets[i], _ = strconv.Atoi(lines[i+2][:10])
+	}
+	if doc.root == 0 || doc.root >= count || doc.info >= count || doc.encrypt >= count {
+		return nil, errors.New("unexpected trailer")
+	}
+	return doc, nil
+}
+
+// object returns the dictionary of object n
+func (doc *pdfDocument) object(n int) (string, error) {
+	if n <= 0 || n >= len(doc.offsets) {
+		return "", fmt.Errorf("no object %d", n)
+	}
+	body := doc.data[doc.offsets[n]:]
+	header := fmt.Sprintf("%d 0 obj\n", n)
+	end := bytes.Index(body, []byte("\nendobj"))
+	if !bytes.HasPrefix(body, []byte(header)) || end < 0 {
+		return "", fmt.Errorf("object %d is not where the cross-reference table puts it", n)
+	}
+	return string(body[len(header):end]), nil
+}
+
+// sign appends a signature made with the generator's signer to a document
+// gofpdf wrote, as an incremental update: a signature field on the page of
+// the first signature block, or an invisible one on the first page, whose
+// signature covers every byte of the document but its own value
+func (pg *PDFGenerator) sign(data []byte) ([]byte, error) {
+	doc, err := readDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document to sign: %w", err)
+	}
+	// The update's strings are encrypted with the key of the document's
+	// other strings
+	var key []byte
+	if doc.encrypt != 0 {
+		if key = pg.fileKey; key == nil {
+			return nil, errors.New("failed to read document to sign: no key for its encryption")
+		}
+	}
+
+	page, rect := 1, "[0 0 0 0]"
+	if block := pg.signature; block != nil {
+		_, pageHeight := pg.pdf.GetPageSize()
+		k := pg.pdf.GetConversionRatio()
+		page = block.page
+		rect = fmt.Sprintf("[%.2f %.2f %.2f %.2f]", block.x*k, (pageHeight-block.y-block.h)*k, (block.x+block.w)*k, (pageHeight-block.y)*k)
+	}
+	// gofpdf writes each page as an object followed by its content stream,
+	// after the page tree and resources
+	pageObject := 1 + 2*page
+	pageDict, err := doc.object(pageObject)
+	if err != nil || !strings.HasPrefix(pageDict, "<</Type /Page\n") {
+		return nil, fmt.Errorf("failed to find page %d to sign", page)
+	}
+	catalog, err := doc.object(doc.root)
+	if err != nil || !strings.HasSuffix(catalog, ">>") {
+		return nil, errors.New("failed to find the document catalog to sign")
+	}
+
+	sigObject, fieldObject, appearanceObject := doc.size, doc.size+1, doc.size+2
+	size := doc.size + 2
+	if pg.signature != nil {
+		size++
+	}
+
+	out := bytes.NewBuffer(data)
+	offsets := make(map[int]int)
+	newObject := func(n int) {
+		offsets[n] = out.Len()
+		fmt.Fprintf(out, "%d 0 obj\n", n)
+	}
+
+	// The catalog gains the form that holds the signature field, and the
+	// page the field's widget
+	newObject(doc.root)
+	fmt.Fprintf(out, "%s/AcroForm <</Fields [%d 0 R] /SigFlags 3>>\n>>\nendobj\n", strings.TrimSuffix(catalog, ">>"), fieldObject)
+	newObject(pageObject)
+	if strings.Contains(pageDict, "/Annots [") {
+		pageDict = strings.Replace(pageDict, "/Annots [", fmt.Sprintf("/Annots [%d 0 R ", fieldObject), 1)
+	} else {
+		pageDict = strings.Replace(pageDict, "/Contents ", fmt.Sprintf("/Annots [%d 0 R]\n/Contents ", fieldObject), 1)
+	}
+	fmt.Fprintf(out, "%s\nendobj\n", pageDict)
+
+	newObject(sigObject)
+	out.WriteString("<</Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached\n/ByteRange ")
+	byteRangeAt := out.Len()
+	out.WriteString(strings.Repeat(" ", byteRangeWidth))
+	out.WriteString("\n/Contents ")
+	contentsAt := out.Len()
+	fmt.Fprintf(out, "<%s>", strings.Repeat("0", 2*pg.signer.MaxSize()))
+	contentsEnd := out.Len()
+	fmt.Fprintf(out, "\n/M %s\n/Name %s", textString(key, "D:"+time.Now().UTC().Format("20060102150405")+"Z"), textString(key, pg.signer.Name()))
+	if pg.signer.Reason != "" {
+		fmt.Fprintf(out, "\n/Reason %s", textString(key, pg.signer.Reason))
+	}
+	if pg.signer.Location != "" {
+		fmt.Fprintf(out, "\n/Location %s", textString(key, pg.signer.Location))
+	}
+	out.WriteString(">>\nendobj\n")
+
+	// The widget is printed (4) and locked (128)
+	newObject(fieldObject)
+	fmt.Fprintf(out, "<</Type /Annot /Subtype /Widget /FT /Sig /F 132 /T %s /V %d 0 R /P %d 0 R /Rect %s",
+		textString(key, signatureFieldName), sigObject, pageObject, rect)
+	if block := pg.signature; block != nil {
+		// The block is printed on the page, so the widget's appearance is
+		// an empty form the size of the block
+		k := pg.pdf.GetConversionRatio()
+		fmt.Fprintf(out, " /AP <</N %d 0 R>>>>\nendobj\n", appearanceObject)
+		newObject(appearanceObject)
+		fmt.Fprintf(out, "<</Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f] /Length 0>>\nstream\n\nendstream\nendobj\n", block.w*k, block.h*k)
+	} else {
+		out.WriteString(">>\nendobj\n")
+	}
+
+	xref := out.Len()
+	out.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for n := range size {
+		if offset, ok := offsets[n]; ok {
+			fmt.Fprintf(out, "%d 1\n%010d 00000 n \n", n, offset)
+		}
+	}
+	fmt.Fprintf(out, "trailer\n<<\n/Size %d\n/Root %d 0 R\n/Info %d 0 R\n", size, doc.root, doc.info)
+	if doc.encrypt != 0 {
+		fmt.Fprintf(out, "/Encrypt %d 0 R\n", doc.encrypt)
+	}
+	if doc.id != "" {
+		fmt.Fprintf(out, "/ID %s\n", doc.id)
+	}
+	fmt.Fprintf(out, "/Prev %d\n>>\nstartxref\n%d\n%%%%EOF\n", doc.xref, xref)
+
+	signed := out.Bytes()
+	byteRange := fmt.Sprintf("[0 %d %d %d]", contentsAt, contentsEnd, len(signed)-contentsEnd)
+	copy(signed[byteRangeAt:], byteRange)
+
+	content := make([]byte, 0, len(signed)-(contentsEnd-contentsAt))
+	content = append(content, signed[:contentsAt]...)
+	content = append(content, signed[contentsEnd:]...)
+	signature, err := pg.signer.Sign(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) > pg.signer.MaxSize() {
+		return nil, fmt.Errorf("signature of %d bytes does not fit the %d reserved", len(signature), pg.signer.MaxSize())
+	}
+	hex.Encode(signed[contentsAt+1:], signature)
+	return signed, nil
+}
+
+// textString writes text as a PDF hex string, in UTF-16 if it is not ASCII,
+// encrypted with key if it is not nil
+func textString(key []byte, text string) string {
+	if !isASCII(text) {
+		text = utf16Text(text)
+	}
+	data := []byte(text)
+	if key != nil {
+		data = encryptAES(key, data)
+	}
+	return "<" + hex.EncodeToString(data) + ">"
+}
@@ -0,0 +1,279 @@
+package pdf
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mozilla.org/pkcs7"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/signing"
+)
+
+// newTestSigner creates a signer whose certificate is issued by a
+// self-signed CA, and a pool trusting that CA
+func newTestSigner(t *testing.T) (*signing.Signer, *x509.CertPool) {
+	t.Helper()
+	issue := func(template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+		require.NoError(t, err)
+		certificate, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return certificate
+	}
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		return key
+	}
+
+	caKey, key := newKey(), newKey()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test School CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca := issue(caTemplate, caTemplate, caKey, caKey)
+	certificate := issue(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Springfield High"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, ca, key, caKey)
+
+	signer, err := signing.NewSigner(certificate, key, []*x509.Certificate{ca})
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return signer, pool
+}
+
+var byteRangePattern = regexp.MustCompile(`/ByteRange \[0 (\d+) (\d+) (\d+)\]`)
+
+// verifySignature checks that a PDF's signature covers all of it but the
+// signature itself, and was made by a certificate pool trusts
+func verifySignature(t *testing.T, output string, pool *x509.CertPool) *pkcs7.PKCS7 {
+	t.Helper()
+	match := byteRangePattern.FindStringSubmatch(output)
+	require.NotNil(t, match, "no /ByteRange")
+	var byteRange [3]int
+	for i := range byteRange {
+		byteRange[i], _ = strconv.Atoi(match[i+1])
+	}
+	require.Equal(t, len(output), byteRange[1]+byteRange[2], "the byte range must reach the end of the file")
+	require.Equal(t, "<", output[byteRange[0]:byteRange[0]+1])
+	require.Equal(t, ">", output[byteRange[1]-1:byteRange[1]])
+
+	signature, err := hex.DecodeString(output[byteRange[0]+1 : byteRange[1]-1])
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(signature)
+	require.NoError(t, err)
+	p7.Content = []byte(output[:byteRange[0]] + output[byteRange[1]:])
+	require.NoError(t, p7.VerifyWithChain(pool))
+	return p7
+}
+
+// checkUpdateOffsets checks that each object in the last cross-reference
+// table starts where the table says
+func checkUpdateOffsets(t *testing.T, output string) {
+	t.Helper()
+	xref := output[strings.LastIndex(output, "\nxref\n"):]
+	entries := regexp.MustCompile(`(\d+) 1\n(\d{10}) 00000 n `).FindAllStringSubmatch(xref, -1)
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		offset, _ := strconv.Atoi(entry[2])
+		assert.True(t, strings.HasPrefix(output[offset:], entry[1]+" 0 obj\n"), "object %s is not at %d", entry[1], offset)
+	}
+}
+
+func TestGenerateStudentReport_Signed(t *testing.T) {
+	signer, pool := newTestSigner(t)
+	signer.Reason = "Official report"
+	signer.Location = "Springfield"
+
+	output := renderUncompressed(t, Options{Signer: signer}, api.GetMockStudent())
+
+	p7 := verifySignature(t, output, pool)
+	assert.Equal(t, "Springfield High", p7.GetOnlySigner().Subject.CommonName)
+	checkUpdateOffsets(t, output)
+
+	assert.Contains(t, output, "/Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached")
+	assert.Contains(t, output, "/AcroForm <</Fields [")
+	assert.Contains(t, output, "/Prev ")
+	assert.Contains(t, output, "/Reason <"+hex.EncodeToString([]byte("Official report"))+">")
+	assert.True(t, strings.HasSuffix(output, "%%EOF\n"))
+
+	// The block is printed by the Reporter/Class Teacher line, and the
+	// signature's widget covers it
+	assert.Contains(t, output, "(Digitally signed by Springfield High)Tj")
+	assert.Contains(t, output, "(Reason: Official report)Tj")
+	assert.Contains(t, output, "(Location: Springfield)Tj")
+	_, reporterY := textPosition(t, output, "(Reporter/Class Teacher:)Tj")
+	blockX, blockY := textPosition(t, output, "(Digitally signed by Springfield High)Tj")
+	assert.Less(t, blockY, reporterY)
+	assert.Greater(t, blockY, reporterY-2*6*72/25.4, "the block is right below the reporter line")
+	assert.Greater(t, blockX, 300.0)
+	assert.Less(t, strings.Index(output, "Digitally signed by"), strings.Index(output, "(This report was generated automatically"))
+	assert.Regexp(t, `/FT /Sig /F 132 /T <[0-9a-f]+> /V \d+ 0 R /P \d+ 0 R /Rect \[3\d\d\.\d\d \d+\.\d\d 5\d\d\.\d\d \d+\.\d\d\] /AP`, output)
+}
+
+func TestGenerateStudentReport_SignedInvisibly(t *testing.T) {
+	signer, pool := newTestSigner(t)
+	signer.Visible = false
+
+	output := renderUncompressed(t, Options{Signer: signer}, api.GetMockStudent())
+
+	verifySignature(t, output, pool)
+	checkUpdateOffsets(t, output)
+	assert.NotContains(t, output, "Digitally signed by")
+	assert.Contains(t, output, "/P 3 0 R /Rect [0 0 0 0]>>")
+	assert.Equal(t, renderUncompressed(t, Options{}, api.GetMockStudent())[:200], output[:200])
+}
+
+func TestGenerateStudentReport_SignedWithoutReporterLine(t *testing.T) {
+	signer, pool := newTestSigner(t)
+	tmpl, err := layout.Parse([]byte(`
+name: plain
+blocks:
+  - type: text
+    text: "{{name}}"
+`))
+	require.NoError(t, err)
+
+	generator := NewPDFGenerator(tmpl, Options{Signer: signer})
+	generator.pdf.SetCompression(false)
+	pdfBytes, err := generator.GenerateStudentReport(context.Background(), api.GetMockStudent())
+	require.NoError(t, err)
+
+	// The block follows the last block of the template
+	output := string(pdfBytes)
+	verifySignature(t, output, pool)
+	_, nameY := textPosition(t, output, "(John Doe)Tj")
+	_, blockY := textPosition(t, output, "(Digitally signed by Springfield High)Tj")
+	assert.Less(t, blockY, nameY)
+}
+
+func TestGenerateStudentReport_SignedAndEncrypted(t *testing.T) {
+	signer, pool := newTestSigner(t)
+
+	output := renderUncompressed(t, Options{Signer: signer, Encryption: &Encryption{UserPassword: "15051995"}}, api.GetMockStudent())
+
+	verifySignature(t, output, pool)
+	checkUpdateOffsets(t, output)
+	assert.True(t, opensWith(t, output, "15051995"))
+	assert.Contains(t, output, "/Encrypt ")
+
+	// The strings of the signature field are encrypted like the rest of the
+	// document, so a reader decrypting them gets the field's name back
+	match := regexp.MustCompile(`/Type /Annot /Subtype /Widget /FT /Sig /F 132 /T <([0-9a-f]+)>`).FindStringSubmatch(output)
+	require.NotNil(t, match)
+	name, err := hex.DecodeString(match[1])
+	require.NoError(t, err)
+	assert.Equal(t, signatureFieldName, string(decryptAES(t, fileKey(t, output, "15051995"), name)))
+}
+
+func TestGenerateStudentReport_SignedRightToLeft(t *testing.T) {
+	signer, pool := newTestSigner(t)
+	locale, err := i18n.Parse("ar")
+	require.NoError(t, err)
+
+	output := renderUncompressed(t, Options{Signer: signer, Locale: locale}, api.GetMockStudent())
+
+	verifySignature(t, output, pool)
+	// The block sits at the end of the line, which is the left margin
+	assert.Regexp(t, `/Rect \[28\.35 `, output)
+}
+
+func TestGenerateMergedReport_Signed(t *testing.T) {
+	signer, pool := newTestSigner(t)
+	generator := NewPDFGenerator(layout.Default(), Options{Signer: signer})
+	generator.pdf.SetCompression(false)
+	students := []*api.Student{api.GetMockStudent(), api.GetMockStudent()}
+
+	pdfBytes, err := generator.GenerateMergedReport(context.Background(), students, func([]PageRange, *i18n.Translator) []string {
+		return []string{"Requested: 2, succeeded: 2, failed: 0"}
+	})
+	require.NoError(t, err)
+	output := string(pdfBytes)
+
+	// One signature covers the whole document; each report has its block,
+	// and the first holds the signature's widget
+	verifySignature(t, output, pool)
+	checkUpdateOffsets(t, output)
+	assert.Equal(t, 2, strings.Count(output, "(Digitally signed by Springfield High)Tj"))
+	assert.Equal(t, 1, strings.Count(output, "/FT /Sig"))
+	assert.Contains(t, output, fmt.Sprintf("/P %d 0 R /Rect", 1+2*generator.signature.page))
+}
+
+func TestGenerateStudentReport_SignedByServer(t *testing.T) {
+	signer, pool := newTestSigner(t)
+	server := newTestServer()
+	server.SetSigner(signer)
+
+	req, err := http.NewRequest("GET", "/api/v1/students/1/report?protect=restrict", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateStudentReport).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	verifySignature(t, rr.Body.String(), pool)
+}
+
+func TestGenerateTestReport_NotSigned(t *testing.T) {
+	signer, _ := newTestSigner(t)
+	server := newTestServer()
+	server.SetSigner(signer)
+
+	// Mock data and student JSON the caller sends must not carry the
+	// school's signature
+	req, err := http.NewRequest("GET", "/test/report?protect=restrict", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateTestReport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "/ByteRange")
+
+	body, err := json.Marshal(api.GetMockStudent())
+	require.NoError(t, err)
+	req, err = http.NewRequest("POST", "/api/v1/reports/student", strings.NewReader(string(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.RenderStudentReport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "/ByteRange")
+}
+
+func TestPreviewTemplate_NotSigned(t *testing.T) {
+	signer, _ := newTestSigner(t)
+	server := newTestServer()
+	server.SetSigner(signer)
+
+	pdfBytes, err := server.renderReport(context.Background(), reportOptions{template: layout.Default(), locale: i18n.English}, api.GetMockStudent())
+	require.NoError(t, err)
+	assert.NotContains(t, string(pdfBytes), "/ByteRange")
+}
@@ -0,0 +1,405 @@
+package pdf
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/layout"
+)
+
+// templatesPath is the route prefix of the template management endpoints
+const templatesPath = "/api/v1/templates"
+
+// maxTemplateBytes bounds an uploaded template document
+const maxTemplateBytes = 256 << 10
+
+// templateMediaTypes are the accepted Content-Types of template documents
+var templateMediaTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+	"application/json":   true,
+}
+
+// templateSummary is one entry of the template list
+type templateSummary struct {
+	Name          string    `json:"name"`
+	Description   string    `json:"description,omitempty"`
+	ActiveVersion int       `json:"activeVersion"`
+	LatestVersion int       `json:"latestVersion"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	URL           string    `json:"url"`
+}
+
+// uploadResponse describes a newly stored template version
+type uploadResponse struct {
+	Name    string         `json:"name"`
+	Version layout.Version `json:"version"`
+	// Active reports whether the new version is used for reports; only the
+	// first version of a template is activated on upload
+	Active    bool   `json:"active"`
+	SourceURL string `json:"sourceUrl"`
+}
+
+// activateRequest is the body of POST /api/v1/templates/{name}/activate
+type activateRequest struct {
+	Version int `json:"version"`
+}
+
+// HandleTemplates handles GET /api/v1/templates, listing the templates, and
+// POST /api/v1/templates, uploading a YAML or JSON template document as a
+// new version of the template it names
+func (s *Server) HandleTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listTemplates(w, r)
+	case http.MethodPost:
+		s.uploadTemplate(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Use GET to list templates or POST to upload one")
+	}
+}
+
+// HandleTemplate handles the endpoints of one template:
+//
+//	GET  /api/v1/templates/{name}                 every version and which is active
+//	GET  /api/v1/templates/{name}/versions/{n}    the document of version n, or "active"
+//	GET  /api/v1/templates/{name}/preview         the mock student rendered with ?version= or the active version
+//	POST /api/v1/templates/{name}/activate        activate {"version": n}
+//	POST /api/v1/templates/{name}/rollback        re-activate the previously active version
+//	POST /api/v1/templates/preview                render an unsaved document with the mock student
+func (s *Server) HandleTemplate(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, templatesPath+"/"), "/")
+	name := parts[0]
+	if len(parts) == 1 && name == "preview" && r.Method == http.MethodPost {
+		s.previewTemplateDocument(w, r)
+		return
+	}
+
+	switch {
+	case name == "":
+	case len(parts) == 1:
+		if allowMethod(w, r, http.MethodGet) {
+			s.getTemplate(w, r, name)
+		}
+		return
+	case len(parts) == 2 && parts[1] == "preview":
+		if allowMethod(w, r, http.MethodGet) {
+			s.previewTemplate(w, r, name)
+		}
+		return
+	case len(parts) == 2 && parts[1] == "activate":
+		if allowMethod(w, r, http.MethodPost) {
+			s.activateTemplate(w, r, name)
+		}
+		return
+	case len(parts) == 2 && parts[1] == "rollback":
+		if allowMethod(w, r, http.MethodPost) {
+			s.rollbackTemplate(w, r, name)
+		}
+		return
+	case len(parts) == 3 && parts[1] == "versions":
+		if allowMethod(w, r, http.MethodGet) {
+			s.getTemplateSource(w, r, name, parts[2])
+		}
+		return
+	}
+
+	writeProblem(w, r, http.StatusNotFound, "Expected: /api/v1/templates/{name}[/versions/{n}|/preview|/activate|/rollback]")
+}
+
+// allowMethod writes a 405 response and returns false unless the request
+// uses method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeProblem(w, r, http.StatusMethodNotAllowed, "Use "+method+" for this endpoint")
+	return false
+}
+
+// authorizeTemplateChange checks the bearer token required to change
+// templates, writing a 401 response if it is missing or wrong. Templates
+// cannot be changed, with a 403 response, unless TEMPLATE_ADMIN_TOKEN is set.
+func (s *Server) authorizeTemplateChange(w http.ResponseWriter, r *http.Request) bool {
+	if s.templateAdminToken == "" {
+		writeProblem(w, r, http.StatusForbidden, "Templates cannot be changed on this server; no admin token is configured")
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.templateAdminToken)) == 1 {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="templates"`)
+	writeProblem(w, r, http.StatusUnauthorized, "A valid admin token is required to change templates")
+	return false
+}
+
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	records, err := s.templates.Records(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to list templates", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "Failed to list templates")
+		return
+	}
+
+	summaries := make([]templateSummary, len(records))
+	for i, record := range records {
+		active, _ := record.Version(record.Active)
+		summaries[i] = templateSummary{
+			Name:          record.Name,
+			Description:   active.Description,
+			ActiveVersion: record.Active,
+			LatestVersion: record.Latest().Version,
+			UpdatedAt:     record.UpdatedAt,
+			URL:           templatesPath + "/" + record.Name,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"templates": summaries})
+}
+
+func (s *Server) uploadTemplate(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeTemplateChange(w, r) {
+		return
+	}
+	source, ok := readTemplateDocument(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	record, version, err := s.templates.Upload(ctx, source)
+	var validationErr *layout.ValidationError
+	if errors.As(err, &validationErr) {
+		slog.InfoContext(ctx, "Rejected invalid template", "error", err)
+		writeTemplateProblem(w, r, validationErr)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to store template", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "Failed to store template")
+		return
+	}
+
+	slog.InfoContext(ctx, "Uploaded template", "template", record.Name, "version", version.Version, "active", record.Active == version.Version)
+
+	response := uploadResponse{
+		Name:      record.Name,
+		Version:   version,
+		Active:    record.Active == version.Version,
+		SourceURL: fmt.Sprintf("%s/%s/versions/%d", templatesPath, record.Name, version.Version),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", response.SourceURL)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) getTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	record, err := s.templates.Record(r.Context(), name)
+	if err != nil {
+		handleTemplateError(w, r, "Failed to load template", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+func (s *Server) getTemplateSource(w http.ResponseWriter, r *http.Request, name, version string) {
+	ctx := r.Context()
+
+	var number int
+	if version == "active" {
+		tmpl, err := s.templates.Get(name)
+		if err != nil {
+			handleTemplateError(w, r, "Failed to load template", err)
+			return
+		}
+		number = tmpl.Version
+	} else {
+		var err error
+		if number, err = strconv.Atoi(version); err != nil || number < 1 {
+			writeProblem(w, r, http.StatusNotFound, "Template versions are positive integers or \"active\"")
+			return
+		}
+	}
+
+	source, err := s.templates.Source(ctx, name, number)
+	if err != nil {
+		handleTemplateError(w, r, "Failed to load template", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", templateContentType(source))
+	w.Header().Set("X-Template-Version", strconv.Itoa(number))
+	w.Header().Set("Content-Length", strconv.Itoa(len(source)))
+	w.Write(source)
+}
+
+func (s *Server) activateTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.authorizeTemplateChange(w, r) {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+	var req activateRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<10)).Decode(&req); err != nil || req.Version < 1 {
+		writeProblem(w, r, http.StatusBadRequest, `Expected a body like {"version": 2}`)
+		return
+	}
+
+	record, err := s.templates.Activate(r.Context(), name, req.Version)
+	if err != nil {
+		handleTemplateError(w, r, "Failed to activate template", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Activated template", "template", name, "version", record.Active)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+func (s *Server) rollbackTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.authorizeTemplateChange(w, r) {
+		return
+	}
+
+	record, err := s.templates.Rollback(r.Context(), name)
+	if err != nil {
+		handleTemplateError(w, r, "Failed to roll back template", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Rolled back template", "template", name, "version", record.Active)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// previewTemplate renders the mock student with a stored template version
+func (s *Server) previewTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	var number int
+	if version := r.URL.Query().Get("version"); version != "" {
+		var err error
+		if number, err = strconv.Atoi(version); err != nil || number < 1 {
+			writeProblem(w, r, http.StatusBadRequest, "version must be a positive integer")
+			return
+		}
+	}
+
+	tmpl, err := s.templates.Version(r.Context(), name, number)
+	if err != nil {
+		handleTemplateError(w, r, "Failed to load template", err)
+		return
+	}
+	s.writePreview(w, r, tmpl)
+}
+
+// previewTemplateDocument validates a template document without storing it
+// and renders the mock student with it
+func (s *Server) previewTemplateDocument(w http.ResponseWriter, r *http.Request) {
+	source, ok := readTemplateDocument(w, r)
+	if !ok {
+		return
+	}
+
+	tmpl, err := layout.Parse(source)
+	var validationErr *layout.ValidationError
+	if errors.As(err, &validationErr) {
+		writeTemplateProblem(w, r, validationErr)
+		return
+	}
+	if err != nil {
+		handleTemplateError(w, r, "Failed to parse template", err)
+		return
+	}
+	s.writePreview(w, r, tmpl)
+}
+
+// writePreview renders api.GetMockStudent() with tmpl for viewing in a
+// browser, in the language the request asks for. Previews show mock data, so
+// they carry the policy's watermark.
+func (s *Server) writePreview(w http.ResponseWriter, r *http.Request, tmpl *layout.Template) {
+	locale, ok := s.localeFor(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	pdfBytes, err := s.renderReport(ctx, reportOptions{template: tmpl, locale: locale, watermark: s.watermarks.Automatic()}, api.GetMockStudent())
+	if err != nil {
+		handleStageError(w, r, "Failed to render template preview", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Rendered template preview", "template", tmpl.Name, "version", tmpl.Version, "bytes", len(pdfBytes))
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s_preview.pdf\"", tmpl.Name))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdfBytes)))
+	if _, err := w.Write(pdfBytes); err != nil {
+		slog.ErrorContext(ctx, "Error writing template preview to response", "error", err)
+	}
+}
+
+// readTemplateDocument reads a YAML or JSON template from the request body,
+// writing an error response and returning false if it cannot
+func readTemplateDocument(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !templateMediaTypes[mediaType] {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/yaml or application/json")
+		return nil, false
+	}
+
+	source, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTemplateBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Templates may be at most %d bytes", maxTemplateBytes))
+			return nil, false
+		}
+		writeProblem(w, r, http.StatusBadRequest, "Failed to read template")
+		return nil, false
+	}
+	return source, true
+}
+
+// templateContentType guesses whether a stored document is JSON or YAML
+func templateContentType(source []byte) string {
+	if trimmed := strings.TrimSpace(string(source)); strings.HasPrefix(trimmed, "{") {
+		return "application/json"
+	}
+	return "application/yaml"
+}
+
+// handleTemplateError maps registry errors to problem responses
+func handleTemplateError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	switch {
+	case errors.Is(err, layout.ErrNotFound):
+		writeProblem(w, r, http.StatusNotFound, message+": "+err.Error())
+	case errors.Is(err, layout.ErrNoRollback):
+		writeProblem(w, r, http.StatusConflict, message+": "+err.Error())
+	default:
+		slog.ErrorContext(r.Context(), message, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, message)
+	}
+}
@@ -0,0 +1,305 @@
+package pdf
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/jobs"
+)
+
+const (
+	letterTemplateV1 = "name: letter\ndescription: First\npage: {size: Letter}\nblocks: [{type: text, text: '{{name}}'}]\n"
+	letterTemplateV2 = `{"name": "letter", "description": "Second", "page": {"size": "Letter", "orientation": "L"}, "blocks": [{"type": "text", "text": "{{name}}"}]}`
+)
+
+// testAdminToken is the token newAdminTestServer requires to change
+// templates, which templateRequest sends
+const testAdminToken = "let-me-in"
+
+// newAdminTestServer creates a test server whose templates can be changed
+func newAdminTestServer(t *testing.T) *Server {
+	t.Helper()
+	t.Setenv("TEMPLATE_ADMIN_TOKEN", testAdminToken)
+	return newTestServer()
+}
+
+// templateRequest sends a request to the template endpoints with the admin
+// token
+func templateRequest(t *testing.T, server *Server, method, path, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, path, reader)
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return serveTemplates(server, req)
+}
+
+// serveTemplates sends req to the template endpoints as it is
+func serveTemplates(server *Server, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	if req.URL.Path == templatesPath {
+		http.HandlerFunc(server.HandleTemplates).ServeHTTP(rr, req)
+	} else {
+		http.HandlerFunc(server.HandleTemplate).ServeHTTP(rr, req)
+	}
+	return rr
+}
+
+func decodeJSON(t *testing.T, rr *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	return body
+}
+
+func TestTemplates_Lifecycle(t *testing.T) {
+	server := newAdminTestServer(t)
+
+	// Upload the first version, which is activated straight away
+	rr := templateRequest(t, server, "POST", templatesPath, "application/yaml", letterTemplateV1)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	assert.Equal(t, "/api/v1/templates/letter/versions/1", rr.Header().Get("Location"))
+	uploaded := decodeJSON(t, rr)
+	assert.Equal(t, true, uploaded["active"])
+	assert.Equal(t, float64(1), uploaded["version"].(map[string]interface{})["version"])
+
+	// A second version is stored but not used yet
+	rr = templateRequest(t, server, "POST", templatesPath, "application/json", letterTemplateV2)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	assert.Equal(t, false, decodeJSON(t, rr)["active"])
+
+	rr = templateRequest(t, server, "GET", templatesPath, "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var list struct {
+		Templates []templateSummary `json:"templates"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	require.Len(t, list.Templates, 2)
+	assert.Equal(t, "default", list.Templates[0].Name)
+	assert.Equal(t, "letter", list.Templates[1].Name)
+	assert.Equal(t, "First", list.Templates[1].Description)
+	assert.Equal(t, 1, list.Templates[1].ActiveVersion)
+	assert.Equal(t, 2, list.Templates[1].LatestVersion)
+
+	// Every version's document can be fetched as uploaded
+	rr = templateRequest(t, server, "GET", "/api/v1/templates/letter/versions/2", "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, letterTemplateV2, rr.Body.String())
+
+	rr = templateRequest(t, server, "GET", "/api/v1/templates/letter/versions/active", "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/yaml", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "1", rr.Header().Get("X-Template-Version"))
+	assert.Equal(t, letterTemplateV1, rr.Body.String())
+
+	// Activate version 2 and check reports use it
+	rr = templateRequest(t, server, "POST", "/api/v1/templates/letter/activate", "application/json", `{"version":2}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, float64(2), decodeJSON(t, rr)["activeVersion"])
+	assert.Contains(t, renderTestReport(t, server, "letter"), "/MediaBox [0 0 792.00 612.00]")
+
+	// Roll back to version 1
+	rr = templateRequest(t, server, "POST", "/api/v1/templates/letter/rollback", "", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, float64(1), decodeJSON(t, rr)["activeVersion"])
+	assert.Contains(t, renderTestReport(t, server, "letter"), "/MediaBox [0 0 612.00 792.00]")
+
+	rr = templateRequest(t, server, "POST", "/api/v1/templates/letter/rollback", "", "")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = templateRequest(t, server, "GET", "/api/v1/templates/letter", "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	record := decodeJSON(t, rr)
+	assert.Equal(t, float64(1), record["activeVersion"])
+	assert.Len(t, record["versions"], 2)
+}
+
+// renderTestReport renders the mock student with the named template
+func renderTestReport(t *testing.T, server *Server, template string) string {
+	t.Helper()
+	req, err := http.NewRequest("GET", "/test/report?template="+template, nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateTestReport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	return rr.Body.String()
+}
+
+func TestTemplates_UploadValidationErrors(t *testing.T) {
+	server := newAdminTestServer(t)
+
+	source := "name: broken\nblocks:\n  - type: section\n    title: INFO\n    rows:\n      - {label: 'Nick:', value: '{{nickname}}'}\n  - type: chart\n"
+	rr := templateRequest(t, server, "POST", templatesPath, "application/yaml", source)
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	require.Len(t, problem.Errors, 2)
+	assert.Equal(t, 6, problem.Errors[0].Line)
+	assert.Equal(t, "blocks[0].rows[0].value", problem.Errors[0].Path)
+	assert.Contains(t, problem.Errors[0].Message, "nickname")
+	assert.Equal(t, 7, problem.Errors[1].Line)
+	assert.Equal(t, "blocks[1].type", problem.Errors[1].Path)
+
+	// Nothing was stored
+	rr = templateRequest(t, server, "GET", "/api/v1/templates/broken", "", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestTemplates_Preview(t *testing.T) {
+	server := newAdminTestServer(t)
+
+	rr := templateRequest(t, server, "POST", "/api/v1/templates/preview", "application/yaml", letterTemplateV1)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `inline; filename="letter_preview.pdf"`, rr.Header().Get("Content-Disposition"))
+	assert.Contains(t, rr.Body.String(), "/MediaBox [0 0 612.00 792.00]")
+
+	// Previewing does not store the template
+	rr = templateRequest(t, server, "GET", "/api/v1/templates/letter", "", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = templateRequest(t, server, "POST", "/api/v1/templates/preview", "application/yaml", "name: x\nblocks: []\n")
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	// Stored versions can be previewed before they are activated
+	templateRequest(t, server, "POST", templatesPath, "application/yaml", letterTemplateV1)
+	templateRequest(t, server, "POST", templatesPath, "application/json", letterTemplateV2)
+
+	rr = templateRequest(t, server, "GET", "/api/v1/templates/letter/preview?version=2", "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "/MediaBox [0 0 792.00 612.00]")
+
+	rr = templateRequest(t, server, "GET", "/api/v1/templates/letter/preview", "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "/MediaBox [0 0 612.00 792.00]")
+
+	rr = templateRequest(t, server, "GET", "/api/v1/templates/letter/preview?version=9", "", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestTemplates_AdminToken(t *testing.T) {
+	server := newAdminTestServer(t)
+
+	for _, authorization := range []string{"", "Bearer wrong", testAdminToken} {
+		req, err := http.NewRequest("POST", templatesPath, strings.NewReader(letterTemplateV1))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/yaml")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := serveTemplates(server, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, authorization)
+		assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "Bearer")
+	}
+
+	rr := templateRequest(t, server, "POST", templatesPath, "application/yaml", letterTemplateV1)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	req, err := http.NewRequest("POST", "/api/v1/templates/letter/rollback", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serveTemplates(server, req).Code)
+
+	// Reading and previewing need no token
+	req, err = http.NewRequest("GET", templatesPath, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serveTemplates(server, req).Code)
+	req, err = http.NewRequest("GET", "/api/v1/templates/letter/preview", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serveTemplates(server, req).Code)
+}
+
+func TestTemplates_NoAdminToken(t *testing.T) {
+	t.Setenv("TEMPLATE_ADMIN_TOKEN", "")
+	server := newTestServer()
+
+	// Without a token configured, no token can change templates
+	for _, path := range []string{templatesPath, "/api/v1/templates/default/activate", "/api/v1/templates/default/rollback"} {
+		rr := templateRequest(t, server, "POST", path, "application/yaml", letterTemplateV1)
+		assert.Equal(t, http.StatusForbidden, rr.Code, path)
+		assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+	}
+	_, err := server.templates.Get("letter")
+	assert.Error(t, err)
+
+	rr := templateRequest(t, server, "GET", templatesPath, "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestTemplates_Rejections(t *testing.T) {
+	server := newAdminTestServer(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{"wrong content type", "POST", templatesPath, "text/plain", letterTemplateV1, http.StatusUnsupportedMediaType},
+		{"too large", "POST", templatesPath, "application/yaml", strings.Repeat("#", maxTemplateBytes+1), http.StatusRequestEntityTooLarge},
+		{"wrong method", "DELETE", templatesPath, "", "", http.StatusMethodNotAllowed},
+		{"unknown template", "GET", "/api/v1/templates/missing", "", "", http.StatusNotFound},
+		{"unknown version", "GET", "/api/v1/templates/default/versions/9", "", "", http.StatusNotFound},
+		{"bad version", "GET", "/api/v1/templates/default/versions/latest", "", "", http.StatusNotFound},
+		{"unknown sub-resource", "GET", "/api/v1/templates/default/history", "", "", http.StatusNotFound},
+		{"missing name", "GET", "/api/v1/templates/", "", "", http.StatusNotFound},
+		{"activate with GET", "GET", "/api/v1/templates/default/activate", "", "", http.StatusMethodNotAllowed},
+		{"activate without version", "POST", "/api/v1/templates/default/activate", "application/json", `{}`, http.StatusBadRequest},
+		{"activate unknown version", "POST", "/api/v1/templates/default/activate", "application/json", `{"version":9}`, http.StatusNotFound},
+		{"bad preview version", "GET", "/api/v1/templates/default/preview?version=x", "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := templateRequest(t, server, tt.method, tt.path, tt.contentType, tt.body)
+			assert.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestTemplates_JobsKeepTheirVersion(t *testing.T) {
+	server := newAdminTestServer(t)
+	// The workers are never started, so the job waits while the template changes
+	server.jobs = jobs.NewManager(jobs.NewMemoryStore(), server.runJob, jobs.Config{})
+
+	templateRequest(t, server, "POST", templatesPath, "application/yaml", letterTemplateV1)
+	templateRequest(t, server, "POST", templatesPath, "application/json", letterTemplateV2)
+
+	req, err := http.NewRequest("POST", "/api/v1/jobs?template=letter", strings.NewReader(`{"studentIds":[1]}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.CreateReportJob).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	created := decodeJSON(t, rr)
+	assert.Equal(t, float64(1), created["templateVersion"])
+
+	rr = templateRequest(t, server, "POST", "/api/v1/templates/letter/activate", "application/json", `{"version":2}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	job, err := server.jobs.Get(req.Context(), created["id"].(string))
+	require.NoError(t, err)
+	result, err := server.runJob(req.Context(), job, func(int) {})
+	require.NoError(t, err)
+	assert.Contains(t, string(result.Data), "/MediaBox [0 0 612.00 792.00]")
+}
@@ -0,0 +1,335 @@
+package pdf
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"pdf-generator/internal/bidi"
+	"pdf-generator/internal/fonts"
+	"pdf-generator/internal/layout"
+)
+
+// setFont selects a template font for the text that follows. PDF/A reports
+// select the main Unicode family rather than the core font, so that the core
+// fonts, which are not embedded, are never added to them.
+func (pg *PDFGenerator) setFont(font layout.Font) {
+	pg.font = font
+	if pg.pdfa {
+		pg.selectFont(pg.fonts.Names()[0])
+		return
+	}
+	pg.selectFont("")
+}
+
+// useFont makes sure the current template font is printed in the named
+// Unicode family, or in the core font if family is empty
+func (pg *PDFGenerator) useFont(family string) {
+	if family != pg.selected {
+		pg.selectFont(family)
+	}
+}
+
+// selectFont switches gofpdf to the current template font in family. Unicode
+// faces are added to the document the first time they are used, so reports
+// only embed the fonts they need.
+func (pg *PDFGenerator) selectFont(family string) {
+	pg.selected = family
+	if family == "" {
+		pg.pdf.SetFont(pg.font.Family, pg.font.Style, pg.font.Size)
+		return
+	}
+
+	style := strings.ReplaceAll(pg.font.Style, "U", "")
+	key := family + "/" + style
+	if !pg.registered[key] {
+		pg.pdf.AddUTF8FontFromBytes(family, style, pg.fonts.Family(family).Face(style))
+		pg.registered[key] = true
+	}
+	pg.pdf.SetFont(family, pg.font.Style, pg.font.Size)
+}
+
+// cell prints UTF-8 text in the current template font like gofpdf's
+// CellFormat. Text the core fonts cannot encode is printed in the Unicode
+// fonts, switching font wherever the script changes. Right-to-left text is
+// put in display order, and in right-to-left reports the alignment is
+// mirrored.
+func (pg *PDFGenerator) cell(w, h float64, text, border string, ln int, align string, fill bool) {
+	align = pg.align(align)
+	runs, missing := pg.split(bidi.Display(text, pg.rtl))
+	for _, r := range missing {
+		pg.missing[r] = true
+	}
+
+	if len(runs) == 1 {
+		pg.useFont(runs[0].Family)
+		pg.pdf.CellFormat(w, h, runs[0].Text, border, ln, align, fill, 0, "")
+		return
+	}
+
+	// Draw the box, then place the runs inside it as CellFormat would
+	x, y := pg.pdf.GetXY()
+	pg.pdf.CellFormat(w, h, "", border, 0, "", fill, 0, "")
+
+	widths := make([]float64, len(runs))
+	var total float64
+	for i, run := range runs {
+		pg.useFont(run.Family)
+		widths[i] = pg.pdf.GetStringWidth(run.Text)
+		total += widths[i]
+	}
+
+	margin := pg.pdf.GetCellMargin()
+	textX := x + margin
+	switch align {
+	case "C":
+		textX = x + (w-total)/2
+	case "R":
+		textX = x + w - margin - total
+	}
+	for i, run := range runs {
+		pg.useFont(run.Family)
+		_, fontSize := pg.pdf.GetFontSize()
+		pg.pdf.Text(textX, y+0.5*h+0.3*fontSize, run.Text)
+		textX += widths[i]
+	}
+
+	switch ln {
+	case 0:
+		pg.pdf.SetXY(x+w, y)
+	case 1:
+		left, _, _, _ := pg.pdf.GetMargins()
+		pg.pdf.SetXY(left, y+h)
+	default:
+		pg.pdf.SetXY(x, y+h)
+	}
+}
+
+// split divides text into the runs cell prints it in. PDF/A reports only
+// print text in embedded fonts, so none in the core fonts, and leave out the
+// characters no font covers rather than print a missing glyph, which PDF/A
+// forbids as well; checkCovered then fails the report.
+func (pg *PDFGenerator) split(text string) ([]fonts.Run, []rune) {
+	if !pg.pdfa {
+		return pg.fonts.Split(text)
+	}
+	runs, missing := pg.fonts.SplitUnicode(text)
+	if len(missing) > 0 {
+		for i := range runs {
+			runs[i].Text = strings.Map(func(r rune) rune {
+				if slices.Contains(missing, r) {
+					return -1
+				}
+				return r
+			}, runs[i].Text)
+		}
+	}
+	return runs, missing
+}
+
+// rowText is one cell of a row printed with addRow
+type rowText struct {
+	width float64
+	text  string
+	font  layout.Font
+	align string
+}
+
+// addRow prints a row of cells side by side, filling from the left margin,
+// or from the right margin in right-to-left reports. Text wraps onto as many
+// lines of lineHeight as it needs, each cell starting on the row's first
+// line, and bordered cells are as tall as the row. The row moves to a new
+// page unless it fits above the footer.
+func (pg *PDFGenerator) addRow(cells []rowText, lineHeight float64, border string) {
+	lines, count := pg.wrapRow(cells)
+	pg.keepTogether(lineHeight * float64(count))
+
+	left, _, _, _ := pg.pdf.GetMargins()
+	for i := 0; i < count; i++ {
+		// Only a row taller than a page breaks between its lines
+		pg.keepTogether(lineHeight)
+		y := pg.pdf.GetY()
+		x := left
+		if pg.rtl {
+			x += pg.contentWidth()
+		}
+		for j, cell := range cells {
+			if pg.rtl {
+				x -= cell.width
+			}
+			text := ""
+			if i < len(lines[j]) {
+				text = lines[j][i]
+			}
+			if cell.font != pg.font {
+				pg.setFont(cell.font)
+			}
+			pg.pdf.SetXY(x, y)
+			pg.cell(cell.width, lineHeight, text, lineBorder(border, i, count), 0, cell.align, false)
+			if !pg.rtl {
+				x += cell.width
+			}
+		}
+		pg.pdf.SetXY(left, y+lineHeight)
+	}
+}
+
+// lineBorder is the border of line i of a cell count lines tall, which
+// together draw the cell's border
+func lineBorder(border string, i, count int) string {
+	if border != "1" || count == 1 {
+		return border
+	}
+	switch i {
+	case 0:
+		return "LRT"
+	case count - 1:
+		return "LRB"
+	}
+	return "LR"
+}
+
+// wrapRow wraps the text of each cell of a row, returning the lines of
+// every cell and the number of lines in the row
+func (pg *PDFGenerator) wrapRow(cells []rowText) ([][]string, int) {
+	lines := make([][]string, len(cells))
+	count := 1
+	// Measuring selects each cell's font, so go backwards to finish in the
+	// font of the first cell, which is printed first
+	for i := len(cells) - 1; i >= 0; i-- {
+		cell := cells[i]
+		if cell.font != pg.font {
+			pg.setFont(cell.font)
+		}
+		lines[i] = pg.wrap(cell.text, cell.width)
+		count = max(count, len(lines[i]))
+	}
+	return lines, count
+}
+
+// rowHeight is the height addRow would give a row
+func (pg *PDFGenerator) rowHeight(cells []rowText, lineHeight float64) float64 {
+	_, count := pg.wrapRow(cells)
+	return lineHeight * float64(count)
+}
+
+// wrap breaks text into lines that fit in a cell width wide when printed in
+// the current template font. Lines break between words, and inside words
+// too wide for a line of their own; line breaks in the text are kept.
+func (pg *PDFGenerator) wrap(text string, width float64) []string {
+	width -= 2 * pg.pdf.GetCellMargin()
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && pg.textWidth(line+" "+word) <= width {
+				line += " " + word
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			for word != "" && pg.textWidth(word) > width {
+				head := pg.fit(word, width)
+				lines = append(lines, head)
+				word = word[len(head):]
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// fit returns the longest start of word that fits in width, and at least
+// its first character
+func (pg *PDFGenerator) fit(word string, width float64) string {
+	_, size := utf8.DecodeRuneInString(word)
+	end := size
+	for end < len(word) {
+		_, size := utf8.DecodeRuneInString(word[end:])
+		if pg.textWidth(word[:end+size]) > width {
+			break
+		}
+		end += size
+	}
+	return word[:end]
+}
+
+// textWidth is the width of text printed by cell in the current template
+// font
+func (pg *PDFGenerator) textWidth(text string) float64 {
+	runs, _ := pg.split(bidi.Display(text, pg.rtl))
+	var width float64
+	for _, run := range runs {
+		pg.useFont(run.Family)
+		width += pg.pdf.GetStringWidth(run.Text)
+	}
+	return width
+}
+
+// keepTogether starts a new page unless content height tall fits above the
+// footer of this one. Content taller than a page starts where it is.
+func (pg *PDFGenerator) keepTogether(height float64) {
+	_, pageHeight := pg.pdf.GetPageSize()
+	_, top, _, _ := pg.pdf.GetMargins()
+	_, bottom := pg.pdf.GetAutoPageBreak()
+	limit := pageHeight - bottom
+	if pg.pdf.GetY()+height > limit && top+height <= limit {
+		pg.pdf.AddPage()
+	}
+}
+
+// align mirrors a template alignment in right-to-left reports
+func (pg *PDFGenerator) align(align string) string {
+	if !pg.rtl {
+		return align
+	}
+	switch align {
+	case "L", "":
+		return "R"
+	case "R":
+		return "L"
+	}
+	return align
+}
+
+// bookmark adds an outline entry for the current page. Outline titles are
+// not drawn with a font, so text beyond ASCII is always written as UTF-16,
+// which gofpdf only does by itself while a Unicode font is selected.
+func (pg *PDFGenerator) bookmark(title string) {
+	if pg.selected == "" && !isASCII(title) {
+		title = utf16Text(title)
+	}
+	pg.pdf.Bookmark(title, 0, -1)
+}
+
+// missingCharacters returns, and forgets, the characters that no font could
+// print since the last call
+func (pg *PDFGenerator) missingCharacters() string {
+	runes := slices.Sorted(maps.Keys(pg.missing))
+	clear(pg.missing)
+	return string(runes)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// utf16Text encodes s as a PDF text string in UTF-16BE with a byte order mark
+func utf16Text(s string) string {
+	var b strings.Builder
+	b.WriteString("\xfe\xff")
+	for _, unit := range utf16.Encode([]rune(s)) {
+		b.WriteByte(byte(unit >> 8))
+		b.WriteByte(byte(unit))
+	}
+	return b.String()
+}
@@ -0,0 +1,258 @@
+package pdf
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/bidi"
+	"pdf-generator/internal/fonts"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/layout"
+)
+
+// multiScriptStudent is the mock student with names in several scripts
+func multiScriptStudent() *api.Student {
+	student := api.GetMockStudent()
+	student.Name = "Łucja Żółkiewska"
+	father, mother, guardian := "Γιώργος Παπαδόπουλος", "Дарья Иванова", "محمد علي"
+	address := "José Müller, 12 Rue d'Été"
+	student.FatherName, student.MotherName, student.GuardianName = &father, &mother, &guardian
+	student.CurrentAddress = &address
+	return student
+}
+
+// renderUncompressed renders a student with readable content streams
+func renderUncompressed(t *testing.T, opts Options, student *api.Student) string {
+	t.Helper()
+	generator := NewPDFGenerator(layout.Default(), opts)
+	generator.pdf.SetCompression(false)
+	pdfBytes, err := generator.GenerateStudentReport(context.Background(), student)
+	require.NoError(t, err)
+	return string(pdfBytes)
+}
+
+// shownText is how gofpdf writes text printed in a Unicode font, escaping
+// the bytes that read as parentheses and backslashes
+func shownText(s string) string {
+	return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(utf16Text(s)[2:]) + ")Tj"
+}
+
+func TestGenerateStudentReport_MultiScript(t *testing.T) {
+	output := renderUncompressed(t, Options{}, multiScriptStudent())
+
+	// Text beyond Windows-1252 is printed in the embedded Unicode font
+	assert.Contains(t, output, "/FontFile2")
+	assert.Contains(t, output, "/BaseFont /utf8dejavusans")
+	for _, name := range []string{"Łucja Żółkiewska", "Γιώργος Παπαδόπουλος", "Дарья Иванова", "محمد علي"} {
+		// Arabic is shaped and drawn right to left
+		assert.Contains(t, output, shownText(bidi.Display(name, false)), name)
+	}
+	// Names in the core fonts' encoding keep using them
+	assert.Contains(t, output, "(Jos\xe9 M\xfcller, 12 Rue d'\xc9t\xe9)Tj")
+
+	// The outline entry is UTF-16 whatever font was last selected
+	title := strings.NewReplacer("(", `\(`, ")", `\)`).Replace(utf16Text("Łucja Żółkiewska (ID 1)"))
+	assert.Contains(t, output, "/Title ("+title+")")
+}
+
+func TestGenerateStudentReport_Devanagari(t *testing.T) {
+	student := api.GetMockStudent()
+	student.Name = "अनुष्का शर्मा"
+
+	generator := NewPDFGenerator(layout.Default(), Options{})
+	generator.pdf.SetCompression(false)
+	pdfBytes, err := generator.GenerateStudentReport(context.Background(), student)
+	require.NoError(t, err)
+	output := string(pdfBytes)
+
+	// Devanagari falls back to the bundled Noto Sans Devanagari
+	assert.Contains(t, output, "/BaseFont /utf8notosansdevanagari")
+	assert.Contains(t, output, shownText("अनुष्का शर्मा"))
+	assert.Empty(t, generator.missingCharacters())
+
+	// which PDF/A reports can print too
+	_, err = NewPDFGenerator(layout.Default(), Options{PDFA: true}).GenerateStudentReport(context.Background(), student)
+	assert.NoError(t, err)
+}
+
+func TestGenerateStudentReport_DevanagariVowelSign(t *testing.T) {
+	student := api.GetMockStudent()
+	student.Name = "प्रिया"
+	output := renderUncompressed(t, Options{}, student)
+
+	// The vowel sign i is drawn to the left of ra, which it follows in the name
+	assert.Contains(t, output, shownText("\u092a\u094d\u093f\u0930\u092f\u093e"))
+	assert.NotContains(t, output, shownText("प्रिया"))
+}
+
+func TestGenerateStudentReport_CoreFontsOnly(t *testing.T) {
+	output := renderUncompressed(t, Options{}, api.GetMockStudent())
+
+	assert.NotContains(t, output, "/FontFile2")
+	assert.Contains(t, output, "/BaseFont /Helvetica-Bold")
+	assert.Contains(t, output, "(John Doe)Tj")
+}
+
+func TestCell_MixedScripts(t *testing.T) {
+	set := fonts.Bundled()
+	generator := NewPDFGenerator(layout.Default(), Options{Fonts: set})
+	generator.pdf.AddPage()
+	generator.setFont(layout.Font{Family: "Arial", Size: 11})
+
+	// Text no font covers is printed in the main family and reported
+	generator.cell(100, 6, "Li 李", "0", 1, "R", false)
+	assert.Equal(t, "李", generator.missingCharacters())
+	assert.Empty(t, generator.missingCharacters())
+	require.NoError(t, generator.pdf.Error())
+
+	x, y := generator.pdf.GetXY()
+	left, top, _, _ := generator.pdf.GetMargins()
+	assert.InDelta(t, left, x, 0.01)
+	assert.InDelta(t, top+6, y, 0.01)
+}
+
+// textX returns the x position at which text is drawn, in points
+func textX(t *testing.T, output, text string) float64 {
+	t.Helper()
+	x, _ := textPosition(t, output, text)
+	return x
+}
+
+// textPosition returns the position at which text is first drawn, in points
+// from the bottom left corner of its page
+func textPosition(t *testing.T, output, text string) (float64, float64) {
+	t.Helper()
+	end := strings.Index(output, " Td "+text)
+	require.GreaterOrEqual(t, end, 0, "%s is not drawn", text)
+	position := strings.Fields(output[strings.LastIndex(output[:end], "BT ")+3 : end])
+	require.Len(t, position, 2)
+	x, err := strconv.ParseFloat(position[0], 64)
+	require.NoError(t, err)
+	y, err := strconv.ParseFloat(position[1], 64)
+	require.NoError(t, err)
+	return x, y
+}
+
+func TestGenerateStudentReport_RightToLeft(t *testing.T) {
+	student := api.GetMockStudent()
+	student.Name = "דני כהן"
+	student.Email = "dani@school.com"
+
+	ltr := renderUncompressed(t, Options{}, student)
+	locale, err := i18n.Parse("he")
+	require.NoError(t, err)
+	rtl := renderUncompressed(t, Options{Locale: locale}, student)
+
+	// Labels move from the left margin to the right one, and values to their left
+	label := shownText(bidi.Display("מספר תלמיד:", true))
+	assert.Less(t, textX(t, ltr, "(Student ID:)Tj"), 50.0)
+	assert.Greater(t, textX(t, rtl, label), 450.0)
+	assert.Less(t, textX(t, rtl, "(1)Tj"), textX(t, rtl, label))
+
+	// Hebrew is drawn in display order; addresses and numbers are unchanged
+	name := shownText("ןהכ ינד")
+	assert.Contains(t, ltr, name)
+	assert.Contains(t, rtl, name)
+	assert.Contains(t, rtl, "(dani@school.com)Tj")
+	assert.Contains(t, rtl, "(+1234567890)Tj")
+}
+
+func TestGenerateStudentReport_Translated(t *testing.T) {
+	student := api.GetMockStudent()
+	student.Phone = nil
+	locale, err := i18n.Parse("pt-BR")
+	require.NoError(t, err)
+
+	output := renderUncompressed(t, Options{Locale: locale}, student)
+
+	assert.Contains(t, output, "(RELAT\xd3RIO DO ALUNO)Tj")
+	assert.Contains(t, output, "(Data de nascimento:)Tj")
+	assert.Contains(t, output, "(15 de maio de 1995)Tj")
+	assert.Contains(t, output, "(N/D)Tj")
+	assert.NotContains(t, output, "(Full Name:)Tj")
+}
+
+func TestGenerateStudentReport_WrapsLongValues(t *testing.T) {
+	student := api.GetMockStudent()
+	address := "Flat 12, Riverside Court, 1234 Long Meadow Avenue, North Springfield Industrial Estate, Springfield, State 12345"
+	student.CurrentAddress = &address
+
+	output := renderUncompressed(t, Options{}, student)
+
+	// The address wraps inside the value column, the label stays on its
+	// first line and the next row follows the last line
+	labelX, labelY := textPosition(t, output, "(Current Address:)Tj")
+	firstX, firstY := textPosition(t, output, "(Flat 12, Riverside Court, 1234 Long Meadow Avenue, North Springfield)Tj")
+	secondX, secondY := textPosition(t, output, "(Industrial Estate, Springfield, State 12345)Tj")
+	_, nextY := textPosition(t, output, "(Permanent Address:)Tj")
+	assert.Less(t, labelX, firstX)
+	assert.InDelta(t, labelY, firstY, 0.01)
+	assert.InDelta(t, firstX, secondX, 0.01)
+	assert.InDelta(t, firstY-17.01, secondY, 0.01)
+	assert.InDelta(t, secondY-17.01, nextY, 0.01)
+}
+
+func TestWrap(t *testing.T) {
+	generator := NewPDFGenerator(layout.Default(), Options{})
+	generator.setFont(layout.Font{Family: "Arial", Size: 11})
+
+	tests := []struct {
+		name  string
+		text  string
+		width float64
+		want  []string
+	}{
+		{"fits", "John Doe", 50, []string{"John Doe"}},
+		{"empty", "", 50, []string{""}},
+		{"between words", "one two three four", 25, []string{"one two", "three four"}},
+		{"line breaks", "one\ntwo", 50, []string{"one", "two"}},
+		{"long word", "abcdefghijklmnopqrstuvwxyz", 30, []string{"abcdefghijklmn", "opqrstuvwxyz"}},
+		{"non-latin", "Γιώργος Παπαδόπουλος", 30, []string{"Γιώργος", "Παπαδόπουλος"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, generator.wrap(tt.text, tt.width))
+		})
+	}
+}
+
+func TestAddRow_KeepsLabelWithValue(t *testing.T) {
+	generator := NewPDFGenerator(layout.Default(), Options{})
+	generator.pdf.AddPage()
+	_, top, _, _ := generator.pdf.GetMargins()
+
+	// Three lines do not fit above the footer, so the row starts the next
+	// page whole
+	generator.pdf.SetY(265)
+	generator.addRow(generator.infoRow("Address:", strings.Repeat("Long Meadow Avenue ", 9)), 6, "0")
+	assert.Equal(t, 2, generator.pdf.PageNo())
+	assert.InDelta(t, top+18, generator.pdf.GetY(), 0.01)
+
+	// A single line still fits
+	generator.pdf.SetY(265)
+	generator.addRow(generator.infoRow("Name:", "John Doe"), 6, "0")
+	assert.Equal(t, 2, generator.pdf.PageNo())
+	require.NoError(t, generator.pdf.Error())
+}
+
+func TestAddSectionHeader_NotOrphaned(t *testing.T) {
+	generator := NewPDFGenerator(layout.Default(), Options{})
+	generator.pdf.AddPage()
+
+	// The header fits, but its first row would not
+	generator.pdf.SetY(262)
+	generator.addSectionHeader("PERSONAL INFORMATION", 6)
+	assert.Equal(t, 2, generator.pdf.PageNo())
+
+	generator.pdf.SetY(200)
+	generator.addSectionHeader("ACADEMIC INFORMATION", 6)
+	assert.Equal(t, 2, generator.pdf.PageNo())
+	require.NoError(t, generator.pdf.Error())
+}
@@ -0,0 +1,190 @@
+package pdf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+
+	"pdf-generator/internal/verification"
+)
+
+const (
+	// verifyPath is the route prefix of the verification endpoint
+	verifyPath = "/verify"
+	// qrSize is the side of the printed QR code in millimetres, including
+	// the quiet zone of qrQuietZone blank modules that readers need around it
+	qrSize      = 26
+	qrQuietZone = 4
+)
+
+// Verification identifies an issued report in the verification registry
+type Verification struct {
+	// ID is the report's verification ID, printed as a short code
+	ID string
+	// URL is where the report can be checked; the QR code links to it
+	URL string
+}
+
+// drawVerificationBlock prints a QR code linking to the report's
+// verification page at the start of the line below the cursor, with the
+// link and the short verification code beside it
+func (pg *PDFGenerator) drawVerificationBlock() {
+	code, err := qr.Encode(pg.verification.URL, qr.M, qr.Auto)
+	if err != nil {
+		pg.pdf.SetError(fmt.Errorf("failed to encode verification QR code: %w", err))
+		return
+	}
+	lines := []string{
+		pg.tr.Text("Scan the QR code or visit the link below to check that this report is genuine"),
+		pg.verification.URL,
+		fmt.Sprintf(pg.tr.Text("Verification code: %s"), verification.FormatID(pg.verification.ID)),
+	}
+
+	pg.keepTogether(qrSize)
+	left, _, right, _ := pg.pdf.GetMargins()
+	pageWidth, _ := pg.pdf.GetPageSize()
+	x, textX := left, left+qrSize
+	if pg.rtl {
+		x, textX = pageWidth-right-qrSize, left
+	}
+	y := pg.pdf.GetY()
+	pg.drawQRCode(code, x, y)
+
+	pg.setFont(pg.marginFont())
+	textY := y + (qrSize-marginLineHeight*float64(len(lines)))/2
+	for i, line := range lines {
+		pg.pdf.SetXY(textX, textY+marginLineHeight*float64(i))
+		pg.cell(pg.contentWidth()-qrSize, marginLineHeight, line, "0", 0, "L", false)
+	}
+	pg.pdf.SetXY(left, y+qrSize)
+}
+
+// drawQRCode draws code in a square of qrSize whose top left corner is at
+// x, y. Dark modules side by side in a row are drawn as one rectangle, so
+// that readers do not show hairlines between them.
+func (pg *PDFGenerator) drawQRCode(code barcode.Barcode, x, y float64) {
+	n := code.Bounds().Dx()
+	module := qrSize / float64(n+2*qrQuietZone)
+	x += module * qrQuietZone
+	y += module * qrQuietZone
+	dark := func(col, row int) bool {
+		return code.At(col, row) == color.Black
+	}
+
+	pg.pdf.SetFillColor(0, 0, 0)
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; {
+			if !dark(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < n && dark(col, row) {
+				col++
+			}
+			pg.pdf.Rect(x+module*float64(start), y+module*float64(row), module*float64(col-start), module, "F")
+		}
+	}
+}
+
+// SetVerificationStore replaces the registry of issued reports, which
+// defaults to an in-memory store
+func (s *Server) SetVerificationStore(store verification.Store) {
+	s.verification = store
+}
+
+// newVerification assigns a verification ID to a report with the given
+// options, or returns nil for reports that are not issued. The link is built
+// from PUBLIC_BASE_URL only, never from the request, which the caller
+// controls.
+func (s *Server) newVerification(opts reportOptions) (*Verification, error) {
+	if !opts.issued {
+		return nil, nil
+	}
+	if s.publicBaseURL == "" {
+		return nil, errors.New("PUBLIC_BASE_URL is not set; issued reports cannot link to their verification page")
+	}
+	id, err := verification.NewID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate verification ID: %w", err)
+	}
+	return &Verification{ID: id, URL: s.publicBaseURL + verifyPath + "/" + id}, nil
+}
+
+// recordIssued adds an issued report about the given students to the
+// verification registry; it does nothing for reports that are not issued
+func (s *Server) recordIssued(ctx context.Context, v *Verification, pdfBytes []byte, studentIDs ...int) error {
+	if v == nil {
+		return nil
+	}
+	if err := s.verification.Save(ctx, verification.NewRecord(v.ID, pdfBytes, studentIDs...)); err != nil {
+		return fmt.Errorf("failed to record report for verification: %w", err)
+	}
+	return nil
+}
+
+// verifyResponse tells whether a report is genuine and, if it is, describes
+// the report the service issued
+type verifyResponse struct {
+	// Code is the verification code as printed on reports
+	Code       string     `json:"code"`
+	Genuine    bool       `json:"genuine"`
+	IssuedAt   *time.Time `json:"issuedAt,omitempty"`
+	StudentIDs []int      `json:"studentIds,omitempty"`
+	SHA256     string     `json:"sha256,omitempty"`
+}
+
+// VerifyReport handles GET /verify/{id}, telling whether the service issued
+// a report with the given verification code. The optional sha256 query
+// parameter is the hash of a PDF copy, which is only genuine if it matches
+// the issued report's hash.
+func (s *Server) VerifyReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Use GET to verify a report")
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, verifyPath+"/")
+	id, err := verification.ParseID(code)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid verification code %q; expected a code such as 7K3QD-M2X9P", code))
+		return
+	}
+
+	ctx := r.Context()
+	response := verifyResponse{Code: verification.FormatID(id)}
+	status := http.StatusOK
+	record, err := s.verification.Get(ctx, id)
+	switch {
+	case errors.Is(err, verification.ErrNotFound):
+		status = http.StatusNotFound
+	case err != nil:
+		slog.ErrorContext(ctx, "Failed to load verification record", "verification_id", id, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "Failed to verify report")
+		return
+	default:
+		response.Genuine = true
+		response.IssuedAt = &record.IssuedAt
+		response.StudentIDs = record.StudentIDs
+		response.SHA256 = record.SHA256
+		if hash := r.URL.Query().Get("sha256"); hash != "" && !strings.EqualFold(hash, record.SHA256) {
+			response.Genuine = false
+		}
+	}
+
+	slog.InfoContext(ctx, "Verified report", "verification_id", id, "genuine", response.Genuine)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,299 @@
+package pdf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/boombuler/barcode/qr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/verification"
+)
+
+// recordingStore is a verification store that also keeps the records saved
+// in it in order
+type recordingStore struct {
+	*verification.MemoryStore
+	mu    sync.Mutex
+	saved []*verification.Record
+}
+
+// newRecordingStore makes server record the reports it issues in a new
+// recording store
+func newRecordingStore(server *Server) *recordingStore {
+	store := &recordingStore{MemoryStore: verification.NewMemoryStore()}
+	server.SetVerificationStore(store)
+	return store
+}
+
+func (s *recordingStore) Save(ctx context.Context, record *verification.Record) error {
+	s.mu.Lock()
+	s.saved = append(s.saved, record)
+	s.mu.Unlock()
+	return s.MemoryStore.Save(ctx, record)
+}
+
+func (s *recordingStore) records() []*verification.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*verification.Record(nil), s.saved...)
+}
+
+// qrRectangles is the number of rectangles drawQRCode draws for a QR code
+// encoding content: one per run of dark modules in a row
+func qrRectangles(t *testing.T, content string) int {
+	t.Helper()
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	require.NoError(t, err)
+	n := code.Bounds().Dx()
+	var runs int
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			if code.At(col, row) == color.Black && (col == 0 || code.At(col-1, row) != color.Black) {
+				runs++
+			}
+		}
+	}
+	return runs
+}
+
+var testVerification = &Verification{ID: "7K3QDM2X9P", URL: "https://reports.example.edu/verify/7K3QDM2X9P"}
+
+func TestGenerateStudentReport_Verification(t *testing.T) {
+	plain := renderUncompressed(t, Options{}, api.GetMockStudent())
+	output := renderUncompressed(t, Options{Verification: testVerification}, api.GetMockStudent())
+
+	assert.NotContains(t, plain, "Verification code")
+	assert.Contains(t, output, "(Verification code: 7K3QD-M2X9P)Tj")
+	assert.Contains(t, output, "(https://reports.example.edu/verify/7K3QDM2X9P)Tj")
+	assert.Equal(t, qrRectangles(t, testVerification.URL), strings.Count(output, " re f\n")-strings.Count(plain, " re f\n"))
+
+	// The block follows the report's last block, with the QR code at the
+	// start of the line and the text beside it
+	assert.Less(t, strings.Index(output, "(This report was generated automatically"), strings.Index(output, "Verification code"))
+	codeX, _ := textPosition(t, output, "(Verification code: 7K3QD-M2X9P)Tj")
+	assert.InDelta(t, (10+qrSize)*72/25.4, codeX, 4)
+}
+
+func TestGenerateStudentReport_VerificationRightToLeft(t *testing.T) {
+	locale, err := i18n.Parse("he")
+	require.NoError(t, err)
+
+	output := renderUncompressed(t, Options{Verification: testVerification, Locale: locale}, api.GetMockStudent())
+
+	// The QR code sits at the right margin and the text to its left
+	codeX, _ := textPosition(t, output, "("+testVerification.URL+")Tj")
+	assert.Less(t, codeX, (210-10-qrSize)*72/25.4)
+	assert.Regexp(t, `\n5\d\d\.\d\d \d+\.\d\d [\d.]+ -[\d.]+ re f\n`, output)
+}
+
+func TestGenerateMergedReport_Verification(t *testing.T) {
+	generator := NewPDFGenerator(layout.Default(), Options{Verification: testVerification})
+	generator.pdf.SetCompression(false)
+	students := []*api.Student{api.GetMockStudent(), mockStudentWithID(2, "Mary Major")}
+
+	pdfBytes, err := generator.GenerateMergedReport(context.Background(), students, func([]PageRange, *i18n.Translator) []string {
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Each student's report carries the document's code
+	assert.Equal(t, 2, strings.Count(string(pdfBytes), "(Verification code: 7K3QD-M2X9P)Tj"))
+}
+
+// getVerification requests the verification endpoint
+func getVerification(t *testing.T, server *Server, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(method, path, nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.VerifyReport).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGenerateStudentReport_Recorded(t *testing.T) {
+	server := newTestServer()
+	store := newRecordingStore(server)
+
+	req, err := http.NewRequest("GET", "/api/v1/students/1/report", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateStudentReport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	records := store.records()
+	require.Len(t, records, 1)
+	record := records[0]
+	assert.True(t, record.Matches(rr.Body.Bytes()))
+	assert.Equal(t, []int{1}, record.StudentIDs)
+
+	rr = getVerification(t, server, "GET", "/verify/"+verification.FormatID(record.ID))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, true, response["genuine"])
+	assert.Equal(t, verification.FormatID(record.ID), response["code"])
+	assert.Equal(t, []interface{}{float64(1)}, response["studentIds"])
+	assert.Equal(t, record.SHA256, response["sha256"])
+	assert.NotEmpty(t, response["issuedAt"])
+}
+
+func TestGenerateTestReport_Verification(t *testing.T) {
+	server := newTestServer()
+	store := newRecordingStore(server)
+
+	// Reports of mock data and of student JSON the caller sends are not
+	// issued, so they carry no code and the registry does not vouch for them
+	rr := getProtectedReport(t, server, "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	body, err := json.Marshal(api.GetMockStudent())
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", "/api/v1/reports/student", strings.NewReader(string(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.RenderStudentReport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Empty(t, store.records())
+}
+
+func TestVerifyReport(t *testing.T) {
+	server := newTestServer()
+	pdf := []byte("%PDF-1.3 report")
+	require.NoError(t, server.verification.Save(context.Background(), verification.NewRecord("7K3QDM2X9P", pdf, 1)))
+	sum := sha256.Sum256(pdf)
+	forged := sha256.Sum256([]byte("%PDF-1.3 forged"))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		wantStatus  int
+		wantGenuine bool
+		wantCode    string
+	}{
+		{"printed code", "GET", "/verify/7K3QD-M2X9P", http.StatusOK, true, "7K3QD-M2X9P"},
+		{"typed code", "GET", "/verify/7k3qdm2x9p", http.StatusOK, true, "7K3QD-M2X9P"},
+		{"matching hash", "GET", "/verify/7K3QDM2X9P?sha256=" + strings.ToUpper(hex.EncodeToString(sum[:])), http.StatusOK, true, "7K3QD-M2X9P"},
+		{"altered copy", "GET", "/verify/7K3QDM2X9P?sha256=" + hex.EncodeToString(forged[:]), http.StatusOK, false, "7K3QD-M2X9P"},
+		{"unknown code", "GET", "/verify/7K3QD-M2X9Q", http.StatusNotFound, false, "7K3QD-M2X9Q"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := getVerification(t, server, tt.method, tt.path)
+
+			require.Equal(t, tt.wantStatus, rr.Code)
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantGenuine, response["genuine"])
+			assert.Equal(t, tt.wantCode, response["code"])
+		})
+	}
+
+	rr := getVerification(t, server, "GET", "/verify/not-a-code")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+	rr = getVerification(t, server, "POST", "/verify/7K3QD-M2X9P")
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestGenerateBatchReport_Verification(t *testing.T) {
+	server := newBatchTestServer()
+	store := newRecordingStore(server)
+
+	// Each report in a ZIP is recorded on its own
+	rr := postBatch(t, server, `{"studentIds":[1,2],"format":"zip"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	files := readZip(t, rr.Body.Bytes())
+	records := store.records()
+	require.Len(t, records, 2)
+	for _, record := range records {
+		require.Len(t, record.StudentIDs, 1)
+		name := "student_" + map[int]string{1: "1", 2: "2"}[record.StudentIDs[0]] + "_report.pdf"
+		assert.True(t, record.Matches(files[name]), "%s does not match its record", name)
+	}
+
+	// A merged report is recorded once, for all of its students
+	rr = postBatch(t, server, `{"studentIds":[1,2],"format":"pdf"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	records = store.records()
+	require.Len(t, records, 3)
+	assert.Equal(t, []int{1, 2}, records[2].StudentIDs)
+	assert.True(t, records[2].Matches(rr.Body.Bytes()))
+}
+
+func TestReportJob_Verification(t *testing.T) {
+	server := newBatchTestServer()
+	store := newRecordingStore(server)
+	startTestJobs(t, server)
+
+	rr := postJob(t, server, `{"studentIds":[1]}`)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	location := rr.Header().Get("Location")
+	assert.Equal(t, "succeeded", waitForJobStatus(t, server, location)["status"])
+
+	rr = getJob(t, server, location+"/result")
+	require.Equal(t, http.StatusOK, rr.Code)
+	records := store.records()
+	require.Len(t, records, 1)
+	assert.True(t, records[0].Matches(rr.Body.Bytes()))
+}
+
+func TestNewVerification(t *testing.T) {
+	server := newTestServer()
+
+	v, err := server.newVerification(reportOptions{issued: true})
+	require.NoError(t, err)
+	assert.Equal(t, testPublicBaseURL+"/verify/"+v.ID, v.URL)
+
+	// Template previews are not issued, so they carry no code
+	v, err = server.newVerification(reportOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestGenerateStudentReport_NoPublicBaseURL(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "")
+	server := newTestServer()
+	store := &recordingStore{}
+	server.SetVerificationStore(store)
+
+	// The link is never built from the Host the caller sends
+	req, err := http.NewRequest("GET", "/api/v1/students/1/report", nil)
+	require.NoError(t, err)
+	req.Host = "reports.example.edu"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GenerateStudentReport).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Empty(t, store.records())
+}
+
+func TestPreviewTemplate_NotRecorded(t *testing.T) {
+	server := newTestServer()
+	store := newRecordingStore(server)
+
+	_, err := server.renderReport(context.Background(), reportOptions{template: layout.Default(), locale: i18n.English}, api.GetMockStudent())
+	require.NoError(t, err)
+	assert.Empty(t, store.records())
+}
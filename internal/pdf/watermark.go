@@ -0,0 +1,111 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/protection"
+	"pdf-generator/internal/watermark"
+)
+
+const (
+	// diagonalSpan is the share of the page's diagonal a diagonal watermark
+	// spans, and maxDiagonalFontSize caps its size in points so that short
+	// text is not drawn taller than it is useful
+	diagonalSpan        = 0.7
+	maxDiagonalFontSize = 110
+	// tiledFontSize is the size of the text of tiled watermarks in points,
+	// and tileGap the space around each copy in millimetres
+	tiledFontSize = 28
+	tileGap       = 20
+)
+
+// drawWatermark prints the report's watermark over the page. It is drawn as
+// the page is finished, over the content, so that filled section headers
+// cannot hide it.
+func (pg *PDFGenerator) drawWatermark() {
+	mark := pg.watermark
+	text := pg.tr.Text(mark.Text)
+	width, height := pg.pdf.GetPageSize()
+	centerX, centerY := width/2, height/2
+
+	pg.pdf.SetAlpha(mark.Opacity, "Normal")
+	pg.pdf.SetTextColor(mark.Color[0], mark.Color[1], mark.Color[2])
+	pg.pdf.TransformBegin()
+	pg.pdf.TransformRotate(mark.Angle, centerX, centerY)
+
+	font := layout.Font{Family: pg.template.Styles.Value.Font.Family, Style: "B", Size: tiledFontSize}
+	switch mark.Style {
+	case watermark.Diagonal:
+		pg.setFont(font)
+		span := diagonalSpan * math.Hypot(width, height)
+		font.Size = min(maxDiagonalFontSize, tiledFontSize*span/pg.textWidth(text))
+		pg.setFont(font)
+		pg.watermarkText(text, centerX, centerY)
+	case watermark.Tiled:
+		pg.setFont(font)
+		// The copies cover a square as wide as the page's diagonal, so that
+		// the page is covered at any angle. Every other row is offset by half
+		// a copy, as bricks are laid.
+		stepX := pg.textWidth(text) + tileGap
+		stepY := pg.fontHeight() + tileGap
+		reach := math.Hypot(width, height) / 2
+		for row, y := 0, centerY-reach; y <= centerY+reach; row, y = row+1, y+stepY {
+			offset := float64(row%2) * stepX / 2
+			for x := centerX - reach - offset; x <= centerX+reach; x += stepX {
+				pg.watermarkText(text, x, y)
+			}
+		}
+	}
+
+	pg.pdf.TransformEnd()
+	pg.pdf.SetAlpha(1, "Normal")
+	pg.pdf.SetTextColor(0, 0, 0)
+}
+
+// watermarkText prints text in the current template font centred on x, y
+func (pg *PDFGenerator) watermarkText(text string, x, y float64) {
+	w, h := pg.textWidth(text)+2*pg.pdf.GetCellMargin(), pg.fontHeight()
+	pg.pdf.SetXY(x-w/2, y-h/2)
+	pg.cell(w, h, text, "0", 0, "C", false)
+}
+
+// fontHeight is the size of the current template font in millimetres
+func (pg *PDFGenerator) fontHeight() float64 {
+	return pg.font.Size / pg.pdf.GetConversionRatio()
+}
+
+// SetWatermarks replaces the watermark policy, which defaults to a diagonal
+// grey DRAFT on mock-data and caller-supplied reports
+func (s *Server) SetWatermarks(policy *watermark.Policy) {
+	s.watermarks = policy
+}
+
+// watermarkFor reads the watermark a request asks for from its watermark,
+// watermarkStyle, watermarkOpacity, watermarkAngle and watermarkColor query
+// parameters. Reports of mock data and of data the caller supplies carry the
+// policy's watermark, which requests can neither change nor remove. It
+// writes an error response and returns false if the choice is invalid.
+func (s *Server) watermarkFor(w http.ResponseWriter, r *http.Request, reportType string) (*watermark.Watermark, bool) {
+	query := r.URL.Query()
+	automatic := reportType == protection.ReportTest || reportType == protection.ReportRender
+	mark, err := s.watermarks.Resolve(watermark.Request{
+		Text:    query.Get("watermark"),
+		Style:   query.Get("watermarkStyle"),
+		Opacity: query.Get("watermarkOpacity"),
+		Angle:   query.Get("watermarkAngle"),
+		Color:   query.Get("watermarkColor"),
+	}, automatic)
+	if errors.Is(err, watermark.ErrRequired) {
+		writeProblem(w, r, http.StatusForbidden, fmt.Sprintf("Reports of type %s carry the server's watermark, which requests cannot change or remove; leave out the watermark parameters", reportType))
+		return nil, false
+	}
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid watermark: "+err.Error())
+		return nil, false
+	}
+	return mark, true
+}
@@ -0,0 +1,170 @@
+package pdf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/watermark"
+)
+
+// pageCount is the number of pages of a PDF
+func pageCount(output string) int {
+	return len(regexp.MustCompile(`/Type /Page\b[^s]`).FindAllString(output, -1))
+}
+
+func TestGenerateStudentReport_Watermark(t *testing.T) {
+	plain := renderUncompressed(t, Options{}, api.GetMockStudent())
+	mark := watermark.Default()
+	output := renderUncompressed(t, Options{Watermark: &mark}, api.GetMockStudent())
+
+	assert.NotContains(t, plain, "/ExtGState")
+	assert.NotContains(t, plain, "(DRAFT)Tj")
+
+	// The text is drawn once on every page, rotated about the page's centre
+	// and at the watermark's opacity
+	pages := pageCount(output)
+	require.Positive(t, pages)
+	assert.Equal(t, pages, strings.Count(output, "(DRAFT)Tj"))
+	assert.Equal(t, pages, strings.Count(output, "/GS1 gs"))
+	assert.Contains(t, output, "/ca 0.150")
+	assert.Contains(t, output, "0.70711 0.70711 -0.70711 0.70711 ")
+	assert.Contains(t, output, " 110.00 Tf")
+	assert.Contains(t, output, "q 0.502 g BT ")
+}
+
+func TestGenerateStudentReport_WatermarkOptions(t *testing.T) {
+	mark := watermark.Watermark{Text: "COPY", Style: watermark.Tiled, Opacity: 0.3, Angle: -30, Color: [3]int{0xC0, 0, 0}}
+	output := renderUncompressed(t, Options{Watermark: &mark}, api.GetMockStudent())
+
+	// Tiled watermarks repeat the text over the page
+	assert.Greater(t, strings.Count(output, "(COPY)Tj"), 20*pageCount(output))
+	assert.Contains(t, output, "/ca 0.300")
+	assert.Contains(t, output, "0.86603 -0.50000 0.50000 0.86603 ")
+	assert.Contains(t, output, "q 0.753 0.000 0.000 rg BT ")
+}
+
+func TestGenerateStudentReport_WatermarkTranslated(t *testing.T) {
+	locale, err := i18n.Parse("fr")
+	require.NoError(t, err)
+	mark := watermark.Default()
+
+	output := renderUncompressed(t, Options{Watermark: &mark, Locale: locale}, api.GetMockStudent())
+
+	assert.Contains(t, output, "(BROUILLON)Tj")
+	assert.NotContains(t, output, "(DRAFT)Tj")
+}
+
+func TestGenerateTestReport_Watermark(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantAlpha  string
+	}{
+		{"automatic", "", http.StatusOK, "/ca 0.150"},
+		{"other text", "?watermark=SAMPLE", http.StatusForbidden, ""},
+		{"nearly invisible", "?watermark=.&watermarkOpacity=0.001", http.StatusForbidden, ""},
+		{"options", "?watermarkStyle=tiled", http.StatusForbidden, ""},
+		{"none", "?watermark=none", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := getProtectedReport(t, newTestServer(), tt.query, "")
+
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+				return
+			}
+			assert.Contains(t, rr.Body.String(), tt.wantAlpha)
+		})
+	}
+}
+
+func TestRenderStudentReport_Watermark(t *testing.T) {
+	body, err := json.Marshal(api.GetMockStudent())
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/api/v1/reports/student?watermark=none", strings.NewReader(string(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(newTestServer().RenderStudentReport).ServeHTTP(rr, req)
+
+	// Reports of data the caller supplies cannot pass for official ones
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestGenerateStudentReport_WatermarkRequested(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantMarked bool
+	}{
+		{"not asked for", "", http.StatusOK, false},
+		{"none", "?watermark=none", http.StatusOK, false},
+		{"asked for", "?watermark=COPY&watermarkColor=1F4E79&watermarkAngle=30", http.StatusOK, true},
+		{"options without text", "?watermarkStyle=tiled", http.StatusBadRequest, false},
+		{"invalid colour", "?watermark=COPY&watermarkColor=blue", http.StatusBadRequest, false},
+		{"unknown style", "?watermark=COPY&watermarkStyle=wavy", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/students/1/report"+tt.query, nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(newTestServer().GenerateStudentReport).ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantMarked, strings.Contains(rr.Body.String(), "/ExtGState"))
+			}
+		})
+	}
+}
+
+func TestReportJob_Watermark(t *testing.T) {
+	server := newJobTestServer(t)
+
+	req, err := http.NewRequest("POST", "/api/v1/jobs?watermark=COPY&watermarkOpacity=0.25", strings.NewReader(`{"studentIds":[1]}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.CreateReportJob).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+
+	// The job keeps the watermark it was created with until it runs
+	location := rr.Header().Get("Location")
+	assert.Equal(t, "succeeded", waitForJobStatus(t, server, location)["status"])
+	rr = getJob(t, server, location+"/result")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "/ca 0.250")
+}
+
+func TestSetWatermarks(t *testing.T) {
+	t.Setenv("WATERMARK_TEXT", "SAMPLE")
+	t.Setenv("WATERMARK_OPACITY", "0.5")
+	policy, err := watermark.NewPolicyFromEnv()
+	require.NoError(t, err)
+	server := newTestServer()
+	server.SetWatermarks(policy)
+
+	rr := getProtectedReport(t, server, "", "")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "/ca 0.500")
+}
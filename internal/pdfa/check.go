@@ -0,0 +1,659 @@
+package pdfa
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// XMP namespaces of the properties Check compares with the document
+// information dictionary
+const (
+	nsRDF    = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC     = "http://purl.org/dc/elements/1.1/"
+	nsXMP    = "http://ns.adobe.com/xap/1.0/"
+	nsPDF    = "http://ns.adobe.com/pdf/1.3/"
+	nsPDFAID = "http://www.aiim.org/pdfa/ns/id/"
+)
+
+// infoProperties maps the text entries of the document information
+// dictionary to the XMP properties that must agree with them
+var infoProperties = map[string]string{
+	"Title":    nsDC + "title",
+	"Author":   nsDC + "creator",
+	"Subject":  nsDC + "description",
+	"Keywords": nsPDF + "Keywords",
+	"Creator":  nsXMP + "CreatorTool",
+	"Producer": nsPDF + "Producer",
+}
+
+// infoDates maps the date entries of the document information dictionary to
+// their XMP properties
+var infoDates = map[string]string{
+	"CreationDate": nsXMP + "CreateDate",
+	"ModDate":      nsXMP + "ModifyDate",
+}
+
+var headerPattern = regexp.MustCompile(`^%PDF-1\.[0-7]\r?\n%([^\r\n]*)\r?\n`)
+
+// Check reports which of the key rules of PDF/A-2b a document breaks: a
+// binary header comment, a document ID and no encryption in the trailer,
+// XMP metadata that identifies the document as PDF/A-2b and agrees with the
+// document information dictionary, an output intent with a valid ICC
+// profile, embedded fonts, stream lengths that match their data, and no
+// JavaScript, launch actions, LZW compression, transfer functions or hidden
+// annotations. It returns nil if the document keeps them all. Check is not
+// a full validator: it reads documents with cross-reference tables, as
+// gofpdf writes them, and does not look into content streams.
+func Check(data []byte) error {
+	doc, err := read(data)
+	if err != nil {
+		return fmt.Errorf("cannot read document: %w", err)
+	}
+	c := &checker{doc: doc}
+	c.header()
+	c.trailer()
+	c.catalog()
+	c.objects()
+	return errors.Join(c.problems...)
+}
+
+// checker collects the rules a document breaks
+type checker struct {
+	doc      *document
+	problems []error
+}
+
+func (c *checker) fail(format string, args ...any) {
+	c.problems = append(c.problems, fmt.Errorf(format, args...))
+}
+
+// header checks that the header is followed by a comment of binary bytes,
+// which marks the file as binary to transfer programs
+func (c *checker) header() {
+	match := headerPattern.FindSubmatch(c.doc.data)
+	if match == nil {
+		c.fail("header must be %%PDF-1.n followed by a comment line")
+		return
+	}
+	var binary int
+	for _, b := range match[1] {
+		if b > 127 {
+			binary++
+		}
+	}
+	if binary < 4 {
+		c.fail("header comment must hold at least four bytes above 127")
+	}
+}
+
+var idPattern = regexp.MustCompile(`/ID\s*\[\s*(<[0-9A-Fa-f]+>|\([^)]+\))\s*(<[0-9A-Fa-f]+>|\([^)]+\))\s*\]`)
+
+// trailer checks the last trailer of the document
+func (c *checker) trailer() {
+	if has(c.doc.trailer, "Encrypt") {
+		c.fail("document must not be encrypted")
+	}
+	if !idPattern.MatchString(c.doc.trailer) {
+		c.fail("trailer must have a document ID")
+	}
+}
+
+// catalog checks the metadata and output intents of the document catalog
+func (c *checker) catalog() {
+	root, err := c.doc.object(ref(c.doc.trailer, "Root"))
+	if err != nil {
+		c.fail("no document catalog: %w", err)
+		return
+	}
+	c.metadata(root.dict)
+	c.outputIntents(root.dict)
+}
+
+// metadata checks the document's XMP metadata
+func (c *checker) metadata(catalog string) {
+	n := ref(catalog, "Metadata")
+	if n == 0 {
+		c.fail("catalog has no XMP metadata")
+		return
+	}
+	metadata, err := c.doc.object(n)
+	if err != nil {
+		c.fail("no XMP metadata: %w", err)
+		return
+	}
+	if name(metadata.dict, "Type") != "Metadata" || name(metadata.dict, "Subtype") != "XML" {
+		c.fail("metadata stream must have /Type /Metadata and /Subtype /XML")
+	}
+	if has(metadata.dict, "Filter") {
+		c.fail("metadata stream must not be compressed")
+	}
+	if !bytes.HasPrefix(metadata.stream, []byte("<?xpacket begin=")) {
+		c.fail("XMP metadata must be an XMP packet")
+	}
+	properties, err := xmpProperties(metadata.stream)
+	if err != nil {
+		c.fail("invalid XMP metadata: %w", err)
+		return
+	}
+	if part, conformance := properties[nsPDFAID+"part"], properties[nsPDFAID+"conformance"]; part != "2" || conformance != "B" {
+		c.fail("XMP metadata must identify the document as PDF/A-2b, not part %q conformance %q", part, conformance)
+	}
+
+	info, err := c.doc.object(ref(c.doc.trailer, "Info"))
+	if err != nil {
+		return
+	}
+	for _, key := range slices.Sorted(maps.Keys(infoProperties)) {
+		if value, ok := stringValue(info.dict, key); ok && properties[infoProperties[key]] != value {
+			c.fail("document information %s %q does not match its XMP metadata %q", key, value, properties[infoProperties[key]])
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(infoDates)) {
+		value, ok := stringValue(info.dict, key)
+		if !ok {
+			continue
+		}
+		date, err := parsePDFDate(value)
+		if err != nil {
+			c.fail("invalid document information %s %q", key, value)
+			continue
+		}
+		xmpDate, err := parseXMPDate(properties[infoDates[key]])
+		if err != nil || !date.Equal(xmpDate) {
+			c.fail("document information %s %q does not match its XMP metadata %q", key, value, properties[infoDates[key]])
+		}
+	}
+}
+
+var outputIntentsPattern = regexp.MustCompile(`/OutputIntents\s*\[([^\]]*)\]`)
+
+// outputIntents checks that the catalog has a PDF/A output intent whose
+// profile is a valid ICC profile
+func (c *checker) outputIntents(catalog string) {
+	intents := outputIntentsPattern.FindStringSubmatch(catalog)
+	if intents == nil {
+		c.fail("catalog has no output intents")
+		return
+	}
+	for _, match := range refPattern.FindAllStringSubmatch(intents[1], -1) {
+		n, _ := strconv.Atoi(match[1])
+		intent, err := c.doc.object(n)
+		if err != nil || name(intent.dict, "S") != "GTS_PDFA1" {
+			continue
+		}
+		profile, err := c.doc.object(ref(intent.dict, "DestOutputProfile"))
+		if err != nil {
+			c.fail("PDF/A output intent has no destination profile")
+			return
+		}
+		data, err := profile.decoded()
+		if err != nil {
+			c.fail("unreadable output intent profile: %w", err)
+			return
+		}
+		components, _ := strconv.Atoi(value(profile.dict, "N"))
+		if err := checkProfile(data, components); err != nil {
+			c.fail("invalid output intent profile: %w", err)
+		}
+		return
+	}
+	c.fail("catalog has no PDF/A output intent")
+}
+
+// checkProfile checks an ICC profile's header against the number of colour
+// components the PDF gives it
+func checkProfile(profile []byte, components int) error {
+	if len(profile) < 132 || int(binary.BigEndian.Uint32(profile)) != len(profile) || string(profile[36:40]) != "acsp" {
+		return errors.New("not a complete ICC profile")
+	}
+	if version := profile[8]; version < 2 || version > 4 {
+		return fmt.Errorf("ICC version %d is not allowed", version)
+	}
+	if class := string(profile[12:16]); class != "mntr" && class != "prtr" {
+		return fmt.Errorf("device class %q is not an output class", class)
+	}
+	space := string(profile[16:20])
+	want := map[string]int{"GRAY": 1, "RGB ": 3, "CMYK": 4}[space]
+	if want == 0 || want != components {
+		return fmt.Errorf("colour space %q does not have the %d components given as /N", space, components)
+	}
+	return nil
+}
+
+// objects checks every object of the document
+func (c *checker) objects() {
+	for _, n := range slices.Sorted(maps.Keys(c.doc.offsets)) {
+		if c.doc.offsets[n] <= 0 {
+			continue
+		}
+		obj, err := c.doc.object(n)
+		if err != nil {
+			c.fail("%w", err)
+			continue
+		}
+		dict := obj.dict
+		switch name(dict, "Type") {
+		case "Font":
+			c.font(n, dict)
+		case "Annot":
+			c.annotation(n, dict)
+		case "ExtGState":
+			if has(dict, "TR") {
+				c.fail("graphics state (object %d) must not have a transfer function", n)
+			}
+		}
+		if strings.Contains(dict, "/LZWDecode") {
+			c.fail("object %d must not be LZW compressed", n)
+		}
+		if has(dict, "JS") || has(dict, "JavaScript") || name(dict, "S") == "JavaScript" {
+			c.fail("object %d must not hold JavaScript", n)
+		}
+		if name(dict, "S") == "Launch" {
+			c.fail("object %d must not be a launch action", n)
+		}
+	}
+}
+
+// font checks that a font's program is embedded. Type 0 fonts are checked
+// through their descendant fonts, which are fonts too, and Type 3 fonts are
+// drawn with content streams.
+func (c *checker) font(n int, dict string) {
+	subtype := name(dict, "Subtype")
+	if subtype == "Type0" || subtype == "Type3" {
+		return
+	}
+	descriptor, err := c.doc.object(ref(dict, "FontDescriptor"))
+	if err != nil || !(has(descriptor.dict, "FontFile") || has(descriptor.dict, "FontFile2") || has(descriptor.dict, "FontFile3")) {
+		c.fail("font %s (object %d) must be embedded", name(dict, "BaseFont"), n)
+	}
+}
+
+// annotation checks that an annotation is printed and not hidden
+func (c *checker) annotation(n int, dict string) {
+	if name(dict, "Subtype") == "Popup" {
+		return
+	}
+	flags, _ := strconv.Atoi(value(dict, "F"))
+	const invisible, hidden, print, noView = 1, 2, 4, 32
+	if flags&print == 0 || flags&(invisible|hidden|noView) != 0 {
+		c.fail("annotation (object %d) must be printed and visible", n)
+	}
+}
+
+// xmpProperties reads the properties of an XMP packet, keyed by namespace
+// and name. The value of an array, such as dc:title, is its first item.
+func xmpProperties(packet []byte) (map[string]string, error) {
+	properties := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	var stack []xml.Name
+	var property string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return properties, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) > 0 && stack[len(stack)-1] == (xml.Name{Space: nsRDF, Local: "Description"}) {
+				property = t.Name.Space + t.Name.Local
+			}
+			if t.Name == (xml.Name{Space: nsRDF, Local: "Description"}) {
+				for _, attr := range t.Attr {
+					if attr.Name.Space != "" && attr.Name.Space != nsRDF && attr.Name.Space != "xmlns" {
+						properties[attr.Name.Space+attr.Name.Local] = attr.Value
+					}
+				}
+			}
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 && stack[len(stack)-1] == (xml.Name{Space: nsRDF, Local: "Description"}) {
+				property = ""
+			}
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if property != "" && text != "" {
+				if _, ok := properties[property]; !ok {
+					properties[property] = text
+				}
+			}
+		}
+	}
+}
+
+// parsePDFDate reads a PDF date such as D:20261017093000+02'00'. Dates
+// without a time zone are read as UTC.
+func parsePDFDate(s string) (time.Time, error) {
+	s = strings.TrimPrefix(s, "D:")
+	digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	if digits < 4 || digits > 14 || digits%2 != 0 {
+		return time.Time{}, errors.New("invalid date")
+	}
+	// Missing fields default to the first month, day and so on
+	date := s[:digits] + "0101000000"[digits-4:]
+	zone := strings.ReplaceAll(strings.TrimSuffix(s[digits:], "'"), "'", ":")
+	switch {
+	case zone == "" || strings.HasPrefix(zone, "Z"):
+		zone = "Z"
+	case len(zone) == 3:
+		zone += ":00"
+	}
+	return time.Parse("20060102150405Z07:00", date+zone)
+}
+
+// parseXMPDate reads an XMP date, which may leave out the seconds or the
+// time
+func parseXMPDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// document is a PDF read far enough to check it: the offset of the latest
+// version of each object and the last trailer
+type document struct {
+	data []byte
+	// offsets holds the offset of each object; it is zero for objects that
+	// were deleted
+	offsets map[int]int
+	trailer string
+}
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	prevPattern      = regexp.MustCompile(`/Prev (\d+)`)
+)
+
+// read reads the cross-reference tables of a document, from the last to the
+// first
+func read(data []byte) (*document, error) {
+	match := startxrefPattern.FindSubmatch(data)
+	if match == nil {
+		return nil, errors.New("no startxref")
+	}
+	doc := &document{data: data, offsets: make(map[int]int)}
+	xref, _ := strconv.Atoi(string(match[1]))
+	for seen := make(map[int]bool); ; {
+		if seen[xref] || xref >= len(data) {
+			return nil, errors.New("broken cross-reference chain")
+		}
+		seen[xref] = true
+		trailer, err := doc.readXref(xref)
+		if err != nil {
+			return nil, err
+		}
+		if doc.trailer == "" {
+			doc.trailer = trailer
+		}
+		prev := prevPattern.FindStringSubmatch(trailer)
+		if prev == nil {
+			return doc, nil
+		}
+		xref, _ = strconv.Atoi(prev[1])
+	}
+}
+
+// readXref reads the cross-reference table at offset, keeping the objects
+// that later tables already placed, and returns its trailer
+func (doc *document) readXref(offset int) (string, error) {
+	section := string(doc.data[offset:])
+	if !strings.HasPrefix(section, "xref") {
+		return "", errors.New("no cross-reference table; cross-reference streams are not supported")
+	}
+	trailerAt := strings.Index(section, "trailer")
+	end := strings.Index(section, "startxref")
+	if trailerAt < 0 || end < trailerAt {
+		return "", errors.New("no trailer")
+	}
+	fields := strings.Fields(section[len("xref"):trailerAt])
+	for len(fields) > 0 {
+		if len(fields) < 2 {
+			return "", errors.New("malformed cross-reference table")
+		}
+		first, err1 := strconv.Atoi(fields[0])
+		count, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil || len(fields) < 2+3*count {
+			return "", errors.New("malformed cross-reference table")
+		}
+		for i := range count {
+			entry := fields[2+3*i : 5+3*i]
+			if _, ok := doc.offsets[first+i]; ok {
+				continue
+			}
+			if entry[2] == "n" {
+				doc.offsets[first+i], _ = strconv.Atoi(entry[0])
+			} else {
+				doc.offsets[first+i] = 0
+			}
+		}
+		fields = fields[2+3*count:]
+	}
+	return section[trailerAt:end], nil
+}
+
+// object is an object of a document: its dictionary, and the data of its
+// stream if it has one
+type object struct {
+	dict   string
+	stream []byte
+}
+
+var lengthPattern = regexp.MustCompile(`/Length\s+(\d+)(\s+0\s+R)?`)
+
+// object reads object n, checking that a stream's /Length matches its data
+func (doc *document) object(n int) (*object, error) {
+	offset := doc.offsets[n]
+	if n <= 0 || offset <= 0 || offset >= len(doc.data) {
+		return nil, fmt.Errorf("no object %d", n)
+	}
+	body := doc.data[offset:]
+	header := fmt.Sprintf("%d 0 obj", n)
+	if !bytes.HasPrefix(body, []byte(header)) {
+		return nil, fmt.Errorf("object %d is not where the cross-reference table puts it", n)
+	}
+	body = body[len(header):]
+	end := bytes.Index(body, []byte("endobj"))
+	streamAt := bytes.Index(body, []byte("stream"))
+	if end < 0 {
+		return nil, fmt.Errorf("object %d has no endobj", n)
+	}
+	if streamAt < 0 || streamAt > end {
+		return &object{dict: strings.TrimSpace(string(body[:end]))}, nil
+	}
+
+	obj := &object{dict: strings.TrimSpace(string(body[:streamAt]))}
+	match := lengthPattern.FindStringSubmatch(obj.dict)
+	if match == nil {
+		return nil, fmt.Errorf("stream of object %d has no /Length", n)
+	}
+	length, _ := strconv.Atoi(match[1])
+	if match[2] != "" {
+		lengthObject, err := doc.object(length)
+		if err != nil {
+			return nil, err
+		}
+		length, _ = strconv.Atoi(lengthObject.dict)
+	}
+	data := body[streamAt+len("stream"):]
+	switch {
+	case bytes.HasPrefix(data, []byte("\r\n")):
+		data = data[2:]
+	case bytes.HasPrefix(data, []byte("\n")):
+		data = data[1:]
+	default:
+		return nil, fmt.Errorf("stream keyword of object %d must be followed by an end of line", n)
+	}
+	if length > len(data) || !regexp.MustCompile(`^\r?\n?endstream`).Match(data[length:]) {
+		return nil, fmt.Errorf("stream length of object %d does not match its data", n)
+	}
+	obj.stream = data[:length]
+	return obj, nil
+}
+
+// decoded returns the stream's data, uncompressed
+func (obj *object) decoded() ([]byte, error) {
+	switch filter := name(obj.dict, "Filter"); filter {
+	case "":
+		return obj.stream, nil
+	case "FlateDecode":
+		r, err := zlib.NewReader(bytes.NewReader(obj.stream))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("unsupported filter %s", filter)
+	}
+}
+
+var refPattern = regexp.MustCompile(`(\d+)\s+0\s+R`)
+
+// has reports whether a dictionary has the key
+func has(dict, key string) bool {
+	return regexp.MustCompile(`/` + key + `[\s/<\[(]`).MatchString(dict)
+}
+
+// value returns the value of a key of a dictionary up to the next
+// delimiter, or empty if it has no such key
+func value(dict, key string) string {
+	match := regexp.MustCompile(`/` + key + `\s+([^\s/<>\[\]()]+)`).FindStringSubmatch(dict)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// name returns the name a dictionary gives the key, without the slash
+func name(dict, key string) string {
+	match := regexp.MustCompile(`/` + key + `\s*/([^\s/<>\[\]()]+)`).FindStringSubmatch(dict)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// ref returns the object number of an indirect reference in a dictionary,
+// or zero
+func ref(dict, key string) int {
+	match := regexp.MustCompile(`/` + key + `\s+(\d+)\s+0\s+R`).FindStringSubmatch(dict)
+	if match == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n
+}
+
+// stringValue reads the text string a dictionary gives the key, literal or
+// hexadecimal, in UTF-16 or, approximately, PDFDocEncoding
+func stringValue(dict, key string) (string, bool) {
+	match := regexp.MustCompile(`/` + key + `\s*([(<])`).FindStringSubmatchIndex(dict)
+	if match == nil || strings.HasPrefix(dict[match[2]:], "<<") {
+		return "", false
+	}
+	var raw []byte
+	rest := dict[match[2]+1:]
+	if dict[match[2]] == '<' {
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return "", false
+		}
+		hex := strings.Join(strings.Fields(rest[:end]), "")
+		if len(hex)%2 != 0 {
+			hex += "0"
+		}
+		for i := 0; i < len(hex); i += 2 {
+			b, err := strconv.ParseUint(hex[i:i+2], 16, 8)
+			if err != nil {
+				return "", false
+			}
+			raw = append(raw, byte(b))
+		}
+	} else {
+		var ok bool
+		if raw, ok = literal(rest); !ok {
+			return "", false
+		}
+	}
+
+	if bytes.HasPrefix(raw, []byte{0xFE, 0xFF}) {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units)), true
+	}
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes), true
+}
+
+// literal reads a literal string up to its closing parenthesis, undoing
+// escapes
+func literal(s string) ([]byte, bool) {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			i++
+			if i >= len(s) {
+				return nil, false
+			}
+			switch e := s[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				j := i
+				for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+					j++
+				}
+				v, _ := strconv.ParseUint(s[i:j], 8, 8)
+				out = append(out, byte(v))
+				i = j - 1
+			case '\n':
+			default:
+				out = append(out, e)
+			}
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			if depth == 0 {
+				return out, true
+			}
+			depth--
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return nil, false
+}
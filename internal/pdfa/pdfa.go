@@ -0,0 +1,90 @@
+// Package pdfa provides what PDF/A-2b documents must embed besides their
+// content, XMP metadata and an sRGB output intent profile, and checks
+// documents against the key rules of the standard.
+package pdfa
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// OutputCondition names the colour space of the output intent, which is the
+// sRGB profile's
+const OutputCondition = "sRGB IEC61966-2.1"
+
+// Metadata describes a document, both in its XMP metadata and in its
+// document information dictionary, which PDF/A requires to agree
+type Metadata struct {
+	Title    string
+	Author   string
+	Producer string
+	// Created is when the document was created, and last modified
+	Created time.Time
+}
+
+// XMP returns the document's XMP metadata packet, which identifies it as
+// PDF/A-2b
+func XMP(m Metadata) []byte {
+	date := XMPDate(m.Created)
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about=""
+ xmlns:dc="http://purl.org/dc/elements/1.1/"
+ xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+ xmlns:pdf="http://ns.adobe.com/pdf/1.3/"
+ xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+<dc:format>application/pdf</dc:format>
+`)
+	if m.Title != "" {
+		fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", escape(m.Title))
+	}
+	if m.Author != "" {
+		fmt.Fprintf(&b, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", escape(m.Author))
+	}
+	fmt.Fprintf(&b, "<xmp:CreateDate>%s</xmp:CreateDate>\n<xmp:ModifyDate>%s</xmp:ModifyDate>\n<xmp:MetadataDate>%s</xmp:MetadataDate>\n", date, date, date)
+	if m.Producer != "" {
+		fmt.Fprintf(&b, "<pdf:Producer>%s</pdf:Producer>\n", escape(m.Producer))
+	}
+	b.WriteString(`<pdfaid:part>2</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+	return b.Bytes()
+}
+
+// escape escapes text for XML character data
+func escape(text string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// XMPDate formats a time as XMP dates are written, in UTC to the second
+func XMPDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// PDFDate formats a time as dates in PDF dictionaries are written, in UTC
+// to the second, so that it agrees with XMPDate
+func PDFDate(t time.Time) string {
+	return "D:" + t.UTC().Format("20060102150405") + "Z"
+}
+
+// srgbProfile is the sRGB IEC61966-2.1 profile published with the
+// standard, version 2.1, as PDF/A tools embed it
+//
+//go:embed sRGB-IEC61966-2.1.icc
+var srgbProfile []byte
+
+// SRGBProfile returns the ICC profile of the sRGB colour space, which the
+// output intent embeds. Callers must not modify it.
+func SRGBProfile() []byte {
+	return srgbProfile
+}
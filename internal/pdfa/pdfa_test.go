@@ -0,0 +1,197 @@
+package pdfa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var created = time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+
+// testDocument lays out a PDF/A-2b document of objects, numbered from one:
+// a catalog, its metadata, output intent and profile, the document
+// information and a font. change may alter the objects and the trailer
+// before they are laid out.
+func testDocument(change func(objects []string, trailer *string)) []byte {
+	xmp := XMP(Metadata{Title: "Report Card", Author: "Springfield High", Producer: "Test", Created: created})
+	profile := SRGBProfile()
+	objects := []string{
+		"<</Type /Catalog /Pages 7 0 R /Metadata 2 0 R /OutputIntents [3 0 R]>>",
+		fmt.Sprintf("<</Type /Metadata /Subtype /XML /Length %d>>\nstream\n%s\nendstream", len(xmp), xmp),
+		"<</Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /DestOutputProfile 4 0 R>>",
+		fmt.Sprintf("<</N 3 /Length %d>>\nstream\n%s\nendstream", len(profile), profile),
+		"<</Title (Report Card) /Author <FEFF0053007000720069006E0067006600690065006C006400200048006900670068> /Producer (Test) /CreationDate (D:20261017113000+02'00') /ModDate (D:20261017093000Z)>>",
+		"<</Type /Font /Subtype /TrueType /BaseFont /DejaVuSans /FontDescriptor 8 0 R>>",
+		"<</Type /Pages /Kids [] /Count 0>>",
+		"<</Type /FontDescriptor /FontName /DejaVuSans /FontFile2 9 0 R>>",
+		"<</Length 4>>\nstream\nfont\nendstream",
+	}
+	trailer := "/ID [<0123456789abcdef> <0123456789abcdef>]"
+	if change != nil {
+		change(objects, &trailer)
+	}
+
+	var b strings.Builder
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<<\n/Size %d\n/Root 1 0 R\n/Info 5 0 R\n%s\n>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return []byte(b.String())
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(objects []string, trailer *string)
+		wantErr string
+	}{
+		{"conforming", nil, ""},
+		{"encrypted", func(_ []string, trailer *string) { *trailer += " /Encrypt 9 0 R" }, "must not be encrypted"},
+		{"no ID", func(_ []string, trailer *string) { *trailer = "" }, "document ID"},
+		{"no metadata", func(objects []string, _ *string) {
+			objects[0] = strings.Replace(objects[0], "/Metadata 2 0 R ", "", 1)
+		}, "no XMP metadata"},
+		{"compressed metadata", func(objects []string, _ *string) {
+			objects[1] = strings.Replace(objects[1], "/XML", "/XML /Filter /FlateDecode", 1)
+		}, "must not be compressed"},
+		{"PDF/A-1", func(objects []string, _ *string) {
+			objects[1] = strings.Replace(objects[1], "<pdfaid:part>2</pdfaid:part>", "<pdfaid:part>1</pdfaid:part>", 1)
+		}, `not part "1" conformance "B"`},
+		{"different title", func(objects []string, _ *string) {
+			objects[4] = strings.Replace(objects[4], "(Report Card)", "(Transcript)", 1)
+		}, `Title "Transcript" does not match its XMP metadata "Report Card"`},
+		{"different date", func(objects []string, _ *string) {
+			objects[4] = strings.Replace(objects[4], "D:20261017093000Z", "D:20261017093000+02'00'", 1)
+		}, "ModDate"},
+		{"no output intents", func(objects []string, _ *string) {
+			objects[0] = strings.Replace(objects[0], " /OutputIntents [3 0 R]", "", 1)
+		}, "no output intents"},
+		{"other output intent", func(objects []string, _ *string) {
+			objects[2] = strings.Replace(objects[2], "/GTS_PDFA1", "/GTS_PDFX", 1)
+		}, "no PDF/A output intent"},
+		{"profile components", func(objects []string, _ *string) {
+			objects[3] = strings.Replace(objects[3], "/N 3", "/N 4", 1)
+		}, "does not have the 4 components"},
+		{"font not embedded", func(objects []string, _ *string) {
+			objects[7] = "<</Type /FontDescriptor /FontName /DejaVuSans>>"
+		}, "font DejaVuSans (object 6) must be embedded"},
+		{"stream length", func(objects []string, _ *string) {
+			objects[8] = "<</Length 3>>\nstream\nfont\nendstream"
+		}, "stream length of object 9"},
+		{"hidden annotation", func(objects []string, _ *string) {
+			objects[8] = "<</Type /Annot /Subtype /Link /F 6>>"
+		}, "annotation (object 9)"},
+		{"unprinted annotation", func(objects []string, _ *string) {
+			objects[8] = "<</Type /Annot /Subtype /Widget /Rect [0 0 0 0]>>"
+		}, "annotation (object 9)"},
+		{"JavaScript", func(objects []string, _ *string) {
+			objects[8] = "<</S /JavaScript /JS (app.alert(1))>>"
+		}, "JavaScript"},
+		{"transfer function", func(objects []string, _ *string) {
+			objects[8] = "<</Type /ExtGState /TR /Identity>>"
+		}, "transfer function"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(testDocument(tt.change))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheck_Header(t *testing.T) {
+	document := testDocument(nil)
+	// Same length, so the offsets still hold
+	plain := []byte(strings.Replace(string(document), "%\xe2\xe3\xcf\xd3\n", "%abcd\n", 1))
+
+	assert.ErrorContains(t, Check(plain), "four bytes above 127")
+	assert.ErrorContains(t, Check([]byte("not a PDF")), "cannot read document")
+}
+
+func TestCheck_IncrementalUpdate(t *testing.T) {
+	document := string(testDocument(nil))
+	xref := document[strings.LastIndex(document, "startxref\n")+len("startxref\n") : len(document)-len("\n%%EOF\n")]
+
+	// An update that replaces the font descriptor with one that does not
+	// embed the font
+	update := "8 0 obj\n<</Type /FontDescriptor /FontName /DejaVuSans>>\nendobj\n"
+	at := len(document) + len(update)
+	updated := document + update + fmt.Sprintf("xref\n8 1\n%010d 00000 n \ntrailer\n<<\n/Size 10\n/Root 1 0 R\n/Info 5 0 R\n/Prev %s\n/ID [<0123456789abcdef> <fedcba9876543210>]\n>>\nstartxref\n%d\n%%%%EOF\n", len(document), xref, at)
+
+	err := Check([]byte(updated))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "font DejaVuSans (object 6) must be embedded")
+	assert.NotContains(t, err.Error(), "metadata")
+}
+
+func TestXMP(t *testing.T) {
+	packet := XMP(Metadata{Title: "Report <Card> & Grades", Author: "École Saint-Jean", Producer: "Test", Created: created.In(time.FixedZone("", 2*60*60))})
+
+	properties, err := xmpProperties(packet)
+	require.NoError(t, err)
+	assert.Equal(t, "Report <Card> & Grades", properties[nsDC+"title"])
+	assert.Equal(t, "École Saint-Jean", properties[nsDC+"creator"])
+	assert.Equal(t, "Test", properties[nsPDF+"Producer"])
+	assert.Equal(t, "2026-10-17T09:30:00Z", properties[nsXMP+"CreateDate"])
+	assert.Equal(t, "2026-10-17T09:30:00Z", properties[nsXMP+"MetadataDate"])
+	assert.Equal(t, "application/pdf", properties[nsDC+"format"])
+	assert.Equal(t, "2", properties[nsPDFAID+"part"])
+	assert.Equal(t, "B", properties[nsPDFAID+"conformance"])
+	assert.True(t, strings.HasSuffix(string(packet), `<?xpacket end="w"?>`))
+}
+
+func TestXMP_NoTitle(t *testing.T) {
+	properties, err := xmpProperties(XMP(Metadata{Created: created}))
+
+	require.NoError(t, err)
+	assert.NotContains(t, properties, nsDC+"title")
+	assert.NotContains(t, properties, nsDC+"creator")
+}
+
+func TestPDFDate(t *testing.T) {
+	date := PDFDate(created.In(time.FixedZone("", -5*60*60)))
+	assert.Equal(t, "D:20261017093000Z", date)
+
+	for _, s := range []string{date, "D:20261017113000+02'00'", "D:20261017043000-05'00", "D:20261017093000"} {
+		parsed, err := parsePDFDate(s)
+		require.NoError(t, err, s)
+		assert.True(t, created.Equal(parsed), s)
+	}
+	parsed, err := parsePDFDate("D:2026")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), parsed)
+	_, err = parsePDFDate("D:202610171")
+	assert.Error(t, err)
+}
+
+func TestSRGBProfile(t *testing.T) {
+	profile := SRGBProfile()
+
+	require.NoError(t, checkProfile(profile, 3))
+	assert.Error(t, checkProfile(profile, 1))
+	assert.Error(t, checkProfile(profile[:len(profile)-4], 3))
+	assert.Equal(t, "mntrRGB XYZ ", string(profile[12:24]))
+	assert.Contains(t, string(profile), OutputCondition)
+	// The profile as published, not an approximation of it
+	sum := sha256.Sum256(profile)
+	assert.Equal(t, "2b3aa1645779a9e634744faf9b01e9102b0c9b88fd6deced7934df86b949af7e", hex.EncodeToString(sum[:]))
+}
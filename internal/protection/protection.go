@@ -0,0 +1,183 @@
+// Package protection decides which reports are encrypted and what password
+// opens them.
+package protection
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Mode is how a report is protected
+type Mode string
+
+const (
+	// None leaves the report unencrypted
+	None Mode = "none"
+	// Restrict encrypts the report without a password to open it; it still
+	// cannot be printed, copied from or modified
+	Restrict Mode = "restrict"
+	// DateOfBirth encrypts the report with the student's date of birth as
+	// the password to open it, written as DateOfBirthFormat
+	DateOfBirth Mode = "dob"
+	// Password encrypts the report with a password supplied by the caller
+	Password Mode = "password"
+)
+
+// Modes lists the modes a request can choose
+var Modes = []Mode{None, Restrict, DateOfBirth, Password}
+
+// DateOfBirthFormat is how a date of birth is typed to open a report:
+// 15 May 1995 is 15051995
+const DateOfBirthFormat = "02012006"
+
+// Report types the policy can require protection for
+const (
+	ReportStudent = "student"
+	ReportTest    = "test"
+	ReportRender  = "render"
+	ReportBatch   = "batch"
+	ReportJob     = "job"
+)
+
+// ReportTypes lists the report types, in the order they are documented
+var ReportTypes = []string{ReportStudent, ReportTest, ReportRender, ReportBatch, ReportJob}
+
+// maxPasswordLength is the longest password PDF encryption uses; longer
+// ones are cut short by readers
+const maxPasswordLength = 32
+
+var (
+	// ErrRequired is returned when a request asks for an unprotected report
+	// of a type the policy protects
+	ErrRequired = errors.New("reports of this type must be protected")
+	// ErrNoDateOfBirth is returned when a report is to be opened with a
+	// date of birth the student's record lacks
+	ErrNoDateOfBirth = errors.New("student has no date of birth to protect the report with")
+)
+
+// ParseMode reads a mode by name. The empty string is a valid mode that
+// leaves the choice to the policy.
+func ParseMode(name string) (Mode, error) {
+	mode := Mode(strings.ToLower(strings.TrimSpace(name)))
+	if mode != "" && !slices.Contains(Modes, mode) {
+		return "", fmt.Errorf("unknown protection %q", name)
+	}
+	return mode, nil
+}
+
+// ValidatePassword checks that a password can be used to encrypt a report:
+// 1 to 32 printable ASCII characters, which every PDF reader accepts
+func ValidatePassword(password string) error {
+	if password == "" || len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be 1 to %d characters long", maxPasswordLength)
+	}
+	for i := 0; i < len(password); i++ {
+		if password[i] < ' ' || password[i] > '~' {
+			return errors.New("password must only contain printable ASCII characters")
+		}
+	}
+	return nil
+}
+
+// DateOfBirthPassword is the password of a report protected with a date of
+// birth in YYYY-MM-DD format
+func DateOfBirthPassword(dob *string) (string, error) {
+	if dob == nil || *dob == "" {
+		return "", ErrNoDateOfBirth
+	}
+	date, err := time.Parse("2006-01-02", *dob)
+	if err != nil {
+		return "", ErrNoDateOfBirth
+	}
+	return date.Format(DateOfBirthFormat), nil
+}
+
+// Policy is the server's rule for which reports are protected
+type Policy struct {
+	// required holds the report types that must be protected
+	required map[string]bool
+	// defaultMode protects required reports whose request does not choose
+	// a mode
+	defaultMode Mode
+	// ownerPassword lifts the restrictions of every protected report; each
+	// report gets a random one if it is empty
+	ownerPassword string
+}
+
+// DefaultPolicy protects only the reports whose requests ask for it, with
+// random owner passwords
+func DefaultPolicy() *Policy {
+	return &Policy{required: make(map[string]bool), defaultMode: Restrict}
+}
+
+// NewPolicyFromEnv reads the report types that must be protected from
+// PROTECTED_REPORTS, a comma-separated list of ReportTypes, the mode they are
+// protected with unless the request chooses from PROTECTION_DEFAULT
+// (restrict or dob, default restrict) and the owner password from
+// PDF_OWNER_PASSWORD.
+func NewPolicyFromEnv() (*Policy, error) {
+	policy := DefaultPolicy()
+	for _, name := range strings.Split(os.Getenv("PROTECTED_REPORTS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(ReportTypes, name) {
+			return nil, fmt.Errorf("invalid PROTECTED_REPORTS: unknown report type %q; expected %s", name, strings.Join(ReportTypes, ", "))
+		}
+		policy.required[name] = true
+	}
+
+	if value := os.Getenv("PROTECTION_DEFAULT"); value != "" {
+		mode, err := ParseMode(value)
+		if err != nil || (mode != Restrict && mode != DateOfBirth) {
+			return nil, fmt.Errorf("invalid PROTECTION_DEFAULT %q; expected %s or %s", value, Restrict, DateOfBirth)
+		}
+		policy.defaultMode = mode
+	}
+
+	if password := os.Getenv("PDF_OWNER_PASSWORD"); password != "" {
+		if err := ValidatePassword(password); err != nil {
+			return nil, fmt.Errorf("invalid PDF_OWNER_PASSWORD: %w", err)
+		}
+		policy.ownerPassword = password
+	}
+	return policy, nil
+}
+
+// Required returns the report types that must be protected, in order
+func (p *Policy) Required() []string {
+	var required []string
+	for _, reportType := range ReportTypes {
+		if p.required[reportType] {
+			required = append(required, reportType)
+		}
+	}
+	return required
+}
+
+// OwnerPassword is the password that lifts the restrictions of protected
+// reports, or empty for a random one per report
+func (p *Policy) OwnerPassword() string {
+	return p.ownerPassword
+}
+
+// Resolve returns the mode a report of reportType is protected with when
+// its request asks for requested, which is empty if the request does not
+// choose. It returns ErrRequired if the request asks for no protection on a
+// report the policy protects.
+func (p *Policy) Resolve(reportType string, requested Mode) (Mode, error) {
+	switch {
+	case requested == "" && p.required[reportType]:
+		return p.defaultMode, nil
+	case requested == "":
+		return None, nil
+	case requested == None && p.required[reportType]:
+		return "", ErrRequired
+	}
+	return requested, nil
+}
@@ -0,0 +1,154 @@
+package protection
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Mode
+		wantErr bool
+	}{
+		{"", "", false},
+		{"none", None, false},
+		{" Restrict ", Restrict, false},
+		{"DOB", DateOfBirth, false},
+		{"password", Password, false},
+		{"secret", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, err := ParseMode(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, mode)
+		})
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"printable", "S3cret pass!", false},
+		{"longest", strings.Repeat("a", 32), false},
+		{"empty", "", true},
+		{"too long", strings.Repeat("a", 33), true},
+		{"control character", "pass\tword", true},
+		{"not ASCII", "contraseña", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePassword(tt.password)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDateOfBirthPassword(t *testing.T) {
+	dob := "1995-05-15"
+	password, err := DateOfBirthPassword(&dob)
+	require.NoError(t, err)
+	assert.Equal(t, "15051995", password)
+
+	invalid := "15/05/1995"
+	empty := ""
+	for _, dob := range []*string{nil, &empty, &invalid} {
+		_, err := DateOfBirthPassword(dob)
+		assert.ErrorIs(t, err, ErrNoDateOfBirth)
+	}
+}
+
+func TestPolicy_Resolve(t *testing.T) {
+	policy := &Policy{required: map[string]bool{ReportBatch: true}, defaultMode: DateOfBirth}
+
+	tests := []struct {
+		name       string
+		reportType string
+		requested  Mode
+		want       Mode
+		wantErr    error
+	}{
+		{"not required, no choice", ReportStudent, "", None, nil},
+		{"not required, chosen", ReportStudent, Password, Password, nil},
+		{"required, no choice", ReportBatch, "", DateOfBirth, nil},
+		{"required, chosen", ReportBatch, Restrict, Restrict, nil},
+		{"required, none", ReportBatch, None, "", ErrRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, err := policy.Resolve(tt.reportType, tt.requested)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, mode)
+		})
+	}
+}
+
+func TestNewPolicyFromEnv(t *testing.T) {
+	t.Setenv("PROTECTED_REPORTS", " job, Student ,")
+	t.Setenv("PROTECTION_DEFAULT", "dob")
+	t.Setenv("PDF_OWNER_PASSWORD", "owner-secret")
+
+	policy, err := NewPolicyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, []string{ReportStudent, ReportJob}, policy.Required())
+	assert.Equal(t, "owner-secret", policy.OwnerPassword())
+
+	mode, err := policy.Resolve(ReportJob, "")
+	require.NoError(t, err)
+	assert.Equal(t, DateOfBirth, mode)
+}
+
+func TestNewPolicyFromEnv_Default(t *testing.T) {
+	t.Setenv("PROTECTED_REPORTS", "")
+	t.Setenv("PROTECTION_DEFAULT", "")
+	t.Setenv("PDF_OWNER_PASSWORD", "")
+
+	policy, err := NewPolicyFromEnv()
+	require.NoError(t, err)
+	assert.Empty(t, policy.Required())
+	assert.Empty(t, policy.OwnerPassword())
+}
+
+func TestNewPolicyFromEnv_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"unknown report type", "PROTECTED_REPORTS", "student,invoice"},
+		{"unknown default", "PROTECTION_DEFAULT", "secret"},
+		{"password default", "PROTECTION_DEFAULT", "password"},
+		{"none default", "PROTECTION_DEFAULT", "none"},
+		{"long owner password", "PDF_OWNER_PASSWORD", strings.Repeat("a", 33)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PROTECTED_REPORTS", "")
+			t.Setenv("PROTECTION_DEFAULT", "")
+			t.Setenv("PDF_OWNER_PASSWORD", "")
+			t.Setenv(tt.key, tt.value)
+
+			_, err := NewPolicyFromEnv()
+			assert.ErrorContains(t, err, tt.key)
+		})
+	}
+}
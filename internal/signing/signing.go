@@ -0,0 +1,220 @@
+// Package signing signs reports with the school's X.509 certificate, so that
+// a reader can check who issued a report and that it was not changed since.
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ErrNotConfigured is returned by NewSignerFromEnv when no certificate is set
+var ErrNotConfigured = errors.New("signing certificate is not configured")
+
+// sizeSlack is added to the size of a trial signature to bound the size of
+// every later one; ECDSA signatures vary by a few bytes
+const sizeSlack = 32
+
+// Signer makes detached PKCS#7 signatures with a certificate and its key
+type Signer struct {
+	certificate *x509.Certificate
+	// chain holds the certificates that issued certificate, issuer first,
+	// which are embedded so that readers can build the path to a trusted root
+	chain []*x509.Certificate
+	key   crypto.Signer
+	// size bounds the length of a signature
+	size int
+
+	// Reason and Location are shown with the signature in PDF readers; they
+	// are omitted if empty
+	Reason   string
+	Location string
+	// Visible prints a signature block on the report besides signing it
+	Visible bool
+}
+
+// NewSigner creates a signer for certificate, whose private key is key.
+// chain lists the certificates that issued it, issuer first, and may be
+// empty for a self-signed certificate. Only RSA and ECDSA keys are supported.
+func NewSigner(certificate *x509.Certificate, key crypto.PrivateKey, chain []*x509.Certificate) (*Signer, error) {
+	var signer crypto.Signer
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signer = key
+	case *ecdsa.PrivateKey:
+		signer = key
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T; expected RSA or ECDSA", key)
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(certificate.PublicKey) {
+		return nil, errors.New("private key does not match the certificate")
+	}
+	if now := time.Now(); now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+		return nil, fmt.Errorf("certificate %q is only valid from %s to %s", certificate.Subject.CommonName,
+			certificate.NotBefore.Format(time.RFC3339), certificate.NotAfter.Format(time.RFC3339))
+	}
+
+	s := &Signer{certificate: certificate, chain: chain, key: signer, Visible: true}
+	// A trial signature checks the chain and sizes the space reserved for
+	// signatures in a report
+	trial, err := s.Sign(nil)
+	if err != nil {
+		return nil, err
+	}
+	s.size = len(trial) + sizeSlack
+	return s, nil
+}
+
+// LoadPEM creates a signer from a PEM certificate file, which may also hold
+// the chain of certificates that issued it, issuer first, and an unencrypted
+// PEM private key file in PKCS#8, PKCS#1 or SEC 1 form
+func LoadPEM(certFile, keyFile string) (*Signer, error) {
+	certData, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	var certificates []*x509.Certificate
+	for block, rest := pem.Decode(certData); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate in %s: %w", certFile, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no PEM certificate in %s", certFile)
+	}
+
+	keyData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key in %s", keyFile)
+	}
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %s: %w", keyFile, err)
+	}
+	return NewSigner(certificates[0], key, certificates[1:])
+}
+
+// parsePrivateKey reads a DER private key in any of the forms OpenSSL writes
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("not a PKCS#8, PKCS#1 or SEC 1 private key")
+}
+
+// LoadPKCS12 creates a signer from a PKCS#12 (.p12 or .pfx) file holding a
+// certificate, its private key and optionally the certificates that issued it
+func LoadPKCS12(file, password string) (*Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PKCS#12 file: %w", err)
+	}
+	key, certificate, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PKCS#12 file %s: %w", file, err)
+	}
+	return NewSigner(certificate, key, chain)
+}
+
+// NewSignerFromEnv creates a signer from SIGNING_CERT_FILE and
+// SIGNING_KEY_FILE, or from SIGNING_PKCS12_FILE and SIGNING_PKCS12_PASSWORD.
+// SIGNING_REASON and SIGNING_LOCATION describe the signature and
+// SIGNING_VISIBLE=false leaves the signature block off reports. It returns
+// ErrNotConfigured if no certificate is set.
+func NewSignerFromEnv() (*Signer, error) {
+	certFile, keyFile := os.Getenv("SIGNING_CERT_FILE"), os.Getenv("SIGNING_KEY_FILE")
+	p12File := os.Getenv("SIGNING_PKCS12_FILE")
+
+	var signer *Signer
+	var err error
+	switch {
+	case p12File != "" && (certFile != "" || keyFile != ""):
+		return nil, errors.New("set either SIGNING_PKCS12_FILE or SIGNING_CERT_FILE and SIGNING_KEY_FILE, not both")
+	case p12File != "":
+		signer, err = LoadPKCS12(p12File, os.Getenv("SIGNING_PKCS12_PASSWORD"))
+	case certFile != "" && keyFile != "":
+		signer, err = LoadPEM(certFile, keyFile)
+	case certFile != "" || keyFile != "":
+		return nil, errors.New("SIGNING_CERT_FILE and SIGNING_KEY_FILE must be set together")
+	default:
+		return nil, ErrNotConfigured
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer.Reason = os.Getenv("SIGNING_REASON")
+	signer.Location = os.Getenv("SIGNING_LOCATION")
+	if value := os.Getenv("SIGNING_VISIBLE"); value != "" {
+		visible, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIGNING_VISIBLE %q; expected true or false", value)
+		}
+		signer.Visible = visible
+	}
+	return signer, nil
+}
+
+// Name is the common name of the certificate's subject, or its whole subject
+// if it has no common name
+func (s *Signer) Name() string {
+	if name := s.certificate.Subject.CommonName; name != "" {
+		return name
+	}
+	return s.certificate.Subject.String()
+}
+
+// Certificate is the certificate signatures are made with
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.certificate
+}
+
+// MaxSize bounds the length of the signatures Sign returns
+func (s *Signer) MaxSize() int {
+	return s.size
+}
+
+// Sign returns a detached PKCS#7 signature of content, made with SHA-256 and
+// carrying the certificate, its chain and the signing time
+func (s *Signer) Sign(content []byte) ([]byte, error) {
+	signedData, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := signedData.AddSignerChain(s.certificate, s.key, s.chain, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	signedData.Detach()
+	signature, err := signedData.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signature, nil
+}
@@ -0,0 +1,256 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mozilla.org/pkcs7"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testCA is a self-signed certificate authority that issues test certificates
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test School CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{certificate: certificate, key: key}
+}
+
+// issue creates a signing certificate for key, valid from notBefore to notAfter
+func (ca *testCA) issue(t *testing.T, name string, key crypto.Signer, notBefore, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Springfield High"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, key.Public(), ca.key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certificate
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+	return pool
+}
+
+func writePEM(t *testing.T, path string, blocks ...*pem.Block) {
+	t.Helper()
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+// verify checks that signature is a detached signature of content by a
+// certificate the CA issued
+func verify(t *testing.T, ca *testCA, signature, content []byte) *pkcs7.PKCS7 {
+	t.Helper()
+	p7, err := pkcs7.Parse(signature)
+	require.NoError(t, err)
+	p7.Content = content
+	require.NoError(t, p7.VerifyWithChain(ca.pool()))
+	return p7
+}
+
+func TestLoadPEM(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		key      crypto.Signer
+		keyBlock func(crypto.Signer) *pem.Block
+	}{
+		{"RSA PKCS#1", mustRSAKey(t), func(key crypto.Signer) *pem.Block {
+			return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key.(*rsa.PrivateKey))}
+		}},
+		{"ECDSA SEC 1", mustECDSAKey(t), func(key crypto.Signer) *pem.Block {
+			der, _ := x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+			return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+		}},
+		{"ECDSA PKCS#8", mustECDSAKey(t), func(key crypto.Signer) *pem.Block {
+			der, _ := x509.MarshalPKCS8PrivateKey(key)
+			return &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certificate := ca.issue(t, "Registrar", tt.key, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+			certFile := filepath.Join(dir, tt.name+".crt")
+			keyFile := filepath.Join(dir, tt.name+".key")
+			// The chain follows the certificate in the same file
+			writePEM(t, certFile,
+				&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw},
+				&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw})
+			writePEM(t, keyFile, tt.keyBlock(tt.key))
+
+			signer, err := LoadPEM(certFile, keyFile)
+			require.NoError(t, err)
+			assert.Equal(t, "Registrar", signer.Name())
+			assert.True(t, signer.Visible)
+
+			content := []byte("%PDF-1.3 report")
+			signature, err := signer.Sign(content)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(signature), signer.MaxSize())
+
+			p7 := verify(t, ca, signature, content)
+			assert.Len(t, p7.Certificates, 2)
+
+			// The signature is detached: it does not carry the content
+			detached, err := pkcs7.Parse(signature)
+			require.NoError(t, err)
+			assert.Empty(t, detached.Content)
+		})
+	}
+}
+
+func TestLoadPKCS12(t *testing.T) {
+	ca := newTestCA(t)
+	key := mustRSAKey(t)
+	certificate := ca.issue(t, "Registrar", key, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	data, err := pkcs12.Modern.Encode(key, certificate, []*x509.Certificate{ca.certificate}, "changeit")
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "school.p12")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+
+	signer, err := LoadPKCS12(file, "changeit")
+	require.NoError(t, err)
+	signature, err := signer.Sign([]byte("report"))
+	require.NoError(t, err)
+	verify(t, ca, signature, []byte("report"))
+
+	_, err = LoadPKCS12(file, "wrong")
+	assert.Error(t, err)
+}
+
+func TestNewSigner_Invalid(t *testing.T) {
+	ca := newTestCA(t)
+	key := mustECDSAKey(t)
+	valid := ca.issue(t, "Registrar", key, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	expired := ca.issue(t, "Registrar", key, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+
+	_, err := NewSigner(valid, mustECDSAKey(t), nil)
+	assert.ErrorContains(t, err, "does not match")
+
+	_, err = NewSigner(expired, key, nil)
+	assert.ErrorContains(t, err, "only valid from")
+
+	// The chain must start with the certificate's issuer
+	_, err = NewSigner(valid, key, []*x509.Certificate{valid})
+	assert.Error(t, err)
+
+	_, err = NewSigner(valid, key, []*x509.Certificate{ca.certificate})
+	assert.NoError(t, err)
+}
+
+func TestNewSignerFromEnv(t *testing.T) {
+	ca := newTestCA(t)
+	key := mustECDSAKey(t)
+	certificate := ca.issue(t, "Registrar", key, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "school.crt"), filepath.Join(dir, "school.key")
+	writePEM(t, certFile, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	writePEM(t, keyFile, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	setEnv := func(t *testing.T, values map[string]string) {
+		for _, key := range []string{"SIGNING_CERT_FILE", "SIGNING_KEY_FILE", "SIGNING_PKCS12_FILE", "SIGNING_PKCS12_PASSWORD", "SIGNING_REASON", "SIGNING_LOCATION", "SIGNING_VISIBLE"} {
+			t.Setenv(key, values[key])
+		}
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		setEnv(t, nil)
+		_, err := NewSignerFromEnv()
+		assert.ErrorIs(t, err, ErrNotConfigured)
+	})
+
+	t.Run("PEM", func(t *testing.T) {
+		setEnv(t, map[string]string{
+			"SIGNING_CERT_FILE": certFile,
+			"SIGNING_KEY_FILE":  keyFile,
+			"SIGNING_REASON":    "Official report",
+			"SIGNING_LOCATION":  "Springfield",
+			"SIGNING_VISIBLE":   "false",
+		})
+		signer, err := NewSignerFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, "Official report", signer.Reason)
+		assert.Equal(t, "Springfield", signer.Location)
+		assert.False(t, signer.Visible)
+	})
+
+	invalid := []struct {
+		name   string
+		values map[string]string
+	}{
+		{"certificate without key", map[string]string{"SIGNING_CERT_FILE": certFile}},
+		{"PEM and PKCS#12", map[string]string{"SIGNING_CERT_FILE": certFile, "SIGNING_KEY_FILE": keyFile, "SIGNING_PKCS12_FILE": "school.p12"}},
+		{"missing file", map[string]string{"SIGNING_PKCS12_FILE": filepath.Join(dir, "missing.p12")}},
+		{"key is not a key", map[string]string{"SIGNING_CERT_FILE": certFile, "SIGNING_KEY_FILE": certFile}},
+		{"invalid visible", map[string]string{"SIGNING_CERT_FILE": certFile, "SIGNING_KEY_FILE": keyFile, "SIGNING_VISIBLE": "sometimes"}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.values)
+			_, err := NewSignerFromEnv()
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, ErrNotConfigured)
+		})
+	}
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func mustECDSAKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
@@ -0,0 +1,74 @@
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"pdf-generator/internal/atomicfile"
+)
+
+// FileStore keeps each record as a JSON file, so reports still verify after
+// a restart. Files are written to a temporary name and renamed into place so
+// a crash never leaves a partially written record behind.
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewFileStore creates a store in dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create verification store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileStore) Save(_ context.Context, record *Record) error {
+	if !validID(record.ID) {
+		return fmt.Errorf("%w %q", ErrInvalidID, record.ID)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal verification record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := atomicfile.WriteFile(s.path(record.ID), data); err != nil {
+		return fmt.Errorf("failed to write verification record: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Get(_ context.Context, id string) (*Record, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verification record: %w", err)
+	}
+
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode verification record %s: %w", id, err)
+	}
+	return &record, nil
+}
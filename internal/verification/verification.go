@@ -0,0 +1,181 @@
+// Package verification keeps a registry of the reports the service issues,
+// so that anyone holding a report can check that it is genuine. Each report
+// carries a short verification ID, and the registry records when it was
+// issued, for which students, and the SHA-256 hash of its PDF.
+package verification
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+
+	// DefaultStoreDir is where the file store keeps records when
+	// VERIFICATION_STORE_DIR is not set
+	DefaultStoreDir = "data/verification"
+
+	// idLength is the number of characters of an ID; 10 characters of base
+	// 32 hold 50 random bits
+	idLength = 10
+	// alphabet is Crockford's base 32, which leaves out I, L, O and U so
+	// that codes read off paper are not mistaken
+	alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var (
+	// ErrNotFound is returned for IDs the registry holds no report for
+	ErrNotFound = errors.New("verification record not found")
+	// ErrInvalidID is returned by ParseID for text that cannot be an ID
+	ErrInvalidID = errors.New("invalid verification ID")
+)
+
+// Record is the registry's entry for an issued report
+type Record struct {
+	ID       string    `json:"id"`
+	IssuedAt time.Time `json:"issuedAt"`
+	// StudentIDs are the students the report is about: one for a student's
+	// report, several for a merged batch report
+	StudentIDs []int `json:"studentIds"`
+	// SHA256 is the hex-encoded hash of the issued PDF
+	SHA256 string `json:"sha256"`
+}
+
+// NewRecord creates the record of a report issued now with the given ID
+func NewRecord(id string, pdf []byte, studentIDs ...int) *Record {
+	sum := sha256.Sum256(pdf)
+	return &Record{
+		ID:         id,
+		IssuedAt:   time.Now().UTC(),
+		StudentIDs: studentIDs,
+		SHA256:     hex.EncodeToString(sum[:]),
+	}
+}
+
+// Matches reports whether pdf is the document the record was made for
+func (r *Record) Matches(pdf []byte) bool {
+	sum := sha256.Sum256(pdf)
+	return strings.EqualFold(r.SHA256, hex.EncodeToString(sum[:]))
+}
+
+// clone returns a copy that shares no memory with the record
+func (r *Record) clone() *Record {
+	c := *r
+	c.StudentIDs = slices.Clone(r.StudentIDs)
+	return &c
+}
+
+// NewID generates a random verification ID
+func NewID() (string, error) {
+	b := make([]byte, idLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = alphabet[b[i]%byte(len(alphabet))]
+	}
+	return string(b), nil
+}
+
+// FormatID splits an ID into two groups of five characters, the short code
+// printed on reports
+func FormatID(id string) string {
+	if len(id) != idLength {
+		return id
+	}
+	return id[:idLength/2] + "-" + id[idLength/2:]
+}
+
+// ParseID reads an ID as a person might type it from a printed code: in any
+// case, with or without the hyphen, and with the letters O, I and L read as
+// the digits they look like
+func ParseID(code string) (string, error) {
+	replacer := strings.NewReplacer("-", "", " ", "", "O", "0", "I", "1", "L", "1")
+	id := replacer.Replace(strings.ToUpper(strings.TrimSpace(code)))
+	if !validID(id) {
+		return "", fmt.Errorf("%w %q", ErrInvalidID, code)
+	}
+	return id, nil
+}
+
+// validID reports whether id could have been produced by NewID, so that IDs
+// taken from URLs are never used to build file paths
+func validID(id string) bool {
+	if len(id) != idLength {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(alphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store persists verification records. Implementations must be safe for
+// concurrent use and must return copies, so callers may modify returned
+// records.
+type Store interface {
+	// Save records an issued report
+	Save(ctx context.Context, record *Record) error
+	// Get returns the record with the given ID or ErrNotFound
+	Get(ctx context.Context, id string) (*Record, error)
+}
+
+// NewStoreFromEnv creates the store selected by VERIFICATION_STORE ("file",
+// the default, or "memory"). The file store keeps its records in
+// VERIFICATION_STORE_DIR.
+func NewStoreFromEnv() (Store, error) {
+	switch kind := os.Getenv("VERIFICATION_STORE"); kind {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case "", StoreFile:
+		dir := os.Getenv("VERIFICATION_STORE_DIR")
+		if dir == "" {
+			dir = DefaultStoreDir
+		}
+		return NewFileStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown VERIFICATION_STORE %q", kind)
+	}
+}
+
+// MemoryStore keeps records in memory; they are lost when the process
+// exits, after which the reports it issued no longer verify
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+func (s *MemoryStore) Save(_ context.Context, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.ID] = record.clone()
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return record.clone(), nil
+}
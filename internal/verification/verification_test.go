@@ -0,0 +1,162 @@
+package verification
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	return map[string]Store{
+		StoreMemory: NewMemoryStore(),
+		StoreFile:   fileStore,
+	}
+}
+
+func newTestRecord(t *testing.T) *Record {
+	id, err := NewID()
+	require.NoError(t, err)
+	return NewRecord(id, []byte("%PDF-1.3 report"), 1, 2)
+}
+
+func TestNewID(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		id, err := NewID()
+		require.NoError(t, err)
+		assert.Regexp(t, `^[0-9A-HJKMNP-TV-Z]{10}$`, id)
+		assert.False(t, seen[id], "duplicate ID %s", id)
+		seen[id] = true
+
+		parsed, err := ParseID(FormatID(id))
+		require.NoError(t, err)
+		assert.Equal(t, id, parsed)
+	}
+}
+
+func TestFormatID(t *testing.T) {
+	assert.Equal(t, "7K3QD-M2X9P", FormatID("7K3QDM2X9P"))
+}
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"printed code", "7K3QD-M2X9P", "7K3QDM2X9P"},
+		{"without hyphen", "7K3QDM2X9P", "7K3QDM2X9P"},
+		{"lower case with spaces", " 7k3qd m2x9p ", "7K3QDM2X9P"},
+		{"letters read as digits", "AB0DE-IL234", "AB0DE11234"},
+		{"O for zero", "ABODE-11234", "AB0DE11234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := ParseID(tt.code)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, id)
+		})
+	}
+
+	for _, code := range []string{"", "7K3QD-M2X9", "7K3QD-M2X9PP", "7K3QD-M2X9U", "../../etc/pa"} {
+		_, err := ParseID(code)
+		assert.ErrorIs(t, err, ErrInvalidID, "code %q", code)
+	}
+}
+
+func TestNewRecord(t *testing.T) {
+	pdf := []byte("%PDF-1.3 report")
+	record := NewRecord("7K3QDM2X9P", pdf, 42)
+
+	sum := sha256.Sum256(pdf)
+	assert.Equal(t, hex.EncodeToString(sum[:]), record.SHA256)
+	assert.Equal(t, []int{42}, record.StudentIDs)
+	assert.False(t, record.IssuedAt.IsZero())
+	assert.True(t, record.Matches(pdf))
+	assert.False(t, record.Matches([]byte("%PDF-1.3 forged")))
+}
+
+func TestStore_SaveGet(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			record := newTestRecord(t)
+			require.NoError(t, store.Save(ctx, record))
+
+			got, err := store.Get(ctx, record.ID)
+			require.NoError(t, err)
+			assert.Equal(t, record.ID, got.ID)
+			assert.Equal(t, record.SHA256, got.SHA256)
+			assert.Equal(t, record.StudentIDs, got.StudentIDs)
+			assert.True(t, record.IssuedAt.Equal(got.IssuedAt))
+
+			// Returned records are copies
+			got.StudentIDs[0] = 99
+			again, err := store.Get(ctx, record.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []int{1, 2}, again.StudentIDs)
+
+			_, err = store.Get(ctx, "0000000000")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestFileStore_PersistsAcrossInstances(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	record := newTestRecord(t)
+	require.NoError(t, store.Save(ctx, record))
+
+	reopened, err := NewFileStore(dir)
+	require.NoError(t, err)
+	got, err := reopened.Get(ctx, record.ID)
+	require.NoError(t, err)
+	assert.Equal(t, record.SHA256, got.SHA256)
+}
+
+func TestFileStore_RejectsPathsAsIDs(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store, err := NewFileStore(filepath.Join(dir, "records"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.json"), []byte(`{"id":"secret"}`), 0o600))
+
+	_, err = store.Get(ctx, "../secret")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, store.Save(ctx, &Record{ID: "../secret"}), ErrInvalidID)
+}
+
+func TestNewStoreFromEnv(t *testing.T) {
+	// Records survive a restart unless the memory store is asked for
+	t.Setenv("VERIFICATION_STORE", "")
+	t.Setenv("VERIFICATION_STORE_DIR", t.TempDir())
+	store, err := NewStoreFromEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &FileStore{}, store)
+
+	t.Setenv("VERIFICATION_STORE", "file")
+	store, err = NewStoreFromEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &FileStore{}, store)
+
+	t.Setenv("VERIFICATION_STORE", "memory")
+	store, err = NewStoreFromEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+
+	t.Setenv("VERIFICATION_STORE", "redis")
+	_, err = NewStoreFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,209 @@
+// Package watermark describes the text stamped across the pages of reports
+// that are not official, such as DRAFT or COPY, and decides which reports
+// carry one.
+package watermark
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"pdf-generator/internal/branding"
+)
+
+// Style is how a watermark is laid out on a page
+type Style string
+
+const (
+	// Diagonal prints the text once, large, across the middle of the page
+	Diagonal Style = "diagonal"
+	// Tiled repeats the text in rows over the whole page
+	Tiled Style = "tiled"
+)
+
+// Styles lists the styles a request can choose
+var Styles = []Style{Diagonal, Tiled}
+
+const (
+	// DefaultText marks reports that carry a watermark without choosing its
+	// text
+	DefaultText = "DRAFT"
+	// DefaultOpacity and DefaultAngle, in degrees counterclockwise, are the
+	// look of watermarks that do not choose their own
+	DefaultOpacity = 0.15
+	DefaultAngle   = 45
+	// None is the text a request gives to leave its reports unmarked
+	None = "none"
+
+	// maxTextLength bounds the characters of a watermark's text
+	maxTextLength = 40
+)
+
+// DefaultColor is the grey of watermarks that do not choose their colour
+var DefaultColor = branding.Color{128, 128, 128}
+
+// ErrRequired is returned when a request asks to remove or change the
+// watermark of a report that must carry the policy's
+var ErrRequired = errors.New("reports of this type must carry the server's watermark")
+
+// Watermark is text printed over every page of a report
+type Watermark struct {
+	Text  string `json:"text"`
+	Style Style  `json:"style"`
+	// Opacity is from 0, invisible, to 1, opaque
+	Opacity float64 `json:"opacity"`
+	// Angle is the slope of the text in degrees counterclockwise
+	Angle float64        `json:"angle"`
+	Color branding.Color `json:"color"`
+}
+
+// Default is the diagonal grey DRAFT watermark
+func Default() Watermark {
+	return Watermark{Text: DefaultText, Style: Diagonal, Opacity: DefaultOpacity, Angle: DefaultAngle, Color: DefaultColor}
+}
+
+// Validate checks that a watermark can be printed
+func (w *Watermark) Validate() error {
+	if w.Text == "" || utf8.RuneCountInString(w.Text) > maxTextLength {
+		return fmt.Errorf("watermark text must be 1 to %d characters long", maxTextLength)
+	}
+	if strings.IndexFunc(w.Text, unicode.IsControl) >= 0 {
+		return errors.New("watermark text must not contain control characters")
+	}
+	if !slices.Contains(Styles, w.Style) {
+		return fmt.Errorf("unknown watermark style %q; expected %s or %s", w.Style, Diagonal, Tiled)
+	}
+	if !(w.Opacity > 0 && w.Opacity <= 1) {
+		return fmt.Errorf("watermark opacity must be above 0 and at most 1, got %g", w.Opacity)
+	}
+	if w.Angle < -180 || w.Angle > 180 {
+		return fmt.Errorf("watermark angle must be from -180 to 180 degrees, got %g", w.Angle)
+	}
+	for _, c := range w.Color {
+		if c < 0 || c > 255 {
+			return fmt.Errorf("watermark colour components must be from 0 to 255, got %v", w.Color)
+		}
+	}
+	return nil
+}
+
+// Request is the watermark a request asks for, as written in its query
+// parameters. Empty fields keep the policy's choice.
+type Request struct {
+	Text    string
+	Style   string
+	Opacity string
+	Angle   string
+	// Color is #RRGGBB; the # may be left out, as it must be escaped in URLs
+	Color string
+}
+
+// hasOptions reports whether the request sets anything besides the text
+func (r Request) hasOptions() bool {
+	return r.Style != "" || r.Opacity != "" || r.Angle != "" || r.Color != ""
+}
+
+// with returns a copy of w changed as req asks
+func (w Watermark) with(req Request) (Watermark, error) {
+	if text := strings.TrimSpace(req.Text); text != "" {
+		w.Text = text
+	}
+	if req.Style != "" {
+		w.Style = Style(strings.ToLower(strings.TrimSpace(req.Style)))
+	}
+	if req.Opacity != "" {
+		opacity, err := strconv.ParseFloat(req.Opacity, 64)
+		if err != nil {
+			return Watermark{}, fmt.Errorf("invalid watermark opacity %q; expected a number from 0 to 1", req.Opacity)
+		}
+		w.Opacity = opacity
+	}
+	if req.Angle != "" {
+		angle, err := strconv.ParseFloat(req.Angle, 64)
+		if err != nil {
+			return Watermark{}, fmt.Errorf("invalid watermark angle %q; expected degrees from -180 to 180", req.Angle)
+		}
+		w.Angle = angle
+	}
+	if req.Color != "" {
+		value := req.Color
+		if !strings.HasPrefix(value, "#") {
+			value = "#" + value
+		}
+		color, err := branding.ParseColor(value)
+		if err != nil {
+			return Watermark{}, fmt.Errorf("invalid watermark colour %q; expected #RRGGBB", req.Color)
+		}
+		w.Color = color
+	}
+	if err := w.Validate(); err != nil {
+		return Watermark{}, err
+	}
+	return w, nil
+}
+
+// Policy is the server's watermark: the one automatic reports carry, and
+// the look of those requests ask for
+type Policy struct {
+	defaults Watermark
+}
+
+// DefaultPolicy marks automatic reports with the Default watermark
+func DefaultPolicy() *Policy {
+	return &Policy{defaults: Default()}
+}
+
+// NewPolicyFromEnv reads the watermark of automatic reports from
+// WATERMARK_TEXT (default DRAFT), WATERMARK_STYLE (diagonal or tiled),
+// WATERMARK_OPACITY (0 to 1, default 0.15), WATERMARK_ANGLE (degrees,
+// default 45) and WATERMARK_COLOR (#RRGGBB, default grey). Requests that
+// choose their own text keep the other settings unless they change them.
+func NewPolicyFromEnv() (*Policy, error) {
+	defaults, err := Default().with(Request{
+		Text:    os.Getenv("WATERMARK_TEXT"),
+		Style:   os.Getenv("WATERMARK_STYLE"),
+		Opacity: os.Getenv("WATERMARK_OPACITY"),
+		Angle:   os.Getenv("WATERMARK_ANGLE"),
+		Color:   os.Getenv("WATERMARK_COLOR"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid watermark settings: %w", err)
+	}
+	return &Policy{defaults: defaults}, nil
+}
+
+// Automatic is the watermark of reports that carry one without asking
+func (p *Policy) Automatic() *Watermark {
+	w := p.defaults
+	return &w
+}
+
+// Resolve returns the watermark of a report whose request asks for req, or
+// nil if it carries none. Automatic reports, such as those of mock data,
+// carry the policy's watermark as it is, so that it cannot be made
+// unreadable; Resolve returns ErrRequired if the request asks for any other.
+// Other reports are only marked if the request gives the text.
+func (p *Policy) Resolve(req Request, automatic bool) (*Watermark, error) {
+	text := strings.TrimSpace(req.Text)
+	switch {
+	case automatic && (text != "" || req.hasOptions()):
+		return nil, ErrRequired
+	case automatic:
+		return p.Automatic(), nil
+	case strings.EqualFold(text, None), text == "":
+		if req.hasOptions() {
+			return nil, errors.New("watermark options can only be used with a watermark text")
+		}
+		return nil, nil
+	}
+	w, err := p.defaults.with(req)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
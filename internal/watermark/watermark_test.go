@@ -0,0 +1,124 @@
+package watermark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-generator/internal/branding"
+)
+
+func TestWatermark_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Watermark)
+		wantErr string
+	}{
+		{"default", func(*Watermark) {}, ""},
+		{"tiled", func(w *Watermark) { w.Style = Tiled }, ""},
+		{"opaque", func(w *Watermark) { w.Opacity = 1 }, ""},
+		{"unicode text", func(w *Watermark) { w.Text = "مسودة" }, ""},
+		{"empty text", func(w *Watermark) { w.Text = "" }, "1 to 40 characters"},
+		{"long text", func(w *Watermark) { w.Text = "CONFIDENTIAL CONFIDENTIAL CONFIDENTIAL CONFIDENTIAL" }, "1 to 40 characters"},
+		{"control character", func(w *Watermark) { w.Text = "DRAFT\n" }, "control characters"},
+		{"unknown style", func(w *Watermark) { w.Style = "wavy" }, `unknown watermark style "wavy"`},
+		{"invisible", func(w *Watermark) { w.Opacity = 0 }, "opacity"},
+		{"too opaque", func(w *Watermark) { w.Opacity = 1.5 }, "opacity"},
+		{"angle", func(w *Watermark) { w.Angle = 270 }, "angle"},
+		{"colour", func(w *Watermark) { w.Color = branding.Color{0, 300, 0} }, "colour"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := Default()
+			tt.change(&w)
+			err := w.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicy_Resolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       Request
+		automatic bool
+		want      *Watermark
+		wantErr   string
+	}{
+		{"automatic", Request{}, true, &Watermark{"DRAFT", Diagonal, 0.15, 45, DefaultColor}, ""},
+		{"automatic with other text", Request{Text: "."}, true, nil, "must carry the server's watermark"},
+		{"automatic with options", Request{Opacity: "0.001"}, true, nil, "must carry the server's watermark"},
+		{"automatic without watermark", Request{Text: "none"}, true, nil, "must carry the server's watermark"},
+		{"not asked for", Request{}, false, nil, ""},
+		{"none", Request{Text: "NONE"}, false, nil, ""},
+		{"asked for", Request{Text: " CONFIDENTIAL ", Color: "#1F4E79"}, false, &Watermark{"CONFIDENTIAL", Diagonal, 0.15, 45, branding.Color{0x1F, 0x4E, 0x79}}, ""},
+		{"options without text", Request{Opacity: "0.5"}, false, nil, "can only be used with a watermark text"},
+		{"options with none", Request{Text: "none", Style: "tiled"}, false, nil, "can only be used with a watermark text"},
+		{"invalid opacity", Request{Text: "COPY", Opacity: "half"}, false, nil, `invalid watermark opacity "half"`},
+		{"invalid angle", Request{Text: "COPY", Angle: "steep"}, false, nil, `invalid watermark angle "steep"`},
+		{"invalid colour", Request{Text: "COPY", Color: "red"}, false, nil, `invalid watermark colour "red"`},
+		{"invalid style", Request{Text: "COPY", Style: "wavy"}, false, nil, "unknown watermark style"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DefaultPolicy().Resolve(tt.req, tt.automatic)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, req := range []Request{{Text: "none"}, {Text: ".", Opacity: "0.001"}, {Style: "tiled"}} {
+		_, err := DefaultPolicy().Resolve(req, true)
+		assert.ErrorIs(t, err, ErrRequired)
+	}
+}
+
+func TestNewPolicyFromEnv(t *testing.T) {
+	setEnv := func(t *testing.T, values map[string]string) {
+		for _, key := range []string{"WATERMARK_TEXT", "WATERMARK_STYLE", "WATERMARK_OPACITY", "WATERMARK_ANGLE", "WATERMARK_COLOR"} {
+			t.Setenv(key, values[key])
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		setEnv(t, nil)
+		policy, err := NewPolicyFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, Default(), *policy.Automatic())
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		setEnv(t, map[string]string{
+			"WATERMARK_TEXT":    "SAMPLE",
+			"WATERMARK_STYLE":   "tiled",
+			"WATERMARK_OPACITY": "0.2",
+			"WATERMARK_ANGLE":   "30",
+			"WATERMARK_COLOR":   "#C00000",
+		})
+		policy, err := NewPolicyFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, &Watermark{"SAMPLE", Tiled, 0.2, 30, branding.Color{0xC0, 0, 0}}, policy.Automatic())
+
+		// Requests that choose their text keep the configured look
+		got, err := policy.Resolve(Request{Text: "COPY"}, false)
+		require.NoError(t, err)
+		assert.Equal(t, &Watermark{"COPY", Tiled, 0.2, 30, branding.Color{0xC0, 0, 0}}, got)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		setEnv(t, map[string]string{"WATERMARK_OPACITY": "2"})
+		_, err := NewPolicyFromEnv()
+		assert.ErrorContains(t, err, "invalid watermark settings")
+	})
+}
@@ -0,0 +1,313 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"pdf-generator/internal/ctxtime"
+	"pdf-generator/internal/envconfig"
+)
+
+// Headers set on every delivery. The signature is "sha256=" followed by the
+// hex HMAC-SHA256 of the timestamp, a period and the body, keyed with the
+// shared secret; receivers should also reject stale timestamps.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+
+	signaturePrefix = "sha256="
+)
+
+const (
+	DefaultMaxAttempts = 5
+	DefaultBaseDelay   = time.Second
+	DefaultMaxDelay    = time.Minute
+	DefaultTimeout     = 10 * time.Second
+)
+
+var (
+	// ErrNotConfigured is returned by NewSenderFromEnv when no secret is set
+	ErrNotConfigured = errors.New("webhook secret is not configured")
+	// ErrHostNotAllowed is returned for callbacks to hosts that are not on
+	// the allowlist or, without one, to addresses that are not public, such
+	// as loopback, private or link-local ones
+	ErrHostNotAllowed = errors.New("callback host is not allowed")
+)
+
+// nonPublicPrefixes are the special-purpose networks, besides loopback,
+// private, link-local and multicast ones, that callbacks may not reach
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// Attempt records one delivery attempt
+type Attempt struct {
+	Number     int       `json:"number"`
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// Succeeded reports whether the receiver accepted the delivery
+func (a Attempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// Sender POSTs signed JSON payloads, retrying failed deliveries with
+// exponential backoff
+type Sender struct {
+	client      *http.Client
+	secret      []byte
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	now         func() time.Time
+	// allowedHosts, if not empty, are the only hosts callbacks may target;
+	// they may have any address, including private ones
+	allowedHosts map[string]bool
+}
+
+// NewSender creates a sender that signs payloads with secret. It only
+// delivers to public addresses and does not follow redirects.
+func NewSender(secret string, maxAttempts int, baseDelay, maxDelay, timeout time.Duration) *Sender {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	s := &Sender{
+		secret:      []byte(secret),
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		now:         time.Now,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the connection in the sender's place, unchecked
+	transport.Proxy = nil
+	transport.DialContext = s.dial
+	s.client = &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// A redirect could lead anywhere; the receiver gets the 3xx status
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+// AllowHosts restricts callbacks to the given host names or IP addresses,
+// which may then be private ones, such as localhost during development
+func (s *Sender) AllowHosts(hosts ...string) {
+	s.allowedHosts = make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			s.allowedHosts[host] = true
+		}
+	}
+}
+
+// NewSenderFromEnv creates a sender from WEBHOOK_SECRET, WEBHOOK_MAX_ATTEMPTS,
+// WEBHOOK_BASE_DELAY, WEBHOOK_MAX_DELAY and WEBHOOK_TIMEOUT, restricted to
+// the comma-separated hosts of WEBHOOK_ALLOWED_HOSTS if it is set. It
+// returns ErrNotConfigured if WEBHOOK_SECRET is empty.
+func NewSenderFromEnv() (*Sender, error) {
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, ErrNotConfigured
+	}
+
+	sender := NewSender(secret, envconfig.Int("WEBHOOK_MAX_ATTEMPTS", DefaultMaxAttempts, 1),
+		envconfig.Duration("WEBHOOK_BASE_DELAY", DefaultBaseDelay, 0),
+		envconfig.Duration("WEBHOOK_MAX_DELAY", DefaultMaxDelay, 0),
+		envconfig.Duration("WEBHOOK_TIMEOUT", DefaultTimeout, 0),
+	)
+	if hosts := os.Getenv("WEBHOOK_ALLOWED_HOSTS"); hosts != "" {
+		sender.AllowHosts(strings.Split(hosts, ",")...)
+	}
+	return sender, nil
+}
+
+// ValidateURL checks that a callback URL is an absolute http or https URL
+// of a host the sender may deliver to. Host names are resolved, and checked,
+// only when a delivery connects.
+func (s *Sender) ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("callback URL must be an absolute http or https URL")
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(s.allowedHosts) > 0 {
+		if !s.allowedHosts[host] {
+			return fmt.Errorf("%w: %s is not on the allowlist", ErrHostNotAllowed, host)
+		}
+		return nil
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !isPublic(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrHostNotAllowed, host)
+	}
+	return nil
+}
+
+// dial connects to a callback host. Unless the host is allowed, the address
+// its name resolves to is checked as the connection is made, so that a name
+// cannot pass as public and then resolve to a private address.
+func (s *Sender) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if len(s.allowedHosts) > 0 {
+		if !s.allowedHosts[strings.ToLower(host)] {
+			return nil, fmt.Errorf("%w: %s is not on the allowlist", ErrHostNotAllowed, host)
+		}
+	} else {
+		dialer.Control = publicOnly
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// publicOnly refuses connections to addresses that are not public
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !isPublic(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrHostNotAllowed, host)
+	}
+	return nil
+}
+
+// isPublic reports whether ip is a globally routable unicast address
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the signature header value for a payload sent at timestamp
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for the payload and timestamp
+func Verify(secret []byte, signature, timestamp string, body []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// Deliver POSTs body to callbackURL until the receiver answers with a 2xx
+// status, a non-retryable status, or the attempts run out. record is called
+// after every attempt. The returned error describes the last failure.
+func (s *Sender) Deliver(ctx context.Context, callbackURL, event string, body []byte, record func(Attempt)) error {
+	var lastErr error
+	for number := 1; number <= s.maxAttempts; number++ {
+		if number > 1 {
+			if err := ctxtime.Sleep(ctx, s.backoff(number-1)); err != nil {
+				return err
+			}
+		}
+
+		attempt, retryable := s.attempt(ctx, number, callbackURL, event, body)
+		if record != nil {
+			record(attempt)
+		}
+		if attempt.Succeeded() {
+			slog.InfoContext(ctx, "Webhook delivered", "attempt", number, "status", attempt.StatusCode)
+			return nil
+		}
+
+		lastErr = fmt.Errorf("webhook attempt %d failed: %s", number, attemptFailure(attempt))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retryable {
+			break
+		}
+		slog.WarnContext(ctx, "Webhook delivery failed", "attempt", number, "status", attempt.StatusCode, "error", attempt.Error)
+	}
+	return lastErr
+}
+
+// attempt makes one delivery and reports whether a failure may be retried
+func (s *Sender) attempt(ctx context.Context, number int, callbackURL, event string, body []byte) (Attempt, bool) {
+	start := s.now()
+	attempt := Attempt{Number: number, At: start.UTC()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pdf-generator-webhook")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(s.secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	attempt.DurationMs = s.now().Sub(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, !errors.Is(err, ErrHostNotAllowed)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	return attempt, resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// backoff returns the delay before the given retry (1 for the first retry)
+func (s *Sender) backoff(retry int) time.Duration {
+	delay := s.baseDelay
+	for i := 1; i < retry && delay < s.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.maxDelay)
+}
+
+func attemptFailure(attempt Attempt) string {
+	if attempt.Error != "" {
+		return attempt.Error
+	}
+	return fmt.Sprintf("status %d", attempt.StatusCode)
+}
@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "s3cret"
+
+// newTestSender creates a sender allowed to deliver to test servers, which
+// listen on loopback
+func newTestSender(maxAttempts int) *Sender {
+	sender := NewSender(testSecret, maxAttempts, time.Millisecond, 5*time.Millisecond, time.Second)
+	sender.AllowHosts("127.0.0.1")
+	return sender
+}
+
+// newReceiver answers with the given statuses in turn, repeating the last one,
+// and fails the test if a delivery is not correctly signed
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "report.job.succeeded", r.Header.Get(EventHeader))
+		assert.True(t, Verify([]byte(testSecret), r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader), body), "signature must verify")
+
+		n := int(calls.Add(1))
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"jobId":"abc"}`)
+	signature := Sign([]byte(testSecret), "1700000000", body)
+
+	assert.Regexp(t, `^sha256=[0-9a-f]{64}$`, signature)
+	assert.True(t, Verify([]byte(testSecret), signature, "1700000000", body))
+	assert.False(t, Verify([]byte("other"), signature, "1700000000", body))
+	assert.False(t, Verify([]byte(testSecret), signature, "1700000001", body))
+	assert.False(t, Verify([]byte(testSecret), signature, "1700000000", []byte(`{"jobId":"abd"}`)))
+}
+
+func TestDeliver_RetriesUntilAccepted(t *testing.T) {
+	receiver, calls := newReceiver(t, http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusNoContent)
+
+	var attempts []Attempt
+	err := newTestSender(5).Deliver(context.Background(), receiver.URL, "report.job.succeeded", []byte(`{}`), func(a Attempt) {
+		attempts = append(attempts, a)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+	require.Len(t, attempts, 3)
+	assert.Equal(t, 1, attempts[0].Number)
+	assert.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+	assert.False(t, attempts[0].Succeeded())
+	assert.Equal(t, http.StatusNoContent, attempts[2].StatusCode)
+	assert.True(t, attempts[2].Succeeded())
+}
+
+func TestDeliver_GivesUpAfterMaxAttempts(t *testing.T) {
+	receiver, calls := newReceiver(t, http.StatusBadGateway)
+
+	var attempts []Attempt
+	err := newTestSender(3).Deliver(context.Background(), receiver.URL, "report.job.succeeded", []byte(`{}`), func(a Attempt) {
+		attempts = append(attempts, a)
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 502")
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Len(t, attempts, 3)
+}
+
+func TestDeliver_DoesNotRetryClientErrors(t *testing.T) {
+	receiver, calls := newReceiver(t, http.StatusGone)
+
+	err := newTestSender(5).Deliver(context.Background(), receiver.URL, "report.job.succeeded", []byte(`{}`), nil)
+
+	require.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestDeliver_RecordsNetworkErrors(t *testing.T) {
+	receiver, _ := newReceiver(t, http.StatusOK)
+	url := receiver.URL
+	receiver.Close()
+
+	var attempts []Attempt
+	err := newTestSender(2).Deliver(context.Background(), url, "report.job.succeeded", []byte(`{}`), func(a Attempt) {
+		attempts = append(attempts, a)
+	})
+
+	require.Error(t, err)
+	require.Len(t, attempts, 2)
+	assert.NotEmpty(t, attempts[0].Error)
+	assert.Zero(t, attempts[0].StatusCode)
+}
+
+func TestDeliver_StopsWhenContextDone(t *testing.T) {
+	receiver, calls := newReceiver(t, http.StatusServiceUnavailable)
+	sender := NewSender(testSecret, 5, time.Hour, time.Hour, time.Second)
+	sender.AllowHosts("127.0.0.1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := sender.Deliver(ctx, receiver.URL, "report.job.succeeded", []byte(`{}`), func(Attempt) { cancel() })
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestValidateURL(t *testing.T) {
+	sender := NewSender(testSecret, 1, 0, 0, time.Second)
+	assert.NoError(t, sender.ValidateURL("https://school.example.com/hooks/reports"))
+	assert.NoError(t, sender.ValidateURL("https://93.184.215.14/hook"))
+	assert.Error(t, sender.ValidateURL("/relative/path"))
+	assert.Error(t, sender.ValidateURL("ftp://example.com/hook"))
+	assert.Error(t, sender.ValidateURL("::not a url"))
+	for _, url := range []string{
+		"http://127.0.0.1:5007/api/v1/report-callback",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://100.64.0.1/hook",
+	} {
+		assert.ErrorIs(t, sender.ValidateURL(url), ErrHostNotAllowed, url)
+	}
+
+	// An allowlist admits its hosts, private or not, and nothing else
+	sender.AllowHosts("localhost", " Hooks.Example.com ")
+	assert.NoError(t, sender.ValidateURL("http://localhost:5007/api/v1/report-callback"))
+	assert.NoError(t, sender.ValidateURL("https://hooks.example.com/reports"))
+	assert.ErrorIs(t, sender.ValidateURL("https://school.example.com/hooks/reports"), ErrHostNotAllowed)
+}
+
+func TestDeliver_RefusesNonPublicAddresses(t *testing.T) {
+	server, calls := newReceiver(t, http.StatusOK)
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	sender := NewSender(testSecret, 3, time.Millisecond, time.Millisecond, time.Second)
+
+	// Names are checked by the address they resolve to when connecting, and
+	// refusals are not retried
+	for _, url := range []string{server.URL, "http://localhost" + port, "http://169.254.169.254/latest/meta-data/"} {
+		var attempts []Attempt
+		err := sender.Deliver(context.Background(), url, "report.job.succeeded", []byte(`{}`), func(a Attempt) { attempts = append(attempts, a) })
+
+		assert.ErrorContains(t, err, "not a public address", url)
+		assert.Len(t, attempts, 1, url)
+	}
+	assert.Equal(t, int32(0), calls.Load())
+}
+
+func TestDeliver_DoesNotFollowRedirects(t *testing.T) {
+	target, targetCalls := newReceiver(t, http.StatusOK)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+
+	var attempts []Attempt
+	err := newTestSender(3).Deliver(context.Background(), redirect.URL, "report.job.succeeded", []byte(`{}`), func(a Attempt) { attempts = append(attempts, a) })
+
+	assert.Error(t, err)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, http.StatusTemporaryRedirect, attempts[0].StatusCode)
+	assert.Equal(t, int32(0), targetCalls.Load())
+}
+
+func TestNewSenderFromEnv(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRET", "")
+	_, err := NewSenderFromEnv()
+	assert.ErrorIs(t, err, ErrNotConfigured)
+
+	t.Setenv("WEBHOOK_SECRET", testSecret)
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "7")
+	t.Setenv("WEBHOOK_BASE_DELAY", "2s")
+	sender, err := NewSenderFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 7, sender.maxAttempts)
+	assert.Equal(t, 2*time.Second, sender.baseDelay)
+	assert.Equal(t, DefaultMaxDelay, sender.maxDelay)
+	assert.Empty(t, sender.allowedHosts)
+
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "localhost, hooks.example.com")
+	sender, err = NewSenderFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"localhost": true, "hooks.example.com": true}, sender.allowedHosts)
+}
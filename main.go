@@ -1,46 +1,171 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
 
 	"github.com/joho/godotenv"
 
+	"pdf-generator/internal/api"
+	"pdf-generator/internal/branding"
+	"pdf-generator/internal/fonts"
+	"pdf-generator/internal/i18n"
+	"pdf-generator/internal/jobs"
+	"pdf-generator/internal/layout"
+	"pdf-generator/internal/logging"
+	"pdf-generator/internal/metrics"
 	pdfgen "pdf-generator/internal/pdf"
+	"pdf-generator/internal/protection"
+	"pdf-generator/internal/signing"
+	"pdf-generator/internal/verification"
+	"pdf-generator/internal/watermark"
 )
 
 func main() {
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		slog.Error("Error loading .env file", "error", err)
+		os.Exit(1)
 	}
 
+	slog.SetDefault(logging.NewFromEnv())
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	handler := setupRoutes()
+	server := pdfgen.NewServer(api.NewAPIClient())
+
+	templates, err := layout.NewRegistryFromEnv(context.Background())
+	if err != nil {
+		slog.Error("Error loading report templates", "error", err)
+		os.Exit(1)
+	}
+	server.SetTemplates(templates)
+	slog.Info("Loaded report templates", "templates", templates.Names())
+	if os.Getenv("TEMPLATE_ADMIN_TOKEN") == "" {
+		slog.Warn("TEMPLATE_ADMIN_TOKEN is not set; report templates cannot be uploaded, activated or rolled back")
+	}
+
+	fontSet, err := fonts.NewSetFromEnv()
+	if err != nil {
+		slog.Error("Error loading fonts", "error", err)
+		os.Exit(1)
+	}
+	server.SetFonts(fontSet)
+	slog.Info("Loaded fonts", "families", fontSet.Names())
+
+	messages, err := i18n.NewCatalogsFromEnv()
+	if err != nil {
+		slog.Error("Error loading message catalogs", "error", err)
+		os.Exit(1)
+	}
+	server.SetMessages(messages)
+	slog.Info("Loaded message catalogs", "languages", messages.Languages())
+
+	schoolBranding, err := branding.NewFromEnv()
+	if err != nil {
+		slog.Error("Error loading branding", "error", err)
+		os.Exit(1)
+	}
+	server.SetBranding(schoolBranding)
+	slog.Info("Loaded branding", "school", schoolBranding.SchoolName, "logo", schoolBranding.Logo != nil, "footer", schoolBranding.HasFooter())
 
-	log.Printf("PDF Generator service starting on :%s", port)
-	log.Println("Available endpoints:")
-	log.Println("  GET /health - Health check")
-	log.Println("  GET /test/report - Generate test PDF report with mock data")
-	log.Println("  GET /api/v1/students/{id}/report - Generate student PDF report")
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+	protectionPolicy, err := protection.NewPolicyFromEnv()
+	if err != nil {
+		slog.Error("Error loading report protection policy", "error", err)
+		os.Exit(1)
+	}
+	server.SetProtection(protectionPolicy)
+	slog.Info("Loaded report protection policy", "required", protectionPolicy.Required(), "owner_password", protectionPolicy.OwnerPassword() != "")
+
+	signer, err := signing.NewSignerFromEnv()
+	switch {
+	case errors.Is(err, signing.ErrNotConfigured):
+		slog.Info("Report signing is disabled; set SIGNING_CERT_FILE and SIGNING_KEY_FILE, or SIGNING_PKCS12_FILE, to sign reports")
+	case err != nil:
+		slog.Error("Error loading signing certificate", "error", err)
+		os.Exit(1)
+	default:
+		server.SetSigner(signer)
+		slog.Info("Loaded signing certificate", "signer", signer.Name(), "expires", signer.Certificate().NotAfter, "visible", signer.Visible)
+	}
+
+	// Issued reports link to their verification page, which must not be
+	// built from the Host of a request
+	if os.Getenv("PUBLIC_BASE_URL") == "" {
+		slog.Error("PUBLIC_BASE_URL is not set; issued reports link to their verification page under it")
+		os.Exit(1)
+	}
+	verificationStore, err := verification.NewStoreFromEnv()
+	if err != nil {
+		slog.Error("Error creating verification store", "error", err)
+		os.Exit(1)
+	}
+	server.SetVerificationStore(verificationStore)
+	if _, ok := verificationStore.(*verification.MemoryStore); ok {
+		slog.Warn("VERIFICATION_STORE is memory; reports issued before a restart will not verify")
+	}
+
+	watermarks, err := watermark.NewPolicyFromEnv()
+	if err != nil {
+		slog.Error("Error loading watermark", "error", err)
+		os.Exit(1)
+	}
+	server.SetWatermarks(watermarks)
+	mark := watermarks.Automatic()
+	slog.Info("Loaded watermark", "text", mark.Text, "style", mark.Style, "opacity", mark.Opacity, "angle", mark.Angle)
+
+	jobStore, err := jobs.NewStoreFromEnv()
+	if err != nil {
+		slog.Error("Error creating job store", "error", err)
+		os.Exit(1)
+	}
+	if _, err := server.StartJobs(context.Background(), jobStore); err != nil {
+		slog.Error("Error starting report jobs", "error", err)
+		os.Exit(1)
+	}
+
+	handler := setupRoutes(server)
+
+	slog.Info("PDF Generator service starting", "port", port)
+	slog.Info("Available endpoints",
+		"health", "GET /health - Health check",
+		"metrics", "GET /debug/vars - Report counters",
+		"test_report", "GET /test/report - Generate test PDF report with mock data",
+		"student_report", "GET /api/v1/students/{id}/report - Generate student PDF report",
+		"render_report", "POST /api/v1/reports/student - Generate PDF report from student JSON",
+		"batch_report", "POST /api/v1/reports/batch - Generate a ZIP or merged PDF for many students",
+		"create_job", "POST /api/v1/jobs - Queue a report job",
+		"job_status", "GET /api/v1/jobs/{id} - Report job status and progress",
+		"job_result", "GET /api/v1/jobs/{id}/result - Download a finished report job",
+		"templates", "GET|POST /api/v1/templates - List or upload report templates",
+		"template", "GET /api/v1/templates/{name}[/versions/{n}|/preview], POST .../activate|rollback - Manage a template",
+		"verify", "GET /verify/{code} - Check that a report is genuine",
+	)
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
 }
 
 // setupRoutes configures all the application routes
-func setupRoutes() http.Handler {
+func setupRoutes(server *pdfgen.Server) http.Handler {
 	mux := http.NewServeMux()
 
 	// Health check endpoint
-	mux.HandleFunc("/health", pdfgen.HealthCheck)
+	mux.HandleFunc("/health", server.HealthCheck)
+
+	// Report outcome counters
+	mux.Handle("/debug/vars", metrics.Handler())
 
 	// Test endpoint for PDF generation with mock data
-	mux.HandleFunc("/test/report", pdfgen.GenerateTestReport)
+	mux.HandleFunc("/test/report", server.GenerateTestReport)
 
 	// API routes handle the specific pattern for student reports
 	mux.HandleFunc("/api/v1/students/", func(w http.ResponseWriter, r *http.Request) {
@@ -48,11 +173,42 @@ func setupRoutes() http.Handler {
 			http.NotFound(w, r)
 			return
 		}
-		pdfgen.GenerateStudentReport(w, r)
+		server.GenerateStudentReport(w, r)
 	})
 
-	// Wrap with CORS middleware
-	return corsMiddleware(mux)
+	// Render a report from student data supplied by the caller
+	mux.HandleFunc("/api/v1/reports/student", server.RenderStudentReport)
+
+	// Batch reports for a list of students or a class and section
+	mux.HandleFunc("/api/v1/reports/batch", server.GenerateBatchReport)
+
+	// Asynchronous report jobs and their results
+	mux.HandleFunc("/api/v1/jobs", server.CreateReportJob)
+	mux.HandleFunc("/api/v1/jobs/", server.GetReportJob)
+
+	// Report template management and previews
+	mux.HandleFunc("/api/v1/templates", server.HandleTemplates)
+	mux.HandleFunc("/api/v1/templates/", server.HandleTemplate)
+
+	// Verification of issued reports, linked from their QR codes
+	mux.HandleFunc("/verify/", server.VerifyReport)
+
+	// Wrap with CORS and request ID middleware
+	return requestIDMiddleware(corsMiddleware(mux))
+}
+
+// requestIDMiddleware tags each request with an ID that is echoed in the
+// response and attached to every log line written while serving it
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = logging.NewRequestID()
+		}
+
+		w.Header().Set(logging.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
 }
 
 // corsMiddleware adds CORS headers to responses
@@ -69,7 +225,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 	allowHeaders := os.Getenv("CORS_ALLOWED_HEADERS")
 	if allowHeaders == "" {
-		allowHeaders = "Content-Type, Authorization"
+		allowHeaders = "Content-Type, Authorization, X-Report-Password"
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {